@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"cmp"
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// AcquireAll acquires a slot of every limiter in waiters for an operation that consumes several resources at once ,
+// for example both a database slot and a slot of an outbound API. It returns a func releasing all the slots , to
+// be called once the operation is done , or an error if any Wait fails: the slots acquired so far are then given
+// back before AcquireAll returns , so the caller holds either all the slots or none of them.
+//
+// The slots are acquired in a consistent order , whatever the order of waiters , so goroutines acquiring
+// overlapping sets of limiters cannot deadlock by each holding a slot the other waits for. Limiters are ordered by
+// identity: pointers by their address , and adapters like the ones of priority.AtPriority and keyed.(*Limiter).For
+// by the address of the limiter they wrap. Other waiters that are not pointers are acquired after the others in the
+// order they are passed. A limiter passed twice is acquired twice.
+func AcquireAll(ctx context.Context, waiters ...Waiter) (release func(), err error) {
+	ordered := slices.Clone(waiters)
+	slices.SortStableFunc(ordered, func(a, b Waiter) int {
+		return cmp.Compare(identity(a), identity(b))
+	})
+	acquired := make([]Waiter, 0, len(ordered))
+	finish := func() {
+		for i := len(acquired) - 1; i >= 0; i-- {
+			acquired[i].Finish()
+		}
+	}
+	for _, w := range ordered {
+		if err := w.Wait(ctx); err != nil {
+			finish()
+			return nil, err
+		}
+		acquired = append(acquired, w)
+	}
+	return sync.OnceFunc(finish), nil
+}
+
+// identifier is implemented by adapters wrapping a limiter , so AcquireAll orders them by the identity of the
+// limiter they wrap instead of leaving them in the order they are passed.
+type identifier interface {
+	LimiterIdentity() uintptr
+}
+
+// identity returns the identity reported by w if it is an adapter , the address of w if it is a pointer , or the
+// max uintptr so it is ordered last.
+func identity(w Waiter) uintptr {
+	if i, ok := w.(identifier); ok {
+		return i.LimiterIdentity()
+	}
+	if v := reflect.ValueOf(w); v.Kind() == reflect.Pointer {
+		return v.Pointer()
+	}
+	return ^uintptr(0)
+}
@@ -0,0 +1,59 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireAll(t *testing.T) {
+	db, api := New(2), New(2)
+	ctx := context.Background()
+	release, err := AcquireAll(ctx, db, api)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, db.InFlight())
+	assert.Equal(t, 1, api.InFlight())
+	release()
+	release()
+	assert.Equal(t, 0, db.InFlight())
+	assert.Equal(t, 0, api.InFlight())
+}
+
+func TestAcquireAll_ReleasesOnFailure(t *testing.T) {
+	db, api := New(1), New(1, WithMaxQueueLength(0))
+	ctx := context.Background()
+	api.Wait(ctx)
+	for _, waiters := range [][]Waiter{{db, api}, {api, db}} {
+		release, err := AcquireAll(ctx, waiters...)
+		assert.Nil(t, release)
+		assert.True(t, errors.Is(err, ErrQueueFull))
+		assert.Equal(t, 0, db.InFlight())
+		assert.Equal(t, 1, api.InFlight())
+	}
+}
+
+func TestAcquireAll_NoDeadlock(t *testing.T) {
+	a, b := New(1), New(1)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		waiters := []Waiter{a, b}
+		if i%2 == 1 {
+			waiters = []Waiter{b, a}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := AcquireAll(ctx, waiters...)
+			if assert.NoError(t, err) {
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, a.InFlight())
+	assert.Equal(t, 0, b.InFlight())
+}
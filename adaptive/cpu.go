@@ -0,0 +1,97 @@
+// Package adaptive provides limit controllers adjusting the limit of a limiter.Limiter to the resources of the
+// process , see limiter.WithLimitController:
+//
+//	cpu := adaptive.NewCPU(0.8, 10, 200)
+//	nl := limiter.New(200, limiter.WithLimitController(cpu, time.Second))
+//
+// Controllers keep the limit they recommend between samples , so the Limiter should be created with the max limit
+// of the controller.
+package adaptive
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+var _ limiter.LimitController = (*CPU)(nil)
+
+// CPU lowers the limit when the CPU utilization of the process exceeds a target , to protect CPU bound handlers.
+// The utilization is the CPU time used by the process between two samples divided by the CPU time GOMAXPROCS
+// processors provide in the meantime , so 1 means the Go scheduler is saturated. Above the target , the limit
+// shrinks in proportion to the excess. Below the target , it grows by one per sample while goroutines are
+// waiting , up to max.
+type CPU struct {
+	target   float64
+	min, max int
+
+	mu      sync.Mutex
+	limit   int
+	last    time.Time
+	lastCPU time.Duration
+	sampled bool
+
+	// now and cpuTime are replaced by tests.
+	now     func() time.Time
+	cpuTime func() (time.Duration, bool)
+}
+
+// NewCPU creates a *CPU keeping the utilization below target , between 0 and 1 , with a limit between min and max.
+func NewCPU(target float64, min, max int) *CPU {
+	return &CPU{
+		target:  target,
+		min:     min,
+		max:     max,
+		limit:   max,
+		now:     time.Now,
+		cpuTime: processCPUTime,
+	}
+}
+
+// OnSample implements limiter.LimitController. The first sample only takes a reference measurement and leaves
+// the limit unchanged.
+func (c *CPU) OnSample(inflight, queueLen int, latency time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	cpu, ok := c.cpuTime()
+	if !ok {
+		return 0
+	}
+	last, lastCPU, sampled := c.last, c.lastCPU, c.sampled
+	c.last, c.lastCPU, c.sampled = now, cpu, true
+	if !sampled || !now.After(last) {
+		return 0
+	}
+	available := float64(now.Sub(last)) * float64(runtime.GOMAXPROCS(0))
+	c.limit = adjust(c.limit, float64(cpu-lastCPU)/available, c.target, queueLen, c.min, c.max)
+	return c.limit
+}
+
+// Limit returns the limit recommended by the last sample.
+func (c *CPU) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit
+}
+
+// adjust returns the limit following limit for a pressure measured against target: the limit shrinks in
+// proportion to the excess above the target , and grows by one below it while goroutines are waiting. The result
+// is kept between min and max.
+func adjust(limit int, pressure, target float64, queueLen, min, max int) int {
+	switch {
+	case pressure > target:
+		limit = int(float64(limit) * target / pressure)
+	case queueLen > 0:
+		limit++
+	}
+	if limit < min {
+		limit = min
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
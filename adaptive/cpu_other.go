@@ -0,0 +1,25 @@
+//go:build !unix
+
+package adaptive
+
+import (
+	"runtime/metrics"
+	"time"
+)
+
+// processCPUTime returns the CPU time used by the Go runtime so far , as estimated by the runtime. The estimate is
+// only refreshed by garbage collections , getrusage is not available on this platform.
+func processCPUTime() (time.Duration, bool) {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		if s.Value.Kind() != metrics.KindFloat64 {
+			return 0, false
+		}
+	}
+	used := samples[0].Value.Float64() - samples[1].Value.Float64()
+	return time.Duration(used * float64(time.Second)), true
+}
@@ -0,0 +1,42 @@
+package adaptive
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPU(t *testing.T) {
+	c := NewCPU(0.5, 2, 100)
+	now, cpu := time.Now(), time.Duration(0)
+	c.now = func() time.Time { return now }
+	c.cpuTime = func() (time.Duration, bool) { return cpu, true }
+	procs := time.Duration(runtime.GOMAXPROCS(0))
+	// sample advances the time by a second during which the process used utilization of the processors.
+	sample := func(utilization float64, queueLen int) int {
+		now = now.Add(time.Second)
+		cpu += time.Duration(utilization * float64(procs*time.Second))
+		return c.OnSample(0, queueLen, 0)
+	}
+
+	assert.Equal(t, 0, c.OnSample(0, 0, 0))
+	assert.Equal(t, 50, sample(1, 0))
+	assert.Equal(t, 25, sample(1, 0))
+	assert.Equal(t, 26, sample(0.25, 3))
+	assert.Equal(t, 26, sample(0.25, 0))
+	for i := 0; i < 10; i++ {
+		sample(1, 0)
+	}
+	assert.Equal(t, 2, c.Limit())
+}
+
+func TestProcessCPUTime(t *testing.T) {
+	before, ok := processCPUTime()
+	assert.True(t, ok)
+	for start := time.Now(); time.Since(start) < 20*time.Millisecond; {
+	}
+	after, _ := processCPUTime()
+	assert.True(t, after > before)
+}
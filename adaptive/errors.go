@@ -0,0 +1,68 @@
+package adaptive
+
+import (
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+var (
+	_ limiter.LimitController = (*ErrorRate)(nil)
+	_ limiter.ResultObserver  = (*ErrorRate)(nil)
+)
+
+// ErrorRate lowers the limit when the fraction of the work failing exceeds a target , to back off from a resource
+// that fails under load. Outcomes are reported with limiter.Permit.Record. Above the target , the limit shrinks in
+// proportion to the excess. Below the target , it grows by one per sample while goroutines are waiting , up to max.
+// Samples without outcomes leave the limit unchanged.
+type ErrorRate struct {
+	target   float64
+	min, max int
+
+	mu     sync.Mutex
+	limit  int
+	total  int
+	errors int
+}
+
+// NewErrorRate creates an *ErrorRate keeping the fraction of failing work below target , with a limit between min
+// and max.
+func NewErrorRate(target float64, min, max int) *ErrorRate {
+	return &ErrorRate{
+		target: target,
+		min:    min,
+		max:    max,
+		limit:  max,
+	}
+}
+
+// OnResult implements limiter.ResultObserver.
+func (e *ErrorRate) OnResult(err error, latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.total++
+	if err != nil {
+		e.errors++
+	}
+}
+
+// OnSample implements limiter.LimitController.
+func (e *ErrorRate) OnSample(inflight, queueLen int, latency time.Duration) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.total == 0 {
+		return 0
+	}
+	rate := float64(e.errors) / float64(e.total)
+	e.total, e.errors = 0, 0
+	e.limit = adjust(e.limit, rate, e.target, queueLen, e.min, e.max)
+	return e.limit
+}
+
+// Limit returns the limit recommended by the last sample.
+func (e *ErrorRate) Limit() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.limit
+}
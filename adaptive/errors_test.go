@@ -0,0 +1,33 @@
+package adaptive
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRate(t *testing.T) {
+	e := NewErrorRate(0.1, 2, 100)
+	// record reports n outcomes , failed of them errors.
+	record := func(n, failed int) {
+		for i := 0; i < n; i++ {
+			var err error
+			if i < failed {
+				err = errors.New("failed")
+			}
+			e.OnResult(err, 0)
+		}
+	}
+
+	assert.Equal(t, 0, e.OnSample(0, 1, 0))
+	record(10, 2)
+	assert.Equal(t, 50, e.OnSample(0, 0, 0))
+	record(10, 0)
+	assert.Equal(t, 51, e.OnSample(0, 1, 0))
+	// outcomes are counted per sample.
+	assert.Equal(t, 0, e.OnSample(0, 1, 0))
+	record(10, 10)
+	assert.Equal(t, 5, e.OnSample(0, 0, 0))
+	assert.Equal(t, 5, e.Limit())
+}
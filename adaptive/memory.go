@@ -0,0 +1,167 @@
+package adaptive
+
+import (
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+var _ limiter.LimitController = (*Memory)(nil)
+
+// Memory lowers the limit under memory pressure , for handlers holding large buffers while they access the
+// resource. The pressure is measured by up to three signals: the live heap against a target , the fraction of wall
+// time spent in GC pauses and the headroom left below GOMEMLIMIT. The limit shrinks in proportion to the worst
+// excess among them. Without excess , it grows by one per sample while goroutines are waiting , up to max.
+//
+// heapTarget: live heap in bytes above which the limit shrinks , 0 to ignore the heap
+//
+// pauseTarget: fraction of wall time spent in GC pauses above which the limit shrinks , 0 to ignore GC pauses
+//
+// headroom: fraction of GOMEMLIMIT that must stay unused , 0 to ignore GOMEMLIMIT
+type Memory struct {
+	heapTarget  uint64
+	pauseTarget float64
+	headroom    float64
+	min, max    int
+
+	mu         sync.Mutex
+	limit      int
+	last       time.Time
+	lastPauses time.Duration
+	sampled    bool
+
+	// now and read are replaced by tests.
+	now  func() time.Time
+	read func() memoryStats
+}
+
+type MemoryOption func(*Memory)
+
+// memoryStats is a reading of the runtime metrics Memory depends on.
+//
+// heap: live heap in bytes
+//
+// total: memory mapped by the runtime and not released to the OS , in bytes , the quantity GOMEMLIMIT limits
+//
+// memLimit: GOMEMLIMIT in bytes , math.MaxInt64 if it is not set
+//
+// pauses: total time spent in GC pauses since the process started
+type memoryStats struct {
+	heap     uint64
+	total    uint64
+	memLimit uint64
+	pauses   time.Duration
+}
+
+// pauseTarget: If this field is specified , the limit also shrinks when the goroutines are stopped by the garbage
+// collector for more than fraction of the wall time between two samples.
+func WithGCPauseTarget(fraction float64) func(*Memory) {
+	return func(m *Memory) {
+		m.pauseTarget = fraction
+	}
+}
+
+// headroom: If this field is specified and GOMEMLIMIT is set , the limit also shrinks when the memory used by the
+// runtime leaves less than fraction of GOMEMLIMIT unused. Close to GOMEMLIMIT , the garbage collector runs
+// continuously , admitting fewer goroutines lets it catch up.
+func WithMemoryLimitHeadroom(fraction float64) func(*Memory) {
+	return func(m *Memory) {
+		m.headroom = fraction
+	}
+}
+
+// NewMemory creates a *Memory keeping the live heap below heapTarget bytes , with a limit between min and max.
+// Configure it with the options specified.
+func NewMemory(heapTarget uint64, min, max int, options ...MemoryOption) *Memory {
+	m := &Memory{
+		heapTarget: heapTarget,
+		min:        min,
+		max:        max,
+		limit:      max,
+		now:        time.Now,
+		read:       readMemoryStats,
+	}
+	for _, o := range options {
+		o(m)
+	}
+	return m
+}
+
+// OnSample implements limiter.LimitController. GC pauses are measured from the second sample on.
+func (m *Memory) OnSample(inflight, queueLen int, latency time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now, s := m.now(), m.read()
+	last, lastPauses, sampled := m.last, m.lastPauses, m.sampled
+	m.last, m.lastPauses, m.sampled = now, s.pauses, true
+
+	// every signal is scaled to its target , so 1 is the pressure to stay below.
+	var pressure float64
+	if m.heapTarget > 0 {
+		pressure = math.Max(pressure, float64(s.heap)/float64(m.heapTarget))
+	}
+	if m.pauseTarget > 0 && sampled && now.After(last) {
+		pressure = math.Max(pressure, float64(s.pauses-lastPauses)/float64(now.Sub(last))/m.pauseTarget)
+	}
+	if m.headroom > 0 && s.memLimit < math.MaxInt64 {
+		pressure = math.Max(pressure, float64(s.total)/(float64(s.memLimit)*(1-m.headroom)))
+	}
+	m.limit = adjust(m.limit, pressure, 1, queueLen, m.min, m.max)
+	return m.limit
+}
+
+// Limit returns the limit recommended by the last sample.
+func (m *Memory) Limit() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limit
+}
+
+// readMemoryStats reads the runtime metrics Memory depends on.
+func readMemoryStats() memoryStats {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/live:bytes"},
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+		{Name: "/gc/gomemlimit:bytes"},
+		{Name: "/sched/pauses/total/gc:seconds"},
+	}
+	metrics.Read(samples)
+	s := memoryStats{memLimit: math.MaxInt64}
+	if v := samples[0].Value; v.Kind() == metrics.KindUint64 {
+		s.heap = v.Uint64()
+	}
+	if v, r := samples[1].Value, samples[2].Value; v.Kind() == metrics.KindUint64 && r.Kind() == metrics.KindUint64 {
+		s.total = v.Uint64() - r.Uint64()
+	}
+	if v := samples[3].Value; v.Kind() == metrics.KindUint64 {
+		s.memLimit = v.Uint64()
+	}
+	if v := samples[4].Value; v.Kind() == metrics.KindFloat64Histogram {
+		s.pauses = histogramTotal(v.Float64Histogram())
+	}
+	return s
+}
+
+// histogramTotal estimates the sum of the durations recorded by h , counting every duration as the middle of its
+// bucket.
+func histogramTotal(h *metrics.Float64Histogram) time.Duration {
+	var total float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		switch {
+		case math.IsInf(lo, -1):
+			lo = hi
+		case math.IsInf(hi, 1):
+			hi = lo
+		}
+		total += float64(n) * (lo + hi) / 2
+	}
+	return time.Duration(total * float64(time.Second))
+}
@@ -0,0 +1,51 @@
+package adaptive
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory(100, 2, 100, WithGCPauseTarget(0.1), WithMemoryLimitHeadroom(0.2))
+	now, s := time.Now(), memoryStats{memLimit: math.MaxInt64}
+	m.now = func() time.Time { return now }
+	m.read = func() memoryStats { return s }
+	// sample advances the time by a second.
+	sample := func(queueLen int) int {
+		now = now.Add(time.Second)
+		return m.OnSample(0, queueLen, 0)
+	}
+
+	s.heap = 50
+	assert.Equal(t, 100, m.OnSample(0, 0, 0))
+	// the live heap is twice the target.
+	s.heap = 200
+	assert.Equal(t, 50, sample(0))
+	// a fifth of the second was spent in GC pauses , twice the target.
+	s.heap = 50
+	s.pauses += 200 * time.Millisecond
+	assert.Equal(t, 25, sample(0))
+	// below every target , the limit grows while goroutines are waiting.
+	assert.Equal(t, 26, sample(1))
+	assert.Equal(t, 26, sample(0))
+	// GOMEMLIMIT is ignored until it is set.
+	s.total = 1000
+	assert.Equal(t, 27, sample(1))
+	// 1000 bytes used leave less than a fifth of GOMEMLIMIT unused.
+	s.memLimit = 1000
+	assert.Equal(t, 21, sample(1))
+}
+
+func TestReadMemoryStats(t *testing.T) {
+	buf := make([]byte, 1<<20)
+	runtime.GC()
+	s := readMemoryStats()
+	runtime.KeepAlive(buf)
+	assert.True(t, s.heap >= 1<<20)
+	assert.True(t, s.total >= s.heap)
+	assert.True(t, s.pauses > 0)
+}
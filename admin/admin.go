@@ -0,0 +1,190 @@
+// Package admin exposes the limiters of a registry over HTTP , so they can be inspected and tuned at
+// runtime , for example with the limiterctl command.
+//
+// Endpoints , relative to the mount point of the handler:
+//
+//	GET  /limiters               {"limiters": ["name" , ...]}
+//	GET  /limiters/{name}        the limiter.State of the limiter
+//	POST /limiters/{name}/limit  body {"limit": 10} , changes the limit and responds with the new state
+//	POST /limiters/{name}/purge  empties the waitlist , responds with {"purged": 3}
+//	POST /limiters/{name}/pause  stops granting slots and responds with the new state
+//	POST /limiters/{name}/resume grants slots again and responds with the new state
+//	POST /limiters/{name}/drain  closes the limiter and waits for the goroutines holding a slot to finish
+//
+// Errors are reported with a non 2xx status code and a {"error": "..."} body. Operations a limiter does not
+// support are answered with 501 Not Implemented.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+// StateProvider is implemented by limiters that can dump their state , see limiter.State.
+type StateProvider interface {
+	State() limiter.State
+}
+
+// LimitSetter is implemented by limiters whose limit can be changed at runtime.
+type LimitSetter interface {
+	SetLimit(limit int)
+}
+
+// Purger is implemented by limiters whose waitlist can be emptied.
+type Purger interface {
+	Purge() int
+}
+
+// Pauser is implemented by limiters that can stop granting slots for a while.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// Closer is implemented by limiters that can be drained: Close stops admitting goroutines and returns once the
+// goroutines holding a slot have finished or the context is done.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// LimitRequest is the body of a request to the limit endpoint.
+type LimitRequest struct {
+	Limit int `json:"limit"`
+}
+
+// ListResponse is the body of the response of the list endpoint.
+type ListResponse struct {
+	Limiters []string `json:"limiters"`
+}
+
+// PurgeResponse is the body of the response of the purge endpoint.
+type PurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// ErrorResponse is the body of error responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the admin endpoints for the limiters registered in reg. Mount it with http.StripPrefix
+// to serve it under a prefix.
+func Handler(reg *registry.Registry) http.Handler {
+	return &handler{reg: reg}
+}
+
+type handler struct {
+	reg *registry.Registry
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "limiters" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, ListResponse{Limiters: h.reg.Names()})
+		return
+	}
+	if !strings.HasPrefix(path, "limiters/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	name, action := strings.TrimPrefix(path, "limiters/"), ""
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name, action = name[:i], name[i+1:]
+	}
+	l, ok := h.reg.Get(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no limiter registered under "+name)
+		return
+	}
+	method := http.MethodPost
+	if action == "" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch action {
+	case "":
+		h.state(w, l)
+	case "limit":
+		s, ok := l.(LimitSetter)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, name+" does not support changing the limit")
+			return
+		}
+		var req LimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+		if req.Limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must not be negative")
+			return
+		}
+		s.SetLimit(req.Limit)
+		h.state(w, l)
+	case "purge":
+		p, ok := l.(Purger)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, name+" does not support purging")
+			return
+		}
+		writeJSON(w, http.StatusOK, PurgeResponse{Purged: p.Purge()})
+	case "pause", "resume":
+		p, ok := l.(Pauser)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, name+" does not support pausing")
+			return
+		}
+		if action == "pause" {
+			p.Pause()
+		} else {
+			p.Resume()
+		}
+		h.state(w, l)
+	case "drain":
+		c, ok := l.(Closer)
+		if !ok {
+			writeError(w, http.StatusNotImplemented, name+" does not support draining")
+			return
+		}
+		if err := c.Close(r.Context()); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		h.state(w, l)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// state writes the state of l.
+func (h *handler) state(w http.ResponseWriter, l registry.StatsProvider) {
+	s, ok := l.(StateProvider)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "the limiter does not support dumping its state")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.State())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+func do(t *testing.T, h http.Handler, method, path string, body string, resp interface{}) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+	if resp != nil {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(resp))
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	reg := registry.New()
+	l := limiter.New(1)
+	reg.Register("db", l)
+	h := Handler(reg)
+
+	var list ListResponse
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/limiters", "", &list))
+	assert.Equal(t, []string{"db"}, list.Limiters)
+
+	var st limiter.State
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/limiters/db/limit", `{"limit": 5}`, &st))
+	assert.Equal(t, 5, st.Limit)
+	assert.Equal(t, 5, l.Limit())
+
+	var e ErrorResponse
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/limiters/db/limit", `{"limit": -1}`, &e))
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/limiters/cache", "", &e))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, http.MethodGet, "/limiters/db/purge", "", &e))
+}
+
+func TestHandler_Purge(t *testing.T) {
+	reg := registry.New()
+	l := limiter.New(1)
+	reg.Register("db", l)
+	h := Handler(reg)
+
+	ctx := context.Background()
+	l.Wait(ctx)
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for l.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var resp PurgeResponse
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/limiters/db/purge", "", &resp))
+	assert.Equal(t, 1, resp.Purged)
+	assert.Equal(t, limiter.ErrPurged, <-errs)
+}
+
+func TestHandler_Drain(t *testing.T) {
+	reg := registry.New()
+	l := limiter.New(1)
+	reg.Register("db", l)
+	h := Handler(reg)
+
+	var st limiter.State
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/limiters/db/drain", "", &st))
+	assert.Equal(t, 0, st.InFlight)
+	assert.Equal(t, limiter.ErrClosed, l.Wait(context.Background()))
+}
+
+func TestHandler_Pause(t *testing.T) {
+	reg := registry.New()
+	l := limiter.New(1)
+	reg.Register("db", l)
+	h := Handler(reg)
+
+	var st limiter.State
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/limiters/db/pause", "", &st))
+	assert.True(t, st.Paused)
+	assert.True(t, l.Paused())
+	var resumed limiter.State
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/limiters/db/resume", "", &resumed))
+	assert.False(t, resumed.Paused)
+	assert.False(t, l.Paused())
+}
@@ -0,0 +1,162 @@
+package limiter
+
+import "time"
+
+// states of the circuit breaker.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker holds the settings of the circuit breaker , see WithCircuitBreaker.
+type circuitBreaker struct {
+	threshold float64
+	window    int
+	coolDown  time.Duration
+}
+
+// breaker is the state of the circuit breaker , fed with the outcomes recorded with Permit.Record.
+//
+// failed: ring of the last outcomes , true for failures , next is the index of the oldest one and recorded the
+// number of outcomes in the ring
+//
+// failures: number of failures in the ring
+//
+// state , until: state of the circuit and , while it is open , the end of the cool-down
+//
+// probe: fencing token of the permit probing the resource while the circuit is half-open , 0 until one is admitted
+type breaker struct {
+	failed   []bool
+	next     int
+	recorded int
+	failures int
+	state    int
+	until    time.Time
+	probe    uint64
+}
+
+// circuitName returns the name of a state of the circuit breaker , as reported in Stats.
+func circuitName(state int) string {
+	switch state {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// check returns an error matching ErrCircuitOpen , carrying the rest of the cool-down as RetryAfter hint , if the
+// circuit is open at now. It moves the circuit to half-open once the cool-down is over. The mutex must be held.
+func (b *breaker) check(now time.Time) error {
+	if b.state != circuitOpen {
+		return nil
+	}
+	if now.Before(b.until) {
+		return &RetryAfterError{
+			Err:   ErrCircuitOpen,
+			After: b.until.Sub(now),
+		}
+	}
+	b.state = circuitHalfOpen
+	return nil
+}
+
+// admitted marks the permit with the fencing token as the probe if the circuit is half-open. The half-open limit of
+// 1 admits goroutines one at a time , so the last permit admitted is the one probing the resource. The mutex must
+// be held.
+func (b *breaker) admitted(token uint64) {
+	if b.state == circuitHalfOpen {
+		b.probe = token
+	}
+}
+
+// record adds the outcome of the permit with the fencing token and reports whether the circuit opened or closed as
+// a result. While the circuit is half-open , only the outcome of the probe decides: a success closes the circuit ,
+// a failure opens it again. The outcomes of the goroutines admitted before the circuit opened , still in flight ,
+// are ignored. The mutex must be held.
+func (b *breaker) record(failed bool, token uint64, now time.Time, cb *circuitBreaker) bool {
+	switch b.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if b.probe == 0 || token != b.probe {
+			return false
+		}
+		if failed {
+			b.open(now, cb)
+		} else {
+			b.reset(circuitClosed)
+		}
+		return true
+	}
+	if b.failed == nil {
+		b.failed = make([]bool, cb.window)
+	}
+	if b.recorded == len(b.failed) {
+		if b.failed[b.next] {
+			b.failures--
+		}
+	} else {
+		b.recorded++
+	}
+	b.failed[b.next] = failed
+	b.next = (b.next + 1) % len(b.failed)
+	if failed {
+		b.failures++
+	}
+	if b.recorded == len(b.failed) && float64(b.failures) > cb.threshold*float64(b.recorded) {
+		b.open(now, cb)
+		return true
+	}
+	return false
+}
+
+// open opens the circuit for the cool-down.
+func (b *breaker) open(now time.Time, cb *circuitBreaker) {
+	b.reset(circuitOpen)
+	b.until = now.Add(cb.coolDown)
+}
+
+// reset forgets the outcomes recorded and moves the circuit to state.
+func (b *breaker) reset(state int) {
+	b.next, b.recorded, b.failures = 0, 0, 0
+	b.probe = 0
+	for i := range b.failed {
+		b.failed[i] = false
+	}
+	b.state = state
+}
+
+// effectiveLimit returns the limit in force: 0 while the Limiter is paused , and 1 while the circuit is half-open ,
+// so a single goroutine probes the resource. Otherwise an unlimited Limiter admits as many goroutines as the state
+// can count. The mutex must be held.
+func (l *Limiter) effectiveLimit(c *config) int {
+	if l.paused() {
+		return 0
+	}
+	if l.breaker.state == circuitHalfOpen {
+		return 1
+	}
+	if c.unlimited {
+		return countMask
+	}
+	return c.limit
+}
+
+// recordOutcome feeds the outcome of the permit with the fencing token to the circuit breaker if it is configured.
+// Opening the circuit rejects the goroutines in the waitlist , closing it admits them up to the limit. The mutex
+// must be held.
+func (l *Limiter) recordOutcome(failed bool, token uint64) {
+	c := l.config()
+	if c.circuitBreaker == nil || !l.breaker.record(failed, token, c.clock.Now(), c.circuitBreaker) {
+		return
+	}
+	l.version.Add(1)
+	if l.breaker.state == circuitOpen {
+		l.clear(ErrCircuitOpen)
+	} else {
+		l.admit()
+	}
+}
@@ -0,0 +1,123 @@
+// Package bulkhead isolates the work of an application in named compartments , in the style of the bulkhead of
+// Resilience4j: each compartment has its own limit and bounded waitlist , so a slow dependency exhausting its
+// compartment does not starve the others.
+//
+//	bulkhead.Define("payments" , 20 , 50)
+//	bulkhead.Define("search" , 50 , 100 , limiter.WithTimeoutDuration(time.Second))
+//
+//	err := bulkhead.Run(ctx , "payments" , func(ctx context.Context) error {
+//		return charge(ctx , order)
+//	})
+//
+// Every compartment is a *limiter.Limiter , so the options of the limiter apply. Stats aggregates the metrics of
+// all the compartments.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+// ErrUnknownCompartment is returned by Run for a compartment that has not been defined.
+var ErrUnknownCompartment = errors.New("bulkhead: unknown compartment")
+
+// ErrDuplicate is returned by Define when a compartment is already defined under the name.
+var ErrDuplicate = errors.New("bulkhead: a compartment is already defined under this name")
+
+// Bulkhead holds compartments by name. The zero value is not usable , create one with New.
+//
+// compartments: registry of the limiters of the compartments , used to collect their metrics
+type Bulkhead struct {
+	mu           sync.Mutex
+	compartments *registry.Registry
+}
+
+// New creates a *Bulkhead without compartments.
+func New() *Bulkhead {
+	return &Bulkhead{compartments: registry.New()}
+}
+
+// Define adds a compartment admitting up to limit concurrent calls of Run and queueing up to maxQueueLength more ,
+// configured with the options. Calls beyond are rejected with limiter.ErrQueueFull , unless the options set
+// another rejection policy. Define returns ErrDuplicate if the name is taken , or an error wrapping
+// limiter.ErrInvalidConfig if the configuration is invalid.
+func (b *Bulkhead) Define(name string, limit, maxQueueLength int, options ...limiter.Option) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.compartments.Get(name); ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, name)
+	}
+	options = append([]limiter.Option{limiter.WithMaxQueueLength(maxQueueLength)}, options...)
+	l, err := limiter.NewWithValidation(limit, options...)
+	if err != nil {
+		return err
+	}
+	return b.compartments.Register(name, l)
+}
+
+// Compartment returns the limiter of the compartment defined under name.
+func (b *Bulkhead) Compartment(name string) (*limiter.Limiter, bool) {
+	return registry.Lookup[*limiter.Limiter](b.compartments, name)
+}
+
+// Names returns the sorted names of the compartments.
+func (b *Bulkhead) Names() []string {
+	return b.compartments.Names()
+}
+
+// Run calls fn while holding a slot of the compartment defined under name , see limiter.Limiter.Do. It returns
+// an error wrapping ErrUnknownCompartment if there is no such compartment.
+func (b *Bulkhead) Run(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	l, ok := b.Compartment(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCompartment, name)
+	}
+	return l.Do(ctx, fn)
+}
+
+// Stats is a snapshot of the metrics of a Bulkhead.
+//
+// Total aggregates the compartments: the limits , counts and totals are summed , the wait percentiles and
+// OldestWait are the highest of the compartments. Version is zero.
+type Stats struct {
+	Total        limiter.Stats
+	Compartments map[string]limiter.Stats
+}
+
+// Stats returns the metrics of every compartment and their aggregate , collected in one consistent pass when
+// possible , see registry.Registry.CollectAll.
+func (b *Bulkhead) Stats() Stats {
+	s := Stats{Compartments: b.compartments.CollectAll().Stats}
+	for _, c := range s.Compartments {
+		s.Total.Limit += c.Limit
+		s.Total.InFlight += c.InFlight
+		s.Total.Waiting += c.Waiting
+		s.Total.WaitP50 = max(s.Total.WaitP50, c.WaitP50)
+		s.Total.WaitP95 = max(s.Total.WaitP95, c.WaitP95)
+		s.Total.WaitP99 = max(s.Total.WaitP99, c.WaitP99)
+		s.Total.OldestWait = max(s.Total.OldestWait, c.OldestWait)
+		s.Total.Reclaimed += c.Reclaimed
+		s.Total.Shed += c.Shed
+		s.Total.Succeeded += c.Succeeded
+		s.Total.Failed += c.Failed
+	}
+	return s
+}
+
+// Default is the bulkhead used by the package level functions.
+var Default = New()
+
+// Define adds a compartment to the Default bulkhead , see Bulkhead.Define.
+func Define(name string, limit, maxQueueLength int, options ...limiter.Option) error {
+	return Default.Define(name, limit, maxQueueLength, options...)
+}
+
+// Run calls fn in the compartment of the Default bulkhead defined under name , see Bulkhead.Run.
+func Run(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	return Default.Run(ctx, name, fn)
+}
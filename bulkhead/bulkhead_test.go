@@ -0,0 +1,59 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestBulkhead_Isolation(t *testing.T) {
+	b := New()
+	assert.NoError(t, b.Define("payments", 1, 0))
+	assert.NoError(t, b.Define("search", 2, 1))
+	assert.True(t, errors.Is(b.Define("search", 1, 0), ErrDuplicate))
+	assert.True(t, errors.Is(b.Define("other", 0, 0), limiter.ErrInvalidConfig))
+	assert.Equal(t, []string{"payments", "search"}, b.Names())
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	running := make(chan struct{})
+	go b.Run(ctx, "payments", func(ctx context.Context) error {
+		close(running)
+		<-release
+		return nil
+	})
+	<-running
+	// the full compartment rejects , the other one is not affected.
+	err := b.Run(ctx, "payments", func(ctx context.Context) error { return nil })
+	assert.True(t, errors.Is(err, limiter.ErrQueueFull))
+	errFailed := errors.New("failed")
+	assert.Equal(t, errFailed, b.Run(ctx, "search", func(ctx context.Context) error { return errFailed }))
+	assert.True(t, errors.Is(b.Run(ctx, "unknown", func(ctx context.Context) error { return nil }), ErrUnknownCompartment))
+
+	s := b.Stats()
+	assert.Equal(t, 3, s.Total.Limit)
+	assert.Equal(t, 1, s.Total.InFlight)
+	assert.Equal(t, uint64(1), s.Total.Shed)
+	assert.Equal(t, 1, s.Compartments["payments"].InFlight)
+	assert.Equal(t, 0, s.Compartments["search"].InFlight)
+	close(release)
+
+	l, ok := b.Compartment("search")
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Config().MaxQueueLength)
+}
+
+func TestBulkhead_Default(t *testing.T) {
+	defer func(b *Bulkhead) { Default = b }(Default)
+	Default = New()
+	assert.NoError(t, Define("default-test", 1, 0))
+	ran := false
+	assert.NoError(t, Run(context.Background(), "default-test", func(ctx context.Context) error {
+		ran = true
+		return nil
+	}))
+	assert.True(t, ran)
+}
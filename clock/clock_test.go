@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake_Timer(t *testing.T) {
+	start := time.Now()
+	f := NewFake(start)
+	timer := f.NewTimer(time.Second)
+	assert.Equal(t, 1, f.Waiters())
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	f.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-timer.C())
+	assert.Zero(t, f.Waiters())
+	assert.False(t, timer.Stop())
+
+	timer = f.NewTimer(time.Second)
+	assert.True(t, timer.Stop())
+	f.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+	assert.Equal(t, start.Add(time.Hour+time.Second), f.Now())
+}
+
+func TestFake_Ticker(t *testing.T) {
+	start := time.Now()
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+	f.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// ticks the receiver is not ready for are dropped.
+	f.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("dropped tick delivered")
+	default:
+	}
+	assert.Equal(t, 1, f.Waiters())
+	ticker.Stop()
+	assert.Zero(t, f.Waiters())
+}
+
+func TestFake_ImmediateTimer(t *testing.T) {
+	f := NewFake(time.Now())
+	timer := f.NewTimer(0)
+	assert.Equal(t, f.Now(), <-timer.C())
+	assert.Zero(t, f.Waiters())
+}
+
+func TestReal(t *testing.T) {
+	c := Real()
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+}
@@ -0,0 +1,258 @@
+// Command limiterctl inspects and tunes the limiters of a running process through the endpoints served by
+// the admin package.
+//
+// Usage:
+//
+//	limiterctl [-addr http://localhost:6060/admin] <command> [arguments]
+//
+// Commands:
+//
+//	list                      list the registered limiters with their stats
+//	stats [-watch 1s] <name>  show the stats and the waitlist of a limiter , refreshed every interval with -watch
+//	set-limit <name> <limit>  change the limit of a limiter
+//	purge <name>              remove every goroutine from the waitlist of a limiter
+//	pause <name>              stop granting slots , goroutines queue until resume
+//	resume <name>             grant slots again
+//	drain <name>              close a limiter and wait for the goroutines holding a slot to finish
+//
+// The address defaults to the LIMITERCTL_ADDR environment variable.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/admin"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "limiterctl:", err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("usage: limiterctl [-addr url] list | stats [-watch interval] <name> | set-limit <name> <limit> | purge <name> | pause <name> | resume <name> | drain <name>")
+
+// run executes the command in args , writing its output to out.
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("limiterctl", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	addr := fs.String("addr", defaultAddr(), "base URL of the admin endpoints")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	c := &client{base: strings.TrimRight(*addr, "/"), http: http.DefaultClient}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "list":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return list(ctx, c, out)
+	case "stats":
+		fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		watch := fs.Duration("watch", 0, "refresh interval")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		return stats(ctx, c, out, fs.Arg(0), *watch)
+	case "set-limit":
+		if len(args) != 2 {
+			return errUsage
+		}
+		limit, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid limit %q", args[1])
+		}
+		var st limiter.State
+		if err := c.do(ctx, http.MethodPost, "/limiters/"+url.PathEscape(args[0])+"/limit", admin.LimitRequest{Limit: limit}, &st); err != nil {
+			return err
+		}
+		printState(out, args[0], st)
+		return nil
+	case "purge":
+		if len(args) != 1 {
+			return errUsage
+		}
+		var resp admin.PurgeResponse
+		if err := c.do(ctx, http.MethodPost, "/limiters/"+url.PathEscape(args[0])+"/purge", nil, &resp); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "purged %d goroutines from %s\n", resp.Purged, args[0])
+		return nil
+	case "pause", "resume":
+		if len(args) != 1 {
+			return errUsage
+		}
+		var st limiter.State
+		if err := c.do(ctx, http.MethodPost, "/limiters/"+url.PathEscape(args[0])+"/"+cmd, nil, &st); err != nil {
+			return err
+		}
+		printState(out, args[0], st)
+		return nil
+	case "drain":
+		if len(args) != 1 {
+			return errUsage
+		}
+		var st limiter.State
+		if err := c.do(ctx, http.MethodPost, "/limiters/"+url.PathEscape(args[0])+"/drain", nil, &st); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "drained %s\n", args[0])
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func defaultAddr() string {
+	if addr := os.Getenv("LIMITERCTL_ADDR"); addr != "" {
+		return addr
+	}
+	return "http://localhost:6060/admin"
+}
+
+func list(ctx context.Context, c *client, out io.Writer) error {
+	var resp admin.ListResponse
+	if err := c.do(ctx, http.MethodGet, "/limiters", nil, &resp); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tKIND\tLIMIT\tIN FLIGHT\tWAITING\tWAIT P99")
+	for _, name := range resp.Limiters {
+		var st limiter.State
+		if err := c.do(ctx, http.MethodGet, "/limiters/"+url.PathEscape(name), nil, &st); err != nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t%v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", name, st.Kind, st.Limit, st.InFlight, st.Waiting, seconds(st.WaitP99Seconds))
+	}
+	return tw.Flush()
+}
+
+func stats(ctx context.Context, c *client, out io.Writer, name string, watch time.Duration) error {
+	for {
+		var st limiter.State
+		if err := c.do(ctx, http.MethodGet, "/limiters/"+url.PathEscape(name), nil, &st); err != nil {
+			return err
+		}
+		printState(out, name, st)
+		if watch <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(watch):
+			fmt.Fprintln(out)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func printState(out io.Writer, name string, st limiter.State) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "name:\t%s\n", name)
+	fmt.Fprintf(tw, "kind:\t%s\n", st.Kind)
+	fmt.Fprintf(tw, "limit:\t%d\n", st.Limit)
+	if st.Paused {
+		fmt.Fprintf(tw, "paused:\ttrue\n")
+	}
+	fmt.Fprintf(tw, "in flight:\t%d\n", st.InFlight)
+	fmt.Fprintf(tw, "waiting:\t%d\n", st.Waiting)
+	if st.OldestWaitSeconds > 0 {
+		fmt.Fprintf(tw, "oldest wait:\t%s\n", seconds(st.OldestWaitSeconds))
+	}
+	fmt.Fprintf(tw, "reclaimed:\t%d\n", st.Reclaimed)
+	if st.Shed > 0 {
+		fmt.Fprintf(tw, "shed:\t%d\n", st.Shed)
+	}
+	if st.Succeeded+st.Failed > 0 {
+		fmt.Fprintf(tw, "succeeded/failed:\t%d / %d\n", st.Succeeded, st.Failed)
+	}
+	if st.Circuit != "" {
+		fmt.Fprintf(tw, "circuit:\t%s\n", st.Circuit)
+	}
+	if st.Profile != "" {
+		fmt.Fprintf(tw, "profile:\t%s\n", st.Profile)
+	}
+	fmt.Fprintf(tw, "wait p50/p95/p99:\t%s / %s / %s\n",
+		seconds(st.WaitP50Seconds), seconds(st.WaitP95Seconds), seconds(st.WaitP99Seconds))
+	for i, w := range st.Waiters {
+		if w.Priority != nil {
+			fmt.Fprintf(tw, "waiter %d:\tpriority %d , waited %s\n", i+1, *w.Priority, seconds(w.WaitedSeconds))
+		} else {
+			fmt.Fprintf(tw, "waiter %d:\twaited %s\n", i+1, seconds(w.WaitedSeconds))
+		}
+	}
+	tw.Flush()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+}
+
+// client calls the admin endpoints.
+type client struct {
+	base string
+	http *http.Client
+}
+
+// do sends body encoded as JSON , if it is not nil , and decodes the response into resp.
+func (c *client) do(ctx context.Context, method, path string, body, resp interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		var e admin.ErrorResponse
+		if json.NewDecoder(res.Body).Decode(&e) == nil && e.Error != "" {
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/admin"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+func TestRun(t *testing.T) {
+	reg := registry.New()
+	l := limiter.New(3)
+	reg.Register("db-writes", l)
+	srv := httptest.NewServer(admin.Handler(reg))
+	defer srv.Close()
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	assert.NoError(t, run(ctx, []string{"-addr", srv.URL, "list"}, &out))
+	assert.Contains(t, out.String(), "db-writes")
+
+	out.Reset()
+	assert.NoError(t, run(ctx, []string{"-addr", srv.URL, "set-limit", "db-writes", "7"}, &out))
+	assert.Contains(t, out.String(), "limit:")
+	assert.Equal(t, 7, l.Limit())
+
+	out.Reset()
+	assert.NoError(t, run(ctx, []string{"-addr", srv.URL, "purge", "db-writes"}, &out))
+	assert.Equal(t, "purged 0 goroutines from db-writes\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, run(ctx, []string{"-addr", srv.URL, "pause", "db-writes"}, &out))
+	assert.Contains(t, out.String(), "paused:")
+	assert.True(t, l.Paused())
+	out.Reset()
+	assert.NoError(t, run(ctx, []string{"-addr", srv.URL, "resume", "db-writes"}, &out))
+	assert.NotContains(t, out.String(), "paused:")
+	assert.False(t, l.Paused())
+
+	err := run(ctx, []string{"-addr", srv.URL, "stats", "cache"}, &out)
+	assert.EqualError(t, err, "no limiter registered under cache")
+	assert.Equal(t, errUsage, run(ctx, []string{"-addr", srv.URL, "set-limit", "db-writes"}, &out))
+}
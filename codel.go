@@ -0,0 +1,66 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// codel implements the CoDel (controlled delay) queue management algorithm on the waitlist.
+//
+// CoDel looks at the time goroutines spent in the waitlist when they are removed from it. Once this
+// sojourn time has stayed above target for a whole interval , goroutines are shed instead of being
+// granted access, and the time between two sheds shrinks with the square root of the number of sheds
+// until the sojourn time drops below target again. This keeps a standing queue from building up
+// while still absorbing short bursts.
+type codel struct {
+	firstAboveTime time.Time
+	dropNext       time.Time
+	count          int
+	dropping       bool
+}
+
+// shed is called with the sojourn time of the goroutine about to be removed from the waitlist and
+// reports whether it has to be shed. The mutex must be held.
+func (c *codel) shed(now time.Time, sojourn, target, interval time.Duration) bool {
+	ok := c.okToShed(now, sojourn, target, interval)
+	if c.dropping {
+		if !ok {
+			c.dropping = false
+			return false
+		}
+		if now.Before(c.dropNext) {
+			return false
+		}
+		c.count++
+		c.dropNext = c.controlLaw(c.dropNext, interval)
+		return true
+	}
+	if !ok {
+		return false
+	}
+	c.dropping = true
+	// if we were shedding recently , resume at a rate close to the previous one.
+	if c.count > 2 && now.Sub(c.dropNext) < 16*interval {
+		c.count -= 2
+	} else {
+		c.count = 1
+	}
+	c.dropNext = c.controlLaw(now, interval)
+	return true
+}
+
+func (c *codel) okToShed(now time.Time, sojourn, target, interval time.Duration) bool {
+	if sojourn < target {
+		c.firstAboveTime = time.Time{}
+		return false
+	}
+	if c.firstAboveTime.IsZero() {
+		c.firstAboveTime = now.Add(interval)
+		return false
+	}
+	return !now.Before(c.firstAboveTime)
+}
+
+func (c *codel) controlLaw(t time.Time, interval time.Duration) time.Time {
+	return t.Add(time.Duration(float64(interval) / math.Sqrt(float64(c.count))))
+}
@@ -0,0 +1,298 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// config holds the settings of a Limiter. A config is immutable once the Limiter has been
+// created: changes are made by publishing a modified copy , so the settings can be read
+// without taking the mutex.
+//
+// limit: max number of concurrent goroutines that can access aresource
+//
+// unlimited: If this field is set , the limit is ignored and every goroutine proceeds immediately
+//
+// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
+// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+//
+// timeoutPolicy: decides whether goroutines removed after the timeout access the resource
+//
+// jitter: If this field is specified , the timeouts of the goroutines are shortened by a random fraction of at most
+// jitter
+//
+// spin: number of times a goroutine yields the processor and checks for a slot before it parks
+//
+// deadlineAsTimeout: If this field is set , the deadline of the context is used as the timeout when it expires first
+//
+// deadlineAwareRejection: If this field is set , goroutines whose estimated wait exceeds their deadline are rejected
+//
+// maxQueueLength: If this field is specified , goroutines will be rejected with ErrQueueFull instead of
+// being added to the waitlist once the waitlist holds this many goroutines.
+//
+// rejectionPolicy: decides what happens when a goroutine arrives while the waitlist is full
+//
+// redThreshold: If this field is specified , goroutines arriving while the waitlist holds at least redThreshold
+// goroutines are rejected at random. See WithRandomEarlyDetection
+//
+// lifoThreshold: If this field is specified , goroutines are removed from the waitlist in LIFO order
+// while the waitlist holds more than lifoThreshold goroutines
+//
+// codelTarget , codelInterval: If these fields are specified , the waitlist is managed with CoDel. See codel
+//
+// admissionPolicy: decides how many goroutines Finish removes from the waitlist
+//
+// warmup: If this field is specified , the limit is ramped up after the Limiter is created. See WithWarmup
+//
+// schedule: If this field is specified , the limit follows the daily profiles. See WithSchedule
+//
+// controller , controlPeriod: If controller is specified , it is sampled every controlPeriod to set the limit. See
+// LimitController
+//
+// circuitBreaker: If this field is specified , the Limiter rejects goroutines while the failure rate recorded on
+// permits is too high. See WithCircuitBreaker
+//
+// fallback: If this field is specified , Do calls it instead of its func when the goroutine is rejected
+//
+// strictFIFO: If this field is set , arriving goroutines queue behind the waitlist instead of taking a free slot
+// while goroutines are waiting
+//
+// weights: If this field is specified , goroutines are removed from the waitlist with weighted fair queuing. See fairQueue
+//
+// clock: tells the time and creates the timers of the timeouts
+//
+// timerTick: If this field is specified , the resolution of the timer wheel driving the timeouts
+//
+// logger , levels: If logger is specified , the events of the Limiter are logged at the level of their kind. See
+// WithLogger
+//
+// history: If this field is positive , the last history events of the Limiter are kept for RecentEvents
+//
+// permitTTL , onReclaim: If permitTTL is specified , permits not renewed within permitTTL are reclaimed and
+// onReclaim is called
+//
+// maxHold , onMaxHold: If maxHold is specified , slots held for longer than maxHold are reclaimed and onMaxHold
+// is called
+type config struct {
+	limit           int
+	unlimited       bool
+	timeout         *time.Duration
+	timeoutPolicy   TimeoutPolicy
+	jitter          float64
+	spin            int
+	maxQueueLength  *int
+	rejectionPolicy RejectionPolicy
+	redThreshold    *int
+	lifoThreshold   *int
+	codelTarget     time.Duration
+	codelInterval   time.Duration
+	admissionPolicy AdmissionPolicy
+	weights         map[string]int
+
+	deadlineAsTimeout      bool
+	deadlineAwareRejection bool
+	strictFIFO             bool
+
+	warmup   *warmup
+	schedule []Profile
+
+	controller    LimitController
+	controlPeriod time.Duration
+
+	circuitBreaker *circuitBreaker
+	fallback       func(ctx context.Context, reason error) error
+
+	clock     clock.Clock
+	timerTick time.Duration
+
+	logger  *slog.Logger
+	levels  map[EventKind]slog.Level
+	history int
+
+	permitTTL time.Duration
+	onReclaim func()
+
+	maxHold   time.Duration
+	onMaxHold func()
+}
+
+// validate returns an error wrapping ErrInvalidConfig if the settings are invalid or contradict each other.
+func (c *config) validate() error {
+	switch {
+	case c.limit <= 0 && !c.unlimited:
+		return fmt.Errorf("%w: limit must be positive , got %d", ErrInvalidConfig, c.limit)
+	case c.timeout != nil && *c.timeout <= 0:
+		return fmt.Errorf("%w: timeout must be positive , got %v", ErrInvalidConfig, *c.timeout)
+	case c.jitter < 0 || c.jitter >= 1:
+		return fmt.Errorf("%w: jitter must be at least 0 and below 1 , got %v", ErrInvalidConfig, c.jitter)
+	case c.spin < 0:
+		return fmt.Errorf("%w: spin must not be negative , got %d", ErrInvalidConfig, c.spin)
+	case !c.timeoutPolicy.Valid():
+		return fmt.Errorf("%w: unknown timeout policy %d", ErrInvalidConfig, int(c.timeoutPolicy))
+	case c.timeout == nil && !c.deadlineAsTimeout && c.timeoutPolicy != AdmitOnTimeout:
+		return fmt.Errorf("%w: timeout policy %v has no effect without a timeout", ErrInvalidConfig, c.timeoutPolicy)
+	case c.maxQueueLength != nil && *c.maxQueueLength < 0:
+		return fmt.Errorf("%w: max queue length must not be negative , got %d", ErrInvalidConfig, *c.maxQueueLength)
+	case c.maxQueueLength == nil && c.rejectionPolicy != RejectNew:
+		return fmt.Errorf("%w: rejection policy %v has no effect without a max queue length", ErrInvalidConfig, c.rejectionPolicy)
+	case !c.rejectionPolicy.Valid():
+		return fmt.Errorf("%w: unknown rejection policy %d", ErrInvalidConfig, int(c.rejectionPolicy))
+	case !c.admissionPolicy.Valid():
+		return fmt.Errorf("%w: unknown admission policy %d", ErrInvalidConfig, int(c.admissionPolicy))
+	case c.redThreshold != nil && (c.maxQueueLength == nil || *c.redThreshold < 0 || *c.redThreshold >= *c.maxQueueLength):
+		return fmt.Errorf("%w: random early detection threshold must be between 0 and the max queue length , got %d",
+			ErrInvalidConfig, *c.redThreshold)
+	case c.lifoThreshold != nil && *c.lifoThreshold < 0:
+		return fmt.Errorf("%w: LIFO threshold must not be negative , got %d", ErrInvalidConfig, *c.lifoThreshold)
+	case c.codelTarget < 0 || c.codelInterval < 0 || (c.codelTarget == 0) != (c.codelInterval == 0):
+		return fmt.Errorf("%w: CoDel target and interval must both be positive , got %v and %v", ErrInvalidConfig, c.codelTarget, c.codelInterval)
+	case c.weights != nil && c.lifoThreshold != nil:
+		return fmt.Errorf("%w: fair queuing contradicts adaptive LIFO", ErrInvalidConfig)
+	case c.strictFIFO && c.lifoThreshold != nil:
+		return fmt.Errorf("%w: strict FIFO contradicts adaptive LIFO", ErrInvalidConfig)
+	case c.warmup != nil && (c.warmup.initial <= 0 || c.warmup.target < c.warmup.initial || c.warmup.ramp <= 0):
+		return fmt.Errorf("%w: warm-up must ramp up from a positive limit over a positive duration , got %d to %d over %v",
+			ErrInvalidConfig, c.warmup.initial, c.warmup.target, c.warmup.ramp)
+	case c.warmup != nil && c.unlimited:
+		return fmt.Errorf("%w: warm-up contradicts unlimited", ErrInvalidConfig)
+	case c.warmup != nil && c.schedule != nil:
+		return fmt.Errorf("%w: warm-up contradicts a schedule", ErrInvalidConfig)
+	case c.schedule != nil && c.unlimited:
+		return fmt.Errorf("%w: schedule contradicts unlimited", ErrInvalidConfig)
+	case c.controller != nil && c.controlPeriod <= 0:
+		return fmt.Errorf("%w: control period must be positive , got %v", ErrInvalidConfig, c.controlPeriod)
+	case c.controller != nil && (c.warmup != nil || c.schedule != nil || c.unlimited):
+		return fmt.Errorf("%w: limit controller contradicts warm-up , schedules and unlimited", ErrInvalidConfig)
+	case c.circuitBreaker != nil && (c.circuitBreaker.threshold <= 0 || c.circuitBreaker.threshold >= 1):
+		return fmt.Errorf("%w: circuit breaker threshold must be between 0 and 1 , got %v", ErrInvalidConfig, c.circuitBreaker.threshold)
+	case c.circuitBreaker != nil && (c.circuitBreaker.window <= 0 || c.circuitBreaker.coolDown <= 0):
+		return fmt.Errorf("%w: circuit breaker window and cool-down must be positive , got %d and %v",
+			ErrInvalidConfig, c.circuitBreaker.window, c.circuitBreaker.coolDown)
+	case c.strictFIFO && c.weights != nil:
+		return fmt.Errorf("%w: strict FIFO contradicts fair queuing", ErrInvalidConfig)
+	case c.clock == nil:
+		return fmt.Errorf("%w: clock must not be nil", ErrInvalidConfig)
+	case c.timerTick < 0:
+		return fmt.Errorf("%w: timer wheel tick must not be negative , got %v", ErrInvalidConfig, c.timerTick)
+	case c.permitTTL < 0:
+		return fmt.Errorf("%w: permit TTL must not be negative , got %v", ErrInvalidConfig, c.permitTTL)
+	case c.maxHold < 0:
+		return fmt.Errorf("%w: max hold duration must not be negative , got %v", ErrInvalidConfig, c.maxHold)
+	case c.history < 0:
+		return fmt.Errorf("%w: event history must not be negative , got %d", ErrInvalidConfig, c.history)
+	}
+	for _, p := range c.schedule {
+		if p.Limit <= 0 || p.Start < 0 || p.Start >= 24*time.Hour || p.End < 0 || p.End >= 24*time.Hour || p.Start == p.End {
+			return fmt.Errorf("%w: profile %q must have a positive limit and distinct start and end within a day , got %d from %v to %v",
+				ErrInvalidConfig, p.Name, p.Limit, p.Start, p.End)
+		}
+	}
+	for flow, w := range c.weights {
+		if w <= 0 {
+			return fmt.Errorf("%w: weight of flow %q must be positive , got %d", ErrInvalidConfig, flow, w)
+		}
+	}
+	return nil
+}
+
+// Config is a snapshot of the configuration of a Limiter.
+//
+// Timeout is zero if no timeout is configured. MaxQueueLength is -1 if the waitlist is unbounded ,
+// REDThreshold is -1 if Random Early Detection is disabled and LIFOThreshold is -1 if adaptive LIFO is disabled. CoDelTarget and CoDelInterval are zero if CoDel
+// is disabled. TimerWheelTick is zero unless the timeouts are driven by a timer wheel. PermitTTL is zero if permits have no lease and MaxHoldDuration is zero if slots can be held
+// indefinitely. FlowWeights is nil if fair queuing is disabled. Limit is ignored if Unlimited is set.
+type Config struct {
+	Limit           int
+	Unlimited       bool
+	Timeout         time.Duration
+	TimeoutPolicy   TimeoutPolicy
+	Jitter          float64
+	Spin            int
+	MaxQueueLength  int
+	RejectionPolicy RejectionPolicy
+	REDThreshold    int
+	LIFOThreshold   int
+	CoDelTarget     time.Duration
+	CoDelInterval   time.Duration
+	AdmissionPolicy AdmissionPolicy
+	FlowWeights     map[string]int
+
+	DeadlineAsTimeout      bool
+	DeadlineAwareRejection bool
+	StrictFIFO             bool
+
+	TimerWheelTick  time.Duration
+	PermitTTL       time.Duration
+	MaxHoldDuration time.Duration
+}
+
+// config returns the current settings. Options run before the Limiter is returned by New , so they
+// are allowed to modify the returned config in place.
+func (l *Limiter) config() *config {
+	return l.cfg.Load().(*config)
+}
+
+// updateConfig publishes a modified copy of the current settings. The mutex must be held.
+func (l *Limiter) updateConfig(update func(c *config)) *config {
+	c := *l.config()
+	update(&c)
+	l.cfg.Store(&c)
+	return &c
+}
+
+// Limit returns the max number of concurrent goroutines that can access the resource.
+// It never blocks on the Limiter's mutex.
+func (l *Limiter) Limit() int {
+	return l.config().limit
+}
+
+// Config returns a snapshot of the configuration of the Limiter.
+// It never blocks on the Limiter's mutex.
+func (l *Limiter) Config() Config {
+	c := l.config()
+	s := Config{
+		Limit:           c.limit,
+		Unlimited:       c.unlimited,
+		TimeoutPolicy:   c.timeoutPolicy,
+		Jitter:          c.jitter,
+		Spin:            c.spin,
+		MaxQueueLength:  -1,
+		RejectionPolicy: c.rejectionPolicy,
+		REDThreshold:    -1,
+		LIFOThreshold:   -1,
+		CoDelTarget:     c.codelTarget,
+		CoDelInterval:   c.codelInterval,
+		AdmissionPolicy: c.admissionPolicy,
+
+		DeadlineAsTimeout:      c.deadlineAsTimeout,
+		DeadlineAwareRejection: c.deadlineAwareRejection,
+		StrictFIFO:             c.strictFIFO,
+
+		TimerWheelTick:  c.timerTick,
+		PermitTTL:       c.permitTTL,
+		MaxHoldDuration: c.maxHold,
+	}
+	if c.timeout != nil {
+		s.Timeout = *c.timeout
+	}
+	if c.weights != nil {
+		s.FlowWeights = make(map[string]int, len(c.weights))
+		for flow, w := range c.weights {
+			s.FlowWeights[flow] = w
+		}
+	}
+	if c.maxQueueLength != nil {
+		s.MaxQueueLength = *c.maxQueueLength
+	}
+	if c.redThreshold != nil {
+		s.REDThreshold = *c.redThreshold
+	}
+	if c.lifoThreshold != nil {
+		s.LIFOThreshold = *c.lifoThreshold
+	}
+	return s
+}
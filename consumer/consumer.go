@@ -0,0 +1,199 @@
+// Package consumer throttles message consumer loops , for example the consumer of a Kafka partition. Each message
+// fetched from a Source is processed in its own goroutine once the limiter admits it , and the Consumer stops
+// fetching while the waitlist of the limiter is longer than a threshold , pausing the Source if it can , so the
+// backlog stays in the broker instead of piling up in memory:
+//
+//	l := limiter.New(16)
+//	c := consumer.New(l , source , consumer.ProcessFunc[Message](handle) , consumer.WithPauseThreshold(32))
+//	err := c.Run(ctx)
+//
+// Several Consumers , one per partition , usually share the same limiter. See the examples module for sources
+// built on sarama and kafka-go.
+package consumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// Source fetches the messages of a stream. Fetch blocks until a message is available or ctx is done.
+type Source[M any] interface {
+	Fetch(ctx context.Context) (M, error)
+}
+
+// Pauser is implemented by Sources able to stop fetching from the broker , for example by pausing the
+// partitions they consume. The Consumer pauses its Source while the waitlist is over the threshold.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// Processor processes the messages fetched by a Consumer. Process is called concurrently , in the order the
+// limiter admits the messages.
+type Processor[M any] interface {
+	Process(ctx context.Context, m M) error
+}
+
+// ProcessFunc adapts a func to the Processor interface.
+type ProcessFunc[M any] func(ctx context.Context, m M) error
+
+// Process calls f(ctx , m).
+func (f ProcessFunc[M]) Process(ctx context.Context, m M) error {
+	return f(ctx, m)
+}
+
+// settings of a Consumer.
+//
+// threshold: the length of the waitlist over which the Consumer stops fetching
+// poll: how often the waitlist is checked while the Consumer is paused
+// clock: the clock the poll ticker runs on
+// onError: called with the messages the limiter rejected or whose processing failed
+type settings struct {
+	threshold int
+	poll      time.Duration
+	clock     clock.Clock
+	onError   func(m any, err error)
+}
+
+type Option func(*settings)
+
+// threshold: If this field is specified , the Consumer stops fetching while the waitlist of the limiter is longer
+// than n. It defaults to 0: the Consumer fetches the next message only once every message it fetched before has
+// left the waitlist.
+func WithPauseThreshold(n int) Option {
+	return func(s *settings) {
+		s.threshold = n
+	}
+}
+
+// poll: If this field is specified , the waitlist is checked every d while the Consumer is paused , instead of
+// every 10ms.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *settings) {
+		s.poll = d
+	}
+}
+
+// clock: If this field is specified , the poll ticker runs on c instead of the real clock , so tests can drive
+// it with a clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *settings) {
+		s.clock = c
+	}
+}
+
+// onError: If this field is specified , fn is called with every message the limiter rejected , which is not
+// processed , and every message whose processing failed , with the error. Errors are dropped otherwise.
+func WithErrorHandler(fn func(m any, err error)) Option {
+	return func(s *settings) {
+		s.onError = fn
+	}
+}
+
+// Consumer fetches messages from a Source and processes them through a limiter.
+//
+// waiting: the messages of this Consumer waiting for a slot , the waitlist when the limiter does not report its
+// own
+// paused: whether the Consumer stopped fetching because of the waitlist
+type Consumer[M any] struct {
+	l       limiter.Waiter
+	src     Source[M]
+	proc    Processor[M]
+	s       settings
+	wg      sync.WaitGroup
+	waiting atomic.Int64
+	paused  atomic.Bool
+}
+
+// New returns a Consumer processing the messages of src with proc , admitted by l.
+func New[M any](l limiter.Waiter, src Source[M], proc Processor[M], options ...Option) *Consumer[M] {
+	c := &Consumer[M]{
+		l:    l,
+		src:  src,
+		proc: proc,
+		s: settings{
+			poll:  10 * time.Millisecond,
+			clock: clock.Real(),
+		},
+	}
+	for _, o := range options {
+		o(&c.s)
+	}
+	return c
+}
+
+// Run fetches and processes messages until ctx is done or Fetch fails. It returns the error of Fetch , usually
+// the context error , once every message it fetched has been processed or rejected.
+func (c *Consumer[M]) Run(ctx context.Context) error {
+	defer c.wg.Wait()
+	for {
+		if err := c.backpressure(ctx); err != nil {
+			return err
+		}
+		m, err := c.src.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+		c.waiting.Add(1)
+		c.wg.Add(1)
+		go c.process(ctx, m)
+	}
+}
+
+// Paused reports whether the Consumer stopped fetching because the waitlist is over the threshold.
+func (c *Consumer[M]) Paused() bool {
+	return c.paused.Load()
+}
+
+// process waits for a slot and processes m.
+func (c *Consumer[M]) process(ctx context.Context, m M) {
+	defer c.wg.Done()
+	err := c.l.Wait(ctx)
+	c.waiting.Add(-1)
+	if err == nil {
+		err = c.proc.Process(ctx, m)
+		c.l.Finish()
+	}
+	if err != nil && c.s.onError != nil {
+		c.s.onError(m, err)
+	}
+}
+
+// backpressure returns once the waitlist is no longer over the threshold , pausing the Source until then , or
+// when ctx is done.
+func (c *Consumer[M]) backpressure(ctx context.Context) error {
+	if c.waitlist() <= c.s.threshold {
+		return nil
+	}
+	if p, ok := c.src.(Pauser); ok {
+		p.Pause()
+		defer p.Resume()
+	}
+	c.paused.Store(true)
+	defer c.paused.Store(false)
+	t := c.s.clock.NewTicker(c.s.poll)
+	defer t.Stop()
+	for c.waitlist() > c.s.threshold {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C():
+		}
+	}
+	return nil
+}
+
+// waitlist returns the length of the waitlist of the limiter , or the number of messages of this Consumer waiting
+// for a slot if it is larger , since these may not have entered the waitlist yet.
+func (c *Consumer[M]) waitlist() int {
+	n := int(c.waiting.Load())
+	if q, ok := c.l.(interface{ QueueLen() int }); ok {
+		n = max(n, q.QueueLen())
+	}
+	return n
+}
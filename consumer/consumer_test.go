@@ -0,0 +1,126 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// source fetches the ints sent on c and records the calls to Pause and Resume.
+type source struct {
+	c       chan int
+	mu      sync.Mutex
+	fetched int
+	pauses  int
+	paused  bool
+}
+
+func (s *source) Fetch(ctx context.Context) (int, error) {
+	select {
+	case m := <-s.c:
+		s.mu.Lock()
+		s.fetched++
+		s.mu.Unlock()
+		return m, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (s *source) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pauses++
+	s.paused = true
+}
+
+func (s *source) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+func (s *source) state() (fetched int, paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetched, s.paused
+}
+
+func TestConsumer_Backpressure(t *testing.T) {
+	src := &source{c: make(chan int, 10)}
+	for i := 0; i < 10; i++ {
+		src.c <- i
+	}
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []int
+	c := New[int](limiter.New(1), src, ProcessFunc[int](func(ctx context.Context, m int) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		processed = append(processed, m)
+		return nil
+	}), WithPollInterval(time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	// one message holds the slot and one waits , so the Consumer pauses the source.
+	assert.Eventually(t, func() bool {
+		fetched, paused := src.state()
+		return fetched == 2 && paused && c.Paused()
+	}, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	fetched, _ := src.state()
+	assert.Equal(t, 2, fetched)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(processed) == 10
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, paused := src.state()
+		return !paused && !c.Paused()
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+}
+
+func TestConsumer_Errors(t *testing.T) {
+	src := &source{c: make(chan int, 2)}
+	src.c <- 1
+	src.c <- 2
+	errFail := errors.New("fail")
+	var mu sync.Mutex
+	failed := map[any]error{}
+	c := New[int](limiter.New(1), src, ProcessFunc[int](func(ctx context.Context, m int) error {
+		if m == 2 {
+			return errFail
+		}
+		return nil
+	}), WithErrorHandler(func(m any, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed[m] = err
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failed) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, map[any]error{2: errFail}, failed)
+}
@@ -0,0 +1,46 @@
+// Command kafkago consumes a topic with kafka-go , processing at most 16 messages at a time. kafka-go cannot pause a
+// partition , so the Source does not implement consumer.Pauser: the Consumer stops calling FetchMessage while the
+// waitlist is over the threshold , and the reader stops fetching from the broker once its internal queue is full.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/segmentio/kafka-go"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/consumer"
+)
+
+// source adapts a *kafka.Reader to consumer.Source.
+type source struct {
+	r *kafka.Reader
+}
+
+func (s source) Fetch(ctx context.Context) (kafka.Message, error) {
+	return s.r.FetchMessage(ctx)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "example",
+		Topic:   "events",
+	})
+	defer r.Close()
+
+	c := consumer.New(limiter.New(16), source{r}, consumer.ProcessFunc[kafka.Message](func(ctx context.Context, m kafka.Message) error {
+		log.Printf("partition %d offset %d: %s", m.Partition, m.Offset, m.Value)
+		return r.CommitMessages(ctx, m)
+	}), consumer.WithPauseThreshold(32), consumer.WithErrorHandler(func(m any, err error) {
+		log.Printf("offset %d: %v", m.(kafka.Message).Offset, err)
+	}))
+	if err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+// Command sarama consumes a topic with a sarama consumer group , processing at most 16 messages at a time across
+// every partition. Each claim is consumed by its own Consumer sharing the same limiter , and a partition is paused
+// in the consumer group while the waitlist is over the threshold , so sarama stops fetching it from the broker.
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/IBM/sarama"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/consumer"
+)
+
+// claim adapts a sarama.ConsumerGroupClaim to consumer.Source and consumer.Pauser.
+type claim struct {
+	group sarama.ConsumerGroup
+	c     sarama.ConsumerGroupClaim
+}
+
+func (s claim) Fetch(ctx context.Context) (*sarama.ConsumerMessage, error) {
+	select {
+	case m, ok := <-s.c.Messages():
+		if !ok {
+			// the claim ended , usually because of a rebalance.
+			return nil, io.EOF
+		}
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s claim) Pause() {
+	s.group.Pause(map[string][]int32{s.c.Topic(): {s.c.Partition()}})
+}
+
+func (s claim) Resume() {
+	s.group.Resume(map[string][]int32{s.c.Topic(): {s.c.Partition()}})
+}
+
+// handler consumes every claim of a session through l.
+type handler struct {
+	group sarama.ConsumerGroup
+	l     *limiter.Limiter
+}
+
+func (h handler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h handler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h handler) ConsumeClaim(session sarama.ConsumerGroupSession, c sarama.ConsumerGroupClaim) error {
+	cons := consumer.New(h.l, claim{h.group, c}, consumer.ProcessFunc[*sarama.ConsumerMessage](func(ctx context.Context, m *sarama.ConsumerMessage) error {
+		log.Printf("partition %d offset %d: %s", m.Partition, m.Offset, m.Value)
+		session.MarkMessage(m, "")
+		return nil
+	}), consumer.WithPauseThreshold(32))
+	if err := cons.Run(session.Context()); err != nil && err != io.EOF && session.Context().Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_8_0_0
+	group, err := sarama.NewConsumerGroup([]string{"localhost:9092"}, "example", config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer group.Close()
+
+	h := handler{group: group, l: limiter.New(16)}
+	for ctx.Err() == nil {
+		if err := group.Consume(ctx, []string{"events"}, h); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package limiter
+
+import "time"
+
+// LimitController drives the limit of a Limiter from outside of the package , for example an autoscaler or a
+// congestion control algorithm. See WithLimitController.
+type LimitController interface {
+	// OnSample is called periodically with the number of goroutines accessing the resource , the number of
+	// goroutines in the waitlist and the estimated time a goroutine holds its slot , and returns the new limit.
+	// A limit that is not positive leaves the limit unchanged. The latency is the mean latency of the outcomes
+	// recorded with Permit.Record since the last sample. Without outcomes , it is derived from the rate at which
+	// slots are given back (Little's law) , and zero until two slots have been given back.
+	OnSample(inflight, queueLen int, latency time.Duration) int
+}
+
+// LimitControllerFunc adapts a func to a LimitController.
+type LimitControllerFunc func(inflight, queueLen int, latency time.Duration) int
+
+// OnSample calls f.
+func (f LimitControllerFunc) OnSample(inflight, queueLen int, latency time.Duration) int {
+	return f(inflight, queueLen, latency)
+}
+
+// control samples the Limiter every period and applies the limit returned by the controller , until the Limiter
+// is closed.
+func (l *Limiter) control() {
+	c := l.config()
+	ticker := c.clock.NewTicker(c.controlPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-l.stop:
+			return
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return
+		}
+		inflight, queueLen := l.InFlight(), l.waitList.Len()
+		r := l.takeResults()
+		l.mu.Unlock()
+		latency, _ := l.serviceRate.Estimate(inflight)
+		if r.count > 0 {
+			latency = r.latency / time.Duration(r.count)
+		}
+
+		limit := c.controller.OnSample(inflight, queueLen, latency)
+		if limit > 0 {
+			l.SetLimit(limit)
+		}
+	}
+}
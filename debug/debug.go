@@ -0,0 +1,171 @@
+// Package debug renders the live state of the limiters of a registry as an HTML page , to diagnose stalls in
+// production from a browser: the limit , the goroutines accessing the resource , the goroutines in the waitlist with
+// their priority and how long they have been waiting , and the recent events of the limiters recording them.
+//
+// Mount the handler like net/http/pprof:
+//
+//	http.Handle("/debug/limiter/", http.StripPrefix("/debug/limiter", debug.Handler(reg)))
+//
+// The page of every registered limiter is served at the mount point , and the page of a single limiter under its
+// name.
+package debug
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+// maxEvents bounds the number of events rendered per limiter.
+const maxEvents = 50
+
+// StateProvider is implemented by limiters that can dump their state , see limiter.State.
+type StateProvider interface {
+	State() limiter.State
+}
+
+// EventSource is implemented by limiters recording their recent events.
+type EventSource interface {
+	RecentEvents() []limiter.Event
+}
+
+// Handler serves the debug page of the limiters registered in reg. Mount it with http.StripPrefix to serve it
+// under a prefix.
+func Handler(reg *registry.Registry) http.Handler {
+	return &handler{reg: reg}
+}
+
+type handler struct {
+	reg *registry.Registry
+}
+
+// page is the data of the template.
+type page struct {
+	Time     time.Time
+	Limiters []limiterPage
+}
+
+// limiterPage describes one limiter. State is nil for limiters that cannot dump their state , which are described
+// by their Stats only.
+type limiterPage struct {
+	Name   string
+	Stats  limiter.Stats
+	State  *limiter.State
+	Events []limiter.Event
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names := h.reg.Names()
+	if name := strings.Trim(r.URL.Path, "/"); name != "" {
+		if _, ok := h.reg.Get(name); !ok {
+			http.Error(w, "no limiter registered under "+name, http.StatusNotFound)
+			return
+		}
+		names = []string{name}
+	}
+	p := page{Time: time.Now()}
+	for _, name := range names {
+		l, ok := h.reg.Get(name)
+		if !ok {
+			// unregistered since the names were listed.
+			continue
+		}
+		p.Limiters = append(p.Limiters, describe(name, l))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.Execute(w, p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// describe returns the description of l , registered under name.
+func describe(name string, l registry.StatsProvider) limiterPage {
+	lp := limiterPage{Name: name}
+	if s, ok := l.(StateProvider); ok {
+		st := s.State()
+		lp.State = &st
+	} else {
+		lp.Stats = l.Stats()
+	}
+	if s, ok := l.(EventSource); ok {
+		events := s.RecentEvents()
+		if len(events) > maxEvents {
+			events = events[len(events)-maxEvents:]
+		}
+		// newest first , the most relevant when diagnosing a stall.
+		lp.Events = slices.Clone(events)
+		slices.Reverse(lp.Events)
+	}
+	return lp
+}
+
+var tmpl = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"seconds": func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second)).Round(time.Microsecond)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>limiters</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<p>{{.Time.Format "2006-01-02T15:04:05.000Z07:00"}}</p>
+{{range .Limiters}}
+<h2 id="{{.Name}}"><a href="{{.Name}}">{{.Name}}</a></h2>
+{{with .State}}
+<table>
+<tr><th>kind</th><td>{{.Kind}}</td></tr>
+<tr><th>limit</th><td>{{.Limit}}{{if .Paused}} (paused){{end}}</td></tr>
+<tr><th>in flight</th><td>{{.InFlight}}</td></tr>
+<tr><th>waiting</th><td>{{.Waiting}}</td></tr>
+<tr><th>oldest wait</th><td>{{seconds .OldestWaitSeconds}}</td></tr>
+<tr><th>wait p50/p95/p99</th><td>{{seconds .WaitP50Seconds}} / {{seconds .WaitP95Seconds}} / {{seconds .WaitP99Seconds}}</td></tr>
+<tr><th>shed</th><td>{{.Shed}}</td></tr>
+<tr><th>reclaimed</th><td>{{.Reclaimed}}</td></tr>
+{{if .Circuit}}<tr><th>circuit</th><td>{{.Circuit}}</td></tr>{{end}}
+{{if .Profile}}<tr><th>profile</th><td>{{.Profile}}</td></tr>{{end}}
+</table>
+{{if .Waiters}}
+<table>
+<tr><th>#</th><th>priority</th><th>flow</th><th>waited</th></tr>
+{{range $i, $w := .Waiters}}<tr><td>{{$i}}</td><td>{{with $w.Priority}}{{.}}{{end}}</td><td>{{$w.Flow}}</td><td>{{seconds $w.WaitedSeconds}}</td></tr>
+{{end}}</table>
+{{else}}<p>no goroutine waiting</p>
+{{end}}
+{{else}}
+<table>
+<tr><th>limit</th><td>{{.Stats.Limit}}{{if .Stats.Paused}} (paused){{end}}</td></tr>
+<tr><th>in flight</th><td>{{.Stats.InFlight}}</td></tr>
+<tr><th>waiting</th><td>{{.Stats.Waiting}}</td></tr>
+<tr><th>oldest wait</th><td>{{.Stats.OldestWait}}</td></tr>
+<tr><th>wait p50/p95/p99</th><td>{{.Stats.WaitP50}} / {{.Stats.WaitP95}} / {{.Stats.WaitP99}}</td></tr>
+</table>
+{{end}}
+{{if .Events}}
+<table>
+<tr><th>time</th><th>event</th><th>priority</th><th>waited</th><th>limit</th><th>error</th></tr>
+{{range .Events}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Kind}}</td><td>{{with .Priority}}{{.}}{{end}}</td><td>{{if .Wait}}{{.Wait}}{{end}}</td><td>{{.Limit}}</td><td>{{with .Err}}{{.}}{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}
+<p>no limiter registered</p>
+{{end}}
+</body>
+</html>
+`))
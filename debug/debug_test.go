@@ -0,0 +1,77 @@
+package debug
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+// recording is a limiter reporting a fixed list of events.
+type recording struct {
+	*limiter.Limiter
+	events []limiter.Event
+}
+
+func (r recording) RecentEvents() []limiter.Event {
+	return r.events
+}
+
+func get(h http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	reg := registry.New()
+	api := priority.NewLimiter(1)
+	reg.Register("api", api)
+	high := 7
+	reg.Register("db", recording{
+		Limiter: limiter.New(3),
+		events: []limiter.Event{
+			{Time: time.Now(), Kind: limiter.EventLimitChange, Limit: 3},
+			{Time: time.Now(), Kind: limiter.EventShed, Priority: &high, Err: limiter.ErrQueueFull},
+		},
+	})
+	h := Handler(reg)
+
+	ctx := context.Background()
+	assert.NoError(t, api.Wait(ctx, priority.Low))
+	go api.Wait(ctx, priority.High)
+	for api.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	defer func() {
+		api.Finish()
+		api.Finish()
+	}()
+
+	code, body := get(h, "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<h2 id="api">`)
+	assert.Contains(t, body, `<h2 id="db">`)
+	assert.Contains(t, body, "<tr><th>kind</th><td>priority</td></tr>")
+	assert.Contains(t, body, "<tr><th>waiting</th><td>1</td></tr>")
+	assert.Contains(t, body, "<td>0</td><td>4</td><td></td>")
+	assert.Contains(t, body, "<td>shed</td><td>7</td>")
+	assert.Contains(t, body, limiter.ErrQueueFull.Error())
+	// newest first.
+	assert.Less(t, strings.Index(body, "<td>shed</td>"), strings.Index(body, "<td>limit change</td>"))
+
+	code, body = get(h, "/db")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, `<h2 id="api">`)
+	assert.Contains(t, body, "no goroutine waiting")
+
+	code, _ = get(h, "/cache")
+	assert.Equal(t, http.StatusNotFound, code)
+}
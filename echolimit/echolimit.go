@@ -0,0 +1,69 @@
+// Package echolimit adapts the HTTP middleware of httplimit to Echo. Requests wait for a slot before reaching the
+// next handlers , and the ones that fail to get one are answered with the status and Retry-After header of the
+// net/http middleware , through the HTTP error handler of Echo:
+//
+//	nl := priority.NewLimiter(100)
+//	m := httplimit.New(nl , httplimit.WithRoutes(routes))
+//	e := echo.New()
+//	e.Use(echolimit.New(m))
+package echolimit
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Limiter admits the requests of an Echo server through a httplimit.Middleware.
+//
+// priority: computes the priority a request waits with when its route does not set one
+type Limiter struct {
+	m        *httplimit.Middleware
+	priority func(c echo.Context) priority.PriorityValue
+}
+
+type Option func(*Limiter)
+
+// New returns an echo.MiddlewareFunc admitting requests through m , with the routes , timeouts and priorities of m.
+func New(m *httplimit.Middleware, options ...Option) echo.MiddlewareFunc {
+	l := &Limiter{
+		m: m,
+		priority: func(c echo.Context) priority.PriorityValue {
+			return m.Priority(c.Request())
+		},
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l.handle
+}
+
+// priority: If this field is specified , computes the priority a request waits with from the echo.Context , for
+// example from a value set by an authentication middleware , instead of the func of httplimit.WithPriority. A
+// priority set by the route of the request still wins.
+func WithPriority(fn func(c echo.Context) priority.PriorityValue) func(*Limiter) {
+	return func(l *Limiter) {
+		l.priority = fn
+	}
+}
+
+// handle returns a handler waiting for a slot , calling next and giving the slot back , or returning an
+// *echo.HTTPError with the status of the rejection.
+func (l *Limiter) handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		release, rej := l.m.Admit(c.Request(), l.priority(c))
+		if rej != nil {
+			if rej.Status == 0 {
+				// the client went away.
+				return nil
+			}
+			if rej.RetryAfter != "" {
+				c.Response().Header().Set("Retry-After", rej.RetryAfter)
+			}
+			return echo.NewHTTPError(rej.Status).SetInternal(rej.Err)
+		}
+		defer release()
+		return next(c)
+	}
+}
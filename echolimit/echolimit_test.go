@@ -0,0 +1,70 @@
+package echolimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func serve(e *echo.Echo, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestLimiter_Rejects(t *testing.T) {
+	f := limitertest.NewPriority()
+	e := echo.New()
+	e.Use(New(httplimit.New(f)))
+	handled := 0
+	e.GET("/", func(c echo.Context) error {
+		handled++
+		return c.String(http.StatusOK, "ok")
+	})
+
+	assert.Equal(t, http.StatusOK, serve(e, "/").Code)
+	f.Script(&limiter.RetryAfterError{Err: limiter.ErrShed, After: 2 * time.Second}, limiter.ErrClosed)
+	rec := serve(e, "/")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(e, "/").Code)
+	// the handlers after the limiter do not run for rejected requests.
+	assert.Equal(t, 1, handled)
+	f.AssertBalanced(t)
+}
+
+func TestLimiter_Priority(t *testing.T) {
+	f := limitertest.NewPriority()
+	m := httplimit.New(f, httplimit.WithRoutes(map[string]httplimit.Route{
+		"/admin": {Priority: priority.MediumHigh},
+	}))
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("batch", c.QueryParam("batch") != "")
+			return next(c)
+		}
+	})
+	e.Use(New(m, WithPriority(func(c echo.Context) priority.PriorityValue {
+		if c.Get("batch").(bool) {
+			return priority.Low
+		}
+		return priority.High
+	})))
+	e.GET("/*", func(c echo.Context) error { return nil })
+
+	serve(e, "/?batch=1")
+	serve(e, "/")
+	serve(e, "/admin?batch=1")
+	assert.Equal(t, []priority.PriorityValue{priority.Low, priority.High, priority.MediumHigh}, f.Priorities())
+	f.AssertBalanced(t)
+}
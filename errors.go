@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrQueueFull is returned by Wait when the waitlist has reached the length configured
+	// with WithMaxQueueLength.
+	ErrQueueFull = errors.New("limiter: waitlist is full")
+	// ErrDropped is returned by Wait when the goroutine was removed from the waitlist to make room
+	// for another goroutine. See RejectionPolicy.
+	ErrDropped = errors.New("limiter: dropped from the waitlist")
+	// ErrShed is returned by Wait , wrapped in a *RetryAfterError , when the goroutine was shed by the CoDel
+	// queue management configured with WithCoDel.
+	ErrShed = errors.New("limiter: shed by queue management")
+	// ErrRejectedEarly is returned by Wait when the goroutine was rejected at random by the Random Early Detection
+	// configured with WithRandomEarlyDetection.
+	ErrRejectedEarly = errors.New("limiter: rejected early by random early detection")
+	// ErrPurged is returned by Wait when the waitlist was purged with Purge.
+	ErrPurged = errors.New("limiter: purged from the waitlist")
+	// ErrClosed is returned by Wait when the limiter has been closed with Close.
+	ErrClosed = errors.New("limiter: closed")
+	// ErrTimeout is returned by Wait when the goroutine was removed from the waitlist after the timeout
+	// and the RejectOnTimeout policy is configured.
+	ErrTimeout = errors.New("limiter: timed out in the waitlist")
+	// ErrWaitExceedsDeadline is returned by Wait when WithDeadlineAwareRejection is configured and the
+	// estimated wait in the waitlist exceeds the time remaining until the deadline of the context.
+	ErrWaitExceedsDeadline = errors.New("limiter: estimated wait exceeds the context deadline")
+	// ErrCanceled is returned by Wait , together with the cause of the cancellation (see context.Cause) , when the
+	// context is done while the goroutine is waiting. Both match with errors.Is:
+	//
+	//	errors.Is(err, limiter.ErrCanceled) && errors.Is(err, context.DeadlineExceeded)
+	ErrCanceled = errors.New("limiter: context done while waiting")
+	// ErrReclaimed is returned by the methods of a permit whose slot has been reclaimed because its lease was not
+	// renewed in time. See WithPermitTTL.
+	ErrReclaimed = errors.New("limiter: permit reclaimed")
+	// ErrCancelledByLimiter is returned by Wait when the goroutine was removed from the waitlist with the Cancel
+	// method of the limiter , for example by admin tooling or a deduplication layer deciding the request is obsolete.
+	ErrCancelledByLimiter = errors.New("limiter: cancelled in the waitlist")
+	// ErrCircuitOpen is returned by Wait , wrapped in a *RetryAfterError , while the circuit breaker configured with
+	// WithCircuitBreaker is open.
+	ErrCircuitOpen = errors.New("limiter: circuit open")
+	// ErrInvalidConfig is returned , wrapped with a description of the problem , by the constructors
+	// validating the configuration such as NewWithValidation.
+	ErrInvalidConfig = errors.New("limiter: invalid configuration")
+)
+
+// canceled returns the error of a goroutine whose context is done while it waits.
+func canceled(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrCanceled, context.Cause(ctx))
+}
+
+// Canceled returns the error limiters return from Wait when ctx is done while the goroutine waits. It matches
+// both ErrCanceled and context.Cause(ctx) with errors.Is. It is meant for limiters implemented in other packages.
+func Canceled(ctx context.Context) error {
+	return canceled(ctx)
+}
@@ -0,0 +1,332 @@
+// Package etcdlimiter implements a limiter whose limit is shared by every process using the same etcd cluster
+// and key prefix.
+//
+// Every goroutine calling Wait registers a waiter key under prefix/waiters/ , ordered by priority and then by
+// arrival. The goroutines ranked within the number of free slots claim a slot key under prefix/slots/ in a
+// transaction , so the limit holds across processes and goroutines are admitted in priority order. All keys are
+// attached to the lease of an etcd session: when a process dies or loses its connection , the lease expires
+// and the slots it held are recovered automatically.
+//
+// The package is a separate module , so the core limiters don't depend on the etcd client.
+package etcdlimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// ErrSessionDone is returned by Wait when the etcd session of the Limiter has expired or has been closed. The
+// slots held through the session have been recovered by etcd.
+var ErrSessionDone = errors.New("etcdlimiter: session done")
+
+var _ priority.Waiter = (*Limiter)(nil)
+
+// Limiter is a limiter shared through etcd. All the Limiters using the same prefix must be configured with the
+// same limit.
+//
+// client: etcd client the keys are read and written with
+//
+// prefix: key prefix shared by the Limiters
+//
+// limit: max number of concurrent goroutines , across all processes , that can access a resource
+//
+// ttl: TTL of the session lease , the time after which the slots of a dead process are recovered
+//
+// session: session the keys are attached to , closed by Close if it was created by New
+//
+// permitTTL , onReclaim: TTL of the leases of the permits and the func called when a permit is reclaimed
+//
+// held: keys of the slots held by the goroutines of this process that called Wait
+type Limiter struct {
+	client      *clientv3.Client
+	prefix      string
+	limit       int
+	ttl         time.Duration
+	session     *concurrency.Session
+	ownSession  bool
+	permitTTL   time.Duration
+	onReclaim   func()
+	seq         uint64
+	mu          sync.Mutex
+	held        []string
+	closed      bool
+	closeOnce   sync.Once
+	closeResult error
+}
+
+type Option func(*Limiter)
+
+// ttl: TTL of the lease the keys of the Limiter are attached to , rounded up to whole seconds. The slots held by a
+// process that dies or loses its connection to etcd are recovered after the TTL. Defaults to 60s.
+func WithTTL(ttl time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.ttl = ttl
+	}
+}
+
+// session: If this field is specified , the keys of the Limiter are attached to the lease of session instead of
+// the lease of a new session. The session is not closed by Close.
+func WithSession(session *concurrency.Session) func(*Limiter) {
+	return func(l *Limiter) {
+		l.session = session
+	}
+}
+
+// New creates an instance of *Limiter sharing limit with the Limiters using the same prefix , and creates the
+// etcd session its keys are attached to unless WithSession is used. It returns an error wrapping
+// limiter.ErrInvalidConfig if the limit is not positive , the prefix is empty or the TTL is negative.
+func New(client *clientv3.Client, prefix string, limit int, options ...Option) (*Limiter, error) {
+	l := &Limiter{
+		client: client,
+		prefix: strings.TrimRight(prefix, "/"),
+		limit:  limit,
+		ttl:    60 * time.Second,
+	}
+	for _, o := range options {
+		o(l)
+	}
+	switch {
+	case l.limit <= 0:
+		return nil, fmt.Errorf("%w: limit must be positive , got %d", limiter.ErrInvalidConfig, l.limit)
+	case l.prefix == "":
+		return nil, fmt.Errorf("%w: prefix must not be empty", limiter.ErrInvalidConfig)
+	case l.ttl < 0:
+		return nil, fmt.Errorf("%w: TTL must not be negative , got %v", limiter.ErrInvalidConfig, l.ttl)
+	case l.permitTTL < 0:
+		return nil, fmt.Errorf("%w: permit TTL must not be negative , got %v", limiter.ErrInvalidConfig, l.permitTTL)
+	}
+	if l.session == nil {
+		ttl := int((l.ttl + time.Second - 1) / time.Second)
+		session, err := concurrency.NewSession(client, concurrency.WithTTL(ttl))
+		if err != nil {
+			return nil, err
+		}
+		l.session, l.ownSession = session, true
+	}
+	return l, nil
+}
+
+// Wait waits until one of the limit slots shared through etcd is free and no waiter with a higher priority ,
+// or with the same priority and an earlier arrival , is queued , in any process. It returns limiter.ErrClosed if the
+// Limiter is closed , ErrSessionDone if its session is done and an error matching limiter.ErrCanceled if ctx is
+// done while the goroutine waits. Errors of the etcd client are returned as is. Only a nil error grants access
+// to the resource.
+func (l *Limiter) Wait(ctx context.Context, p priority.PriorityValue) error {
+	key, err := l.enqueue(ctx, p)
+	if err != nil {
+		return err
+	}
+	slot, _, err := l.acquire(ctx, key, l.session.Lease())
+	if err != nil {
+		return l.waitErr(ctx, err)
+	}
+	l.mu.Lock()
+	l.held = append(l.held, slot)
+	l.mu.Unlock()
+	return nil
+}
+
+// enqueue registers a waiter key with the priority p.
+func (l *Limiter) enqueue(ctx context.Context, p priority.PriorityValue) (string, error) {
+	l.mu.Lock()
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		return "", limiter.ErrClosed
+	}
+	key := fmt.Sprintf("%s/waiters/%s/%x-%d", l.prefix, priorityKey(p), int64(l.session.Lease()), atomic.AddUint64(&l.seq, 1))
+	if _, err := l.client.Put(ctx, key, "", clientv3.WithLease(l.session.Lease())); err != nil {
+		return "", l.waitErr(ctx, err)
+	}
+	return key, nil
+}
+
+// waitErr returns the error of Wait for an error of the etcd client.
+func (l *Limiter) waitErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return limiter.Canceled(ctx)
+	}
+	return err
+}
+
+// acquire claims a slot attached to lease for the waiter key once it ranks within the free slots. It returns the
+// slot key and the revision it was created at. The waiter key is deleted in any case.
+func (l *Limiter) acquire(ctx context.Context, key string, lease clientv3.LeaseID) (string, int64, error) {
+	for {
+		slot, rev, err := l.tryAcquire(ctx, key, lease)
+		if err != nil {
+			// the waiter key is removed with the session if the deletion fails.
+			l.client.Delete(l.client.Ctx(), key)
+			return "", 0, err
+		}
+		if slot != "" {
+			return slot, rev, nil
+		}
+		if err := l.waitDelete(ctx, rev+1); err != nil {
+			l.client.Delete(l.client.Ctx(), key)
+			return "", 0, err
+		}
+	}
+}
+
+// tryAcquire claims a slot if the waiter key ranks within the free slots. Otherwise it returns an empty slot key
+// and the revision the ranking was computed at.
+func (l *Limiter) tryAcquire(ctx context.Context, key string, lease clientv3.LeaseID) (string, int64, error) {
+	for {
+		select {
+		case <-l.session.Done():
+			return "", 0, ErrSessionDone
+		default:
+		}
+		resp, err := l.client.Get(ctx, l.prefix+"/", clientv3.WithPrefix())
+		if err != nil {
+			return "", 0, err
+		}
+		rank, free, ok := l.rank(resp.Kvs, key)
+		if !ok {
+			// the lease expired and etcd removed the waiter key.
+			return "", 0, ErrSessionDone
+		}
+		if rank >= len(free) {
+			return "", resp.Header.Revision, nil
+		}
+		slot := l.slotKey(free[rank])
+		txn, err := l.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(slot), "=", 0),
+				clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+			Then(clientv3.OpPut(slot, key, clientv3.WithLease(lease)),
+				clientv3.OpDelete(key)).
+			Commit()
+		if err != nil {
+			return "", 0, err
+		}
+		if txn.Succeeded {
+			return slot, txn.Header.Revision, nil
+		}
+	}
+}
+
+// waitDelete waits until a key under the prefix is deleted at or after rev: only deletions free slots or move
+// waiters up.
+func (l *Limiter) waitDelete(ctx context.Context, rev int64) error {
+	wctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	wch := l.client.Watch(wctx, l.prefix+"/", clientv3.WithPrefix(), clientv3.WithRev(rev), clientv3.WithFilterPut())
+	for {
+		select {
+		case wr, ok := <-wch:
+			if !ok {
+				return ctx.Err()
+			}
+			if err := wr.Err(); err != nil {
+				return err
+			}
+			if len(wr.Events) > 0 {
+				return nil
+			}
+		case <-l.session.Done():
+			return ErrSessionDone
+		}
+	}
+}
+
+// rank returns the rank of the waiter key among the queued waiters and the free slot numbers , or false if key
+// is not queued.
+func (l *Limiter) rank(kvs []*mvccpb.KeyValue, key string) (int, []int, bool) {
+	type queued struct {
+		key string
+		rev int64
+	}
+	var waiters []queued
+	occupied := make(map[int]bool)
+	slots, queue := l.prefix+"/slots/", l.prefix+"/waiters/"
+	for _, kv := range kvs {
+		k := string(kv.Key)
+		switch {
+		case strings.HasPrefix(k, slots):
+			if n, err := strconv.Atoi(strings.TrimPrefix(k, slots)); err == nil {
+				occupied[n] = true
+			}
+		case strings.HasPrefix(k, queue):
+			waiters = append(waiters, queued{key: k, rev: kv.CreateRevision})
+		}
+	}
+	// the priority segment sorts the higher priorities first , the create revision keeps the arrival order.
+	sort.Slice(waiters, func(i, j int) bool {
+		pi, pj := waiters[i].key[len(queue):len(queue)+16], waiters[j].key[len(queue):len(queue)+16]
+		if pi != pj {
+			return pi < pj
+		}
+		return waiters[i].rev < waiters[j].rev
+	})
+	rank := -1
+	for i, w := range waiters {
+		if w.key == key {
+			rank = i
+			break
+		}
+	}
+	var free []int
+	for n := 0; n < l.limit; n++ {
+		if !occupied[n] {
+			free = append(free, n)
+		}
+	}
+	return rank, free, rank >= 0
+}
+
+// priorityKey encodes p so that higher priorities sort first.
+func priorityKey(p priority.PriorityValue) string {
+	return fmt.Sprintf("%016x", ^(uint64(int64(p)) ^ 1<<63))
+}
+
+func (l *Limiter) slotKey(n int) string {
+	return l.prefix + "/slots/" + strconv.Itoa(n)
+}
+
+// Finish gives back a slot held by a goroutine of this process. If the slot cannot be deleted , it is recovered
+// when the session ends.
+func (l *Limiter) Finish() {
+	l.mu.Lock()
+	if len(l.held) == 0 {
+		l.mu.Unlock()
+		return
+	}
+	slot := l.held[len(l.held)-1]
+	l.held = l.held[:len(l.held)-1]
+	l.mu.Unlock()
+	l.client.Delete(l.client.Ctx(), slot)
+}
+
+// FinishPriority gives back a slot like Finish. Slots are not tied to priorities in etcd.
+func (l *Limiter) FinishPriority(priority.PriorityValue) {
+	l.Finish()
+}
+
+// Close stops admitting goroutines and , if the session was created by New , closes it: its lease is revoked , so
+// the waiter and slot keys of this process are deleted at once.
+func (l *Limiter) Close() error {
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		l.closed = true
+		l.held = nil
+		l.mu.Unlock()
+		if l.ownSession {
+			l.closeResult = l.session.Close()
+		}
+	})
+	return l.closeResult
+}
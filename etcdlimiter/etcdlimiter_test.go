@@ -0,0 +1,194 @@
+package etcdlimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var prefixes uint64
+
+// newClient connects to the etcd cluster listed in ETCD_ENDPOINTS and returns a prefix no other test uses. The
+// test is skipped if ETCD_ENDPOINTS is not set.
+func newClient(t *testing.T) (*clientv3.Client, string) {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS is not set")
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	prefix := fmt.Sprintf("/etcdlimiter-test/%d/%d", time.Now().UnixNano(), atomic.AddUint64(&prefixes, 1))
+	return client, prefix
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		_, err := New(nil, "/p", limit)
+		assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	}
+	_, err := New(nil, "", 1)
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityKey(t *testing.T) {
+	values := []priority.PriorityValue{100, priority.High, priority.Low, 0, -1, -100}
+	for i := 1; i < len(values); i++ {
+		assert.True(t, priorityKey(values[i-1]) < priorityKey(values[i]), "%d before %d", values[i-1], values[i])
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	client, prefix := newClient(t)
+	a, err := New(client, prefix, 2, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := New(client, prefix, 2, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer b.Close()
+	ctx := context.Background()
+
+	assert.NoError(t, a.Wait(ctx, priority.Low))
+	assert.NoError(t, b.Wait(ctx, priority.Low))
+
+	admitted := make(chan priority.PriorityValue, 2)
+	for _, p := range []priority.PriorityValue{priority.Low, priority.High} {
+		go func(p priority.PriorityValue) {
+			if a.Wait(ctx, p) == nil {
+				admitted <- p
+			}
+		}(p)
+		time.Sleep(100 * time.Millisecond)
+	}
+	select {
+	case <-admitted:
+		t.Fatal("admitted above the limit")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the limit is shared: a slot released by b goes to the highest priority waiter of a.
+	b.Finish()
+	assert.Equal(t, priority.High, <-admitted)
+	a.Finish()
+	assert.Equal(t, priority.Low, <-admitted)
+	a.Finish()
+	a.Finish()
+}
+
+func TestLimiter_ContextDone(t *testing.T) {
+	client, prefix := newClient(t)
+	l, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer l.Close()
+	assert.NoError(t, l.Wait(context.Background(), priority.Low))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = l.Wait(ctx, priority.High)
+	assert.True(t, errors.Is(err, limiter.ErrCanceled))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	resp, err := client.Get(context.Background(), prefix+"/waiters/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	assert.NoError(t, err)
+	assert.Zero(t, resp.Count)
+	l.Finish()
+}
+
+func TestLimiter_SessionRecovery(t *testing.T) {
+	client, prefix := newClient(t)
+	dead, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	l, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer l.Close()
+	ctx := context.Background()
+	assert.NoError(t, dead.Wait(ctx, priority.Low))
+
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx, priority.Low)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// the slot of a process whose session ends without calling Finish is recovered.
+	dead.Close()
+	assert.NoError(t, <-errs)
+	assert.Equal(t, limiter.ErrClosed, dead.Wait(ctx, priority.Low))
+	l.Finish()
+}
+
+func TestAtPriority(t *testing.T) {
+	client, prefix := newClient(t)
+	l, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer l.Close()
+	w := priority.AtPriority(l, priority.High)
+	assert.NoError(t, w.Wait(context.Background()))
+	w.Finish()
+	assert.NoError(t, w.Wait(context.Background()))
+	w.Finish()
+}
+
+func TestPermit_TTL(t *testing.T) {
+	client, prefix := newClient(t)
+	reclaimed := make(chan struct{}, 1)
+	l, err := New(client, prefix, 1,
+		WithTTL(5*time.Second),
+		WithPermitTTL(time.Second, func() { reclaimed <- struct{}{} }),
+	)
+	assert.NoError(t, err)
+	defer l.Close()
+	ctx := context.Background()
+
+	alive, err := l.Acquire(ctx, priority.Low)
+	assert.NoError(t, err)
+	assert.NoError(t, alive.KeepAlive(ctx))
+	time.Sleep(3 * time.Second)
+	assert.NoError(t, alive.Renew(ctx))
+	alive.Release()
+
+	// a holder that never renews its lease loses the slot to the next waiter.
+	hung, err := l.Acquire(ctx, priority.Low)
+	assert.NoError(t, err)
+	wctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	assert.NoError(t, l.Wait(wctx, priority.High))
+	<-reclaimed
+	assert.Equal(t, limiter.ErrReclaimed, hung.Renew(ctx))
+	hung.Release()
+	l.Finish()
+}
+
+func TestPermit_Token(t *testing.T) {
+	client, prefix := newClient(t)
+	a, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := New(client, prefix, 1, WithTTL(5*time.Second))
+	assert.NoError(t, err)
+	defer b.Close()
+	ctx := context.Background()
+
+	// tokens increase across the Limiters sharing the prefix.
+	first, err := a.Acquire(ctx, priority.Low)
+	assert.NoError(t, err)
+	first.Release()
+	second, err := b.Acquire(ctx, priority.Low)
+	assert.NoError(t, err)
+	assert.True(t, first.Token() < second.Token())
+	second.Release()
+}
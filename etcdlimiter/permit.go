@@ -0,0 +1,160 @@
+package etcdlimiter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// states of a Permit.
+const (
+	permitHeld int32 = iota
+	permitReleased
+	permitReclaimed
+)
+
+// Permit is a slot of a Limiter acquired with Acquire. The slot is held until Release is called or the Limiter's
+// session ends. If WithPermitTTL is configured , the slot is attached to a lease of its own that must be renewed
+// with KeepAlive , otherwise etcd deletes the slot key once the lease expires and the slot is reclaimed.
+type Permit struct {
+	l      *Limiter
+	slot   string
+	token  uint64
+	lease  clientv3.LeaseID
+	state  int32
+	cancel context.CancelFunc
+}
+
+// permitTTL , onReclaim: If these fields are specified , every Permit acquired with Acquire attaches its slot to a
+// lease of its own with a TTL of permitTTL , rounded up to whole seconds. The holder must renew it with
+// Permit.KeepAlive or Permit.Renew , otherwise etcd reclaims the slot when the lease expires and onReclaim , if not
+// nil , is called. This protects the Limiters against hung holders that never give their slot back , even if
+// the session of their process stays alive. Slots acquired with Wait are not affected.
+func WithPermitTTL(permitTTL time.Duration, onReclaim func()) func(*Limiter) {
+	return func(l *Limiter) {
+		l.permitTTL = permitTTL
+		l.onReclaim = onReclaim
+	}
+}
+
+// Acquire waits like Wait and returns a Permit holding the slot.
+func (l *Limiter) Acquire(ctx context.Context, p priority.PriorityValue) (*Permit, error) {
+	key, err := l.enqueue(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	pm := &Permit{l: l, lease: l.session.Lease()}
+	if l.permitTTL > 0 {
+		ttl := int64((l.permitTTL + time.Second - 1) / time.Second)
+		grant, err := l.client.Grant(ctx, ttl)
+		if err != nil {
+			l.client.Delete(l.client.Ctx(), key)
+			return nil, l.waitErr(ctx, err)
+		}
+		pm.lease = grant.ID
+	}
+	slot, rev, err := l.acquire(ctx, key, pm.lease)
+	if err != nil {
+		pm.revoke()
+		return nil, l.waitErr(ctx, err)
+	}
+	pm.slot, pm.token = slot, uint64(rev)
+	if l.permitTTL > 0 {
+		wctx, cancel := context.WithCancel(l.client.Ctx())
+		pm.cancel = cancel
+		go pm.watch(wctx, rev+1)
+	}
+	return pm, nil
+}
+
+// watch marks the permit reclaimed when etcd deletes its slot key while it is held.
+func (pm *Permit) watch(ctx context.Context, rev int64) {
+	wch := pm.l.client.Watch(ctx, pm.slot, clientv3.WithRev(rev), clientv3.WithFilterPut())
+	for wr := range wch {
+		if len(wr.Events) == 0 {
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&pm.state, permitHeld, permitReclaimed) && pm.l.onReclaim != nil {
+			pm.l.onReclaim()
+		}
+		return
+	}
+}
+
+// Token returns the fencing token of the permit: the etcd revision its slot was acquired at. Tokens increase
+// monotonically across all the Limiters of the cluster , so the protected resource can reject requests carrying a
+// token lower than the highest it has seen: a holder whose permit was reclaimed , or whose process lost its
+// session , cannot overwrite the work of the holder that got the slot after it.
+func (pm *Permit) Token() uint64 {
+	return pm.token
+}
+
+// Release gives the slot back. Calling Release more than once or after the permit has been reclaimed has no effect.
+func (pm *Permit) Release() {
+	if !atomic.CompareAndSwapInt32(&pm.state, permitHeld, permitReleased) {
+		return
+	}
+	if pm.cancel != nil {
+		pm.cancel()
+	}
+	if !pm.revoke() {
+		pm.l.client.Delete(pm.l.client.Ctx(), pm.slot)
+	}
+}
+
+// revoke revokes the lease of the permit , which deletes its slot key , and reports whether the permit has a lease
+// of its own.
+func (pm *Permit) revoke() bool {
+	if pm.lease == pm.l.session.Lease() {
+		return false
+	}
+	pm.l.client.Revoke(pm.l.client.Ctx(), pm.lease)
+	return true
+}
+
+// Renew extends the lease of the permit by the TTL configured with WithPermitTTL. It returns limiter.ErrReclaimed
+// if the slot has already been reclaimed: the work done under the permit should then stop. Renew has no effect if
+// no TTL is configured or the permit has been released.
+func (pm *Permit) Renew(ctx context.Context) error {
+	switch atomic.LoadInt32(&pm.state) {
+	case permitReclaimed:
+		return limiter.ErrReclaimed
+	case permitReleased:
+		return nil
+	}
+	if pm.lease == pm.l.session.Lease() {
+		return nil
+	}
+	_, err := pm.l.client.KeepAliveOnce(ctx, pm.lease)
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		if atomic.CompareAndSwapInt32(&pm.state, permitHeld, permitReclaimed) && pm.l.onReclaim != nil {
+			pm.l.onReclaim()
+		}
+		return limiter.ErrReclaimed
+	}
+	return err
+}
+
+// KeepAlive renews the lease of the permit in the background until ctx is done or the permit is released. Tie ctx
+// to the liveness of the work: a holder that hangs while ctx stays alive is not detected. KeepAlive returns
+// limiter.ErrReclaimed if the slot has already been reclaimed.
+func (pm *Permit) KeepAlive(ctx context.Context) error {
+	if err := pm.Renew(ctx); err != nil || pm.lease == pm.l.session.Lease() {
+		return err
+	}
+	ch, err := pm.l.client.KeepAlive(ctx, pm.lease)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for range ch {
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,161 @@
+package limiter
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventShed: a goroutine was refused access because of overload , see IsRejection.
+	EventShed EventKind = iota
+	// EventTimeout: a goroutine left the waitlist after its timeout.
+	EventTimeout
+	// EventPromotion: a goroutine in the waitlist was promoted to a higher priority.
+	EventPromotion
+	// EventReclaim: a slot was taken back from its holder , see WithMaxHoldDuration and WithPermitTTL.
+	EventReclaim
+	// EventLimitChange: the limit was changed.
+	EventLimitChange
+)
+
+// String returns the name of the kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventShed:
+		return "shed"
+	case EventTimeout:
+		return "timeout"
+	case EventPromotion:
+		return "promotion"
+	case EventReclaim:
+		return "reclaim"
+	case EventLimitChange:
+		return "limit change"
+	}
+	return "EventKind(unknown)"
+}
+
+// Level returns the level events of the kind are logged at by default: warnings for goroutines turned away and slots
+// reclaimed , which point at overload or leaks , info for limit changes and debug for promotions , which are routine.
+func (k EventKind) Level() slog.Level {
+	switch k {
+	case EventShed, EventTimeout, EventReclaim:
+		return slog.LevelWarn
+	case EventLimitChange:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// Event is something that happened in a limiter , reported to help diagnose why goroutines stall.
+//
+// Time: when the event happened
+//
+// Priority: priority of the goroutine concerned , nil for limiters without priorities and events concerning no
+// goroutine
+//
+// Wait: time the goroutine concerned had spent in the waitlist , if any
+//
+// Limit: limit in effect after the event
+//
+// Err: error returned to the goroutine concerned , if any
+type Event struct {
+	Time     time.Time
+	Kind     EventKind
+	Priority *int
+	Wait     time.Duration
+	Limit    int
+	Err      error
+}
+
+// Log logs e to logger at level , with the message "limiter " followed by the kind and the fields of e as
+// attributes. It is meant for limiters implemented in other packages.
+func (e Event) Log(logger *slog.Logger, level slog.Level) {
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	attrs := make([]slog.Attr, 0, 4)
+	if e.Priority != nil {
+		attrs = append(attrs, slog.Int("priority", *e.Priority))
+	}
+	if e.Wait > 0 {
+		attrs = append(attrs, slog.Duration("wait", e.Wait))
+	}
+	attrs = append(attrs, slog.Int("limit", e.Limit))
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	logger.LogAttrs(ctx, level, "limiter "+e.Kind.String(), attrs...)
+}
+
+// EventBuffer keeps the last events added to it in a ring buffer of fixed size. It is safe for concurrent use.
+type EventBuffer struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// NewEventBuffer creates an *EventBuffer keeping the last size events. size must be positive.
+func NewEventBuffer(size int) *EventBuffer {
+	return &EventBuffer{events: make([]Event, size)}
+}
+
+// Add adds e , overwriting the oldest event if the buffer is full.
+func (b *EventBuffer) Add(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events[b.next] = e
+	b.next++
+	if b.next == len(b.events) {
+		b.next, b.full = 0, true
+	}
+}
+
+// Events returns a copy of the events in the buffer , oldest first.
+func (b *EventBuffer) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return slices.Clone(b.events[:b.next])
+	}
+	return slices.Concat(b.events[b.next:], b.events[:b.next])
+}
+
+// RecentEvents returns the last events of the Limiter , oldest first , or nil unless WithEventHistory is
+// configured.
+func (l *Limiter) RecentEvents() []Event {
+	if l.events == nil {
+		return nil
+	}
+	return l.events.Events()
+}
+
+// emit records an event of the kind for RecentEvents and reports it to the logger configured with WithLogger.
+// wait is the time the goroutine concerned spent in the waitlist , if any , and err the error it got. The mutex
+// must not be held: the handler of the logger may block.
+func (l *Limiter) emit(kind EventKind, wait time.Duration, err error) {
+	c := l.config()
+	if c.logger == nil && l.events == nil {
+		return
+	}
+	e := Event{Time: c.clock.Now(), Kind: kind, Wait: wait, Limit: c.limit, Err: err}
+	if l.events != nil {
+		l.events.Add(e)
+	}
+	if c.logger == nil {
+		return
+	}
+	level, ok := c.levels[kind]
+	if !ok {
+		level = kind.Level()
+	}
+	e.Log(c.logger, level)
+}
@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use by the handler of a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestEventKind_Level(t *testing.T) {
+	assert.Equal(t, slog.LevelWarn, EventShed.Level())
+	assert.Equal(t, slog.LevelWarn, EventTimeout.Level())
+	assert.Equal(t, slog.LevelWarn, EventReclaim.Level())
+	assert.Equal(t, slog.LevelInfo, EventLimitChange.Level())
+	assert.Equal(t, slog.LevelDebug, EventPromotion.Level())
+}
+
+func TestEvent_Log(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	priority := 3
+	Event{Kind: EventTimeout, Priority: &priority, Wait: time.Second, Limit: 2, Err: ErrTimeout}.Log(logger, slog.LevelWarn)
+	out := buf.String()
+	assert.Contains(t, out, `level=WARN msg="limiter timeout" priority=3 wait=1s limit=2 error=`)
+
+	// disabled levels are not logged.
+	Event{Kind: EventPromotion}.Log(logger, slog.LevelDebug)
+	assert.Equal(t, out, buf.String())
+}
+
+func TestConcurrentRateLimiter_Logger(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	l := New(1,
+		WithLogger(logger),
+		WithMaxQueueLength(1),
+		WithTimeoutDuration(10*time.Millisecond),
+		WithTimeoutPolicy(RejectOnTimeout),
+		WithEventLevel(EventLimitChange, slog.LevelDebug),
+	)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, errors.Is(l.Wait(ctx), ErrQueueFull))
+	assert.True(t, errors.Is(<-done, ErrTimeout))
+
+	l.SetLimit(2)
+	// the limit is unchanged , nothing is logged.
+	l.SetLimit(2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Contains(t, lines[0], `level=WARN msg="limiter shed" limit=1 error=`)
+		assert.Contains(t, lines[1], `level=WARN msg="limiter timeout" wait=`)
+		assert.Contains(t, lines[2], `level=DEBUG msg="limiter limit change" limit=2`)
+	}
+}
+
+func TestEventBuffer(t *testing.T) {
+	b := NewEventBuffer(3)
+	assert.Empty(t, b.Events())
+	for limit := 1; limit <= 2; limit++ {
+		b.Add(Event{Limit: limit})
+	}
+	limits := func() []int {
+		var limits []int
+		for _, e := range b.Events() {
+			limits = append(limits, e.Limit)
+		}
+		return limits
+	}
+	assert.Equal(t, []int{1, 2}, limits())
+	for limit := 3; limit <= 7; limit++ {
+		b.Add(Event{Limit: limit})
+	}
+	assert.Equal(t, []int{5, 6, 7}, limits())
+}
+
+func TestConcurrentRateLimiter_RecentEvents(t *testing.T) {
+	assert.Nil(t, New(1).RecentEvents())
+	_, err := NewWithValidation(1, WithEventHistory(-1))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	l := New(1, WithEventHistory(2), WithMaxQueueLength(0))
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	assert.True(t, errors.Is(l.Wait(ctx), ErrQueueFull))
+	l.SetLimit(2)
+	l.SetLimit(3)
+	events := l.RecentEvents()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventLimitChange, events[0].Kind)
+		assert.Equal(t, 2, events[0].Limit)
+		assert.Equal(t, 3, events[1].Limit)
+		assert.False(t, events[0].Time.IsZero())
+	}
+}
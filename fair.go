@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"context"
+)
+
+type flowKey struct{}
+
+// WithFlow returns a copy of ctx tagging the goroutine calling Wait with it as a member of flow , for example a
+// tenant. Flows only matter if fair queuing is configured , see WithFairQueuing and priority.WithFlowWeights.
+func WithFlow(ctx context.Context, flow string) context.Context {
+	return context.WithValue(ctx, flowKey{}, flow)
+}
+
+// FlowFrom returns the flow ctx is tagged with by WithFlow , or the empty flow.
+func FlowFrom(ctx context.Context) string {
+	flow, _ := ctx.Value(flowKey{}).(string)
+	return flow
+}
+
+// fairQueue implements self-clocked weighted fair queuing on the waitlist.
+//
+// Every goroutine entering the waitlist is stamped with a virtual finish time: its flow's previous finish time ,
+// or the current virtual time if the flow is idle , plus the inverse of the flow's weight. Goroutines are removed
+// from the waitlist in the order of their finish times and the virtual time advances to the finish time of the
+// last goroutine removed. A flow with twice the weight of another one is thus served twice as often while both
+// have goroutines waiting , and a flow that has been idle does not accumulate credit.
+//
+// vtime: the virtual time
+//
+// flows: number of queued goroutines and finish time of the last goroutine queued , per flow with queued goroutines
+type fairQueue struct {
+	vtime float64
+	flows map[string]*flowState
+}
+
+type flowState struct {
+	queued int
+	last   float64
+}
+
+// enqueue stamps w , a goroutine of a flow with the given weight , with its finish time. The mutex must be held.
+func (q *fairQueue) enqueue(w *waiter, weight int) {
+	if q.flows == nil {
+		q.flows = make(map[string]*flowState)
+	}
+	f := q.flows[w.flow]
+	if f == nil {
+		f = &flowState{last: q.vtime}
+		q.flows[w.flow] = f
+	}
+	if f.last < q.vtime {
+		f.last = q.vtime
+	}
+	f.last += 1 / float64(weight)
+	f.queued++
+	w.finish = f.last
+}
+
+// leave records that w left the waitlist. If it was served , the virtual time advances to its finish time. The
+// mutex must be held.
+func (q *fairQueue) leave(w *waiter, served bool) {
+	if served && w.finish > q.vtime {
+		q.vtime = w.finish
+	}
+	if f := q.flows[w.flow]; f != nil {
+		if f.queued--; f.queued <= 0 {
+			delete(q.flows, w.flow)
+		}
+	}
+}
+
+// reset forgets every flow after the waitlist has been cleared. The mutex must be held.
+func (q *fairQueue) reset() {
+	q.flows = nil
+}
+
+// next returns the goroutine of the waitlist with the earliest finish time , the oldest one among equals. The
+// mutex must be held.
+func (q *fairQueue) next(waiting *waitList) *waiter {
+	var best *waiter
+	for w := waiting.Front(); w != nil; w = w.next {
+		if best == nil || w.finish < best.finish {
+			best = w
+		}
+	}
+	return best
+}
+
+// weight returns the weight of flow , 1 for flows without a configured weight.
+func (c *config) weight(flow string) int {
+	if w, ok := c.weights[flow]; ok {
+		return w
+	}
+	return 1
+}
+
+// fairPosition returns the position of w in the order of the finish times , or 0 if it is not in the waitlist.
+// The mutex must be held.
+func (l *Limiter) fairPosition(w *waiter) int {
+	pos, found := 1, false
+	for o := l.waitList.Front(); o != nil; o = o.next {
+		if o == w {
+			found = true
+			continue
+		}
+		// among equal finish times , the oldest goroutine goes first.
+		if o.finish < w.finish || (o.finish == w.finish && !found) {
+			pos++
+		}
+	}
+	if !found {
+		return 0
+	}
+	return pos
+}
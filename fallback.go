@@ -0,0 +1,18 @@
+package limiter
+
+import "context"
+
+// Do calls fn while holding a slot of the Limiter , and gives the slot back when fn returns. If the Limiter
+// rejects the goroutine , see IsRejection , Do returns the result of the fallback configured with WithFallback
+// instead , or the rejection if none is configured. Otherwise Do returns the error of fn , or the error of Wait if
+// ctx is done while waiting.
+func (l *Limiter) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := l.Wait(ctx); err != nil {
+		if fallback := l.config().fallback; fallback != nil && IsRejection(err) {
+			return fallback(ctx, err)
+		}
+		return err
+	}
+	defer l.Finish()
+	return fn(ctx)
+}
@@ -0,0 +1,44 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo_Fallback(t *testing.T) {
+	degraded := errors.New("degraded")
+	var reasons []error
+	l := New(1, WithMaxQueueLength(0), WithFallback(func(ctx context.Context, reason error) error {
+		reasons = append(reasons, reason)
+		return degraded
+	}))
+	ctx := context.Background()
+
+	failed := errors.New("failed")
+	err := l.Do(ctx, func(ctx context.Context) error {
+		// the waitlist is full while the slot is held.
+		assert.Equal(t, degraded, l.Do(ctx, func(ctx context.Context) error {
+			t.Fatal("called while rejected")
+			return nil
+		}))
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	assert.Equal(t, []error{ErrQueueFull}, reasons)
+	assert.Equal(t, 0, l.Stats().InFlight)
+
+	// cancellations are not rejections.
+	l = New(1, WithFallback(func(ctx context.Context, reason error) error {
+		t.Fatal("fallback called on cancellation")
+		return nil
+	}))
+	l.Wait(ctx)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = l.Do(cctx, func(context.Context) error { return nil })
+	assert.True(t, errors.Is(err, ErrCanceled))
+}
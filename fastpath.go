@@ -0,0 +1,110 @@
+package limiter
+
+// Layout of Limiter.state. The number of goroutines accessing the resource , the number of goroutines in the
+// waitlist and whether the Limiter is paused or closed share a single word , so the fast path of Wait can take a
+// free slot with one compare and swap that fails if any of them changes concurrently.
+const (
+	countMask  = 1<<32 - 1
+	queuedOne  = 1 << 32
+	queuedMask = 1<<30 - 1
+	pausedBit  = 1 << 62
+	closedBit  = 1 << 63
+)
+
+// InFlight returns the number of goroutines accessing the resource. It reads a single atomic word and never blocks
+// on the Limiter's mutex.
+func (l *Limiter) InFlight() int {
+	return int(l.state.Load() & countMask)
+}
+
+// QueueLen returns the number of goroutines in the waitlist. It reads a single atomic word and never blocks on the
+// Limiter's mutex.
+func (l *Limiter) QueueLen() int {
+	return int(l.state.Load() >> 32 & queuedMask)
+}
+
+// addCount adds delta to the number of goroutines accessing the resource and reports whether it did. The count
+// never drops below zero: a negative delta that would take it below zero is refused , so an unmatched Finish cannot
+// borrow from the other fields.
+func (l *Limiter) addCount(delta int) bool {
+	for {
+		s := l.state.Load()
+		if delta < 0 && int(s&countMask) < -delta {
+			return false
+		}
+		if l.state.CompareAndSwap(s, s+uint64(int64(delta))) {
+			l.version.Add(1)
+			return true
+		}
+	}
+}
+
+// addQueued adds delta to the number of goroutines in the waitlist. The mutex must be held.
+func (l *Limiter) addQueued(delta int) {
+	l.state.Add(uint64(int64(delta) * queuedOne))
+}
+
+// acquireFast takes a free slot without the mutex and reports whether it did. It fails as soon as goroutines are
+// queued , the Limiter is paused or closed or the limit is reached: Wait then takes the slow path under the mutex. Features
+// that decide admission under the mutex , like the circuit breaker , disable the fast path.
+func (l *Limiter) acquireFast(c *config) bool {
+	if c.circuitBreaker != nil {
+		return false
+	}
+	for {
+		s := l.state.Load()
+		if s&^countMask != 0 || (!c.unlimited && int(s&countMask) >= c.limit) {
+			return false
+		}
+		if l.state.CompareAndSwap(s, s+1) {
+			l.version.Add(1)
+			return true
+		}
+	}
+}
+
+// reserve takes a free slot below limit , whether goroutines are queued or not , and reports whether it did. Slots
+// are only given back under the mutex , so a slot reserved by the holder of the mutex cannot be lost to the fast
+// path , which only ever takes slots. The mutex must be held.
+func (l *Limiter) reserve(limit int) bool {
+	for {
+		s := l.state.Load()
+		if int(s&countMask) >= limit {
+			return false
+		}
+		if l.state.CompareAndSwap(s, s+1) {
+			l.version.Add(1)
+			return true
+		}
+	}
+}
+
+// TryWait takes a free slot without waiting and reports whether it did. Unlike Wait with a context that is already
+// done , it never enters the waitlist: a failed TryWait does not apply the rejection policy , drop waiting
+// goroutines , count as shed or emit events , and leaves the Limiter unchanged. A goroutine that got a slot must
+// call Finish once done.
+func (l *Limiter) TryWait() bool {
+	c := l.config()
+	if !l.acquireFast(c) && !l.tryLocked() {
+		return false
+	}
+	l.hold()
+	return true
+}
+
+// tryLocked takes a free slot under the mutex like proceed , without queueing , and reports whether it did.
+func (l *Limiter) tryLocked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	c := l.config()
+	if c.circuitBreaker != nil && l.breaker.check(c.clock.Now()) != nil {
+		return false
+	}
+	if c.unlimited && l.breaker.state != circuitHalfOpen && !l.paused() {
+		return l.addCount(1)
+	}
+	return (!c.strictFIFO || l.waitList.Len() == 0) && l.reserve(l.effectiveLimit(c))
+}
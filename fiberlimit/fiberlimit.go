@@ -0,0 +1,95 @@
+// Package fiberlimit adapts the HTTP middleware of httplimit to Fiber. Fiber does not serve net/http requests , so
+// the route of a request is matched on a *http.Request carrying its method , host , path , query and headers.
+// Requests failing to get a slot are answered with the status and Retry-After header of the net/http middleware ,
+// and the handlers after the limiter never run for them:
+//
+//	nl := priority.NewLimiter(100)
+//	m := httplimit.New(nl , httplimit.WithRoutes(routes))
+//	app := fiber.New()
+//	app.Use(fiberlimit.New(m))
+package fiberlimit
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Limiter admits the requests of a Fiber app through a httplimit.Middleware.
+//
+// priority: computes the priority a request waits with when its route does not set one , nil to use the func of
+// httplimit.WithPriority
+type Limiter struct {
+	m        *httplimit.Middleware
+	priority func(c *fiber.Ctx) priority.PriorityValue
+}
+
+type Option func(*Limiter)
+
+// New returns a fiber.Handler admitting requests through m , with the routes , timeouts and priorities of m.
+func New(m *httplimit.Middleware, options ...Option) fiber.Handler {
+	l := &Limiter{
+		m: m,
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l.handle
+}
+
+// priority: If this field is specified , computes the priority a request waits with from the fiber.Ctx , for
+// example from a local set by an authentication middleware , instead of the func of httplimit.WithPriority. A
+// priority set by the route of the request still wins.
+func WithPriority(fn func(c *fiber.Ctx) priority.PriorityValue) func(*Limiter) {
+	return func(l *Limiter) {
+		l.priority = fn
+	}
+}
+
+// handle waits for a slot , runs the next handlers and gives the slot back , or answers with the status of the
+// rejection.
+func (l *Limiter) handle(c *fiber.Ctx) error {
+	r := request(c)
+	var p priority.PriorityValue
+	if l.priority != nil {
+		p = l.priority(c)
+	} else {
+		p = l.m.Priority(r)
+	}
+	release, rej := l.m.Admit(r, p)
+	if rej != nil {
+		if rej.Status == 0 {
+			// the client went away.
+			return nil
+		}
+		if rej.RetryAfter != "" {
+			c.Set(fiber.HeaderRetryAfter, rej.RetryAfter)
+		}
+		return c.SendStatus(rej.Status)
+	}
+	defer release()
+	return c.Next()
+}
+
+// request returns the *http.Request the routes of the middleware are matched on , waiting with the user context of
+// c.
+func request(c *fiber.Ctx) *http.Request {
+	r := &http.Request{
+		Method: c.Method(),
+		URL: &url.URL{
+			Path:     c.Path(),
+			RawQuery: string(c.Request().URI().QueryString()),
+		},
+		Host:       c.Hostname(),
+		RequestURI: c.OriginalURL(),
+		Header:     make(http.Header),
+	}
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		r.Header.Add(string(k), string(v))
+	})
+	return r.WithContext(c.UserContext())
+}
@@ -0,0 +1,89 @@
+package fiberlimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func serve(t *testing.T, app *fiber.App, target string) *http.Response {
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestLimiter_Rejects(t *testing.T) {
+	f := limitertest.NewPriority()
+	app := fiber.New()
+	app.Use(New(httplimit.New(f)))
+	handled := 0
+	app.Get("/", func(c *fiber.Ctx) error {
+		handled++
+		return c.SendString("ok")
+	})
+
+	assert.Equal(t, http.StatusOK, serve(t, app, "/").StatusCode)
+	f.Script(&limiter.RetryAfterError{Err: limiter.ErrShed, After: 2 * time.Second}, limiter.ErrClosed)
+	resp := serve(t, app, "/")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(t, app, "/").StatusCode)
+	// the handlers after the limiter do not run for rejected requests.
+	assert.Equal(t, 1, handled)
+	f.AssertBalanced(t)
+}
+
+func TestLimiter_Priority(t *testing.T) {
+	f := limitertest.NewPriority()
+	m := httplimit.New(f, httplimit.WithRoutes(map[string]httplimit.Route{
+		"/admin": {Priority: priority.MediumHigh},
+	}))
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("batch", c.Query("batch") != "")
+		return c.Next()
+	})
+	app.Use(New(m, WithPriority(func(c *fiber.Ctx) priority.PriorityValue {
+		if c.Locals("batch").(bool) {
+			return priority.Low
+		}
+		return priority.High
+	})))
+	app.Get("/*", func(c *fiber.Ctx) error { return nil })
+
+	serve(t, app, "/?batch=1")
+	serve(t, app, "/")
+	serve(t, app, "/admin?batch=1")
+	assert.Equal(t, []priority.PriorityValue{priority.Low, priority.High, priority.MediumHigh}, f.Priorities())
+	f.AssertBalanced(t)
+}
+
+func TestLimiter_DefaultPriority(t *testing.T) {
+	f := limitertest.NewPriority()
+	m := httplimit.New(f, httplimit.WithPriority(func(r *http.Request) priority.PriorityValue {
+		if r.Header.Get("X-Batch") != "" {
+			return priority.Low
+		}
+		return priority.High
+	}))
+	app := fiber.New()
+	app.Use(New(m))
+	app.Get("/", func(c *fiber.Ctx) error { return nil })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Batch", "1")
+	_, err := app.Test(req)
+	assert.NoError(t, err)
+	serve(t, app, "/")
+	assert.Equal(t, []priority.PriorityValue{priority.Low, priority.High}, f.Priorities())
+	f.AssertBalanced(t)
+}
@@ -0,0 +1,411 @@
+// Package fileconfig builds a set of named limiters from a configuration file and applies changes to the file
+// while the limiters are in use , so processes managing dozens of limiters do not spread their settings over as
+// many constructor calls. The file is YAML , or JSON which is valid YAML:
+//
+//	limiters:
+//	  db-writes:
+//	    limit: 10
+//	    timeout: 500ms
+//	    timeout_policy: RejectOnTimeout
+//	    max_queue_length: 100
+//	    rejection_policy: DropOldest
+//	  outbound:
+//	    kind: priority
+//	    limit: 50
+//	    priority_quota: {"4": 30, "1": 5}
+//
+// Kind is "limiter" , the default , or "priority". Durations are formatted as for time.ParseDuration and policies
+// are named as by their String method. Settings that are omitted keep their default.
+//
+// The limiters are registered in a registry.Registry under their name , where the admin and debug handlers find
+// them. Reload and Watch change the limit , the timeout , the bound of the waitlist and the priority quotas of the
+// limiters in place: goroutines holding a limiter are not affected. Limiters added to the file are created and
+// limiters removed from it are unregistered , but not closed , since code may still use them.
+//
+// It lives in its own module so the core limiters don't depend on a YAML parser.
+package fileconfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+// Kinds of limiters.
+const (
+	KindLimiter  = "limiter"
+	KindPriority = "priority"
+)
+
+// ErrKindChanged is returned by Reload , wrapped with the name of the limiter , when the kind of a limiter
+// changes: a limiter cannot change kind in place , the process must be restarted.
+var ErrKindChanged = errors.New("fileconfig: the kind of a limiter cannot be changed")
+
+// File is the content of a configuration file.
+type File struct {
+	Limiters map[string]Spec `json:"limiters"`
+}
+
+// Spec holds the settings of a limiter.
+//
+// Kind: "limiter" or "priority" , "limiter" if empty
+//
+// Limit: max number of concurrent goroutines that can access the resource
+//
+// Timeout , TimeoutPolicy: see WithTimeoutDuration and WithTimeoutPolicy
+//
+// MaxQueueLength , RejectionPolicy: see WithMaxQueueLength and WithRejectionPolicy , the waitlist is unbounded if
+// MaxQueueLength is nil
+//
+// PriorityQuota: slots reserved per priority , formatted as a decimal number , see priority.WithPriorityQuota. Only
+// for the priority kind
+type Spec struct {
+	Kind            string         `json:"kind,omitempty"`
+	Limit           int            `json:"limit"`
+	Timeout         Duration       `json:"timeout,omitempty"`
+	TimeoutPolicy   string         `json:"timeout_policy,omitempty"`
+	MaxQueueLength  *int           `json:"max_queue_length,omitempty"`
+	RejectionPolicy string         `json:"rejection_policy,omitempty"`
+	PriorityQuota   map[string]int `json:"priority_quota,omitempty"`
+}
+
+// Duration is a time.Duration formatted as for time.ParseDuration.
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration like "500ms".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("fileconfig: duration must be a string like \"500ms\" , got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("fileconfig: %w", err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON formats the duration like "500ms".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse parses the content of a configuration file , YAML or JSON.
+func Parse(data []byte) (*File, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("fileconfig: %w", err)
+	}
+	// YAML maps are re-encoded as JSON , so the File is decoded the same way whatever the format.
+	b, err := json.Marshal(stringKeys(doc))
+	if err != nil {
+		return nil, fmt.Errorf("fileconfig: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("fileconfig: %w", err)
+	}
+	for name, s := range f.Limiters {
+		if _, err := s.options(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return &f, nil
+}
+
+// stringKeys converts the maps decoded from YAML , whose keys may be numbers like priorities , to maps with string
+// keys.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+	}
+	return v
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// settings are the settings of a Spec , checked and converted to the types of the limiters.
+type settings struct {
+	timeout         time.Duration
+	timeoutPolicy   limiter.TimeoutPolicy
+	maxQueueLength  int
+	rejectionPolicy limiter.RejectionPolicy
+	quota           map[priority.PriorityValue]int
+}
+
+// options checks the Spec and converts its settings.
+func (s Spec) options() (settings, error) {
+	st := settings{timeout: time.Duration(s.Timeout), maxQueueLength: -1}
+	if s.Kind != "" && s.Kind != KindLimiter && s.Kind != KindPriority {
+		return st, fmt.Errorf("%w: unknown kind %q", limiter.ErrInvalidConfig, s.Kind)
+	}
+	if s.MaxQueueLength != nil {
+		st.maxQueueLength = *s.MaxQueueLength
+	}
+	var ok bool
+	if st.timeoutPolicy, ok = parsePolicy(s.TimeoutPolicy, limiter.AdmitOnTimeout); !ok {
+		return st, fmt.Errorf("%w: unknown timeout policy %q", limiter.ErrInvalidConfig, s.TimeoutPolicy)
+	}
+	if st.rejectionPolicy, ok = parsePolicy(s.RejectionPolicy, limiter.RejectNew); !ok {
+		return st, fmt.Errorf("%w: unknown rejection policy %q", limiter.ErrInvalidConfig, s.RejectionPolicy)
+	}
+	if s.PriorityQuota != nil {
+		if s.Kind != KindPriority {
+			return st, fmt.Errorf("%w: priority quotas need the priority kind", limiter.ErrInvalidConfig)
+		}
+		st.quota = make(map[priority.PriorityValue]int, len(s.PriorityQuota))
+		for k, n := range s.PriorityQuota {
+			p, err := strconv.Atoi(k)
+			if err != nil {
+				return st, fmt.Errorf("%w: priority %q is not a number", limiter.ErrInvalidConfig, k)
+			}
+			st.quota[priority.PriorityValue(p)] = n
+		}
+	}
+	return st, nil
+}
+
+// parsePolicy returns the policy named name , or def if name is empty.
+func parsePolicy[P interface {
+	~int
+	String() string
+	Valid() bool
+}](name string, def P) (P, bool) {
+	if name == "" {
+		return def, true
+	}
+	for p := P(0); p.Valid(); p++ {
+		if p.String() == name {
+			return p, true
+		}
+	}
+	return def, false
+}
+
+// Set is the set of limiters built from a File.
+type Set struct {
+	reg *registry.Registry
+
+	mu       sync.Mutex
+	specs    map[string]Spec
+	limiters map[string]registry.StatsProvider
+}
+
+// Build creates the limiters of f and registers them in reg. Nothing is registered if a limiter cannot be created
+// or a name is taken.
+func Build(reg *registry.Registry, f *File) (*Set, error) {
+	s := &Set{
+		reg:      reg,
+		specs:    make(map[string]Spec),
+		limiters: make(map[string]registry.StatsProvider),
+	}
+	for _, name := range sortedNames(f) {
+		l, err := create(f.Limiters[name])
+		if err == nil {
+			err = reg.Register(name, l)
+		}
+		if err != nil {
+			for registered := range s.limiters {
+				reg.Unregister(registered)
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		s.specs[name], s.limiters[name] = f.Limiters[name], l
+	}
+	return s, nil
+}
+
+// Get returns the limiter created under name , *limiter.Limiter or *priority.PriorityLimiter depending on its kind.
+func (s *Set) Get(name string) (registry.StatsProvider, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[name]
+	return l, ok
+}
+
+// Reload applies f to the limiters of the Set. Limiters whose settings did not change are left alone. Reload
+// carries on when a limiter cannot be updated or created , and returns the errors of all of them joined , each
+// wrapped with the name of the limiter.
+func (s *Set) Reload(f *File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for name := range s.specs {
+		if _, ok := f.Limiters[name]; !ok {
+			s.reg.Unregister(name)
+			delete(s.specs, name)
+			delete(s.limiters, name)
+		}
+	}
+	for _, name := range sortedNames(f) {
+		spec := f.Limiters[name]
+		old, ok := s.specs[name]
+		if !ok {
+			l, err := create(spec)
+			if err == nil {
+				err = s.reg.Register(name, l)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			s.specs[name], s.limiters[name] = spec, l
+			continue
+		}
+		if err := update(s.limiters[name], old, spec); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		s.specs[name] = spec
+	}
+	return errors.Join(errs...)
+}
+
+// Watch reloads the file at path whenever its content changes , checking it every interval until ctx is done. The
+// file is reloaded at the first check , so changes made between Build and Watch are not missed. Errors reading ,
+// parsing or applying the file are passed to onError if it is not nil , the limiters then keep the settings of the
+// last file applied.
+func (s *Set) Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	var last []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(data, last) {
+			continue
+		}
+		if err == nil {
+			last = data
+			var f *File
+			if f, err = Parse(data); err == nil {
+				err = s.Reload(f)
+			}
+		}
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// create creates the limiter described by spec.
+func create(spec Spec) (registry.StatsProvider, error) {
+	st, err := spec.options()
+	if err != nil {
+		return nil, err
+	}
+	if spec.Kind == KindPriority {
+		options := []priority.Option{priority.WithTimeoutPolicy(st.timeoutPolicy), priority.WithRejectionPolicy(st.rejectionPolicy)}
+		if st.timeout > 0 {
+			options = append(options, priority.WithTimeoutDuration(st.timeout))
+		}
+		if st.maxQueueLength >= 0 {
+			options = append(options, priority.WithMaxQueueLength(st.maxQueueLength))
+		}
+		if st.quota != nil {
+			options = append(options, priority.WithPriorityQuota(st.quota))
+		}
+		return priority.NewLimiterWithValidation(spec.Limit, options...)
+	}
+	options := []limiter.Option{limiter.WithTimeoutPolicy(st.timeoutPolicy), limiter.WithRejectionPolicy(st.rejectionPolicy)}
+	if st.timeout > 0 {
+		options = append(options, limiter.WithTimeoutDuration(st.timeout))
+	}
+	if st.maxQueueLength >= 0 {
+		options = append(options, limiter.WithMaxQueueLength(st.maxQueueLength))
+	}
+	return limiter.NewWithValidation(spec.Limit, options...)
+}
+
+// reconfigurable is implemented by *limiter.Limiter and *priority.PriorityLimiter.
+type reconfigurable interface {
+	SetLimit(limit int)
+	SetTimeout(timeout time.Duration, policy limiter.TimeoutPolicy) error
+	SetMaxQueueLength(maxQueueLength int, policy limiter.RejectionPolicy) error
+}
+
+// update applies the changes from old to spec to l.
+func update(l registry.StatsProvider, old, spec Spec) error {
+	if (old.Kind == KindPriority) != (spec.Kind == KindPriority) {
+		return ErrKindChanged
+	}
+	prev, _ := old.options()
+	st, err := spec.options()
+	if err != nil {
+		return err
+	}
+	if spec.Limit <= 0 {
+		return fmt.Errorf("%w: limit must be positive , got %d", limiter.ErrInvalidConfig, spec.Limit)
+	}
+	r := l.(reconfigurable)
+	if prev.timeout != st.timeout || prev.timeoutPolicy != st.timeoutPolicy {
+		if err := r.SetTimeout(st.timeout, st.timeoutPolicy); err != nil {
+			return err
+		}
+	}
+	if prev.maxQueueLength != st.maxQueueLength || prev.rejectionPolicy != st.rejectionPolicy {
+		if err := r.SetMaxQueueLength(st.maxQueueLength, st.rejectionPolicy); err != nil {
+			return err
+		}
+	}
+	if p, ok := l.(*priority.PriorityLimiter); ok && ((prev.quota == nil) != (st.quota == nil) || !maps.Equal(prev.quota, st.quota)) {
+		if err := p.SetPriorityQuota(st.quota); err != nil {
+			return err
+		}
+	}
+	if old.Limit != spec.Limit {
+		r.SetLimit(spec.Limit)
+	}
+	return nil
+}
+
+func sortedNames(f *File) []string {
+	names := make([]string, 0, len(f.Limiters))
+	for name := range f.Limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
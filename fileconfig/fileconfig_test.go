@@ -0,0 +1,153 @@
+package fileconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"github.com/vivek-ng/concurrency-limiter/registry"
+)
+
+const config = `
+limiters:
+  db-writes:
+    limit: 10
+    timeout: 500ms
+    timeout_policy: RejectOnTimeout
+    max_queue_length: 100
+    rejection_policy: DropOldest
+  outbound:
+    kind: priority
+    limit: 50
+    priority_quota: {4: 30, 1: 5}
+`
+
+func TestBuild(t *testing.T) {
+	f, err := Parse([]byte(config))
+	assert.NoError(t, err)
+	reg := registry.New()
+	s, err := Build(reg, f)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db-writes", "outbound"}, reg.Names())
+
+	db, ok := registry.Lookup[*limiter.Limiter](reg, "db-writes")
+	assert.True(t, ok)
+	c := db.Config()
+	assert.Equal(t, 10, c.Limit)
+	assert.Equal(t, 500*time.Millisecond, c.Timeout)
+	assert.Equal(t, limiter.RejectOnTimeout, c.TimeoutPolicy)
+	assert.Equal(t, 100, c.MaxQueueLength)
+	assert.Equal(t, limiter.DropOldest, c.RejectionPolicy)
+
+	outbound, ok := s.Get("outbound")
+	assert.True(t, ok)
+	pc := outbound.(*priority.PriorityLimiter).Config()
+	assert.Equal(t, 50, pc.Limit)
+	assert.Equal(t, map[priority.PriorityValue]int{priority.High: 30, priority.Low: 5}, pc.PriorityQuota)
+	assert.Equal(t, -1, pc.MaxQueueLength)
+
+	// nothing is registered if a name is taken.
+	reg2 := registry.New()
+	reg2.Register("outbound", limiter.New(1))
+	_, err = Build(reg2, f)
+	assert.Equal(t, registry.ErrDuplicate, errors.Unwrap(err))
+	assert.Equal(t, []string{"outbound"}, reg2.Names())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`limiters: {db: {limit: 1, timeout: 5}}`,
+		`limiters: {db: {limit: 1, timeout_policy: Sometimes}}`,
+		`limiters: {db: {limit: 1, kind: sharded}}`,
+		`limiters: {db: {limit: 1, priority_quota: {4: 1}}}`,
+		`limiters: {db: {limit: 1, priority_quota: {high: 1}, kind: priority}}`,
+		`limiters: {db: {limit: 1, burst: 4}}`,
+		`{"limiters": [}`,
+	} {
+		_, err := Parse([]byte(config))
+		assert.Error(t, err, config)
+	}
+	// JSON is valid YAML.
+	f, err := Parse([]byte(`{"limiters": {"db": {"limit": 3, "timeout": "1s"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(time.Second), f.Limiters["db"].Timeout)
+}
+
+func TestReload(t *testing.T) {
+	f, _ := Parse([]byte(config))
+	reg := registry.New()
+	s, err := Build(reg, f)
+	assert.NoError(t, err)
+	db, _ := registry.Lookup[*limiter.Limiter](reg, "db-writes")
+	outbound, _ := registry.Lookup[*priority.PriorityLimiter](reg, "outbound")
+
+	f, _ = Parse([]byte(`
+limiters:
+  db-writes:
+    limit: 20
+  outbound:
+    kind: priority
+    limit: 50
+    max_queue_length: 5
+  cache:
+    limit: 3
+`))
+	assert.NoError(t, s.Reload(f))
+	assert.Equal(t, []string{"cache", "db-writes", "outbound"}, reg.Names())
+	c := db.Config()
+	assert.Equal(t, 20, c.Limit)
+	assert.Zero(t, c.Timeout)
+	assert.Equal(t, -1, c.MaxQueueLength)
+	pc := outbound.Config()
+	assert.Nil(t, pc.PriorityQuota)
+	assert.Equal(t, 5, pc.MaxQueueLength)
+
+	// limiters that cannot be updated keep their settings , the others are updated.
+	f, _ = Parse([]byte(`
+limiters:
+  db-writes:
+    limit: 30
+  outbound:
+    limit: 50
+`))
+	err = s.Reload(f)
+	assert.True(t, errors.Is(err, ErrKindChanged))
+	assert.Equal(t, 30, db.Limit())
+	assert.Equal(t, []string{"db-writes", "outbound"}, reg.Names())
+	_, ok := reg.Get("cache")
+	assert.False(t, ok)
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limiters.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`limiters: {db: {limit: 1}}`), 0o644))
+	f, err := Load(path)
+	assert.NoError(t, err)
+	reg := registry.New()
+	s, err := Build(reg, f)
+	assert.NoError(t, err)
+	db, _ := registry.Lookup[*limiter.Limiter](reg, "db")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan struct{})
+	go func() {
+		s.Watch(ctx, path, time.Millisecond, func(err error) { errs <- err })
+		close(done)
+	}()
+	assert.NoError(t, os.WriteFile(path, []byte(`limiters: {db: {limit: 4}}`), 0o644))
+	for db.Limit() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(`limiters: {db: {limit: -1}}`), 0o644))
+	assert.True(t, errors.Is(<-errs, limiter.ErrInvalidConfig))
+	assert.Equal(t, 4, db.Limit())
+	cancel()
+	<-done
+}
@@ -0,0 +1,13 @@
+module github.com/vivek-ng/concurrency-limiter/fileconfig
+
+go 1.26
+
+require (
+	github.com/stretchr/testify v1.12.1
+	github.com/vivek-ng/concurrency-limiter v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require go.yaml.in/yaml/v3 v3.0.5 // indirect
+
+replace github.com/vivek-ng/concurrency-limiter => ../
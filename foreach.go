@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ForEachLimited calls fn for every item in its own goroutine , holding a slot of l for the duration of the call ,
+// and returns once every call has returned. The calling goroutine waits for the slots , so at most as many
+// goroutines as l admits are running at any time.
+//
+// The errors returned by fn do not stop the other items: ForEachLimited returns all of them joined with
+// errors.Join , or nil. An item rejected by l , see IsRejection , is skipped and its rejection is part of the
+// returned errors. Any other error of Wait , for example because ctx is done or l is closed , stops the iteration
+// and is returned along with the errors of the items already processed.
+func ForEachLimited[T any](ctx context.Context, l Waiter, items []T, fn func(ctx context.Context, item T) error) error {
+	var f forEach
+	for _, item := range items {
+		if !run(ctx, &f, l, item, fn) {
+			break
+		}
+	}
+	return f.wait()
+}
+
+// ForEachLimitedChan is like ForEachLimited for items received from a channel. It returns once items is closed ,
+// or ctx is done , and every call of fn has returned.
+func ForEachLimitedChan[T any](ctx context.Context, l Waiter, items <-chan T, fn func(ctx context.Context, item T) error) error {
+	var f forEach
+	for {
+		select {
+		case item, ok := <-items:
+			if !ok {
+				return f.wait()
+			}
+			if !run(ctx, &f, l, item, fn) {
+				return f.wait()
+			}
+		case <-ctx.Done():
+			f.fail(Canceled(ctx))
+			return f.wait()
+		}
+	}
+}
+
+// forEach tracks the calls and collects the errors of ForEachLimited.
+type forEach struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// run calls fn for item in a new goroutine of f once l admits it , and reports whether the iteration should go on.
+func run[T any](ctx context.Context, f *forEach, l Waiter, item T, fn func(ctx context.Context, item T) error) bool {
+	if err := l.Wait(ctx); err != nil {
+		f.fail(err)
+		return IsRejection(err)
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer l.Finish()
+		if err := fn(ctx, item); err != nil {
+			f.fail(err)
+		}
+	}()
+	return true
+}
+
+// fail records err , returned by Wait or by a call of fn.
+func (f *forEach) fail(err error) {
+	f.mu.Lock()
+	f.errs = append(f.errs, err)
+	f.mu.Unlock()
+}
+
+// wait waits for the calls of fn and returns the errors joined.
+func (f *forEach) wait() error {
+	f.wg.Wait()
+	return errors.Join(f.errs...)
+}
@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachLimited(t *testing.T) {
+	l := New(3)
+	items := make([]int, 50)
+	for i := range items {
+		items[i] = i
+	}
+	var running, max, sum int64
+	errOdd := errors.New("odd")
+	err := ForEachLimited(context.Background(), l, items, func(ctx context.Context, item int) error {
+		n := atomic.AddInt64(&running, 1)
+		for m := atomic.LoadInt64(&max); n > m && !atomic.CompareAndSwapInt64(&max, m, n); m = atomic.LoadInt64(&max) {
+		}
+		defer atomic.AddInt64(&running, -1)
+		atomic.AddInt64(&sum, int64(item))
+		if item == 7 || item == 9 {
+			return errOdd
+		}
+		return nil
+	})
+	assert.True(t, errors.Is(err, errOdd))
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+	assert.Equal(t, int64(49*50/2), sum)
+	assert.True(t, max <= 3)
+}
+
+// rejecting admits goroutines except on the calls listed in reject.
+type rejecting struct {
+	mu     sync.Mutex
+	calls  int
+	reject map[int]error
+}
+
+func (r *rejecting) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	return r.reject[r.calls]
+}
+
+func (r *rejecting) Finish() {}
+
+func TestForEachLimited_Rejections(t *testing.T) {
+	l := &rejecting{reject: map[int]error{2: ErrQueueFull, 4: ErrClosed}}
+	var processed int64
+	err := ForEachLimited(context.Background(), l, []string{"a", "b", "c", "d", "e"}, func(ctx context.Context, item string) error {
+		atomic.AddInt64(&processed, 1)
+		return nil
+	})
+	// a rejected item is skipped , the closed limiter stops the iteration.
+	assert.True(t, errors.Is(err, ErrQueueFull))
+	assert.True(t, errors.Is(err, ErrClosed))
+	assert.Equal(t, int64(2), processed)
+}
+
+func TestForEachLimitedChan(t *testing.T) {
+	l := New(2)
+	items := make(chan int)
+	go func() {
+		for i := 1; i <= 10; i++ {
+			items <- i
+		}
+		close(items)
+	}()
+	var sum int64
+	err := ForEachLimitedChan(context.Background(), l, items, func(ctx context.Context, item int) error {
+		atomic.AddInt64(&sum, int64(item))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(55), sum)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ForEachLimitedChan(ctx, l, make(chan int), func(ctx context.Context, item int) error { return nil })
+	assert.True(t, errors.Is(err, ErrCanceled))
+}
@@ -0,0 +1,73 @@
+// Package ginlimit adapts the HTTP middleware of httplimit to Gin. Requests wait for a slot before reaching the
+// next handlers , and the ones that fail to get one are aborted with the status and Retry-After header of the
+// net/http middleware , so the handlers after the limiter never run for them:
+//
+//	nl := priority.NewLimiter(100)
+//	m := httplimit.New(nl , httplimit.WithRoutes(routes))
+//	r := gin.New()
+//	r.Use(ginlimit.New(m , ginlimit.WithPriority(func(c *gin.Context) priority.PriorityValue {
+//		if c.GetHeader("X-Batch") != "" {
+//			return priority.Low
+//		}
+//		return priority.High
+//	})))
+package ginlimit
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Limiter admits the requests of a Gin engine through a httplimit.Middleware.
+//
+// priority: computes the priority a request waits with when its route does not set one
+type Limiter struct {
+	m        *httplimit.Middleware
+	priority func(c *gin.Context) priority.PriorityValue
+}
+
+type Option func(*Limiter)
+
+// New returns a gin.HandlerFunc admitting requests through m , with the routes , timeouts and priorities of m.
+func New(m *httplimit.Middleware, options ...Option) gin.HandlerFunc {
+	l := &Limiter{
+		m: m,
+		priority: func(c *gin.Context) priority.PriorityValue {
+			return m.Priority(c.Request)
+		},
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l.handle
+}
+
+// priority: If this field is specified , computes the priority a request waits with from the gin.Context , for
+// example from a value set by an authentication middleware , instead of the func of httplimit.WithPriority. A
+// priority set by the route of the request still wins.
+func WithPriority(fn func(c *gin.Context) priority.PriorityValue) func(*Limiter) {
+	return func(l *Limiter) {
+		l.priority = fn
+	}
+}
+
+// handle waits for a slot , runs the next handlers and gives the slot back , or aborts the request.
+func (l *Limiter) handle(c *gin.Context) {
+	release, rej := l.m.Admit(c.Request, l.priority(c))
+	if rej != nil {
+		if rej.Status == 0 {
+			// the client went away.
+			c.Abort()
+			return
+		}
+		if rej.RetryAfter != "" {
+			c.Header("Retry-After", rej.RetryAfter)
+		}
+		c.AbortWithStatus(rej.Status)
+		return
+	}
+	defer release()
+	c.Next()
+}
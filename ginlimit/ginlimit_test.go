@@ -0,0 +1,71 @@
+package ginlimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/httplimit"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func serve(r *gin.Engine, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestLimiter_Aborts(t *testing.T) {
+	f := limitertest.NewPriority()
+	r := gin.New()
+	r.Use(New(httplimit.New(f)))
+	handled := 0
+	r.GET("/", func(c *gin.Context) {
+		handled++
+		c.String(http.StatusOK, "ok")
+	})
+
+	assert.Equal(t, http.StatusOK, serve(r, "/").Code)
+	f.Script(&limiter.RetryAfterError{Err: limiter.ErrShed, After: 2 * time.Second}, limiter.ErrClosed)
+	rec := serve(r, "/")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(r, "/").Code)
+	// the handlers after the limiter do not run for aborted requests.
+	assert.Equal(t, 1, handled)
+	f.AssertBalanced(t)
+}
+
+func TestLimiter_Priority(t *testing.T) {
+	f := limitertest.NewPriority()
+	m := httplimit.New(f, httplimit.WithRoutes(map[string]httplimit.Route{
+		"/admin": {Priority: priority.MediumHigh},
+	}))
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("batch", c.Query("batch") != "")
+	})
+	r.Use(New(m, WithPriority(func(c *gin.Context) priority.PriorityValue {
+		if c.GetBool("batch") {
+			return priority.Low
+		}
+		return priority.High
+	})))
+	r.GET("/*path", func(c *gin.Context) {})
+
+	serve(r, "/?batch=1")
+	serve(r, "/")
+	serve(r, "/admin?batch=1")
+	assert.Equal(t, []priority.PriorityValue{priority.Low, priority.High, priority.MediumHigh}, f.Priorities())
+	f.AssertBalanced(t)
+}
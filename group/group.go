@@ -0,0 +1,77 @@
+// Package group runs goroutines with bounded concurrency and priorities , like golang.org/x/sync/errgroup with
+// SetLimit. Instead of a plain counter , the goroutines are admitted by a priority.Waiter , usually a
+// *priority.PriorityLimiter , so the ones started with a higher priority run first and the timeouts , queue bounds
+// and other options of the limiter apply:
+//
+//	nl := priority.NewLimiter(4)
+//	g , ctx := group.New(ctx , nl)
+//	for _ , job := range jobs {
+//		g.Go(job.Priority , func() error { return job.Run(ctx) })
+//	}
+//	err := g.Wait()
+package group
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Group is a collection of goroutines working on subtasks of the same task. A Group must not be reused after
+// Wait returns.
+type Group struct {
+	l      priority.Waiter
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// New returns a Group whose goroutines are admitted by l , and a context derived from ctx. The context is
+// cancelled the first time a goroutine of the Group returns an error , or when Wait returns , whichever
+// happens first. Goroutines that have not started running fn when the context is cancelled are not run.
+func New(ctx context.Context, l priority.Waiter) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{l: l, ctx: ctx, cancel: cancel}, ctx
+}
+
+// Go calls fn in a new goroutine once l admits it with priority p , and gives the slot back when fn returns.
+// Go never blocks. The first error returned by fn , or by l if it rejects the goroutine , cancels the context of
+// the Group and is returned by Wait. A goroutine rejected because the context has already been cancelled does not
+// override the first error.
+func (g *Group) Go(p priority.PriorityValue, fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := g.l.Wait(g.ctx, p); err != nil {
+			g.fail(err)
+			return
+		}
+		defer g.l.FinishPriority(p)
+		if g.ctx.Err() != nil {
+			// admitted without waiting after the Group failed.
+			return
+		}
+		if err := fn(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// fail records the first error and cancels the context of the Group.
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
+
+// Wait blocks until every goroutine started with Go has returned or has been rejected , then returns the first
+// error , if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
@@ -0,0 +1,73 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func TestGroup_Priority(t *testing.T) {
+	nl := priority.NewLimiter(1)
+	assert.NoError(t, nl.Wait(context.Background(), priority.Low))
+	g, _ := New(context.Background(), nl)
+
+	var mu sync.Mutex
+	var order []priority.PriorityValue
+	for i, p := range []priority.PriorityValue{priority.Low, priority.Medium, priority.High} {
+		p := p
+		g.Go(p, func() error {
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			return nil
+		})
+		for nl.Stats().Waiting != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	nl.Finish()
+	assert.NoError(t, g.Wait())
+	assert.Equal(t, []priority.PriorityValue{priority.High, priority.Medium, priority.Low}, order)
+}
+
+func TestGroup_FirstError(t *testing.T) {
+	nl := priority.NewLimiter(1)
+	g, ctx := New(context.Background(), nl)
+	errFailed := errors.New("failed")
+	started := make(chan struct{})
+	g.Go(priority.High, func() error {
+		close(started)
+		return errFailed
+	})
+	<-started
+	ran := false
+	g.Go(priority.Low, func() error {
+		ran = true
+		return nil
+	})
+	assert.Equal(t, errFailed, g.Wait())
+	assert.False(t, ran)
+	assert.Equal(t, errFailed, context.Cause(ctx))
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestGroup_Rejected(t *testing.T) {
+	f := limitertest.NewPriority()
+	f.Script(nil, limiter.ErrQueueFull)
+	g, ctx := New(context.Background(), f)
+	g.Go(priority.High, func() error { return nil })
+	assert.NoError(t, g.Wait())
+
+	g, ctx = New(context.Background(), f)
+	g.Go(priority.High, func() error { return nil })
+	assert.Equal(t, limiter.ErrQueueFull, g.Wait())
+	assert.Error(t, ctx.Err())
+	f.AssertBalanced(t)
+}
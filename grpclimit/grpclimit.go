@@ -0,0 +1,100 @@
+// Package grpclimit rejects the RPCs of a gRPC server over the limit in the transport , before their messages are
+// decoded and a goroutine is started for their handler , which is much cheaper than rejecting them in an
+// interceptor when the server is overloaded:
+//
+//	l := limiter.New(100)
+//	t := grpclimit.New(l , grpclimit.WithExempt("/grpc.health.v1.Health/Check"))
+//	s := grpc.NewServer(grpc.InTapHandle(t.Handle))
+//
+// The tap handle runs in the I/O goroutine of the connection , so it never waits for a slot: an RPC is admitted only
+// if a slot is free , and holds it until the RPC ends. It lives in its own module so the core limiters don't depend
+// on gRPC.
+package grpclimit
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/tap"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// Tap admits the RPCs of a gRPC server through a limiter.
+//
+// exempt: the full names of the methods admitted without a slot , for example health checks
+type Tap struct {
+	l      limiter.Waiter
+	exempt map[string]bool
+}
+
+type Option func(*Tap)
+
+// New returns a Tap admitting RPCs through l. Use priority.AtPriority to admit them through a priority limiter.
+func New(l limiter.Waiter, options ...Option) *Tap {
+	t := &Tap{
+		l:      l,
+		exempt: make(map[string]bool),
+	}
+	for _, o := range options {
+		o(t)
+	}
+	return t
+}
+
+// exempt: If this field is specified , the RPCs of these methods , given by their full name in the format
+// /package.service/method , are admitted without a slot , so the server keeps answering them when it is overloaded.
+func WithExempt(methods ...string) func(*Tap) {
+	return func(t *Tap) {
+		for _, m := range methods {
+			t.exempt[m] = true
+		}
+	}
+}
+
+// ServerOption returns the grpc.ServerOption installing t as the tap handle of a server.
+func (t *Tap) ServerOption() grpc.ServerOption {
+	return grpc.InTapHandle(t.Handle)
+}
+
+// Handle is a tap.ServerInHandle admitting an RPC if a slot of the limiter is free , taken with limiter.TryWait so
+// refused RPCs never enter the waitlist. The slot is given back when the context of the RPC is done , which gRPC
+// does when the RPC ends. RPCs finding no free slot , including once the limiter is closed , fail with
+// codes.ResourceExhausted and a RetryInfo detail when the limiter can tell when to retry.
+func (t *Tap) Handle(ctx context.Context, info *tap.Info) (context.Context, error) {
+	if t.exempt[info.FullMethodName] {
+		return ctx, nil
+	}
+	if !limiter.TryWait(t.l) {
+		return ctx, t.reject()
+	}
+	context.AfterFunc(ctx, t.l.Finish)
+	return ctx, nil
+}
+
+// reject returns the status error an RPC finding no free slot is answered with.
+func (t *Tap) reject() error {
+	st := status.New(codes.ResourceExhausted, "grpclimit: over the concurrency limit")
+	if after, ok := t.retryAfter(); ok {
+		if d, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(after)}); err == nil {
+			st = d
+		}
+	}
+	return st.Err()
+}
+
+// retryAfter returns when the client of a rejected RPC should retry: the time the limiter is expected to take to
+// drain its waitlist.
+func (t *Tap) retryAfter() (time.Duration, bool) {
+	if e, ok := t.l.(interface{ EstimatedWait() (time.Duration, bool) }); ok {
+		if after, ok := e.EstimatedWait(); ok && after > 0 {
+			return after, true
+		}
+	}
+	return 0, false
+}
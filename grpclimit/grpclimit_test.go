@@ -0,0 +1,85 @@
+package grpclimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func dial(t *testing.T, tp *Tap) healthpb.HealthClient {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(tp.ServerOption())
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestTap_Rejects(t *testing.T) {
+	l := limiter.New(1)
+	c := dial(t, New(l))
+	ctx := context.Background()
+
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	// the slot is given back when the RPC ends.
+	assert.Eventually(t, func() bool { return l.Stats().InFlight == 0 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, l.Wait(ctx))
+	_, err = c.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	l.Finish()
+	_, err = c.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestTap_Exempt(t *testing.T) {
+	l := limiter.New(1)
+	c := dial(t, New(l, WithExempt("/grpc.health.v1.Health/Check")))
+	ctx := context.Background()
+
+	assert.NoError(t, l.Wait(ctx))
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Stats().InFlight)
+	l.Finish()
+}
+
+// estimating is a waiter refusing every caller and expecting its waitlist to drain in 2s.
+type estimating struct{}
+
+func (estimating) Wait(ctx context.Context) error       { return limiter.ErrQueueFull }
+func (estimating) Finish()                              {}
+func (estimating) EstimatedWait() (time.Duration, bool) { return 2 * time.Second, true }
+
+func TestTap_Status(t *testing.T) {
+	st := status.Convert(New(estimating{}).reject())
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Equal(t, 2*time.Second, st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+	}
+
+	l := limiter.New(1)
+	c := dial(t, New(l))
+	assert.NoError(t, l.Close(context.Background()))
+	_, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
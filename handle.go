@@ -0,0 +1,76 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type handleKey struct{}
+
+// Handle reports the progress of a goroutine waiting in a Limiter. Create one with WithHandle and pass
+// the returned context to Wait , the Handle can then be queried from any goroutine.
+type Handle struct {
+	mu sync.Mutex
+	l  *Limiter
+	w  *waiter
+}
+
+// WithHandle returns a copy of ctx carrying a new *Handle. A Handle describes a single call to Wait.
+func WithHandle(ctx context.Context) (context.Context, *Handle) {
+	h := &Handle{}
+	return context.WithValue(ctx, handleKey{}, h), h
+}
+
+// handleFrom returns the Handle carried by ctx , or nil.
+func handleFrom(ctx context.Context) *Handle {
+	h, _ := ctx.Value(handleKey{}).(*Handle)
+	return h
+}
+
+// attach records that the goroutine waits in l as w.
+func (h *Handle) attach(l *Limiter, w *waiter) {
+	w.pinned = true
+	h.mu.Lock()
+	h.l, h.w = l, w
+	h.mu.Unlock()
+}
+
+// Position returns the position of the goroutine in the waitlist , 1 being the next goroutine to access the
+// resource. It returns 0 if the goroutine is not waiting , because Wait has not queued it yet or it left the waitlist.
+func (h *Handle) Position() int {
+	h.mu.Lock()
+	l, w := h.l, h.w
+	h.mu.Unlock()
+	if l == nil {
+		return 0
+	}
+	return l.position(w)
+}
+
+// EstimatedWait returns how long the goroutine is expected to keep waiting , based on its position and the rate
+// at which the Limiter served goroutines recently. It is zero if the goroutine is not waiting. ok is false if the
+// Limiter has not served enough goroutines yet to estimate its rate.
+func (h *Handle) EstimatedWait() (d time.Duration, ok bool) {
+	h.mu.Lock()
+	l := h.l
+	h.mu.Unlock()
+	pos := h.Position()
+	if pos == 0 {
+		return 0, true
+	}
+	return l.serviceRate.Estimate(pos)
+}
+
+// Cancel removes the goroutine waiting with h from the waitlist without granting it access , its Wait returns
+// ErrCancelledByLimiter. Cancel returns false if the goroutine does not wait in the waitlist of l , for example
+// because it has been admitted already.
+func (l *Limiter) Cancel(h *Handle) bool {
+	h.mu.Lock()
+	owner, w := h.l, h.w
+	h.mu.Unlock()
+	if owner != l {
+		return false
+	}
+	return l.removeWaiter(w, ErrCancelledByLimiter)
+}
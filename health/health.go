@@ -0,0 +1,178 @@
+// Package health reports whether a limiter is healthy , for readiness probes and alerting. A limiter is unhealthy
+// when its waitlist is too long , when its oldest goroutine has been waiting for too long , which points at a stuck
+// limiter even while the waitlist is short , or when it sheds goroutines too fast.
+//
+// The Checker is an http.Handler answering with a Report as JSON , with status 200 when the limiter is healthy and
+// 503 Service Unavailable otherwise:
+//
+//	http.Handle("/ready", health.New(l, health.Thresholds{MaxWaiting: 100, MaxOldestWait: 5 * time.Second}))
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// defaultWindow is the default period the shed rate is measured over.
+const defaultWindow = 10 * time.Second
+
+// ErrUnhealthy is returned by CheckHealth , wrapped with the threshold that was exceeded , when the limiter is
+// unhealthy.
+var ErrUnhealthy = errors.New("health: limiter unhealthy")
+
+// StatsProvider is implemented by *limiter.Limiter and *priority.PriorityLimiter.
+type StatsProvider interface {
+	Stats() limiter.Stats
+}
+
+// Thresholds are the limits beyond which a limiter is unhealthy. A zero threshold is not checked.
+//
+// MaxWaiting: max number of goroutines in the waitlist
+//
+// MaxOldestWait: max time the oldest goroutine in the waitlist may have been waiting , see limiter.Stats.OldestWait
+//
+// MaxShedRate: max number of goroutines rejected per second because of overload , see limiter.IsRejection
+type Thresholds struct {
+	MaxWaiting    int
+	MaxOldestWait time.Duration
+	MaxShedRate   float64
+}
+
+// Report is the outcome of a health check , and the body of the responses of the Checker.
+type Report struct {
+	Healthy           bool     `json:"healthy"`
+	Waiting           int      `json:"waiting"`
+	OldestWaitSeconds float64  `json:"oldest_wait_seconds"`
+	ShedRate          float64  `json:"shed_rate"`
+	Reasons           []string `json:"reasons,omitempty"`
+}
+
+// Checker checks the health of a limiter against Thresholds.
+//
+// window: period the shed rate is measured over. The rate reported is the one of the last complete window , so
+// checks made in quick succession , for example by several probes , do not make it noisy
+//
+// since , shed: start of the current window and number of goroutines shed by then
+//
+// rate: shed rate measured over the last complete window
+type Checker struct {
+	l          StatsProvider
+	thresholds Thresholds
+	clock      clock.Clock
+	window     time.Duration
+
+	mu    sync.Mutex
+	since time.Time
+	shed  uint64
+	rate  float64
+}
+
+type Option func(*Checker)
+
+// New creates a *Checker of l. The shed rate is measured from the creation of the Checker on.
+func New(l StatsProvider, thresholds Thresholds, options ...Option) *Checker {
+	c := &Checker{
+		l:          l,
+		thresholds: thresholds,
+		clock:      clock.Real(),
+		window:     defaultWindow,
+	}
+	for _, o := range options {
+		o(c)
+	}
+	c.since, c.shed = c.clock.Now(), l.Stats().Shed
+	return c
+}
+
+// WithWindow sets the period the shed rate is measured over , ten seconds by default.
+func WithWindow(window time.Duration) func(*Checker) {
+	return func(c *Checker) {
+		c.window = window
+	}
+}
+
+// WithClock makes the Checker measure time with c , typically a *clock.Fake in tests.
+func WithClock(clk clock.Clock) func(*Checker) {
+	return func(c *Checker) {
+		c.clock = clk
+	}
+}
+
+// Check returns a Report of the current health of the limiter.
+func (c *Checker) Check() Report {
+	s := c.l.Stats()
+	r := Report{
+		Waiting:           s.Waiting,
+		OldestWaitSeconds: s.OldestWait.Seconds(),
+		ShedRate:          c.shedRate(s.Shed),
+	}
+	t := c.thresholds
+	if t.MaxWaiting > 0 && r.Waiting > t.MaxWaiting {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d goroutines waiting , more than %d", r.Waiting, t.MaxWaiting))
+	}
+	if t.MaxOldestWait > 0 && s.OldestWait > t.MaxOldestWait {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("oldest goroutine waiting for %s , more than %s", s.OldestWait, t.MaxOldestWait))
+	}
+	if t.MaxShedRate > 0 && r.ShedRate > t.MaxShedRate {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%.2f goroutines shed per second , more than %.2f", r.ShedRate, t.MaxShedRate))
+	}
+	r.Healthy = len(r.Reasons) == 0
+	return r
+}
+
+// shedRate returns the shed rate of the last complete window , starting a new window if the current one is over.
+// shed is the number of goroutines shed so far.
+func (c *Checker) shedRate(shed uint64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if elapsed := now.Sub(c.since); elapsed >= c.window && elapsed > 0 {
+		c.rate = float64(shed-c.shed) / elapsed.Seconds()
+		c.since, c.shed = now, shed
+	}
+	return c.rate
+}
+
+// Healthy reports whether the limiter is within the thresholds.
+func (c *Checker) Healthy() bool {
+	return c.Check().Healthy
+}
+
+// CheckHealth returns nil if the limiter is within the thresholds , and otherwise an error matching ErrUnhealthy
+// describing the thresholds exceeded.
+func (c *Checker) CheckHealth() error {
+	r := c.Check()
+	if r.Healthy {
+		return nil
+	}
+	errs := make([]error, len(r.Reasons))
+	for i, reason := range r.Reasons {
+		errs[i] = fmt.Errorf("%w: %s", ErrUnhealthy, reason)
+	}
+	return errors.Join(errs...)
+}
+
+// ServeHTTP answers with the Report of the limiter , with status 200 if it is healthy and 503 otherwise.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	report := c.Check()
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
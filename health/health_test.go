@@ -0,0 +1,85 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestChecker(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := limiter.New(1, limiter.WithClock(clk), limiter.WithMaxQueueLength(1))
+	c := New(l, Thresholds{MaxWaiting: 1, MaxOldestWait: time.Second, MaxShedRate: 1}, WithClock(clk), WithWindow(time.Second))
+	assert.True(t, c.Healthy())
+	assert.NoError(t, c.CheckHealth())
+
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	go l.Wait(ctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		assert.True(t, errors.Is(l.Wait(ctx), limiter.ErrQueueFull))
+	}
+	assert.Equal(t, uint64(3), l.Stats().Shed)
+	// the shed rate is only measured once the window is over.
+	assert.True(t, c.Healthy())
+
+	clk.Advance(2 * time.Second)
+	r := c.Check()
+	assert.False(t, r.Healthy)
+	assert.Equal(t, 1, r.Waiting)
+	assert.Equal(t, 2.0, r.OldestWaitSeconds)
+	assert.Equal(t, 1.5, r.ShedRate)
+	assert.Len(t, r.Reasons, 2)
+	err := c.CheckHealth()
+	assert.True(t, errors.Is(err, ErrUnhealthy))
+
+	l.Finish()
+	l.Finish()
+	clk.Advance(time.Second)
+	assert.True(t, c.Healthy())
+}
+
+func TestChecker_ServeHTTP(t *testing.T) {
+	l := limiter.New(1)
+	c := New(l, Thresholds{MaxWaiting: 1})
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var r Report
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&r))
+	assert.True(t, r.Healthy)
+
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	for i := 0; i < 2; i++ {
+		go l.Wait(ctx)
+	}
+	for l.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&r))
+	assert.False(t, r.Healthy)
+	assert.Equal(t, 2, r.Waiting)
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ready", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	for i := 0; i < 3; i++ {
+		l.Finish()
+	}
+}
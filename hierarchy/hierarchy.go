@@ -0,0 +1,315 @@
+// Package hierarchy implements limiters composed into a tree. A slot acquired from a child Limiter also counts
+// against all of its ancestors , so a parent caps the sum of its children:
+//
+//	outbound := hierarchy.New(200)
+//	payments := outbound.Child(50)
+//	search := outbound.Child(50)
+//
+// A goroutine calling Wait on payments is admitted once both payments and outbound have a free slot. The slots of
+// the whole chain are taken at once under the lock of the tree: a goroutine never holds a slot of a child while
+// waiting for its parent , so acquisitions through different children cannot deadlock or hoard capacity.
+package hierarchy
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+var _ limiter.Waiter = (*Limiter)(nil)
+
+// tree holds the state shared by the Limiters of a tree.
+//
+// waitList: goroutines waiting for a slot of any Limiter of the tree , in arrival order
+//
+// version: incremented whenever a limit , a count or the waitlist change , see limiter.Stats
+//
+// root: the root Limiter , once it is full no waiting goroutine fits
+//
+// borrowing: whether a Limiter of the tree is configured with WithBorrowing
+//
+// admitting , reclaimed: while admit runs , the results of reclaiming are kept in reclaimed so the waitlist is not
+// scanned again for every waiting goroutine
+type tree struct {
+	mu        sync.Mutex
+	waitList  list.List
+	version   uint64
+	root      *Limiter
+	borrowing bool
+	admitting bool
+	reclaimed map[*Limiter]bool
+}
+
+// waiter is a goroutine waiting for a slot of l. done is closed once it has been admitted.
+type waiter struct {
+	l    *Limiter
+	done chan struct{}
+	elem *list.Element
+}
+
+// Limiter is a node of a tree of limiters.
+//
+// limit: max number of concurrent goroutines that can access the resource through the Limiter and its descendants
+//
+// count: current number of goroutines accessing the resource through the Limiter and its descendants
+//
+// borrow: max number of slots the Limiter may take above its limit from the capacity its siblings leave unused
+type Limiter struct {
+	tree   *tree
+	parent *Limiter
+	limit  int
+	count  int
+	borrow int
+}
+
+type Option func(*Limiter)
+
+// borrow: If this field is specified , the Limiter may admit up to borrow goroutines above its limit while the
+// parent has free slots that its siblings don't use. A sibling below its own limit takes its capacity back: while
+// it has waiting goroutines , the Limiter stops borrowing , and the borrowed slots return to the parent as the
+// goroutines holding them finish. Nothing is preempted. Static splits of a parent waste capacity when some
+// children are idle , borrowing lets busy children use it.
+func WithBorrowing(borrow int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.borrow = borrow
+	}
+}
+
+// New creates the root *Limiter of a new tree.
+func New(limit int) *Limiter {
+	l := &Limiter{
+		tree:  &tree{},
+		limit: limit,
+	}
+	l.tree.root = l
+	return l
+}
+
+// Child creates a *Limiter whose slots also count against l and its ancestors. limit may exceed the limit of l ,
+// for example to let children share the capacity of l without splitting it statically. Configure the child with
+// the options specified.
+func (l *Limiter) Child(limit int, options ...Option) *Limiter {
+	c := &Limiter{
+		tree:   l.tree,
+		parent: l,
+		limit:  limit,
+	}
+	for _, o := range options {
+		o(c)
+	}
+	if c.borrow > 0 {
+		l.tree.mu.Lock()
+		l.tree.borrowing = true
+		l.tree.mu.Unlock()
+	}
+	return c
+}
+
+// Parent returns the parent of the Limiter , or nil for the root of the tree.
+func (l *Limiter) Parent() *Limiter {
+	return l.parent
+}
+
+// Wait waits until the Limiter and all of its ancestors have a free slot , and takes one slot of each of them.
+// Goroutines are admitted in FIFO order among those that fit: a goroutine blocked by the limit of its own Limiter
+// does not hold back goroutines of other Limiters , and goroutines fitting within the limits of their Limiters are
+// admitted before goroutines borrowing slots , see WithBorrowing. If ctx is done while the goroutine waits , Wait
+// returns an error matching both limiter.ErrCanceled and the cause of the cancellation , and the goroutine must not
+// access the resource. Otherwise Wait returns nil.
+func (l *Limiter) Wait(ctx context.Context) error {
+	t := l.tree
+	t.mu.Lock()
+	if l.fits(false) || l.fits(true) {
+		l.acquire()
+		t.mu.Unlock()
+		return nil
+	}
+	w := &waiter{
+		l:    l,
+		done: make(chan struct{}),
+	}
+	w.elem = t.waitList.PushBack(w)
+	t.version++
+	t.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if w.elem == nil {
+			// admitted concurrently , the slot is given back.
+			l.release()
+		} else {
+			t.waitList.Remove(w.elem)
+			t.version++
+		}
+		return limiter.Canceled(ctx)
+	}
+}
+
+// TryWait takes one slot of the Limiter and of all of its ancestors if they all have a free slot , without
+// waiting , and reports whether it did. A goroutine refused by TryWait never enters the waitlist. If TryWait returns
+// true , the goroutine must call Finish once done.
+func (l *Limiter) TryWait() bool {
+	l.tree.mu.Lock()
+	defer l.tree.mu.Unlock()
+	if l.fits(false) || l.fits(true) {
+		l.acquire()
+		return true
+	}
+	return false
+}
+
+// fits reports whether the Limiter and all of its ancestors have a free slot. If borrow is set , the Limiters
+// configured with WithBorrowing may exceed their limit as long as none of their siblings needs its capacity back.
+// The mutex of the tree must be held.
+func (l *Limiter) fits(borrow bool) bool {
+	for n := l; n != nil; n = n.parent {
+		if n.count < n.limit {
+			continue
+		}
+		if !borrow || n.count >= n.limit+n.borrow || n.tree.reclaiming(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// reclaiming reports whether a sibling of l below its own limit has waiting goroutines , which means the sibling
+// needs the capacity l borrows. The mutex must be held.
+func (t *tree) reclaiming(l *Limiter) (r bool) {
+	if t.admitting {
+		if r, ok := t.reclaimed[l]; ok {
+			return r
+		}
+		defer func() { t.reclaimed[l] = r }()
+	}
+	for e := t.waitList.Front(); e != nil; e = e.Next() {
+		for n := e.Value.(*waiter).l; n.parent != nil; n = n.parent {
+			if n.parent == l.parent {
+				if n != l && n.count < n.limit {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+// acquire takes a slot of the Limiter and all of its ancestors. The mutex of the tree must be held.
+func (l *Limiter) acquire() {
+	for n := l; n != nil; n = n.parent {
+		n.count++
+	}
+	l.tree.version++
+}
+
+// Finish gives back the slot of the Limiter and of its ancestors , and admits the goroutines waiting anywhere in
+// the tree that fit now.
+func (l *Limiter) Finish() {
+	l.tree.mu.Lock()
+	defer l.tree.mu.Unlock()
+	l.release()
+}
+
+// release gives back a slot of the Limiter and its ancestors. The mutex of the tree must be held.
+func (l *Limiter) release() {
+	if l.count == 0 {
+		// unmatched Finish.
+		return
+	}
+	for n := l; n != nil; n = n.parent {
+		n.count--
+	}
+	l.tree.version++
+	l.tree.admit()
+}
+
+// admit grants a slot to every waiting goroutine that fits , in FIFO order. The goroutines fitting within the
+// limits of their Limiters are served before the ones borrowing slots. The scan stops once the root is full.
+// Admissions only raise counts and shorten the waitlist , so a sibling found reclaiming capacity during the scan may
+// stop needing it but never the reverse: reusing the result until the scan ends at worst defers a borrowed slot to
+// the next Finish. The mutex must be held.
+func (t *tree) admit() {
+	if t.reclaimed == nil {
+		t.reclaimed = make(map[*Limiter]bool)
+	}
+	clear(t.reclaimed)
+	t.admitting = true
+	defer func() { t.admitting = false }()
+	for _, borrow := range []bool{false, true} {
+		if borrow && !t.borrowing {
+			return
+		}
+		for e := t.waitList.Front(); e != nil && !t.root.full(borrow); {
+			next := e.Next()
+			if w := e.Value.(*waiter); w.l.fits(borrow) {
+				t.waitList.Remove(e)
+				w.elem = nil
+				w.l.acquire()
+				close(w.done)
+			}
+			e = next
+		}
+	}
+}
+
+// full reports whether the Limiter has no slot left , counting the slots it may borrow if borrow is set. The mutex
+// must be held.
+func (l *Limiter) full(borrow bool) bool {
+	if borrow {
+		return l.count >= l.limit+l.borrow
+	}
+	return l.count >= l.limit
+}
+
+// SetLimit changes the max number of concurrent goroutines that can access the resource through the Limiter and
+// its descendants. Raising the limit admits the waiting goroutines that fit.
+func (l *Limiter) SetLimit(limit int) {
+	l.tree.mu.Lock()
+	defer l.tree.mu.Unlock()
+	l.limit = limit
+	l.tree.version++
+	l.tree.admit()
+}
+
+// Limit returns the max number of concurrent goroutines that can access the resource through the Limiter.
+func (l *Limiter) Limit() int {
+	l.tree.mu.Lock()
+	defer l.tree.mu.Unlock()
+	return l.limit
+}
+
+// Stats returns a snapshot of the Limiter. InFlight and Waiting include the goroutines of its descendants. Wait
+// times are not tracked.
+func (l *Limiter) Stats() limiter.Stats {
+	t := l.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := limiter.Stats{
+		Limit:    l.limit,
+		InFlight: l.count,
+		Version:  t.version,
+	}
+	for e := t.waitList.Front(); e != nil; e = e.Next() {
+		if e.Value.(*waiter).l.descends(l) {
+			s.Waiting++
+		}
+	}
+	return s
+}
+
+// descends reports whether the Limiter is ancestor or one of its descendants.
+func (l *Limiter) descends(ancestor *Limiter) bool {
+	for n := l; n != nil; n = n.parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
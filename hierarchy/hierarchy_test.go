@@ -0,0 +1,168 @@
+package hierarchy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestLimiter_ParentCapsChildren(t *testing.T) {
+	root := New(3)
+	a, b := root.Child(2), root.Child(2)
+	ctx := context.Background()
+	assert.NoError(t, a.Wait(ctx))
+	assert.NoError(t, a.Wait(ctx))
+	assert.NoError(t, b.Wait(ctx))
+	assert.Equal(t, 3, root.Stats().InFlight)
+
+	admitted := make(chan *Limiter, 2)
+	for i, l := range []*Limiter{a, b} {
+		l := l
+		go func() {
+			if l.Wait(ctx) == nil {
+				admitted <- l
+			}
+		}()
+		for root.Stats().Waiting != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 1, a.Stats().Waiting)
+	assert.Equal(t, 1, b.Stats().Waiting)
+
+	// the slot given back by b frees the parent. The waiter of a is queued first but a is still full.
+	b.Finish()
+	assert.Equal(t, b, <-admitted)
+	a.Finish()
+	assert.Equal(t, a, <-admitted)
+	assert.Equal(t, 3, root.Stats().InFlight)
+	assert.Equal(t, 2, a.Stats().InFlight)
+	assert.Equal(t, 1, b.Stats().InFlight)
+}
+
+func TestLimiter_NoHeadOfLineBlocking(t *testing.T) {
+	root := New(10)
+	a, b := root.Child(1), root.Child(1)
+	ctx := context.Background()
+	assert.NoError(t, a.Wait(ctx))
+	go a.Wait(ctx)
+	for a.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// a goroutine of a waiting for its own limit does not hold back b.
+	assert.NoError(t, b.Wait(ctx))
+}
+
+func TestLimiter_ContextDone(t *testing.T) {
+	root := New(1)
+	child := root.Child(1)
+	ctx := context.Background()
+	assert.NoError(t, root.Wait(ctx))
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := child.Wait(cctx)
+	assert.True(t, errors.Is(err, limiter.ErrCanceled))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 0, root.Stats().Waiting)
+	assert.Equal(t, 0, child.Stats().InFlight)
+
+	root.Finish()
+	assert.Equal(t, 0, root.Stats().InFlight)
+}
+
+func TestLimiter_TryWait(t *testing.T) {
+	root := New(2)
+	child := root.Child(1)
+	ctx := context.Background()
+	assert.True(t, child.TryWait())
+	assert.False(t, child.TryWait())
+	assert.Equal(t, 0, root.Stats().Waiting)
+
+	admitted := make(chan struct{})
+	go func() {
+		if child.Wait(ctx) == nil {
+			close(admitted)
+		}
+	}()
+	for root.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// a refused TryWait leaves the waitlist alone , the queued goroutine gets the slot given back.
+	assert.False(t, child.TryWait())
+	assert.Equal(t, 1, root.Stats().Waiting)
+	child.Finish()
+	<-admitted
+	assert.True(t, root.TryWait())
+	assert.Equal(t, 2, root.Stats().InFlight)
+}
+
+func TestLimiter_UnmatchedFinish(t *testing.T) {
+	root := New(1)
+	child := root.Child(1)
+	// a Finish without a Wait is ignored instead of freeing a slot nobody holds.
+	root.Finish()
+	child.Finish()
+	assert.Equal(t, 0, root.Stats().InFlight)
+	assert.NoError(t, child.Wait(context.Background()))
+	assert.False(t, root.TryWait())
+	assert.Equal(t, 1, root.Stats().InFlight)
+}
+
+func TestLimiter_SetLimit(t *testing.T) {
+	root := New(1)
+	child := root.Child(5)
+	ctx := context.Background()
+	assert.NoError(t, child.Wait(ctx))
+	done := make(chan error)
+	go func() {
+		done <- child.Wait(ctx)
+	}()
+	for root.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	root.SetLimit(2)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, root.Stats().InFlight)
+	assert.Equal(t, root, child.Parent())
+	assert.Nil(t, root.Parent())
+}
+
+func TestLimiter_Borrowing(t *testing.T) {
+	root := New(4)
+	a, b := root.Child(2, WithBorrowing(1)), root.Child(2)
+	ctx := context.Background()
+	// b is idle , a borrows one of its slots but not more.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, a.Wait(ctx))
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(a.Wait(cctx), limiter.ErrCanceled))
+	assert.Equal(t, 3, a.Stats().InFlight)
+
+	// b takes its capacity back: a stops borrowing while b waits , and the borrowed slot goes to b.
+	assert.NoError(t, b.Wait(ctx))
+	admitted := make(chan *Limiter, 2)
+	for i, l := range []*Limiter{a, b} {
+		l := l
+		go func() {
+			if l.Wait(ctx) == nil {
+				admitted <- l
+			}
+		}()
+		for root.Stats().Waiting != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	a.Finish()
+	assert.Equal(t, b, <-admitted)
+	b.Finish()
+	assert.Equal(t, a, <-admitted)
+	assert.Equal(t, 3, a.Stats().InFlight)
+	assert.Equal(t, 1, b.Stats().InFlight)
+}
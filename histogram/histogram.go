@@ -0,0 +1,97 @@
+// Package histogram implements a lightweight streaming quantile sketch for durations.
+//
+// Observations are counted in logarithmically sized buckets, so quantiles are reported with a
+// bounded relative error (about 2.5%) using constant memory and without any locking.
+package histogram
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minValue is the lower bound of the first non zero bucket. Anything below it is reported as zero.
+	minValue = time.Microsecond
+	// growth is the ratio between the bounds of two adjacent buckets.
+	growth     = 1.05
+	numBuckets = 512
+)
+
+var logGrowth = math.Log(growth)
+
+// Histogram records durations and answers quantile queries over everything observed so far.
+// The zero value is ready to use and all methods are safe for concurrent use.
+type Histogram struct {
+	total  uint64
+	counts [numBuckets]uint64
+}
+
+// New creates an empty *Histogram.
+func New() *Histogram {
+	return &Histogram{}
+}
+
+// Observe records a single duration.
+func (h *Histogram) Observe(d time.Duration) {
+	atomic.AddUint64(&h.counts[bucketOf(d)], 1)
+	atomic.AddUint64(&h.total, 1)
+}
+
+// Count returns the number of observations recorded.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.total)
+}
+
+// Quantile returns the approximate q-quantile (0 <= q <= 1) of the observed durations.
+// It returns zero if nothing has been observed yet.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	total := atomic.LoadUint64(&h.total)
+	if total == 0 {
+		return 0
+	}
+	if q < 0 {
+		q = 0
+	}
+	if q > 1 {
+		q = 1
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i := range h.counts {
+		seen += atomic.LoadUint64(&h.counts[i])
+		if seen >= rank {
+			return valueOf(i)
+		}
+	}
+	// Observations raced with the scan, report the largest bucket we have seen.
+	for i := numBuckets - 1; i >= 0; i-- {
+		if atomic.LoadUint64(&h.counts[i]) > 0 {
+			return valueOf(i)
+		}
+	}
+	return 0
+}
+
+func bucketOf(d time.Duration) int {
+	if d < minValue {
+		return 0
+	}
+	i := 1 + int(math.Log(float64(d)/float64(minValue))/logGrowth)
+	if i >= numBuckets {
+		return numBuckets - 1
+	}
+	return i
+}
+
+// valueOf returns the midpoint of the bucket i.
+func valueOf(i int) time.Duration {
+	if i == 0 {
+		return 0
+	}
+	lower := float64(minValue) * math.Pow(growth, float64(i-1))
+	return time.Duration(lower * (1 + growth) / 2)
+}
@@ -0,0 +1,35 @@
+package histogram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram_Empty(t *testing.T) {
+	h := New()
+	assert.Zero(t, h.Count())
+	assert.Zero(t, h.Quantile(0.99))
+}
+
+func TestHistogram_Quantiles(t *testing.T) {
+	h := New()
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1000), h.Count())
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(h.Quantile(0.5)), 0.03)
+	assert.InEpsilon(t, float64(950*time.Millisecond), float64(h.Quantile(0.95)), 0.03)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(h.Quantile(0.99)), 0.03)
+}
+
+func TestHistogram_ZeroDurations(t *testing.T) {
+	h := New()
+	for i := 0; i < 10; i++ {
+		h.Observe(0)
+	}
+	h.Observe(time.Second)
+	assert.Zero(t, h.Quantile(0.5))
+	assert.InEpsilon(t, float64(time.Second), float64(h.Quantile(1)), 0.03)
+}
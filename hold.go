@@ -0,0 +1,66 @@
+package limiter
+
+import "time"
+
+// hold records that a slot has been acquired with Wait , so it can be reclaimed once the max hold duration
+// passes , and starts the goroutine reclaiming the slots if it is not running.
+func (l *Limiter) hold() {
+	c := l.config()
+	if c.maxHold <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holds.PushBack(c.clock.Now())
+	if !l.reaping {
+		l.reaping = true
+		go l.reap()
+	}
+}
+
+// unhold forgets the acquisition of a slot given back with Finish and reports whether the slot is still held.
+// Finish gives back the most recently acquired slot: leaked slots are the oldest ones , so they are the ones left
+// to reclaim. The mutex must be held.
+func (l *Limiter) unhold() bool {
+	if e := l.holds.Back(); e != nil {
+		l.holds.Remove(e)
+		return true
+	}
+	if l.orphans > 0 {
+		// the slot has already been reclaimed.
+		l.orphans--
+		return false
+	}
+	return true
+}
+
+// reap reclaims the slots held for longer than the max hold duration , oldest first , until no slot acquired
+// with Wait is held anymore.
+func (l *Limiter) reap() {
+	for {
+		c := l.config()
+		l.mu.Lock()
+		e := l.holds.Front()
+		if e == nil {
+			l.reaping = false
+			l.mu.Unlock()
+			return
+		}
+		wait := e.Value.(time.Time).Add(c.maxHold).Sub(c.clock.Now())
+		if wait <= 0 {
+			l.holds.Remove(e)
+			l.orphans++
+			l.reclaimed++
+			l.release()
+			l.mu.Unlock()
+			l.emit(EventReclaim, 0, nil)
+			if c.onMaxHold != nil {
+				c.onMaxHold()
+			}
+			continue
+		}
+		l.mu.Unlock()
+		t := c.clock.NewTimer(wait)
+		<-t.C()
+	}
+}
@@ -0,0 +1,264 @@
+// Package httplimit limits the concurrency of HTTP handlers with the limiters of this module. Requests wait for a
+// slot before reaching the handler , and the ones the limiter rejects because of overload are answered with 429
+// Too Many Requests:
+//
+//	nl := priority.NewLimiter(100)
+//	m := httplimit.New(nl , httplimit.WithRoutes(map[string]httplimit.Route{
+//		"/api/v1/export/": {Limit: 2 , Priority: priority.Low , Timeout: 5 * time.Second} ,
+//		"/api/v1/search":  {Priority: priority.High} ,
+//	}))
+//	http.ListenAndServe(":8080" , m.Handler(mux))
+//
+// Routes are declared with the patterns of http.ServeMux , so heavy endpoints like exports and reports get tighter
+// caps than cheap ones under a single handler wrapper. A request matching no route waits with the default priority
+// and timeout.
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Route is the configuration of the requests matching a route pattern.
+//
+// Limit: If this field is positive , the max number of concurrent requests of the route. They also count against
+// the limiter passed to New.
+//
+// Priority: priority the requests of the route wait with , instead of the default priority if it is not zero
+//
+// Timeout: If this field is positive , requests of the route still waiting for a slot after Timeout are rejected ,
+// instead of waiting for the default timeout
+type Route struct {
+	Limit    int
+	Priority priority.PriorityValue
+	Timeout  time.Duration
+}
+
+// estimator is implemented by the limiters estimating the wait of a new request , like *priority.PriorityLimiter ,
+// see priority.PriorityLimiter.EstimatedWait.
+type estimator interface {
+	EstimatedWait() (d time.Duration, ok bool)
+}
+
+// route is a Route with the limiter of its own limit , nil if it has none.
+type route struct {
+	Route
+	l *priority.PriorityLimiter
+}
+
+// Middleware admits HTTP requests through a limiter.
+//
+// l: limiter every request waits for
+//
+// routes , patterns: the routes by pattern , and a mux resolving the pattern of a request
+//
+// priority , timeout: default priority and timeout of the requests
+type Middleware struct {
+	l        priority.Waiter
+	routes   map[string]*route
+	patterns *http.ServeMux
+	priority func(r *http.Request) priority.PriorityValue
+	timeout  time.Duration
+}
+
+type Option func(*Middleware)
+
+// New creates a *Middleware admitting requests through l. Use priority.NewLimiter for a limiter ordering requests
+// by priority.
+func New(l priority.Waiter, options ...Option) *Middleware {
+	m := &Middleware{
+		l:        l,
+		routes:   make(map[string]*route),
+		patterns: http.NewServeMux(),
+		priority: func(*http.Request) priority.PriorityValue { return priority.Medium },
+	}
+	for _, o := range options {
+		o(m)
+	}
+	return m
+}
+
+// priority: computes the priority a request waits with when its route does not set one , for example from a header
+// or the authenticated user. Defaults to priority.Medium.
+func WithPriority(fn func(r *http.Request) priority.PriorityValue) func(*Middleware) {
+	return func(m *Middleware) {
+		m.priority = fn
+	}
+}
+
+// timeout: If this field is specified , requests still waiting for a slot after timeout are rejected with 429 Too
+// Many Requests , unless their route sets a timeout of its own.
+func WithTimeout(timeout time.Duration) func(*Middleware) {
+	return func(m *Middleware) {
+		m.timeout = timeout
+	}
+}
+
+// routes: the configuration of the requests by route pattern , see http.ServeMux for the syntax of the patterns. A
+// request matching several patterns gets the configuration of the most specific one , like with http.ServeMux.
+// WithRoutes panics if a pattern is invalid or registered twice.
+func WithRoutes(routes map[string]Route) func(*Middleware) {
+	return func(m *Middleware) {
+		for pattern, r := range routes {
+			rt := &route{Route: r}
+			if r.Limit > 0 {
+				rt.l = priority.NewLimiter(r.Limit)
+			}
+			m.routes[pattern] = rt
+			m.patterns.Handle(pattern, http.NotFoundHandler())
+		}
+	}
+}
+
+// RouteLimiter returns the limiter of the route pattern , if the route has a limit of its own , for example to
+// register it with registry.Register.
+func (m *Middleware) RouteLimiter(pattern string) (*priority.PriorityLimiter, bool) {
+	if rt, ok := m.routes[pattern]; ok && rt.l != nil {
+		return rt.l, true
+	}
+	return nil, false
+}
+
+// routeOf returns the route matching r , or nil.
+func (m *Middleware) routeOf(r *http.Request) *route {
+	if len(m.routes) == 0 {
+		return nil
+	}
+	_, pattern := m.patterns.Handler(r)
+	return m.routes[pattern]
+}
+
+// Handler returns a handler calling next once the request has a slot , and giving the slot back when next returns.
+// Requests rejected because of overload , see limiter.IsRejection , or still waiting after their timeout are
+// answered with 429 Too Many Requests , with a Retry-After header telling the client when to retry: the hint
+// carried by the rejection , see limiter.RetryAfter , or else the time the limiter is expected to take to drain its
+// waitlist , see priority.PriorityLimiter.EstimatedWait. Requests failing to get a slot for another reason , for
+// example because the limiter is closed , are answered with 503 Service Unavailable. Nothing is written if the
+// client goes away while waiting.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, rej := m.Admit(r, m.priority(r))
+		if rej != nil {
+			rej.Write(w)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejection is the response to a request that failed to get a slot. Adapters to other frameworks than net/http
+// answer with it.
+//
+// Status: 429 Too Many Requests if the request was rejected because of overload or timed out , 503 Service
+// Unavailable if it failed otherwise , or zero if the client went away and nothing should be written
+//
+// RetryAfter: value of the Retry-After header , empty if there is none
+//
+// Err: the error of Wait
+type Rejection struct {
+	Status     int
+	RetryAfter string
+	Err        error
+}
+
+// Write answers the request with the rejection.
+func (rej *Rejection) Write(w http.ResponseWriter) {
+	if rej.Status == 0 {
+		return
+	}
+	if rej.RetryAfter != "" {
+		w.Header().Set("Retry-After", rej.RetryAfter)
+	}
+	http.Error(w, http.StatusText(rej.Status), rej.Status)
+}
+
+// Priority returns the priority of r computed by the func of WithPriority.
+func (m *Middleware) Priority(r *http.Request) priority.PriorityValue {
+	return m.priority(r)
+}
+
+// Admit waits for the slots of the request r like Handler , with the priority p unless its route sets one. It
+// returns a func giving the slots back , or the Rejection to answer with. Adapters to other frameworks than net/http
+// build on it , see Handler for the behavior.
+func (m *Middleware) Admit(r *http.Request, p priority.PriorityValue) (release func(), rej *Rejection) {
+	release, l, err := m.acquire(r, p)
+	if err != nil {
+		return nil, m.reject(r, l, err)
+	}
+	return release, nil
+}
+
+// acquire waits for the slots of the request , the one of its route first , and returns a func giving them back ,
+// or the limiter that failed to grant a slot.
+func (m *Middleware) acquire(r *http.Request, p priority.PriorityValue) (func(), priority.Waiter, error) {
+	rt := m.routeOf(r)
+	timeout := m.timeout
+	if rt != nil {
+		if rt.Priority != 0 {
+			p = rt.Priority
+		}
+		if rt.Timeout > 0 {
+			timeout = rt.Timeout
+		}
+	}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if rt != nil && rt.l != nil {
+		if err := rt.l.Wait(ctx, p); err != nil {
+			return nil, rt.l, err
+		}
+	}
+	if err := m.l.Wait(ctx, p); err != nil {
+		if rt != nil && rt.l != nil {
+			rt.l.FinishPriority(p)
+		}
+		return nil, m.l, err
+	}
+	return func() {
+		m.l.FinishPriority(p)
+		if rt != nil && rt.l != nil {
+			rt.l.FinishPriority(p)
+		}
+	}, nil, nil
+}
+
+// reject returns the response to the request r that failed to get a slot of l with err.
+func (m *Middleware) reject(r *http.Request, l priority.Waiter, err error) *Rejection {
+	rej := &Rejection{Err: err}
+	switch {
+	case r.Context().Err() != nil:
+		// the client went away.
+	case limiter.IsRejection(err) || errors.Is(err, context.DeadlineExceeded):
+		rej.Status = http.StatusTooManyRequests
+		if after, ok := retryAfter(l, err); ok {
+			rej.RetryAfter = strconv.Itoa(max(int(math.Ceil(after.Seconds())), 1))
+		}
+	default:
+		rej.Status = http.StatusServiceUnavailable
+	}
+	return rej
+}
+
+// retryAfter returns when the client of a request rejected by l with err should retry: the hint carried by err ,
+// see limiter.RetryAfter , or else the time l is expected to take to drain its waitlist.
+func retryAfter(l priority.Waiter, err error) (time.Duration, bool) {
+	if after, ok := limiter.RetryAfter(err); ok {
+		return after, true
+	}
+	if e, ok := l.(estimator); ok {
+		return e.EstimatedWait()
+	}
+	return 0, false
+}
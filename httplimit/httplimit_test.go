@@ -0,0 +1,126 @@
+package httplimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// blocking returns a handler blocking until release is closed , and a channel receiving a value once it runs.
+func blocking(release chan struct{}) (http.Handler, chan struct{}) {
+	running := make(chan struct{}, 10)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		running <- struct{}{}
+		<-release
+	}), running
+}
+
+func serve(h http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestMiddleware_Rejects(t *testing.T) {
+	nl := priority.NewLimiter(1)
+	release := make(chan struct{})
+	next, running := blocking(release)
+	h := New(nl, WithTimeout(10*time.Millisecond)).Handler(next)
+	go serve(h, "/")
+	<-running
+
+	rec := serve(h, "/")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	close(release)
+
+	nl.Close(context.Background())
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, "/").Code)
+}
+
+func TestMiddleware_Routes(t *testing.T) {
+	nl := priority.NewLimiter(10)
+	m := New(nl, WithRoutes(map[string]Route{
+		"/export/":    {Limit: 1, Priority: priority.Low, Timeout: 10 * time.Millisecond},
+		"/export/csv": {Priority: priority.MediumHigh},
+	}))
+	release := make(chan struct{})
+	next, running := blocking(release)
+	h := m.Handler(next)
+	go serve(h, "/export/pdf")
+	<-running
+
+	// the route is at its limit , other routes are not affected.
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, "/export/xls").Code)
+	go serve(h, "/export/csv")
+	<-running
+	assert.Equal(t, 2, nl.InFlight())
+	l, ok := m.RouteLimiter("/export/")
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.InFlight())
+	_, ok = m.RouteLimiter("/export/csv")
+	assert.False(t, ok)
+	close(release)
+}
+
+func TestMiddleware_Priority(t *testing.T) {
+	f := limitertest.NewPriority()
+	h := New(f,
+		WithPriority(func(r *http.Request) priority.PriorityValue {
+			if r.Header.Get("X-Interactive") != "" {
+				return priority.High
+			}
+			return priority.Low
+		}),
+		WithRoutes(map[string]Route{"/batch": {Priority: priority.Low}, "/admin": {Priority: priority.High}}),
+	).Handler(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Interactive", "1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	serve(h, "/")
+	serve(h, "/admin")
+	assert.Equal(t, []priority.PriorityValue{priority.High, priority.Low, priority.High}, f.Priorities())
+	f.AssertBalanced(t)
+
+	f.Script(limiter.ErrShed)
+	assert.Equal(t, http.StatusTooManyRequests, serve(h, "/").Code)
+}
+
+func TestMiddleware_RetryAfter(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := priority.NewLimiter(1, priority.WithClock(clk), priority.WithMaxQueueLength(1))
+	ctx := context.Background()
+	nl.Wait(ctx, priority.Low)
+	nl.Finish()
+	clk.Advance(1500 * time.Millisecond)
+	nl.Wait(ctx, priority.Low)
+	nl.Finish()
+
+	release := make(chan struct{})
+	next, running := blocking(release)
+	h := New(nl).Handler(next)
+	go serve(h, "/")
+	<-running
+	go serve(h, "/")
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// the waitlist drains in two intervals of 1.5 s.
+	rec := serve(h, "/")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("Retry-After"))
+
+	// the hint carried by the rejection wins.
+	f := limitertest.NewPriority()
+	f.Script(&limiter.RetryAfterError{Err: limiter.ErrShed, After: 200 * time.Millisecond})
+	rec = serve(New(f).Handler(next), "/")
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	close(release)
+}
@@ -0,0 +1,28 @@
+package limiter
+
+import "context"
+
+// Waiter is the interface shared by the limiters of this module , so application code and middleware can be
+// written without depending on a particular implementation. Wait blocks until the goroutine may access the
+// resource or returns an error if it must not , and Finish gives back the slot acquired by a successful Wait.
+//
+// *Limiter implements Waiter. Limiters ordering goroutines by priority implement priority.Waiter instead , and
+// priority.AtPriority adapts them to Waiter. The limitertest package provides fake implementations.
+type Waiter interface {
+	Wait(ctx context.Context) error
+	Finish()
+}
+
+var _ Waiter = (*Limiter)(nil)
+
+// TryWait takes a slot of w without waiting and reports whether it did. Waiters with a TryWait method , like
+// *Limiter and the adapters of priority.AtPriority , never enter their waitlist. Other Waiters are asked with Wait
+// and a context that is already done , so they may enter their waitlist briefly and apply their rejection policy.
+func TryWait(w Waiter) bool {
+	if t, ok := w.(interface{ TryWait() bool }); ok {
+		return t.TryWait()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return w.Wait(ctx) == nil
+}
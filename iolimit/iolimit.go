@@ -0,0 +1,138 @@
+// Package iolimit gates the Read and Write calls of io.Readers and io.Writers through a limiter , and optionally
+// limits their bandwidth with a rate.Bucket of bytes , so file and network copy pipelines share the admission
+// control of the rest of the process:
+//
+//	nl := limiter.New(8)
+//	bw := rate.NewBucket(10 << 20 , 1 << 20)
+//	r := iolimit.NewReader(f , nl , iolimit.WithBandwidth(bw) , iolimit.WithContext(ctx))
+//	_ , err := io.Copy(dst , r)
+//
+// Each call holds a slot of the limiter while it reads or writes. Readers and Writers sharing a Bucket share its
+// bandwidth.
+package iolimit
+
+import (
+	"context"
+	"io"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/rate"
+)
+
+// settings of a Reader or Writer.
+//
+// ctx: the context the calls wait with
+// bandwidth: the bytes per second of the calls , nil for no bandwidth limit
+type settings struct {
+	ctx       context.Context
+	bandwidth *rate.Bucket
+}
+
+type Option func(*settings)
+
+// ctx: If this field is specified , the calls wait for a slot and for bandwidth with ctx instead of a background
+// context , so they fail once ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(s *settings) {
+		s.ctx = ctx
+	}
+}
+
+// bandwidth: If this field is specified , the bytes read or written go through b , so the calls are limited to
+// the rate of b in addition to the limiter. A call moves at most b.Burst() bytes.
+func WithBandwidth(b *rate.Bucket) Option {
+	return func(s *settings) {
+		s.bandwidth = b
+	}
+}
+
+func newSettings(options []Option) settings {
+	s := settings{ctx: context.Background()}
+	for _, o := range options {
+		o(&s)
+	}
+	return s
+}
+
+// chunk returns the largest part of p a call moves.
+func (s settings) chunk(p []byte) []byte {
+	if s.bandwidth != nil && len(p) > s.bandwidth.Burst() {
+		return p[:s.bandwidth.Burst()]
+	}
+	return p
+}
+
+// throttle waits until n bytes can go through the bandwidth limit.
+func (s settings) throttle(n int) error {
+	if s.bandwidth == nil || n == 0 {
+		return nil
+	}
+	if err := s.bandwidth.WaitN(s.ctx, n); err != nil {
+		return limiter.Canceled(s.ctx)
+	}
+	return nil
+}
+
+// Reader gates the Read calls of an io.Reader through a limiter.
+type Reader struct {
+	r io.Reader
+	l limiter.Waiter
+	s settings
+}
+
+// NewReader returns a *Reader reading from r , each Read holding a slot of l.
+func NewReader(r io.Reader, l limiter.Waiter, options ...Option) *Reader {
+	return &Reader{r: r, l: l, s: newSettings(options)}
+}
+
+// Read waits for a slot , reads from the underlying reader and gives the slot back. With a bandwidth limit , it
+// reads at most Burst bytes and then waits until the bytes read can go through , so the next calls are slowed
+// down. If the limiter rejects the call or the context is done , Read returns 0 and the error of the limiter.
+func (r *Reader) Read(p []byte) (int, error) {
+	if err := r.l.Wait(r.s.ctx); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(r.s.chunk(p))
+	r.l.Finish()
+	if werr := r.s.throttle(n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+// Writer gates the Write calls of an io.Writer through a limiter.
+type Writer struct {
+	w io.Writer
+	l limiter.Waiter
+	s settings
+}
+
+// NewWriter returns a *Writer writing to w , each Write holding a slot of l.
+func NewWriter(w io.Writer, l limiter.Waiter, options ...Option) *Writer {
+	return &Writer{w: w, l: l, s: newSettings(options)}
+}
+
+// Write writes p to the underlying writer , holding a slot of the limiter. With a bandwidth limit , p is written
+// in chunks of at most Burst bytes , each waiting for its bandwidth and then for a slot , so other calls interleave
+// with a large write. Write returns the number of bytes written and the first error , of the limiter or of the
+// underlying writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := w.s.chunk(p)
+		if err := w.s.throttle(len(chunk)); err != nil {
+			return written, err
+		}
+		if err := w.l.Wait(w.s.ctx); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		w.l.Finish()
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,100 @@
+package iolimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+	"github.com/vivek-ng/concurrency-limiter/rate"
+)
+
+func TestReader(t *testing.T) {
+	f := limitertest.New()
+	r := NewReader(strings.NewReader("hello world"), f)
+
+	f.Script(limiter.ErrShed)
+	n, err := r.Read(make([]byte, 4))
+	assert.Equal(t, 0, n)
+	assert.True(t, errors.Is(err, limiter.ErrShed))
+
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+	f.AssertBalanced(t)
+}
+
+func TestWriter(t *testing.T) {
+	f := limitertest.New()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, f)
+
+	n, err := w.Write([]byte("hello"))
+	assert.Equal(t, 5, n)
+	assert.NoError(t, err)
+	f.Script(limiter.ErrShed)
+	n, err = w.Write([]byte("world"))
+	assert.Equal(t, 0, n)
+	assert.True(t, errors.Is(err, limiter.ErrShed))
+	assert.Equal(t, "hello", buf.String())
+	f.AssertBalanced(t)
+}
+
+func TestWriter_Bandwidth(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	f := limitertest.New()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, f, WithBandwidth(rate.NewBucket(4, 4, rate.WithClock(c))))
+
+	done := make(chan error)
+	go func() {
+		_, err := w.Write([]byte("hello world!"))
+		done <- err
+	}()
+	// the first chunk goes through at once , the next ones wait for a second each.
+	for i := 1; i <= 2; i++ {
+		assert.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, 4*i, buf.Len())
+		c.Advance(time.Second)
+	}
+	assert.NoError(t, <-done)
+	assert.Equal(t, "hello world!", buf.String())
+	assert.Equal(t, 3, f.Waits())
+	f.AssertBalanced(t)
+}
+
+func TestReader_Bandwidth(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	b := rate.NewBucket(4, 4, rate.WithClock(c))
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewReader(strings.NewReader("hello world!"), limitertest.New(), WithBandwidth(b), WithContext(ctx))
+
+	// a read moves at most the burst.
+	n, err := r.Read(make([]byte, 16))
+	assert.Equal(t, 4, n)
+	assert.NoError(t, err)
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := r.Read(make([]byte, 16))
+		done <- result{n, err}
+	}()
+	assert.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	res := <-done
+	// the bytes were read , the error tells the next reads will fail.
+	assert.Equal(t, 4, res.n)
+	assert.True(t, errors.Is(res.err, limiter.ErrCanceled))
+}
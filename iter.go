@@ -0,0 +1,36 @@
+package limiter
+
+import (
+	"context"
+	"iter"
+)
+
+// Over returns an iterator yielding the items of seq , each one only while a slot of l is held. The slot is
+// acquired before an item is yielded and released when the loop body returns , so the body of a range loop over
+// the iterator runs under the limit:
+//
+//	for item := range limiter.Over(ctx , nl , items) {
+//		go process(item) // wrong: the slot is released when the body returns
+//		process(item)
+//	}
+//
+// The iteration stops when Wait fails , for example because ctx is done or l rejects the goroutine: use
+// ForEachLimited to get the errors. Use priority.AtPriority to iterate under a priority limiter.
+func Over[T any](ctx context.Context, l Waiter, seq iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for item := range seq {
+			if l.Wait(ctx) != nil {
+				return
+			}
+			if !yieldHeld(l, yield, item) {
+				return
+			}
+		}
+	}
+}
+
+// yieldHeld yields item and releases the slot of l once the loop body returns , even if it panics.
+func yieldHeld[T any](l Waiter, yield func(T) bool, item T) bool {
+	defer l.Finish()
+	return yield(item)
+}
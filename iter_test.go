@@ -0,0 +1,35 @@
+package limiter
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOver(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	var got []int
+	for item := range Over(ctx, l, slices.Values([]int{1, 2, 3})) {
+		assert.Equal(t, 1, l.Stats().InFlight)
+		got = append(got, item)
+	}
+	assert.Equal(t, []int{1, 2, 3}, got)
+	assert.Equal(t, 0, l.Stats().InFlight)
+
+	// the slot is released on break.
+	for range Over(ctx, l, slices.Values([]int{1, 2, 3})) {
+		break
+	}
+	assert.Equal(t, 0, l.Stats().InFlight)
+
+	cctx, cancel := context.WithCancel(ctx)
+	assert.NoError(t, l.Wait(ctx))
+	cancel()
+	for range Over(cctx, l, slices.Values([]int{1, 2, 3})) {
+		t.Fatal("yielded without a slot")
+	}
+	l.Finish()
+}
@@ -0,0 +1,17 @@
+package limiter
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter returns d shortened by a random fraction of at most fraction , so timers started at the same instant ,
+// for example by goroutines queued by the same spike , don't fire at the same instant. The result stays within
+// [d*(1-fraction) , d] , so a jittered timeout is never longer than configured. It is meant for limiters
+// implemented in other packages.
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return d - time.Duration(float64(d)*min(fraction, 1)*rand.Float64())
+}
@@ -0,0 +1,53 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestJitter(t *testing.T) {
+	assert.Equal(t, time.Second, Jitter(time.Second, 0))
+	for i := 0; i < 100; i++ {
+		d := Jitter(time.Second, 0.2)
+		assert.True(t, d > 800*time.Millisecond && d <= time.Second, "%v", d)
+	}
+}
+
+func TestConcurrentRateLimiter_Jitter(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l, err := NewWithValidation(1,
+		WithTimeoutDuration(100*time.Millisecond),
+		WithTimeoutPolicy(RejectOnTimeout),
+		WithJitter(0.5),
+		WithClock(clk),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	l.Wait(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the timeout fires between half of the timeout and the timeout.
+	clk.Advance(49 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatalf("timed out early: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clk.Advance(51 * time.Millisecond)
+	assert.Equal(t, ErrTimeout, <-errs)
+	assert.Equal(t, 0.5, l.Config().Jitter)
+
+	_, err = NewWithValidation(1, WithJitter(1))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
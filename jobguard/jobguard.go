@@ -0,0 +1,163 @@
+// Package jobguard prevents too many concurrent executions of the same named job , for example a cron job whose
+// run may outlast its schedule. Triggers beyond the limit of a job either wait for an execution to finish or are
+// skipped:
+//
+//	g := jobguard.New(jobguard.WithPolicy(jobguard.Skip))
+//	c.AddFunc("@every 1m" , g.Func("report" , func(ctx context.Context) error {
+//		return buildReport(ctx)
+//	}))
+//
+// The executions of each job are limited by a keyed.Limiter , so different jobs never hold each other back.
+package jobguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/keyed"
+)
+
+// Policy tells what happens to a trigger of a job already running at its limit.
+type Policy int
+
+const (
+	// Queue makes the trigger wait until an execution of the job finishes.
+	Queue Policy = iota
+	// Skip drops the trigger: Run returns ErrSkipped without calling the job.
+	Skip
+)
+
+// ErrSkipped is returned by Run for a trigger skipped because the job is already running at its limit.
+var ErrSkipped = errors.New("jobguard: skipped , the job is already running")
+
+// Guard limits the concurrent executions of named jobs.
+//
+// l: admits the executions , the jobs are its keys
+//
+// limit , patterns: the max concurrent executions of a job , and of the jobs matching the glob patterns
+//
+// policy , policies: the policy of the jobs , and of the jobs given by name
+//
+// onError: called with the errors of the jobs run by the funcs of Func
+type Guard struct {
+	l        *keyed.Limiter
+	limit    int
+	patterns map[string]int
+	policy   Policy
+	policies map[string]Policy
+	onError  func(name string, err error)
+}
+
+type Option func(*Guard)
+
+// New creates a *Guard running a single execution of each job at a time and queueing the other triggers , unless
+// the options say otherwise.
+func New(options ...Option) *Guard {
+	g := &Guard{
+		limit:    1,
+		policy:   Queue,
+		policies: make(map[string]Policy),
+	}
+	for _, o := range options {
+		o(g)
+	}
+	var keyOptions []keyed.Option
+	if len(g.patterns) > 0 {
+		keyOptions = append(keyOptions, keyed.WithPatternLimits(g.patterns))
+	}
+	g.l = keyed.New(g.limit, keyOptions...)
+	return g
+}
+
+// limit: If this field is specified , the max number of concurrent executions of every job , instead of 1.
+func WithLimit(limit int) func(*Guard) {
+	return func(g *Guard) {
+		g.limit = limit
+	}
+}
+
+// patterns: If this field is specified , the max number of concurrent executions of the jobs whose name matches
+// a glob pattern , see keyed.WithPatternLimits. Example: WithJobLimits(map[string]int{"export-*": 3})
+func WithJobLimits(patterns map[string]int) func(*Guard) {
+	return func(g *Guard) {
+		g.patterns = patterns
+	}
+}
+
+// policy: If this field is specified , what happens to the triggers of a job already running at its limit ,
+// instead of Queue.
+func WithPolicy(p Policy) func(*Guard) {
+	return func(g *Guard) {
+		g.policy = p
+	}
+}
+
+// policies: If this field is specified , the policy of the jobs given by name , overriding WithPolicy.
+// Example: WithJobPolicies(map[string]jobguard.Policy{"cleanup": jobguard.Skip})
+func WithJobPolicies(policies map[string]Policy) func(*Guard) {
+	return func(g *Guard) {
+		for name, p := range policies {
+			g.policies[name] = p
+		}
+	}
+}
+
+// onError: If this field is specified , fn is called with the name and the error of every job run by a func of
+// Func that fails or is skipped. The errors are dropped otherwise.
+func WithErrorHandler(fn func(name string, err error)) func(*Guard) {
+	return func(g *Guard) {
+		g.onError = fn
+	}
+}
+
+// Run calls fn , once the job called name is below its limit. If the job is already running at its limit , Run
+// waits for an execution to finish under the Queue policy , or returns ErrSkipped without calling fn under the
+// Skip policy. If ctx is done while the trigger waits , Run returns an error matching both limiter.ErrCanceled and
+// the cause of the cancellation. Otherwise Run returns the error of fn.
+func (g *Guard) Run(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if err := g.enter(ctx, name); err != nil {
+		return err
+	}
+	defer g.l.Finish(name)
+	return fn(ctx)
+}
+
+// Func returns a func running fn as the job called name with a background context , for schedulers taking a
+// func() like cron libraries. The errors of fn and ErrSkipped go to the handler of WithErrorHandler.
+func (g *Guard) Func(name string, fn func(ctx context.Context) error) func() {
+	return func() {
+		if err := g.Run(context.Background(), name, fn); err != nil && g.onError != nil {
+			g.onError(name, err)
+		}
+	}
+}
+
+// Running returns the number of executions of the job called name in progress.
+func (g *Guard) Running(name string) int {
+	return g.l.KeyStats(name).InFlight
+}
+
+// Queued returns the number of triggers of the job called name waiting for an execution to finish.
+func (g *Guard) Queued(name string) int {
+	return g.l.KeyStats(name).Waiting
+}
+
+// enter takes a slot of the job called name , applying its policy if the job is running at its limit.
+func (g *Guard) enter(ctx context.Context, name string) error {
+	p, ok := g.policies[name]
+	if !ok {
+		p = g.policy
+	}
+	if p != Skip {
+		return g.l.Wait(ctx, name)
+	}
+	if ctx.Err() != nil {
+		return limiter.Canceled(ctx)
+	}
+	if !g.l.TryWait(name) {
+		return fmt.Errorf("%w: %s", ErrSkipped, name)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package jobguard
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// block starts the job called name on g and returns once it runs , with the func finishing it.
+func block(t *testing.T, g *Guard, name string) (finish func()) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- g.Run(context.Background(), name, func(ctx context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	return func() {
+		close(release)
+		assert.NoError(t, <-done)
+	}
+}
+
+func TestGuard_Queue(t *testing.T) {
+	g := New()
+	finish := block(t, g, "report")
+	assert.Equal(t, 1, g.Running("report"))
+
+	done := make(chan error)
+	go func() {
+		done <- g.Run(context.Background(), "report", func(ctx context.Context) error { return nil })
+	}()
+	assert.Eventually(t, func() bool { return g.Queued("report") == 1 }, time.Second, time.Millisecond)
+	// other jobs are not held back.
+	assert.NoError(t, g.Run(context.Background(), "cleanup", func(ctx context.Context) error { return nil }))
+
+	finish()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, g.Running("report"))
+
+	finish = block(t, g, "report")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := g.Run(ctx, "report", func(ctx context.Context) error { return nil })
+	assert.True(t, errors.Is(err, limiter.ErrCanceled))
+	finish()
+}
+
+func TestGuard_Skip(t *testing.T) {
+	var mu sync.Mutex
+	var skipped []string
+	g := New(WithLimit(2), WithJobPolicies(map[string]Policy{"cleanup": Skip}), WithErrorHandler(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if errors.Is(err, ErrSkipped) {
+			skipped = append(skipped, name)
+		}
+	}))
+	finish1 := block(t, g, "cleanup")
+	finish2 := block(t, g, "cleanup")
+	ran := false
+	g.Func("cleanup", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})()
+	assert.False(t, ran)
+	assert.Equal(t, []string{"cleanup"}, skipped)
+	assert.Equal(t, 0, g.Queued("cleanup"))
+	finish1()
+	finish2()
+
+	g.Func("cleanup", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})()
+	assert.True(t, ran)
+}
+
+func TestGuard_JobLimits(t *testing.T) {
+	g := New(WithPolicy(Skip), WithJobLimits(map[string]int{"export-*": 2}))
+	finish1 := block(t, g, "export-csv")
+	finish2 := block(t, g, "export-csv")
+	err := g.Run(context.Background(), "export-csv", func(ctx context.Context) error { return nil })
+	assert.True(t, errors.Is(err, ErrSkipped))
+
+	finish3 := block(t, g, "report")
+	err = g.Run(context.Background(), "report", func(ctx context.Context) error { return nil })
+	assert.True(t, errors.Is(err, ErrSkipped))
+	finish1()
+	finish2()
+	finish3()
+}
@@ -0,0 +1,249 @@
+// Package keyed implements a limiter capping the concurrency of every key , for example every tenant , together
+// with a global cap on the sum of all keys:
+//
+//	nl := keyed.New(10 , keyed.WithGlobalLimit(200))
+//	if err := nl.Wait(ctx , tenant); err != nil {
+//		return err
+//	}
+//	defer nl.Finish(tenant)
+//
+// A goroutine is admitted once both its key and the global limit have a free slot , in one atomic decision: the
+// slots are taken at once , so a goroutine never holds a slot of its key while waiting for the global limit. When
+// global headroom opens , the waiting goroutines are admitted in FIFO order among those whose key is below its
+// cap: a key at its cap does not hold back the goroutines of other keys. The state of a key is created on its
+// first use , see hierarchy for the underlying tree of limiters , and evicted once idle if WithIdleTTL is
+// configured.
+package keyed
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+	"github.com/vivek-ng/concurrency-limiter/hierarchy"
+)
+
+// Limiter limits the concurrency per key and globally.
+//
+// global: root of the tree of limiters , the limiters of the keys are its children
+//
+// perKey , patterns: limit of the keys , and of the keys matching the glob patterns
+//
+// keys: the state of the keys , guarded by mu
+//
+// idleTTL , sweeping: the time after which idle keys are evicted and whether a goroutine evicts them
+//
+// closed , stop: whether Close was called , stop is closed by Close to end the goroutine evicting the keys
+//
+// clock: tells the time of the last use of the keys
+type Limiter struct {
+	global   *hierarchy.Limiter
+	perKey   int
+	patterns []pattern
+	mu       sync.Mutex
+	keys     map[string]*key
+	idleTTL  time.Duration
+	sweeping bool
+	closed   bool
+	stop     chan struct{}
+	clock    clock.Clock
+}
+
+// key is the state of a key: its limiter and the time it was last used.
+type key struct {
+	l        *hierarchy.Limiter
+	lastUsed time.Time
+}
+
+type Option func(*Limiter)
+
+// New creates an instance of *Limiter admitting up to perKey concurrent goroutines per key , unless the key matches
+// a pattern of WithPatternLimits. The sum of all keys is not capped unless WithGlobalLimit is configured.
+func New(perKey int, options ...Option) *Limiter {
+	l := &Limiter{
+		global: hierarchy.New(math.MaxInt),
+		perKey: perKey,
+		keys:   make(map[string]*key),
+		stop:   make(chan struct{}),
+		clock:  clock.Real(),
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l
+}
+
+// global: If this field is specified , the max number of concurrent goroutines of all keys together.
+// Example: keyed.New(10 , keyed.WithGlobalLimit(200)) admits up to 10 goroutines per tenant and 200 overall.
+func WithGlobalLimit(global int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.global.SetLimit(global)
+	}
+}
+
+// idleTTL: If this field is specified , the state of a key without goroutines in flight or waiting is evicted
+// once the key has not been used for idleTTL , so the Limiter does not grow forever with short lived keys like
+// client addresses. A goroutine of the Limiter checks the keys every idleTTL while there are keys , so idle keys
+// are evicted between idleTTL and twice idleTTL after their last use. An evicted key starts afresh on its next use.
+// Example: WithIdleTTL(10 * time.Minute)
+func WithIdleTTL(idleTTL time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.idleTTL = idleTTL
+	}
+}
+
+// clock: tells the time of the last use of the keys and drives their eviction. Defaults to the real time. Tests
+// can pass a clock.Fake to control the passage of time instead of sleeping.
+func WithClock(c clock.Clock) func(*Limiter) {
+	return func(l *Limiter) {
+		l.clock = c
+	}
+}
+
+// key returns the limiter of name , creating it on first use , and records that it is used.
+func (l *Limiter) key(name string) *hierarchy.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k, ok := l.keys[name]
+	if !ok {
+		k = &key{l: l.global.Child(l.limitOf(name))}
+		l.keys[name] = k
+		if l.idleTTL > 0 && !l.sweeping && !l.closed {
+			l.sweeping = true
+			go l.sweep()
+		}
+	}
+	k.lastUsed = l.clock.Now()
+	return k.l
+}
+
+// sweep evicts the idle keys every idle TTL , until no key is left or the Limiter is closed.
+func (l *Limiter) sweep() {
+	ticker := l.clock.NewTicker(l.idleTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+		case <-l.stop:
+			return
+		}
+		l.mu.Lock()
+		now := l.clock.Now()
+		for name, k := range l.keys {
+			if now.Sub(k.lastUsed) < l.idleTTL {
+				continue
+			}
+			if s := k.l.Stats(); s.InFlight == 0 && s.Waiting == 0 {
+				delete(l.keys, name)
+			}
+		}
+		if len(l.keys) == 0 {
+			l.sweeping = false
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+	}
+}
+
+// Close stops the goroutine evicting the idle keys , see WithIdleTTL. Keys are no longer evicted afterwards , the
+// Limiter keeps admitting goroutines. Close is idempotent.
+func (l *Limiter) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.stop)
+	}
+}
+
+// Keys returns the sorted keys whose state is kept.
+func (l *Limiter) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.keys))
+	for name := range l.keys {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of keys whose state is kept.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.keys)
+}
+
+// Wait waits until key and the global limit both have a free slot and takes one slot of each. If ctx is done
+// while the goroutine waits , Wait returns an error matching both limiter.ErrCanceled and the cause of the
+// cancellation , and the goroutine must not access the resource. Otherwise Wait returns nil and the goroutine must
+// call Finish with the same key once done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.key(key).Wait(ctx)
+}
+
+// TryWait takes one slot of key and one of the global limit if both have a free slot , without waiting , and
+// reports whether it did. If TryWait returns true , the goroutine must call Finish with the same key once done.
+func (l *Limiter) TryWait(key string) bool {
+	return l.key(key).TryWait()
+}
+
+// Finish gives back the slots of key and of the global limit acquired by a successful Wait , and admits the
+// waiting goroutines that fit now. Finish is a no-op for a key whose state is not kept , which holds no slot.
+func (l *Limiter) Finish(key string) {
+	l.mu.Lock()
+	k, ok := l.keys[key]
+	if ok {
+		k.lastUsed = l.clock.Now()
+	}
+	l.mu.Unlock()
+	if ok {
+		k.l.Finish()
+	}
+}
+
+// Stats returns a snapshot of the global limit: InFlight and Waiting count the goroutines of all keys. Limit is
+// math.MaxInt unless WithGlobalLimit is configured.
+func (l *Limiter) Stats() limiter.Stats {
+	return l.global.Stats()
+}
+
+// KeyStats returns a snapshot of key. A key that has not been used yet has no goroutine in flight or waiting.
+func (l *Limiter) KeyStats(key string) limiter.Stats {
+	l.mu.Lock()
+	k, ok := l.keys[key]
+	l.mu.Unlock()
+	if !ok {
+		return limiter.Stats{Limit: l.limitOf(key)}
+	}
+	return k.l.Stats()
+}
+
+// For returns a limiter.Waiter acquiring the slots of key , for code written against limiter.Waiter.
+func (l *Limiter) For(key string) limiter.Waiter {
+	return forKey{l: l, key: key}
+}
+
+type forKey struct {
+	l   *Limiter
+	key string
+}
+
+func (f forKey) Wait(ctx context.Context) error { return f.l.Wait(ctx, f.key) }
+
+func (f forKey) TryWait() bool { return f.l.TryWait(f.key) }
+
+func (f forKey) Finish() { f.l.Finish(f.key) }
+
+// LimiterIdentity returns the address of the limiter of the key , so limiter.AcquireAll orders the adapters of
+// different keys consistently.
+func (f forKey) LimiterIdentity() uintptr {
+	return reflect.ValueOf(f.l.key(f.key)).Pointer()
+}
@@ -0,0 +1,171 @@
+package keyed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestLimiter_PerKeyAndGlobal(t *testing.T) {
+	nl := New(2, WithGlobalLimit(3))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, "a"))
+	assert.NoError(t, nl.Wait(ctx, "a"))
+	assert.Equal(t, 2, nl.KeyStats("a").InFlight)
+
+	admitted := make(chan string, 3)
+	wait := func(key string) {
+		go func() {
+			if nl.Wait(ctx, key) == nil {
+				admitted <- key
+			}
+		}()
+	}
+	// a is at its cap , b gets the last global slot.
+	wait("a")
+	for nl.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, nl.Wait(ctx, "b"))
+	assert.Equal(t, 3, nl.Stats().InFlight)
+
+	// the global limit is reached: c waits behind a.
+	wait("c")
+	for nl.Stats().Waiting != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 1, nl.KeyStats("c").Waiting)
+
+	// global headroom goes to the first waiter whose key is below its cap.
+	nl.Finish("b")
+	assert.Equal(t, "c", <-admitted)
+	nl.Finish("a")
+	assert.Equal(t, "a", <-admitted)
+	assert.Equal(t, 3, nl.Stats().InFlight)
+	assert.Equal(t, 0, nl.Stats().Waiting)
+	assert.Equal(t, 2, nl.KeyStats("unknown").Limit)
+}
+
+func TestLimiter_For(t *testing.T) {
+	nl := New(1)
+	w := nl.For("a")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, w.Wait(ctx))
+	assert.Error(t, w.Wait(ctx))
+	assert.NoError(t, nl.Wait(ctx, "b"))
+	w.Finish()
+	assert.Equal(t, 0, nl.KeyStats("a").InFlight)
+	assert.Equal(t, 1, nl.Stats().InFlight)
+}
+
+func TestLimiter_TryWait(t *testing.T) {
+	nl := New(1, WithGlobalLimit(2))
+	assert.True(t, nl.TryWait("a"))
+	assert.False(t, nl.TryWait("a"))
+	assert.True(t, limiter.TryWait(nl.For("b")))
+	assert.False(t, nl.TryWait("c"))
+	assert.Equal(t, 0, nl.Stats().Waiting)
+	nl.Finish("a")
+	assert.True(t, nl.TryWait("c"))
+	assert.Equal(t, 2, nl.Stats().InFlight)
+}
+
+func TestLimiter_IdleTTL(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := New(1, WithIdleTTL(time.Minute), WithClock(clk))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, "b"))
+	assert.NoError(t, nl.Wait(ctx, "a"))
+	nl.Finish("b")
+	assert.Equal(t, []string{"a", "b"}, nl.Keys())
+	assert.Equal(t, 2, nl.Len())
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// keys with goroutines in flight are kept.
+	clk.Advance(time.Minute)
+	for nl.Len() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []string{"a"}, nl.Keys())
+
+	// the last use counts from Finish.
+	nl.Finish("a")
+	clk.Advance(time.Minute)
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, nl.Len())
+	assert.Equal(t, 0, nl.Stats().InFlight)
+
+	// an evicted key starts afresh.
+	assert.NoError(t, nl.Wait(ctx, "a"))
+	assert.Equal(t, 1, nl.Len())
+	nl.Finish("a")
+}
+
+func TestLimiter_UnknownKeyFinish(t *testing.T) {
+	nl := New(1, WithGlobalLimit(1))
+	nl.Finish("ghost")
+	assert.Equal(t, 0, nl.Len())
+	assert.Equal(t, 0, nl.Stats().InFlight)
+	assert.True(t, nl.TryWait("a"))
+	assert.False(t, nl.TryWait("b"))
+}
+
+func TestLimiter_Close(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := New(1, WithIdleTTL(time.Minute), WithClock(clk))
+	assert.NoError(t, nl.Wait(context.Background(), "a"))
+	nl.Finish("a")
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	nl.Close()
+	nl.Close()
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Minute)
+	assert.Equal(t, 1, nl.Len())
+	// the Limiter keeps admitting goroutines , without starting a new goroutine to evict the keys.
+	assert.True(t, nl.TryWait("b"))
+	assert.Equal(t, 0, clk.Waiters())
+}
+
+func TestLimiter_ForAcquireAllOrder(t *testing.T) {
+	nl := New(1)
+	wa, wb := nl.For("a"), nl.For("b")
+	first, second := "a", "b"
+	if wb.(forKey).LimiterIdentity() < wa.(forKey).LimiterIdentity() {
+		first, second = "b", "a"
+	}
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, first))
+
+	for _, waiters := range [][]limiter.Waiter{{wa, wb}, {wb, wa}} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			release, err := limiter.AcquireAll(ctx, waiters...)
+			if assert.NoError(t, err) {
+				release()
+			}
+		}()
+		assert.Eventually(t, func() bool { return nl.KeyStats(first).Waiting == 1 }, time.Second, time.Millisecond)
+		// the keys are acquired in a consistent order , so the second one is not held while waiting for the
+		// first one.
+		assert.Equal(t, 0, nl.KeyStats(second).InFlight)
+		nl.Finish(first)
+		<-done
+		assert.NoError(t, nl.Wait(ctx, first))
+	}
+	nl.Finish(first)
+}
@@ -0,0 +1,84 @@
+package keyed
+
+import (
+	"maps"
+	"strings"
+)
+
+// pattern is a glob pattern of keys with the limit of the keys it matches.
+type pattern struct {
+	glob  string
+	limit int
+}
+
+// patternLimits: If this field is specified , the limit of the keys matching a glob pattern , instead of the limit
+// passed to New. In a pattern , '*' matches any sequence of characters , including '/' , and '?' matches any single
+// character. A key matching several patterns gets the limit of the most specific one: the pattern with the most
+// literal characters , so an exact key wins over any wildcard. Keys matching no pattern get the limit passed to New.
+// Example: WithPatternLimits(map[string]int{"/api/v1/export*": 2, "*": 20})
+func WithPatternLimits(patternLimits map[string]int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.patterns = l.patterns[:0]
+		for glob, limit := range maps.Clone(patternLimits) {
+			l.patterns = append(l.patterns, pattern{glob: glob, limit: limit})
+		}
+	}
+}
+
+// limitOf returns the limit of the key name.
+func (l *Limiter) limitOf(name string) int {
+	var best *pattern
+	for i, p := range l.patterns {
+		if match(p.glob, name) && (best == nil || moreSpecific(p.glob, best.glob)) {
+			best = &l.patterns[i]
+		}
+	}
+	if best == nil {
+		return l.perKey
+	}
+	return best.limit
+}
+
+// moreSpecific reports whether the glob pattern a is more specific than b: it has more literal characters , or
+// as many and is longer. Ties are broken by the order of the patterns , so the choice does not depend on the order
+// of the map passed to WithPatternLimits.
+func moreSpecific(a, b string) bool {
+	if la, lb := literals(a), literals(b); la != lb {
+		return la > lb
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a < b
+}
+
+// literals returns the number of characters of the glob pattern that are not wildcards.
+func literals(glob string) int {
+	return len(glob) - strings.Count(glob, "*") - strings.Count(glob, "?")
+}
+
+// match reports whether name matches the glob pattern.
+func match(glob, name string) bool {
+	// star and next are the position of the last '*' in glob and of the character of name it is retried at.
+	star, next := -1, 0
+	g, n := 0, 0
+	for n < len(name) {
+		switch {
+		case g < len(glob) && (glob[g] == '?' || glob[g] == name[n]):
+			g++
+			n++
+		case g < len(glob) && glob[g] == '*':
+			star, next = g, n
+			g++
+		case star >= 0:
+			next++
+			g, n = star+1, next
+		default:
+			return false
+		}
+	}
+	for g < len(glob) && glob[g] == '*' {
+		g++
+	}
+	return g == len(glob)
+}
@@ -0,0 +1,48 @@
+package keyed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		glob, name string
+		match      bool
+	}{
+		{"*", "", true},
+		{"*", "/api/v1/users", true},
+		{"/api/v1/export*", "/api/v1/export", true},
+		{"/api/v1/export*", "/api/v1/exports/42", true},
+		{"/api/v1/export*", "/api/v1/users", false},
+		{"/api/*/users", "/api/v2/users", true},
+		{"/api/*/users", "/api/v2/users/1", false},
+		{"/api/v?/users", "/api/v1/users", true},
+		{"/api/v?/users", "/api/v10/users", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"tenant-a", "tenant-a", true},
+		{"tenant-a", "tenant-ab", false},
+	} {
+		assert.Equal(t, c.match, match(c.glob, c.name), "%s %s", c.glob, c.name)
+	}
+}
+
+func TestLimiter_PatternLimits(t *testing.T) {
+	nl := New(5, WithPatternLimits(map[string]int{
+		"/api/v1/export*":     2,
+		"/api/v1/export/fast": 10,
+		"/api/*":              20,
+	}))
+	assert.Equal(t, 2, nl.KeyStats("/api/v1/export/csv").Limit)
+	assert.Equal(t, 10, nl.KeyStats("/api/v1/export/fast").Limit)
+	assert.Equal(t, 20, nl.KeyStats("/api/v1/users").Limit)
+	assert.Equal(t, 5, nl.KeyStats("/health").Limit)
+
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, "/api/v1/export/csv"))
+	assert.Equal(t, 2, nl.KeyStats("/api/v1/export/csv").Limit)
+	nl.Finish("/api/v1/export/csv")
+}
@@ -0,0 +1,179 @@
+// Package limitertest provides fake limiters for testing code that uses the limiters of this module , without
+// real concurrency.
+//
+// A Fake never blocks: every call to Wait returns the next scripted decision right away , so tests can make
+// Wait fail with any error , for example limiter.ErrQueueFull , and check how the code under test reacts. The
+// Fake also counts the slots it hands out and the calls to Finish , so tests can assert that every acquired
+// slot is released exactly once:
+//
+//	f := limitertest.New()
+//	f.Script(nil , limiter.ErrQueueFull)
+//	handle(f) // calls f.Wait and f.Finish
+//	f.AssertBalanced(t)
+package limitertest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+var (
+	_ limiter.Waiter  = (*Fake)(nil)
+	_ priority.Waiter = (*PriorityFake)(nil)
+)
+
+// Fake is a fake limiter.Waiter. All methods are safe for concurrent use.
+type Fake struct {
+	mu       sync.Mutex
+	script   []error
+	fallback error
+	waits    int
+	acquired int
+	released int
+	extra    int
+}
+
+// New creates a *Fake admitting every goroutine until decisions are scripted.
+func New() *Fake {
+	return &Fake{}
+}
+
+// Script appends decisions for the next calls to Wait , in order: a nil decision admits the goroutine and an
+// error is returned by Wait without admitting it. Once the script is exhausted , Wait returns the fallback
+// decision , see SetFallback.
+func (f *Fake) Script(decisions ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.script = append(f.script, decisions...)
+}
+
+// SetFallback sets the decision applied to the calls to Wait once the script is exhausted. It is nil , which
+// admits every goroutine , by default.
+func (f *Fake) SetFallback(decision error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fallback = decision
+}
+
+// Wait returns the next decision without blocking. Like the real limiters , it returns an error matching
+// limiter.ErrCanceled if ctx is already done.
+func (f *Fake) Wait(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.decide(ctx)
+}
+
+// decide applies the next decision to a call to Wait. The mutex must be held.
+func (f *Fake) decide(ctx context.Context) error {
+	f.waits++
+	if ctx.Err() != nil {
+		return limiter.Canceled(ctx)
+	}
+	err := f.fallback
+	if len(f.script) > 0 {
+		err, f.script = f.script[0], f.script[1:]
+	}
+	if err == nil {
+		f.acquired++
+	}
+	return err
+}
+
+// Finish releases a slot acquired with Wait. Calls to Finish without a matching successful Wait are counted
+// and reported by AssertBalanced.
+func (f *Fake) Finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.released == f.acquired {
+		f.extra++
+		return
+	}
+	f.released++
+}
+
+// Waits returns the number of calls to Wait.
+func (f *Fake) Waits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.waits
+}
+
+// Acquired returns the number of calls to Wait that admitted the goroutine.
+func (f *Fake) Acquired() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.acquired
+}
+
+// InFlight returns the number of slots acquired and not released yet.
+func (f *Fake) InFlight() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.acquired - f.released
+}
+
+// AssertBalanced reports an error to t unless every slot acquired with Wait has been released exactly once
+// with Finish.
+func (f *Fake) AssertBalanced(t testing.TB) bool {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ok := true
+	if n := f.acquired - f.released; n > 0 {
+		t.Errorf("limitertest: %d of %d acquired slots were not released", n, f.acquired)
+		ok = false
+	}
+	if f.extra > 0 {
+		t.Errorf("limitertest: Finish was called %d times without a matching Wait", f.extra)
+		ok = false
+	}
+	return ok
+}
+
+// AssertInFlight reports an error to t unless n slots are acquired and not released yet.
+func (f *Fake) AssertInFlight(t testing.TB, n int) bool {
+	t.Helper()
+	if got := f.InFlight(); got != n {
+		t.Errorf("limitertest: %d slots in flight , want %d", got, n)
+		return false
+	}
+	return true
+}
+
+// PriorityFake is a fake priority.Waiter. It follows the script of its Fake and also records the priorities goroutines were admitted with.
+type PriorityFake struct {
+	*Fake
+	priorities []priority.PriorityValue
+}
+
+// NewPriority creates a *PriorityFake admitting every goroutine until decisions are scripted.
+func NewPriority() *PriorityFake {
+	return &PriorityFake{Fake: New()}
+}
+
+// Wait returns the next decision without blocking , like Fake.Wait.
+func (f *PriorityFake) Wait(ctx context.Context, p priority.PriorityValue) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.decide(ctx)
+	if err == nil {
+		f.priorities = append(f.priorities, p)
+	}
+	return err
+}
+
+// FinishPriority releases a slot acquired with Wait , like Finish.
+func (f *PriorityFake) FinishPriority(p priority.PriorityValue) {
+	f.Finish()
+}
+
+// Priorities returns the priorities of the goroutines admitted by Wait , in the order of the calls.
+func (f *PriorityFake) Priorities() []priority.PriorityValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]priority.PriorityValue(nil), f.priorities...)
+}
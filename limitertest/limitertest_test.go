@@ -0,0 +1,78 @@
+package limitertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// recorder is a testing.TB recording the errors reported to it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestFake_Script(t *testing.T) {
+	f := New()
+	f.Script(nil, limiter.ErrQueueFull)
+	f.SetFallback(limiter.ErrClosed)
+	ctx := context.Background()
+
+	assert.NoError(t, f.Wait(ctx))
+	assert.Equal(t, limiter.ErrQueueFull, f.Wait(ctx))
+	assert.Equal(t, limiter.ErrClosed, f.Wait(ctx))
+	assert.Equal(t, 3, f.Waits())
+	assert.Equal(t, 1, f.Acquired())
+	f.AssertInFlight(t, 1)
+	f.Finish()
+	f.AssertBalanced(t)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.True(t, errors.Is(f.Wait(cctx), limiter.ErrCanceled))
+	assert.Equal(t, 1, f.Acquired())
+}
+
+func TestFake_AssertBalanced(t *testing.T) {
+	f := New()
+	ctx := context.Background()
+	f.Wait(ctx)
+	f.Wait(ctx)
+	f.Finish()
+
+	r := &recorder{TB: t}
+	assert.False(t, f.AssertBalanced(r))
+	assert.Equal(t, []string{"limitertest: 1 of 2 acquired slots were not released"}, r.errors)
+
+	f.Finish()
+	f.Finish()
+	r = &recorder{TB: t}
+	assert.False(t, f.AssertBalanced(r))
+	assert.Equal(t, []string{"limitertest: Finish was called 1 times without a matching Wait"}, r.errors)
+	assert.False(t, f.AssertInFlight(r, 1))
+}
+
+func TestPriorityFake(t *testing.T) {
+	f := NewPriority()
+	f.Script(nil, limiter.ErrDropped, nil)
+	ctx := context.Background()
+
+	assert.NoError(t, f.Wait(ctx, priority.High))
+	assert.Equal(t, limiter.ErrDropped, f.Wait(ctx, priority.Low))
+	assert.NoError(t, f.Wait(ctx, priority.Medium))
+	assert.Equal(t, []priority.PriorityValue{priority.High, priority.Medium}, f.Priorities())
+	f.FinishPriority(priority.High)
+	f.Finish()
+	f.AssertBalanced(t)
+}
@@ -0,0 +1,38 @@
+package limiter
+
+// Pause stops granting slots without rejecting anybody: goroutines calling Wait are queued , subject to the bounds
+// of the waitlist , and slots given back are not handed to the goroutines in the waitlist. The goroutines accessing
+// the resource are not affected. Pause lets operators hold traffic back during an incident , Resume lets it through
+// again. Pausing a paused Limiter does nothing.
+func (l *Limiter) Pause() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paused() {
+		return
+	}
+	l.state.Or(pausedBit)
+	l.version.Add(1)
+}
+
+// Resume grants slots again after Pause , admitting goroutines from the waitlist up to the limit. Resuming a
+// Limiter that is not paused does nothing.
+func (l *Limiter) Resume() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.paused() {
+		return
+	}
+	l.state.And(^uint64(pausedBit))
+	l.version.Add(1)
+	l.admit()
+}
+
+// Paused reports whether the Limiter is paused. It never blocks on the Limiter's mutex.
+func (l *Limiter) Paused() bool {
+	return l.paused()
+}
+
+// paused reports whether the pause bit is set.
+func (l *Limiter) paused() bool {
+	return l.state.Load()&pausedBit != 0
+}
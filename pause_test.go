@@ -0,0 +1,67 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentRateLimiter_Pause(t *testing.T) {
+	l := New(2)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	l.Pause()
+	l.Pause()
+	assert.True(t, l.Paused())
+	assert.True(t, l.Stats().Paused)
+
+	// a free slot is left , but goroutines are queued while the Limiter is paused.
+	done := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			l.Wait(ctx)
+			done <- struct{}{}
+		}()
+	}
+	for l.QueueLen() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	assert.Equal(t, 0, l.InFlight())
+	assert.Equal(t, 3, l.QueueLen())
+
+	l.Resume()
+	l.Resume()
+	assert.False(t, l.Paused())
+	<-done
+	<-done
+	assert.Equal(t, 2, l.InFlight())
+	assert.Equal(t, 1, l.QueueLen())
+	l.Finish()
+	<-done
+	l.FinishN(2)
+}
+
+func TestConcurrentRateLimiter_PauseUnlimited(t *testing.T) {
+	l := New(1, WithUnlimited())
+	ctx := context.Background()
+	l.Pause()
+	done := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			l.Wait(ctx)
+			done <- struct{}{}
+		}()
+	}
+	for l.QueueLen() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Resume()
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	assert.Equal(t, 3, l.InFlight())
+	l.FinishN(3)
+}
@@ -0,0 +1,206 @@
+package limiter
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// states of a Permit.
+const (
+	permitHeld int32 = iota
+	permitReleased
+	permitReclaimed
+)
+
+// Permit is a slot of a Limiter acquired with AcquireCtx. The slot is held until the context passed to
+// AcquireCtx is done or Release is called , whichever happens first. If WithPermitTTL is configured , the
+// permit is a lease that must be renewed , see Renew. If WithMaxHoldDuration is configured , the slot is
+// reclaimed once it has been held for the max hold duration.
+type Permit struct {
+	l      *Limiter
+	token  uint64
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   chan struct{}
+	renew  chan struct{}
+	state  int32
+}
+
+// AcquireCtx waits like Wait and returns a Permit holding the slot. The slot is released automatically when ctx
+// is done , so AcquireCtx suits work whose lifetime is strictly bound to ctx , for example the handling of a
+// request: the caller must not call Finish. Release gives the slot back earlier. A ctx that is never done ,
+// like context.Background , holds the slot until Release is called.
+func (l *Limiter) AcquireCtx(ctx context.Context) (*Permit, error) {
+	if err := l.wait(ctx); err != nil {
+		l.countShed(err)
+		return nil, err
+	}
+	c := l.config()
+	pm := &Permit{
+		l:     l,
+		token: atomic.AddUint64(&l.tokens, 1),
+		stop:  make(chan struct{}),
+		renew: make(chan struct{}, 1),
+	}
+	if c.circuitBreaker != nil {
+		l.mu.Lock()
+		l.breaker.admitted(pm.token)
+		l.mu.Unlock()
+	}
+	pm.ctx, pm.cancel = context.WithCancelCause(ctx)
+	if done := ctx.Done(); done != nil || c.permitTTL > 0 || c.maxHold > 0 {
+		go pm.watch(done, c)
+	}
+	return pm, nil
+}
+
+// AcquireChan acquires a Permit like AcquireCtx in a new goroutine , so the caller can select on the returned
+// channel alongside other channels instead of blocking in Wait. The channel delivers the permit once the slot is
+// acquired , or is closed without delivering anything if Wait fails , for example because ctx is done. Like with
+// AcquireCtx , the slot is released when ctx is done: a caller that gives up receiving must cancel ctx , so a
+// permit delivered in the meantime is not leaked.
+func (l *Limiter) AcquireChan(ctx context.Context) <-chan *Permit {
+	ch := make(chan *Permit, 1)
+	go func() {
+		defer close(ch)
+		if pm, err := l.AcquireCtx(ctx); err == nil {
+			ch <- pm
+		}
+	}()
+	return ch
+}
+
+// watch releases the slot when done is closed , reclaims it if the lease is not renewed within the permit TTL and
+// reclaims it once it has been held for the max hold duration.
+func (pm *Permit) watch(done <-chan struct{}, c *config) {
+	var t clock.Timer
+	var expired, overdue <-chan time.Time
+	if c.permitTTL > 0 {
+		t = c.clock.NewTimer(c.permitTTL)
+		defer func() { t.Stop() }()
+		expired = t.C()
+	}
+	if c.maxHold > 0 {
+		hold := c.clock.NewTimer(c.maxHold)
+		defer hold.Stop()
+		overdue = hold.C()
+	}
+	for {
+		select {
+		case <-done:
+			pm.Release()
+			return
+		case <-pm.stop:
+			return
+		case <-pm.renew:
+			if t != nil {
+				t.Stop()
+				t = c.clock.NewTimer(c.permitTTL)
+				expired = t.C()
+			}
+		case <-expired:
+			if pm.end(permitReclaimed) && c.onReclaim != nil {
+				c.onReclaim()
+			}
+			return
+		case <-overdue:
+			if pm.end(permitReclaimed) && c.onMaxHold != nil {
+				c.onMaxHold()
+			}
+			return
+		}
+	}
+}
+
+// Token returns the fencing token of the permit. Tokens increase monotonically with every permit acquired from
+// the Limiter , so the protected resource can reject requests carrying a token lower than the highest it has
+// seen: a holder whose permit was reclaimed cannot overwrite the work of the holder that got the slot after it.
+func (pm *Permit) Token() uint64 {
+	return pm.token
+}
+
+// Context returns a context derived from the context passed to AcquireCtx , cancelled when the permit is released
+// or reclaimed. Running the work done under the permit with it stops the work when the slot is taken back: if the
+// permit was reclaimed , context.Cause returns ErrReclaimed.
+func (pm *Permit) Context() context.Context {
+	return pm.ctx
+}
+
+// Release gives the slot back to the Limiter. Calling Release more than once , after the context passed to
+// AcquireCtx is done or after the permit has been reclaimed has no effect.
+func (pm *Permit) Release() {
+	pm.end(permitReleased)
+}
+
+// end gives the slot back if the permit is still held , and reports whether it was.
+func (pm *Permit) end(state int32) bool {
+	if !atomic.CompareAndSwapInt32(&pm.state, permitHeld, state) {
+		return false
+	}
+	close(pm.stop)
+	if state == permitReclaimed {
+		pm.cancel(ErrReclaimed)
+	} else {
+		pm.cancel(nil)
+	}
+	l := pm.l
+	l.mu.Lock()
+	if state == permitReclaimed {
+		l.reclaimed++
+	}
+	l.release()
+	l.mu.Unlock()
+	if state == permitReclaimed {
+		l.emit(EventReclaim, 0, ErrReclaimed)
+	}
+	return true
+}
+
+// Renew extends the lease of the permit by the TTL configured with WithPermitTTL. It returns ErrReclaimed if the
+// slot has already been reclaimed: the work done under the permit should then stop. Renew has no effect if no
+// TTL is configured or the permit has been released.
+func (pm *Permit) Renew() error {
+	if atomic.LoadInt32(&pm.state) == permitReclaimed {
+		return ErrReclaimed
+	}
+	select {
+	case pm.renew <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// KeepAlive renews the lease of the permit in the background , three times per TTL , until ctx is done or the
+// permit is released or reclaimed. Tie ctx to the liveness of the work: a holder that hangs while ctx stays alive
+// is not detected. KeepAlive returns ErrReclaimed if the slot has already been reclaimed.
+func (pm *Permit) KeepAlive(ctx context.Context) error {
+	if err := pm.Renew(); err != nil {
+		return err
+	}
+	c := pm.l.config()
+	if c.permitTTL <= 0 {
+		return nil
+	}
+	go func() {
+		period := c.permitTTL / 3
+		if period <= 0 {
+			period = c.permitTTL
+		}
+		t := c.clock.NewTicker(period)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+				pm.Renew()
+			case <-ctx.Done():
+				return
+			case <-pm.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
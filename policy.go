@@ -0,0 +1,98 @@
+package limiter
+
+// RejectionPolicy decides what happens to a goroutine calling Wait when the waitlist
+// has reached the length configured with WithMaxQueueLength.
+type RejectionPolicy int
+
+const (
+	// RejectNew rejects the arriving goroutine with ErrQueueFull. This is the default.
+	RejectNew RejectionPolicy = iota
+	// DropOldest removes the goroutine that has been waiting the longest to make room for the
+	// arriving one. The Wait call of the removed goroutine returns ErrDropped.
+	DropOldest
+	// DropLowestPriority removes the waiting goroutine that would be served last to make room for
+	// the arriving one, if the arriving goroutine would be served before it. Otherwise the arriving
+	// goroutine is rejected with ErrQueueFull. The Wait call of the removed goroutine returns ErrDropped.
+	// In the FIFO Limiter the arriving goroutine is always served last , so this behaves like RejectNew.
+	DropLowestPriority
+	// BlockCaller blocks the arriving goroutine until there is room in the waitlist or its context is done.
+	BlockCaller
+)
+
+// String returns the name of the policy.
+func (p RejectionPolicy) String() string {
+	switch p {
+	case RejectNew:
+		return "RejectNew"
+	case DropOldest:
+		return "DropOldest"
+	case DropLowestPriority:
+		return "DropLowestPriority"
+	case BlockCaller:
+		return "BlockCaller"
+	}
+	return "RejectionPolicy(unknown)"
+}
+
+// Valid reports whether p is one of the defined policies.
+func (p RejectionPolicy) Valid() bool {
+	return p >= RejectNew && p <= BlockCaller
+}
+
+// AdmissionPolicy decides how many goroutines Finish removes from the waitlist. It matters once the number of
+// goroutines accessing the resource has drifted away from the limit , for instance because timed out goroutines
+// were let through above the limit.
+type AdmissionPolicy int
+
+const (
+	// AdmitOne removes at most one goroutine from the waitlist on every call to Finish , even if the number of
+	// goroutines accessing the resource is above the limit. This is the default.
+	AdmitOne AdmissionPolicy = iota
+	// AdmitUpToLimit removes goroutines from the waitlist on every call to Finish until the number of goroutines
+	// accessing the resource reaches the limit. Finish admits no goroutine while that number is still above the
+	// limit , and admits several if it is more than one below the limit.
+	AdmitUpToLimit
+)
+
+// String returns the name of the policy.
+func (p AdmissionPolicy) String() string {
+	switch p {
+	case AdmitOne:
+		return "AdmitOne"
+	case AdmitUpToLimit:
+		return "AdmitUpToLimit"
+	}
+	return "AdmissionPolicy(unknown)"
+}
+
+// Valid reports whether p is one of the defined policies.
+func (p AdmissionPolicy) Valid() bool {
+	return p == AdmitOne || p == AdmitUpToLimit
+}
+
+// TimeoutPolicy decides what happens to a goroutine that is still in the waitlist when the timeout configured
+// with WithTimeoutDuration expires.
+type TimeoutPolicy int
+
+const (
+	// AdmitOnTimeout lets the goroutine access the resource , even if this exceeds the limit. This is the default.
+	AdmitOnTimeout TimeoutPolicy = iota
+	// RejectOnTimeout makes Wait return ErrTimeout. The goroutine must not access the resource.
+	RejectOnTimeout
+)
+
+// String returns the name of the policy.
+func (p TimeoutPolicy) String() string {
+	switch p {
+	case AdmitOnTimeout:
+		return "AdmitOnTimeout"
+	case RejectOnTimeout:
+		return "RejectOnTimeout"
+	}
+	return "TimeoutPolicy(unknown)"
+}
+
+// Valid reports whether p is one of the defined policies.
+func (p TimeoutPolicy) Valid() bool {
+	return p == AdmitOnTimeout || p == RejectOnTimeout
+}
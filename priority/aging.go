@@ -0,0 +1,64 @@
+package priority
+
+import (
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// aging is the dynamic period of a queued goroutine and the time it ages next , see WithAgingScanInterval.
+type aging struct {
+	period time.Duration
+	next   time.Time
+}
+
+// schedule registers the queued goroutine w to be aged every period by the scanning goroutine , and starts it if
+// it is not running.
+func (p *PriorityLimiter) schedule(w *queue.Item, period time.Duration) {
+	c := p.config()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.aging[w] = &aging{period: period, next: c.clock.Now().Add(period)}
+	if !p.scanning {
+		p.scanning = true
+		go p.scan()
+	}
+}
+
+// unschedule forgets the goroutine w once it leaves Wait , before its item can be reused by another goroutine.
+func (p *PriorityLimiter) unschedule(w *queue.Item) {
+	p.mu.Lock()
+	delete(p.aging, w)
+	p.mu.Unlock()
+}
+
+// scan ages the scheduled goroutines whose dynamic period has passed every aging scan interval , until no
+// goroutine is scheduled anymore.
+func (p *PriorityLimiter) scan() {
+	ticker := p.config().clock.NewTicker(p.config().agingScan)
+	defer ticker.Stop()
+	var changes []PriorityChange
+	for range ticker.C() {
+		c := p.config()
+		now := c.clock.Now()
+		p.mu.Lock()
+		if len(p.aging) == 0 {
+			p.scanning = false
+			p.mu.Unlock()
+			return
+		}
+		changes = changes[:0]
+		for w, a := range p.aging {
+			for !now.Before(a.next) {
+				a.next = a.next.Add(a.period)
+				if change, ok := p.ageLocked(c, w); ok {
+					changes = append(changes, change)
+				}
+			}
+		}
+		p.mu.Unlock()
+		for _, change := range changes {
+			p.changed(change)
+		}
+	}
+}
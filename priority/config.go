@@ -0,0 +1,378 @@
+package priority
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// config holds the settings of a PriorityLimiter. A config is immutable once the PriorityLimiter has been
+// created: changes are made by publishing a modified copy , so the settings can be read
+// without taking the mutex.
+//
+// limit: max number of concurrent goroutines that can access aresource
+//
+// unlimited: If this field is set , the limit is ignored and every goroutine proceeds immediately
+//
+// dynamicPeriod: If this field is specified , priority is increased for low priority goroutines periodically by the
+// interval specified by dynamicPeriod
+//
+// agingPeriods: If this field is specified , the dynamic period of the goroutines calling Wait with a priority in
+// it , instead of dynamicPeriod
+//
+// agingFunc: If this field is specified , it computes the new priority of a goroutine every dynamicPeriod
+//
+// agingScan: If this field is specified , the interval at which a single goroutine of the PriorityLimiter ages the
+// queued goroutines , instead of a ticker per goroutine
+//
+// priorityRange: If this field is specified , the range of priorities accepted by Wait
+//
+// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
+// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+//
+// priorityTimeouts: If this field is specified , the timeout of the goroutines calling Wait with a priority in it ,
+// instead of timeout
+//
+// jitter: If this field is specified , the timeouts and dynamic periods of the goroutines are shortened by a random
+// fraction of at most jitter
+//
+// spin: number of times a queued goroutine yields the processor and checks for a slot before it parks
+//
+// timeoutPolicy: decides whether goroutines removed after the timeout access the resource
+//
+// deadlineAsTimeout: If this field is set , the deadline of the context is used as the timeout when it expires first
+//
+// deadlineAwareRejection: If this field is set , goroutines whose estimated wait exceeds their deadline are rejected
+//
+// maxQueueLength: If this field is specified , goroutines will be rejected with limiter.ErrQueueFull instead of
+// being added to the priority queue once the queue holds this many goroutines.
+//
+// queueLimits: If this field is specified , the max number of goroutines of a priority class in the priority queue
+//
+// rejectionPolicy: decides what happens when a goroutine arrives while the priority queue , or the queue of its
+// priority class , is full
+//
+// deadlineCurve: If this field is specified , goroutines whose context has a deadline are queued with at least the
+// priority the curve assigns to the time remaining until the deadline
+//
+// edf: If this field is set , goroutines are ordered by the deadline of their context instead of their priority
+//
+// admissionPolicy: decides how many goroutines Finish removes from the priority queue
+//
+// weights: If this field is specified , the goroutines sharing a priority are served by weighted fair queuing among
+// their flows , see WithFlowWeights
+//
+// lottery: If this field is set , the goroutine served next is drawn at random with chances proportional to its
+// priority
+//
+// preemption: If this field is set , queued goroutines ask lower priority permit holders to give up their slot
+//
+// quota: If this field is specified , the number of slots reserved for each priority
+//
+// maxWait: If this field is specified , goroutines waiting for longer are admitted before every other goroutine
+//
+// clock: tells the time and creates the timers and tickers
+//
+// timerTick: If this field is specified , the resolution of the timer wheel driving the timeouts and the dynamic
+// priority of the goroutines in the priority queue
+//
+// permitTTL , onReclaim: If permitTTL is specified , permits not renewed within permitTTL are reclaimed and
+// onReclaim is called
+//
+// onPriorityChange: called when the priority of a queued goroutine changes or it is promoted past maxWait
+//
+// logger , levels: If logger is specified , the events of the PriorityLimiter are logged at the level of their
+// kind. See WithLogger
+//
+// history: If this field is positive , the last history events of the PriorityLimiter are kept for RecentEvents
+//
+// maxHold , onMaxHold: If maxHold is specified , slots held for longer than maxHold are reclaimed and onMaxHold
+// is called
+type config struct {
+	limit         int
+	dynamicPeriod *time.Duration
+	agingPeriods  map[PriorityValue]time.Duration
+	agingFunc     func(current int, waited time.Duration) int
+	agingScan     time.Duration
+	priorityRange *priorityRange
+	timeout       *time.Duration
+	timeoutPolicy limiter.TimeoutPolicy
+
+	priorityTimeouts map[PriorityValue]time.Duration
+	jitter           float64
+	spin             int
+	maxQueueLength   *int
+	queueLimits      map[PriorityValue]int
+	rejectionPolicy  limiter.RejectionPolicy
+	deadlineCurve    DeadlineCurve
+	edf              bool
+	admissionPolicy  limiter.AdmissionPolicy
+	preemption       bool
+	weights          map[string]int
+	lottery          bool
+	quota            map[PriorityValue]int
+	maxWait          time.Duration
+
+	deadlineAsTimeout      bool
+	deadlineAwareRejection bool
+	unlimited              bool
+
+	clock     clock.Clock
+	timerTick time.Duration
+
+	permitTTL time.Duration
+	onReclaim func()
+
+	maxHold   time.Duration
+	onMaxHold func()
+
+	onPriorityChange func(PriorityChange)
+
+	logger  *slog.Logger
+	levels  map[limiter.EventKind]slog.Level
+	history int
+}
+
+// priorityRange is the inclusive range of valid priorities.
+type priorityRange struct {
+	min PriorityValue
+	max PriorityValue
+}
+
+// countsQueued reports whether the goroutines in the priority queue are counted per priority class , which quotas
+// and queue limits require.
+func (c *config) countsQueued() bool {
+	return c.quota != nil || c.queueLimits != nil
+}
+
+// validate returns an error wrapping limiter.ErrInvalidConfig if the settings are invalid or contradict each other.
+func (c *config) validate() error {
+	invalid := limiter.ErrInvalidConfig
+	switch {
+	case c.limit <= 0 && !c.unlimited:
+		return fmt.Errorf("%w: limit must be positive , got %d", invalid, c.limit)
+	case c.timeout != nil && *c.timeout <= 0:
+		return fmt.Errorf("%w: timeout must be positive , got %v", invalid, *c.timeout)
+	case c.dynamicPeriod != nil && *c.dynamicPeriod <= 0:
+		return fmt.Errorf("%w: dynamic period must be positive , got %v", invalid, *c.dynamicPeriod)
+	case c.agingScan < 0:
+		return fmt.Errorf("%w: aging scan interval must not be negative , got %v", invalid, c.agingScan)
+	case c.jitter < 0 || c.jitter >= 1:
+		return fmt.Errorf("%w: jitter must be at least 0 and below 1 , got %v", invalid, c.jitter)
+	case c.spin < 0:
+		return fmt.Errorf("%w: spin must not be negative , got %d", invalid, c.spin)
+	case !c.timeoutPolicy.Valid():
+		return fmt.Errorf("%w: unknown timeout policy %d", invalid, int(c.timeoutPolicy))
+	case c.timeout == nil && c.priorityTimeouts == nil && !c.deadlineAsTimeout && c.timeoutPolicy != limiter.AdmitOnTimeout:
+		return fmt.Errorf("%w: timeout policy %v has no effect without a timeout", invalid, c.timeoutPolicy)
+	case c.agingFunc != nil && c.dynamicPeriod == nil && c.agingPeriods == nil:
+		return fmt.Errorf("%w: an aging func has no effect without a dynamic period", invalid)
+	case c.maxQueueLength != nil && *c.maxQueueLength < 0:
+		return fmt.Errorf("%w: max queue length must not be negative , got %d", invalid, *c.maxQueueLength)
+	case c.maxQueueLength == nil && c.queueLimits == nil && c.rejectionPolicy != limiter.RejectNew:
+		return fmt.Errorf("%w: rejection policy %v has no effect without a max queue length", invalid, c.rejectionPolicy)
+	case !c.rejectionPolicy.Valid():
+		return fmt.Errorf("%w: unknown rejection policy %d", invalid, int(c.rejectionPolicy))
+	case !c.admissionPolicy.Valid():
+		return fmt.Errorf("%w: unknown admission policy %d", invalid, int(c.admissionPolicy))
+	case c.edf && (c.dynamicPeriod != nil || c.agingPeriods != nil || c.deadlineCurve != nil):
+		return fmt.Errorf("%w: earliest deadline first ignores priorities and cannot be combined with dynamic or deadline derived priority", invalid)
+	case c.edf && c.weights != nil:
+		return fmt.Errorf("%w: earliest deadline first cannot be combined with flow weights", invalid)
+	case c.lottery && (c.edf || c.weights != nil):
+		return fmt.Errorf("%w: lottery scheduling cannot be combined with earliest deadline first or flow weights", invalid)
+	case c.priorityRange != nil && c.priorityRange.min > c.priorityRange.max:
+		return fmt.Errorf("%w: empty priority range [%d , %d]", invalid, c.priorityRange.min, c.priorityRange.max)
+	case c.maxWait < 0:
+		return fmt.Errorf("%w: max wait before promotion must not be negative , got %v", invalid, c.maxWait)
+	case c.clock == nil:
+		return fmt.Errorf("%w: clock must not be nil", invalid)
+	case c.timerTick < 0:
+		return fmt.Errorf("%w: timer wheel tick must not be negative , got %v", invalid, c.timerTick)
+	case c.permitTTL < 0:
+		return fmt.Errorf("%w: permit TTL must not be negative , got %v", invalid, c.permitTTL)
+	case c.maxHold < 0:
+		return fmt.Errorf("%w: max hold duration must not be negative , got %v", invalid, c.maxHold)
+	case c.history < 0:
+		return fmt.Errorf("%w: event history must not be negative , got %d", invalid, c.history)
+	}
+	for priority, period := range c.agingPeriods {
+		if period <= 0 {
+			return fmt.Errorf("%w: dynamic period of priority %d must be positive , got %v", invalid, priority, period)
+		}
+		if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+			return fmt.Errorf("%w: dynamic period for priority %d outside of the priority range", invalid, priority)
+		}
+	}
+	for priority, timeout := range c.priorityTimeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: timeout of priority %d must be positive , got %v", invalid, priority, timeout)
+		}
+		if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+			return fmt.Errorf("%w: timeout for priority %d outside of the priority range", invalid, priority)
+		}
+	}
+	for flow, w := range c.weights {
+		if w <= 0 {
+			return fmt.Errorf("%w: weight of flow %q must be positive , got %d", invalid, flow, w)
+		}
+	}
+	for priority, n := range c.queueLimits {
+		if n < 0 {
+			return fmt.Errorf("%w: queue limit of priority %d must not be negative , got %d", invalid, priority, n)
+		}
+		if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+			return fmt.Errorf("%w: queue limit for priority %d outside of the priority range", invalid, priority)
+		}
+	}
+	for priority, n := range c.quota {
+		if n < 0 {
+			return fmt.Errorf("%w: quota of priority %d must not be negative , got %d", invalid, priority, n)
+		}
+		if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+			return fmt.Errorf("%w: quota for priority %d outside of the priority range", invalid, priority)
+		}
+	}
+	return nil
+}
+
+// Config is a snapshot of the configuration of a PriorityLimiter.
+//
+// DynamicPeriod and Timeout are zero if they are not configured and MaxQueueLength is -1 if the
+// priority queue is unbounded.
+type Config struct {
+	Limit           int
+	DynamicPeriod   time.Duration
+	Timeout         time.Duration
+	TimeoutPolicy   limiter.TimeoutPolicy
+	Jitter          float64
+	Spin            int
+	MaxQueueLength  int
+	RejectionPolicy limiter.RejectionPolicy
+	DeadlineCurve   DeadlineCurve
+	// EarliestDeadlineFirst is true if goroutines are ordered by the deadline of their context.
+	EarliestDeadlineFirst bool
+	AdmissionPolicy       limiter.AdmissionPolicy
+	Preemption            bool
+	Lottery               bool
+	// PriorityQuota is nil if no quotas are configured.
+	PriorityQuota map[PriorityValue]int
+	// PriorityTimeouts is nil if no priority has a timeout of its own.
+	PriorityTimeouts map[PriorityValue]time.Duration
+	// AgingPeriods is nil if no priority has a dynamic period of its own.
+	AgingPeriods map[PriorityValue]time.Duration
+	// AgingScanInterval is zero unless the queued goroutines are aged by a single scheduler goroutine.
+	AgingScanInterval time.Duration
+	// PriorityQueueLimits is nil if the queues of the priorities are not bounded.
+	PriorityQueueLimits map[PriorityValue]int
+	// FlowWeights is nil unless the flows sharing a priority are served by weighted fair queuing.
+	FlowWeights map[string]int
+	// MaxWaitBeforePromotion is zero if it is not configured.
+	MaxWaitBeforePromotion time.Duration
+	// AgingFunc is nil if the default aging is used.
+	AgingFunc func(current int, waited time.Duration) int
+	// PriorityRange is false if any priority is accepted , MinPriority and MaxPriority are then zero.
+	PriorityRange bool
+	MinPriority   PriorityValue
+	MaxPriority   PriorityValue
+
+	DeadlineAsTimeout      bool
+	DeadlineAwareRejection bool
+	// Limit is ignored if Unlimited is set.
+	Unlimited bool
+
+	// TimerWheelTick is zero unless the timeouts and the dynamic priority are driven by a timer wheel.
+	TimerWheelTick time.Duration
+
+	// PermitTTL is zero if permits have no lease and MaxHoldDuration is zero if slots can be held indefinitely.
+	PermitTTL       time.Duration
+	MaxHoldDuration time.Duration
+}
+
+// config returns the current settings. Options run before the PriorityLimiter is returned by NewLimiter ,
+// so they are allowed to modify the returned config in place.
+func (p *PriorityLimiter) config() *config {
+	return p.cfg.Load().(*config)
+}
+
+// updateConfig publishes a modified copy of the current settings. The mutex must be held.
+func (p *PriorityLimiter) updateConfig(update func(c *config)) *config {
+	c := *p.config()
+	update(&c)
+	p.cfg.Store(&c)
+	return &c
+}
+
+// Limit returns the max number of concurrent goroutines that can access the resource.
+// It never blocks on the PriorityLimiter's mutex.
+func (p *PriorityLimiter) Limit() int {
+	return p.config().limit
+}
+
+// Config returns a snapshot of the configuration of the PriorityLimiter.
+// It never blocks on the PriorityLimiter's mutex.
+func (p *PriorityLimiter) Config() Config {
+	c := p.config()
+	s := Config{
+		Limit:           c.limit,
+		TimeoutPolicy:   c.timeoutPolicy,
+		Jitter:          c.jitter,
+		Spin:            c.spin,
+		MaxQueueLength:  -1,
+		RejectionPolicy: c.rejectionPolicy,
+		DeadlineCurve:   c.deadlineCurve,
+
+		EarliestDeadlineFirst: c.edf,
+		AdmissionPolicy:       c.admissionPolicy,
+		Preemption:            c.preemption,
+		Lottery:               c.lottery,
+
+		MaxWaitBeforePromotion: c.maxWait,
+		AgingFunc:              c.agingFunc,
+		DeadlineAsTimeout:      c.deadlineAsTimeout,
+		DeadlineAwareRejection: c.deadlineAwareRejection,
+		Unlimited:              c.unlimited,
+
+		AgingScanInterval: c.agingScan,
+		TimerWheelTick:    c.timerTick,
+		PermitTTL:         c.permitTTL,
+		MaxHoldDuration:   c.maxHold,
+	}
+	if c.dynamicPeriod != nil {
+		s.DynamicPeriod = *c.dynamicPeriod
+	}
+	if c.timeout != nil {
+		s.Timeout = *c.timeout
+	}
+	if c.maxQueueLength != nil {
+		s.MaxQueueLength = *c.maxQueueLength
+	}
+	if c.priorityRange != nil {
+		s.PriorityRange = true
+		s.MinPriority = c.priorityRange.min
+		s.MaxPriority = c.priorityRange.max
+	}
+	if c.quota != nil {
+		s.PriorityQuota = make(map[PriorityValue]int, len(c.quota))
+		for priority, n := range c.quota {
+			s.PriorityQuota[priority] = n
+		}
+	}
+	if c.priorityTimeouts != nil {
+		s.PriorityTimeouts = maps.Clone(c.priorityTimeouts)
+	}
+	if c.agingPeriods != nil {
+		s.AgingPeriods = maps.Clone(c.agingPeriods)
+	}
+	if c.queueLimits != nil {
+		s.PriorityQueueLimits = maps.Clone(c.queueLimits)
+	}
+	if c.weights != nil {
+		s.FlowWeights = maps.Clone(c.weights)
+	}
+	return s
+}
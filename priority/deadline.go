@@ -0,0 +1,121 @@
+package priority
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeadlineStep maps goroutines whose context expires within Within to Priority.
+type DeadlineStep struct {
+	Within   time.Duration
+	Priority PriorityValue
+}
+
+// DeadlineCurve maps the time remaining until the deadline of a goroutine's context to a priority.
+// The first step whose Within is greater than or equal to the remaining time applies, so the steps
+// should be sorted by Within. ParseDeadlineCurve builds a sorted curve from its text form.
+//
+// A DeadlineCurve implements encoding.TextUnmarshaler , so it can be loaded from JSON , YAML or
+// command line flags with the same syntax as ParseDeadlineCurve.
+type DeadlineCurve []DeadlineStep
+
+// ParseDeadlineCurve parses a comma separated list of duration:priority pairs, for instance
+// "50ms:High,200ms:MediumHigh,1s:2". Priorities are either PriorityValue names or integers.
+func ParseDeadlineCurve(s string) (DeadlineCurve, error) {
+	var curve DeadlineCurve
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.Split(field, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("priority: invalid deadline curve step %q", field)
+		}
+		within, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("priority: invalid deadline curve step %q: %v", field, err)
+		}
+		pr, err := parsePriority(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("priority: invalid deadline curve step %q: %v", field, err)
+		}
+		curve = append(curve, DeadlineStep{
+			Within:   within,
+			Priority: pr,
+		})
+	}
+	sort.SliceStable(curve, func(i, j int) bool {
+		return curve[i].Within < curve[j].Within
+	})
+	return curve, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *DeadlineCurve) UnmarshalText(text []byte) error {
+	curve, err := ParseDeadlineCurve(string(text))
+	if err != nil {
+		return err
+	}
+	*c = curve
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c DeadlineCurve) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// String returns the curve in the format accepted by ParseDeadlineCurve.
+func (c DeadlineCurve) String() string {
+	steps := make([]string, len(c))
+	for i, step := range c {
+		steps[i] = step.Within.String() + ":" + strconv.Itoa(int(step.Priority))
+	}
+	return strings.Join(steps, ",")
+}
+
+// Priority returns the priority for a goroutine whose deadline is remaining away. ok is false
+// if the deadline is further away than every step of the curve.
+func (c DeadlineCurve) Priority(remaining time.Duration) (priority PriorityValue, ok bool) {
+	for _, step := range c {
+		if remaining <= step.Within {
+			return step.Priority, true
+		}
+	}
+	return 0, false
+}
+
+// adjust raises priority to the priority the curve assigns to the deadline of ctx at now.
+func (c DeadlineCurve) adjust(ctx context.Context, now time.Time, priority PriorityValue) PriorityValue {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return priority
+	}
+	if pr, ok := c.Priority(deadline.Sub(now)); ok && pr > priority {
+		return pr
+	}
+	return priority
+}
+
+func parsePriority(s string) (PriorityValue, error) {
+	switch s {
+	case "Low":
+		return Low, nil
+	case "Medium":
+		return Medium, nil
+	case "MediumHigh":
+		return MediumHigh, nil
+	case "High":
+		return High, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown priority %q", s)
+	}
+	return PriorityValue(n), nil
+}
@@ -0,0 +1,103 @@
+package priority
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeadlineCurve(t *testing.T) {
+	curve, err := ParseDeadlineCurve("1s:2, 50ms:High,200ms:MediumHigh")
+	assert.NoError(t, err)
+	assert.Equal(t, DeadlineCurve{
+		{50 * time.Millisecond, High},
+		{200 * time.Millisecond, MediumHigh},
+		{time.Second, Medium},
+	}, curve)
+	assert.Equal(t, "50ms:4,200ms:3,1s:2", curve.String())
+
+	pr, ok := curve.Priority(100 * time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, MediumHigh, pr)
+	_, ok = curve.Priority(2 * time.Second)
+	assert.False(t, ok)
+
+	_, err = ParseDeadlineCurve("50ms")
+	assert.Error(t, err)
+	_, err = ParseDeadlineCurve("soon:High")
+	assert.Error(t, err)
+	_, err = ParseDeadlineCurve("50ms:Urgent")
+	assert.Error(t, err)
+}
+
+func TestDeadlineCurve_UnmarshalJSON(t *testing.T) {
+	var conf struct {
+		Curve DeadlineCurve `json:"curve"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"curve": "10ms:High"}`), &conf))
+	assert.Equal(t, DeadlineCurve{{10 * time.Millisecond, High}}, conf.Curve)
+}
+
+func TestPriorityLimiter_DeadlinePriority(t *testing.T) {
+	nl := NewLimiter(1,
+		WithDeadlinePriority(DeadlineCurve{{time.Second, High}}),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	granted := make(chan string, 2)
+	go func() {
+		nl.Wait(ctx, Medium)
+		granted <- "no deadline"
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	dctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	go func() {
+		nl.Wait(dctx, Low)
+		granted <- "deadline"
+	}()
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	assert.Equal(t, "deadline", <-granted)
+	nl.Finish()
+	assert.Equal(t, "no deadline", <-granted)
+}
+
+func TestPriorityLimiter_EarliestDeadlineFirst(t *testing.T) {
+	nl := NewLimiter(1,
+		WithEarliestDeadlineFirst(),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	granted := make(chan int, 3)
+	timeouts := []time.Duration{0, time.Hour, time.Minute}
+	for i, d := range timeouts {
+		wctx := ctx
+		if d > 0 {
+			var cancel context.CancelFunc
+			wctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		go func(id int) {
+			// the static priority is ignored in EDF mode.
+			nl.Wait(wctx, PriorityValue(High-PriorityValue(id)))
+			granted <- id
+		}(i)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, id := range []int{2, 1, 0} {
+		nl.Finish()
+		assert.Equal(t, id, <-granted)
+	}
+}
@@ -0,0 +1,62 @@
+package priority
+
+import (
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// RecentEvents returns the last events of the PriorityLimiter , oldest first , or nil unless WithEventHistory is
+// configured.
+func (p *PriorityLimiter) RecentEvents() []limiter.Event {
+	if p.events == nil {
+		return nil
+	}
+	return p.events.Events()
+}
+
+// emit completes e with the time and the limit , records it for RecentEvents and reports it to the logger
+// configured with WithLogger. The mutex must not be held: the handler of the logger may block.
+func (p *PriorityLimiter) emit(e limiter.Event) {
+	c := p.config()
+	if c.logger == nil && p.events == nil {
+		return
+	}
+	e.Time, e.Limit = c.clock.Now(), c.limit
+	if p.events != nil {
+		p.events.Add(e)
+	}
+	if c.logger == nil {
+		return
+	}
+	level, ok := c.levels[e.Kind]
+	if !ok {
+		level = e.Kind.Level()
+	}
+	e.Log(c.logger, level)
+}
+
+// timedOut reports that w left the priority queue after its timeout with err.
+func (p *PriorityLimiter) timedOut(w *queue.Item, err error) {
+	p.emit(limiter.Event{
+		Kind:     limiter.EventTimeout,
+		Priority: priorityOf(w.Priority),
+		Wait:     p.config().clock.Now().Sub(w.EnqueuedAt()),
+		Err:      err,
+	})
+}
+
+// changed reports a change of priority to the onPriorityChange func , and promotions to the logger.
+func (p *PriorityLimiter) changed(pc PriorityChange) {
+	c := p.config()
+	if c.onPriorityChange != nil {
+		c.onPriorityChange(pc)
+	}
+	if pc.Promoted || pc.New > pc.Old {
+		p.emit(limiter.Event{Kind: limiter.EventPromotion, Priority: priorityOf(int(pc.New)), Wait: pc.Waited})
+	}
+}
+
+// priorityOf returns a pointer to a copy of priority , for limiter.Event.
+func priorityOf(priority int) *int {
+	return &priority
+}
@@ -0,0 +1,85 @@
+package priority
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use by the handler of a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPriorityLimiter_Logger(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	nl := NewLimiter(1,
+		WithLogger(logger),
+		WithTimeoutDuration(20*time.Millisecond),
+		WithTimeoutPolicy(limiter.RejectOnTimeout),
+		WithEventLevel(limiter.EventPromotion, slog.LevelInfo),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+
+	hctx, h := WithHandle(ctx)
+	done := make(chan error)
+	go func() {
+		done <- nl.Wait(hctx, Medium)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, nl.Boost(h, High))
+	// lowering the priority is not a promotion.
+	assert.True(t, nl.Boost(h, Low))
+	assert.True(t, errors.Is(<-done, limiter.ErrTimeout))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `level=INFO msg="limiter promotion" priority=4 wait=`)
+		assert.Contains(t, lines[1], `level=WARN msg="limiter timeout" priority=1 wait=`)
+		assert.Contains(t, lines[1], "limit=1 error=")
+	}
+}
+
+func TestPriorityLimiter_RecentEvents(t *testing.T) {
+	assert.Nil(t, NewLimiter(1).RecentEvents())
+
+	nl := NewLimiter(1, WithEventHistory(10), WithMaxQueueLength(0))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.True(t, errors.Is(nl.Wait(ctx, High), limiter.ErrQueueFull))
+	nl.SetLimit(2)
+	events := nl.RecentEvents()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, limiter.EventShed, events[0].Kind)
+		assert.Equal(t, int(High), *events[0].Priority)
+		assert.True(t, errors.Is(events[0].Err, limiter.ErrQueueFull))
+		assert.Equal(t, limiter.EventLimitChange, events[1].Kind)
+		assert.Nil(t, events[1].Priority)
+		assert.Equal(t, 2, events[1].Limit)
+	}
+}
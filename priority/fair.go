@@ -0,0 +1,114 @@
+package priority
+
+import "github.com/vivek-ng/concurrency-limiter/queue"
+
+// fairQueue implements self-clocked weighted fair queuing among the flows of each priority class , see
+// WithFlowWeights. It works like the fair queuing of limiter.WithFairQueuing , with a virtual time per class: every
+// goroutine entering the priority queue is stamped with a virtual finish time , its flow's previous finish time in
+// its class , or the virtual time of the class if the flow is idle , plus the inverse of the flow's weight. Among
+// goroutines with the same priority , the one with the earliest finish time is served first , and the virtual time
+// of its class advances to its finish time.
+//
+// classes: the state of the classes with queued goroutines
+type fairQueue struct {
+	classes map[int]*fairClass
+}
+
+// fairClass is the state of the fair queuing of a priority class.
+//
+// vtime: the virtual time of the class
+//
+// flows: number of queued goroutines and finish time of the last goroutine queued , per flow with queued goroutines
+type fairClass struct {
+	vtime float64
+	flows map[string]*flowState
+}
+
+type flowState struct {
+	queued int
+	last   float64
+}
+
+// enqueue stamps w , a goroutine of a flow with the given weight , with its finish time. The mutex must be held.
+func (q *fairQueue) enqueue(w *queue.Item, weight int) {
+	if q.classes == nil {
+		q.classes = make(map[int]*fairClass)
+	}
+	fc := q.classes[w.Class]
+	if fc == nil {
+		fc = &fairClass{flows: make(map[string]*flowState)}
+		q.classes[w.Class] = fc
+	}
+	f := fc.flows[w.Flow]
+	if f == nil {
+		f = &flowState{last: fc.vtime}
+		fc.flows[w.Flow] = f
+	}
+	if f.last < fc.vtime {
+		f.last = fc.vtime
+	}
+	f.last += 1 / float64(weight)
+	f.queued++
+	w.Finish = f.last
+}
+
+// serve advances the virtual time of the class of w , which is about to be served , to its finish time. The mutex
+// must be held.
+func (q *fairQueue) serve(w *queue.Item) {
+	if fc := q.classes[w.Class]; fc != nil && w.Finish > fc.vtime {
+		fc.vtime = w.Finish
+	}
+}
+
+// leave records that w left the priority queue. The state of a class is dropped along with its last flow: the
+// virtual time only orders the goroutines queued at the same time. The mutex must be held.
+func (q *fairQueue) leave(w *queue.Item) {
+	fc := q.classes[w.Class]
+	if fc == nil {
+		return
+	}
+	if f := fc.flows[w.Flow]; f != nil {
+		if f.queued--; f.queued <= 0 {
+			delete(fc.flows, w.Flow)
+		}
+	}
+	if len(fc.flows) == 0 {
+		delete(q.classes, w.Class)
+	}
+}
+
+// reset forgets every class after the priority queue has been cleared. The mutex must be held.
+func (q *fairQueue) reset() {
+	q.classes = nil
+}
+
+// fairBefore reports whether a is served before b when the flows are weighted: by priority , then by finish time
+// and finally in FIFO order.
+func fairBefore(a, b *queue.Item) bool {
+	if queue.Outranks(a, b) {
+		return true
+	}
+	if queue.Outranks(b, a) {
+		return false
+	}
+	if a.Finish != b.Finish {
+		return a.Finish < b.Finish
+	}
+	return a.PushedBefore(b)
+}
+
+// weight returns the weight of flow , 1 for flows without a configured weight.
+func (c *config) weight(flow string) int {
+	if w, ok := c.weights[flow]; ok {
+		return w
+	}
+	return 1
+}
+
+// before returns the order the goroutines in the priority queue are served in.
+func (c *config) before() func(a, b *queue.Item) bool {
+	if c.weights != nil {
+		return fairBefore
+	}
+	return queue.Before
+}
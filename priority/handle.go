@@ -0,0 +1,140 @@
+package priority
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+type handleKey struct{}
+
+// Handle reports the progress of a goroutine waiting in a PriorityLimiter. Create one with WithHandle and pass
+// the returned context to Wait or Acquire , the Handle can then be queried from any goroutine.
+type Handle struct {
+	mu sync.Mutex
+	p  *PriorityLimiter
+	w  *queue.Item
+}
+
+// WithHandle returns a copy of ctx carrying a new *Handle. A Handle describes a single call to Wait.
+func WithHandle(ctx context.Context) (context.Context, *Handle) {
+	h := &Handle{}
+	return context.WithValue(ctx, handleKey{}, h), h
+}
+
+// handleFrom returns the Handle carried by ctx , or nil.
+func handleFrom(ctx context.Context) *Handle {
+	h, _ := ctx.Value(handleKey{}).(*Handle)
+	return h
+}
+
+// attach records that the goroutine waits in p as w.
+func (h *Handle) attach(p *PriorityLimiter, w *queue.Item) {
+	h.mu.Lock()
+	h.p, h.w = p, w
+	h.mu.Unlock()
+}
+
+// Position returns the position of the goroutine in the priority queue , 1 being the next goroutine to access the
+// resource. It returns 0 if the goroutine is not waiting , because Wait has not queued it yet or it left the queue.
+// The position follows the priority order: goroutines promoted by WithMaxWaitBeforePromotion or held back by
+// quotas may still overtake the goroutine.
+func (h *Handle) Position() int {
+	h.mu.Lock()
+	p, w := h.p, h.w
+	h.mu.Unlock()
+	if p == nil {
+		return 0
+	}
+	return p.position(w)
+}
+
+// EstimatedWait returns how long the goroutine is expected to keep waiting , based on its position and the rate
+// at which the PriorityLimiter served goroutines recently. It is zero if the goroutine is not waiting. ok is false
+// if the PriorityLimiter has not served enough goroutines yet to estimate its rate.
+func (h *Handle) EstimatedWait() (d time.Duration, ok bool) {
+	h.mu.Lock()
+	p := h.p
+	h.mu.Unlock()
+	pos := h.Position()
+	if pos == 0 {
+		return 0, true
+	}
+	return p.serviceRate.Estimate(pos)
+}
+
+// queuedIn returns the item of the goroutine if it waits in p , or nil.
+func (h *Handle) queuedIn(p *PriorityLimiter) *queue.Item {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.p != p {
+		return nil
+	}
+	return h.w
+}
+
+// Cancel removes the goroutine waiting with h from the priority queue without granting it access , its Wait
+// returns limiter.ErrCancelledByLimiter. Cancel returns false if the goroutine does not wait in the priority queue
+// of p , for example because it has been admitted already.
+func (p *PriorityLimiter) Cancel(h *Handle) bool {
+	w := h.queuedIn(p)
+	if w == nil {
+		return false
+	}
+	return p.removeWaiter(w, limiter.ErrCancelledByLimiter)
+}
+
+// Boost changes the priority of the goroutine waiting with h to priority , for example from an operator endpoint
+// bumping a stuck request. The class of the goroutine , which quotas and FinishPriority use , is not changed and
+// the priority may still change with aging. Boost returns false if the goroutine does not wait in the priority
+// queue of p.
+func (p *PriorityLimiter) Boost(h *Handle, priority PriorityValue) bool {
+	return p.reprioritize(h, func(*queue.Item) int {
+		return int(priority)
+	})
+}
+
+// PromoteToFront raises the priority of the goroutine waiting with h above every other queued goroutine , so it is
+// the next one to access the resource unless goroutines are promoted by WithMaxWaitBeforePromotion or held back by
+// quotas. PromoteToFront returns false if the goroutine does not wait in the priority queue of p.
+func (p *PriorityLimiter) PromoteToFront(h *Handle) bool {
+	return p.reprioritize(h, func(w *queue.Item) int {
+		if top := p.waitList.Front(); top != w {
+			return top.Priority + 1
+		}
+		return w.Priority
+	})
+}
+
+// reprioritize sets the priority of the goroutine waiting with h to the one computed by priority , with the mutex
+// held , and reports the change to the onPriorityChange func and the logger.
+func (p *PriorityLimiter) reprioritize(h *Handle, priority func(w *queue.Item) int) bool {
+	w := h.queuedIn(p)
+	if w == nil {
+		return false
+	}
+	c := p.config()
+	p.mu.Lock()
+	if !p.waitList.Contains(w) {
+		p.mu.Unlock()
+		return false
+	}
+	old, changed := w.Priority, priority(w)
+	if changed != old {
+		p.waitList.Update(w, changed)
+		p.version++
+	}
+	p.mu.Unlock()
+	if changed != old {
+		p.changed(PriorityChange{
+			Old:    PriorityValue(old),
+			New:    PriorityValue(changed),
+			Class:  PriorityValue(w.Class),
+			Waited: c.clock.Now().Sub(w.EnqueuedAt()),
+		})
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package priority
+
+import (
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// held is a slot acquired with Wait.
+type held struct {
+	acquired time.Time
+	class    PriorityValue
+}
+
+// hold records that a slot has been acquired with Wait by the priority class , so it can be reclaimed once the max
+// hold duration passes , and starts the goroutine reclaiming the slots if it is not running.
+func (p *PriorityLimiter) hold(class PriorityValue) {
+	c := p.config()
+	if c.maxHold <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.holds.PushBack(held{acquired: c.clock.Now(), class: class})
+	if !p.reaping {
+		p.reaping = true
+		go p.reap()
+	}
+}
+
+// unhold forgets the acquisition of a slot given back with Finish or FinishPriority and reports whether the slot
+// is still held. The most recently acquired slot is forgotten: leaked slots are the oldest ones , so they are the
+// ones left to reclaim. The mutex must be held.
+func (p *PriorityLimiter) unhold() bool {
+	if e := p.holds.Back(); e != nil {
+		p.holds.Remove(e)
+		return true
+	}
+	if p.orphans > 0 {
+		// the slot has already been reclaimed.
+		p.orphans--
+		return false
+	}
+	return true
+}
+
+// reap reclaims the slots held for longer than the max hold duration , oldest first , until no slot acquired
+// with Wait is held anymore.
+func (p *PriorityLimiter) reap() {
+	for {
+		c := p.config()
+		p.mu.Lock()
+		e := p.holds.Front()
+		if e == nil {
+			p.reaping = false
+			p.mu.Unlock()
+			return
+		}
+		h := e.Value.(held)
+		wait := h.acquired.Add(c.maxHold).Sub(c.clock.Now())
+		if wait <= 0 {
+			p.holds.Remove(e)
+			p.orphans++
+			p.reclaimed++
+			p.release(h.class)
+			p.mu.Unlock()
+			p.emit(limiter.Event{Kind: limiter.EventReclaim, Priority: priorityOf(int(h.class))})
+			if c.onMaxHold != nil {
+				c.onMaxHold()
+			}
+			continue
+		}
+		p.mu.Unlock()
+		t := c.clock.NewTimer(wait)
+		<-t.C()
+	}
+}
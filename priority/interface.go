@@ -0,0 +1,59 @@
+package priority
+
+import (
+	"context"
+	"reflect"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// Waiter is the priority capable extension of limiter.Waiter , implemented by limiters ordering goroutines by
+// priority. FinishPriority gives back a slot acquired with the given priority , which limiters with per priority
+// quotas need to know , Finish gives back any slot.
+type Waiter interface {
+	Wait(ctx context.Context, priority PriorityValue) error
+	Finish()
+	FinishPriority(priority PriorityValue)
+}
+
+var _ Waiter = (*PriorityLimiter)(nil)
+
+// AtPriority adapts w to limiter.Waiter: every goroutine waits with the given priority. It lets code written
+// against limiter.Waiter , like limiter.RetryUnderLimit , use a priority limiter.
+func AtPriority(w Waiter, priority PriorityValue) limiter.Waiter {
+	return atPriority{w: w, priority: priority}
+}
+
+type atPriority struct {
+	w        Waiter
+	priority PriorityValue
+}
+
+func (a atPriority) Wait(ctx context.Context) error {
+	return a.w.Wait(ctx, a.priority)
+}
+
+func (a atPriority) Finish() {
+	a.w.FinishPriority(a.priority)
+}
+
+// TryWait takes a slot with the priority of the adapter without waiting and reports whether it did. Limiters
+// without a TryWaitPriority method are asked with Wait and a context that is already done , like limiter.TryWait
+// does.
+func (a atPriority) TryWait() bool {
+	if t, ok := a.w.(interface{ TryWaitPriority(PriorityValue) bool }); ok {
+		return t.TryWaitPriority(a.priority)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return a.w.Wait(ctx, a.priority) == nil
+}
+
+// LimiterIdentity returns the address of the wrapped limiter , so limiter.AcquireAll orders the adapters of the
+// same limiter consistently.
+func (a atPriority) LimiterIdentity() uintptr {
+	if v := reflect.ValueOf(a.w); v.Kind() == reflect.Pointer {
+		return v.Pointer()
+	}
+	return ^uintptr(0)
+}
@@ -0,0 +1,40 @@
+package priority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestAtPriority_AcquireAllOrder(t *testing.T) {
+	a, b := NewLimiter(1), NewLimiter(1)
+	wa, wb := AtPriority(a, High), AtPriority(b, High)
+	first, second := a, b
+	if wb.(atPriority).LimiterIdentity() < wa.(atPriority).LimiterIdentity() {
+		first, second = b, a
+	}
+	ctx := context.Background()
+	assert.NoError(t, first.Wait(ctx, High))
+
+	for _, waiters := range [][]limiter.Waiter{{wa, wb}, {wb, wa}} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			release, err := limiter.AcquireAll(ctx, waiters...)
+			if assert.NoError(t, err) {
+				release()
+			}
+		}()
+		assert.Eventually(t, func() bool { return first.QueueLen() == 1 }, time.Second, time.Millisecond)
+		// the adapters are acquired in the order of their limiters , so the second one is not held while
+		// waiting for the first one.
+		assert.Equal(t, 0, second.InFlight())
+		first.Finish()
+		<-done
+		assert.NoError(t, first.Wait(ctx, High))
+	}
+	first.Finish()
+}
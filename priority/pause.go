@@ -0,0 +1,34 @@
+package priority
+
+// Pause stops granting slots without rejecting anybody: goroutines calling Wait are queued , subject to the bounds
+// of the priority queue , and slots given back are not handed to the goroutines in the priority queue. The
+// goroutines accessing the resource are not affected. Pausing a paused PriorityLimiter does nothing.
+func (p *PriorityLimiter) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.version++
+}
+
+// Resume grants slots again after Pause , admitting goroutines from the priority queue in priority order up to the
+// limit. Resuming a PriorityLimiter that is not paused does nothing.
+func (p *PriorityLimiter) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	p.version++
+	p.admit()
+}
+
+// Paused reports whether the PriorityLimiter is paused.
+func (p *PriorityLimiter) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
@@ -0,0 +1,41 @@
+package priority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityLimiter_Pause(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	nl.Pause()
+	assert.True(t, nl.Paused())
+	assert.True(t, nl.Stats().Paused)
+
+	granted := make(chan PriorityValue, 2)
+	for i, priority := range []PriorityValue{Low, High} {
+		priority := priority
+		go func() {
+			nl.Wait(ctx, priority)
+			granted <- priority
+		}()
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	nl.Finish()
+	assert.Equal(t, 0, nl.InFlight())
+	assert.Equal(t, 2, nl.QueueLen())
+
+	// the goroutine with the highest priority is served first once resumed.
+	nl.Resume()
+	assert.False(t, nl.Paused())
+	assert.Equal(t, High, <-granted)
+	nl.Finish()
+	assert.Equal(t, Low, <-granted)
+	nl.Finish()
+}
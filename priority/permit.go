@@ -0,0 +1,253 @@
+package priority
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// states of a Permit.
+const (
+	permitHeld int32 = iota
+	permitReleased
+	permitReclaimed
+)
+
+// Permit is a slot of a PriorityLimiter acquired with Acquire or AcquireCtx. The slot is held until Release is
+// called or , for a permit acquired with AcquireCtx , until the context is done. If WithPermitTTL is configured ,
+// the permit is a lease that must be renewed , see Renew. If WithMaxHoldDuration is configured , the slot is
+// reclaimed once it has been held for the max hold duration.
+type Permit struct {
+	p         *PriorityLimiter
+	priority  PriorityValue
+	token     uint64
+	acquired  time.Time
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	onPreempt func()
+	preempted bool
+	stop      chan struct{}
+	renew     chan struct{}
+	state     int32
+}
+
+// Acquire waits like Wait and returns a Permit holding the slot. If preemption is enabled with WithPreemption ,
+// onPreempt is called when a goroutine with a higher priority is queued and this permit is the lowest priority
+// holder: the work done under the permit should then stop as soon as possible and Release the permit. onPreempt
+// is typically the cancel func of the context of the work. A nil onPreempt makes the permit non preemptible.
+func (p *PriorityLimiter) Acquire(ctx context.Context, priority PriorityValue, onPreempt func()) (*Permit, error) {
+	return p.acquire(ctx, priority, onPreempt, nil)
+}
+
+// AcquireCtx waits like Wait and returns a Permit holding the slot. The slot is released automatically when ctx
+// is done , so AcquireCtx suits work whose lifetime is strictly bound to ctx , for example the handling of a
+// request. Release gives the slot back earlier. The permit is not preemptible. A ctx that is never done , like
+// context.Background , holds the slot until Release is called.
+func (p *PriorityLimiter) AcquireCtx(ctx context.Context, priority PriorityValue) (*Permit, error) {
+	return p.acquire(ctx, priority, nil, ctx.Done())
+}
+
+// AcquireChan acquires a Permit like AcquireCtx in a new goroutine , so the caller can select on the returned
+// channel alongside other channels instead of blocking in Wait. The channel delivers the permit once the slot is
+// acquired , or is closed without delivering anything if Wait fails , for example because ctx is done. Like with
+// AcquireCtx , the slot is released when ctx is done: a caller that gives up receiving must cancel ctx , so a
+// permit delivered in the meantime is not leaked.
+func (p *PriorityLimiter) AcquireChan(ctx context.Context, priority PriorityValue) <-chan *Permit {
+	ch := make(chan *Permit, 1)
+	go func() {
+		defer close(ch)
+		if pm, err := p.AcquireCtx(ctx, priority); err == nil {
+			ch <- pm
+		}
+	}()
+	return ch
+}
+
+// acquire returns a Permit released when done is closed.
+func (p *PriorityLimiter) acquire(ctx context.Context, priority PriorityValue, onPreempt func(), done <-chan struct{}) (*Permit, error) {
+	if err := p.wait(ctx, priority); err != nil {
+		p.countShed(err, priority)
+		return nil, err
+	}
+	c := p.config()
+	pm := &Permit{
+		p:         p,
+		priority:  priority,
+		token:     atomic.AddUint64(&p.tokens, 1),
+		acquired:  c.clock.Now(),
+		onPreempt: onPreempt,
+		stop:      make(chan struct{}),
+		renew:     make(chan struct{}, 1),
+	}
+	pm.ctx, pm.cancel = context.WithCancelCause(ctx)
+	p.mu.Lock()
+	p.holders[pm] = struct{}{}
+	p.mu.Unlock()
+	if done != nil || c.permitTTL > 0 || c.maxHold > 0 {
+		go pm.watch(done, c)
+	}
+	return pm, nil
+}
+
+// watch releases the slot when done is closed , reclaims it if the lease is not renewed within the permit TTL and
+// reclaims it once it has been held for the max hold duration.
+func (pm *Permit) watch(done <-chan struct{}, c *config) {
+	var t clock.Timer
+	var expired, overdue <-chan time.Time
+	if c.permitTTL > 0 {
+		t = c.clock.NewTimer(c.permitTTL)
+		defer func() { t.Stop() }()
+		expired = t.C()
+	}
+	if c.maxHold > 0 {
+		hold := c.clock.NewTimer(c.maxHold)
+		defer hold.Stop()
+		overdue = hold.C()
+	}
+	for {
+		select {
+		case <-done:
+			pm.Release()
+			return
+		case <-pm.stop:
+			return
+		case <-pm.renew:
+			if t != nil {
+				t.Stop()
+				t = c.clock.NewTimer(c.permitTTL)
+				expired = t.C()
+			}
+		case <-expired:
+			if pm.end(permitReclaimed) && c.onReclaim != nil {
+				c.onReclaim()
+			}
+			return
+		case <-overdue:
+			if pm.end(permitReclaimed) && c.onMaxHold != nil {
+				c.onMaxHold()
+			}
+			return
+		}
+	}
+}
+
+// Token returns the fencing token of the permit. Tokens increase monotonically with every permit acquired from
+// the PriorityLimiter , so the protected resource can reject requests carrying a token lower than the highest it
+// has seen: a holder whose permit was reclaimed or preempted cannot overwrite the work of the holder that got the
+// slot after it.
+func (pm *Permit) Token() uint64 {
+	return pm.token
+}
+
+// Context returns a context derived from the context passed to Acquire or AcquireCtx , cancelled when the permit
+// is released or reclaimed. Running the work done under the permit with it stops the work when the slot is taken
+// back: if the permit was reclaimed , context.Cause returns limiter.ErrReclaimed.
+func (pm *Permit) Context() context.Context {
+	return pm.ctx
+}
+
+// Release gives the slot back to the PriorityLimiter. Calling Release more than once , after the context passed to
+// AcquireCtx is done or after the permit has been reclaimed has no effect.
+func (pm *Permit) Release() {
+	pm.end(permitReleased)
+}
+
+// end gives the slot back if the permit is still held , and reports whether it was.
+func (pm *Permit) end(state int32) bool {
+	if !atomic.CompareAndSwapInt32(&pm.state, permitHeld, state) {
+		return false
+	}
+	close(pm.stop)
+	if state == permitReclaimed {
+		pm.cancel(limiter.ErrReclaimed)
+	} else {
+		pm.cancel(nil)
+	}
+	pm.p.mu.Lock()
+	if state == permitReclaimed {
+		pm.p.reclaimed++
+	}
+	delete(pm.p.holders, pm)
+	pm.p.release(pm.priority)
+	pm.p.mu.Unlock()
+	if state == permitReclaimed {
+		pm.p.emit(limiter.Event{Kind: limiter.EventReclaim, Priority: priorityOf(int(pm.priority)), Err: limiter.ErrReclaimed})
+	}
+	return true
+}
+
+// Renew extends the lease of the permit by the TTL configured with WithPermitTTL. It returns limiter.ErrReclaimed
+// if the slot has already been reclaimed: the work done under the permit should then stop. Renew has no effect if
+// no TTL is configured or the permit has been released.
+func (pm *Permit) Renew() error {
+	if atomic.LoadInt32(&pm.state) == permitReclaimed {
+		return limiter.ErrReclaimed
+	}
+	select {
+	case pm.renew <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// KeepAlive renews the lease of the permit in the background , three times per TTL , until ctx is done or the
+// permit is released or reclaimed. Tie ctx to the liveness of the work: a holder that hangs while ctx stays alive
+// is not detected. KeepAlive returns limiter.ErrReclaimed if the slot has already been reclaimed.
+func (pm *Permit) KeepAlive(ctx context.Context) error {
+	if err := pm.Renew(); err != nil {
+		return err
+	}
+	c := pm.p.config()
+	if c.permitTTL <= 0 {
+		return nil
+	}
+	go func() {
+		period := c.permitTTL / 3
+		if period <= 0 {
+			period = c.permitTTL
+		}
+		t := c.clock.NewTicker(period)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+				pm.Renew()
+			case <-ctx.Done():
+				return
+			case <-pm.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Preempted reports whether the permit has been asked to give its slot to a goroutine with a higher priority.
+func (pm *Permit) Preempted() bool {
+	pm.p.mu.Lock()
+	defer pm.p.mu.Unlock()
+	return pm.preempted
+}
+
+// preemptFor picks the permit to preempt in favour of the queued goroutine w: the lowest priority preemptible
+// holder with a priority lower than w , the most recently acquired one among equals. It returns nil if there
+// is none. The mutex must be held.
+func (p *PriorityLimiter) preemptFor(priority int) *Permit {
+	var victim *Permit
+	for pm := range p.holders {
+		if pm.onPreempt == nil || pm.preempted || int(pm.priority) >= priority {
+			continue
+		}
+		if victim == nil || pm.priority < victim.priority ||
+			(pm.priority == victim.priority && pm.acquired.After(victim.acquired)) {
+			victim = pm
+		}
+	}
+	if victim != nil {
+		victim.preempted = true
+	}
+	return victim
+}
@@ -0,0 +1,158 @@
+package priority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestPriorityLimiter_Preemption(t *testing.T) {
+	nl := NewLimiter(2,
+		WithPreemption(),
+	)
+	ctx := context.Background()
+
+	preempted := make(chan string, 2)
+	low, err := nl.Acquire(ctx, Low, func() { preempted <- "low" })
+	assert.NoError(t, err)
+	medium, err := nl.Acquire(ctx, Medium, func() { preempted <- "medium" })
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		nl.Wait(ctx, High)
+	}()
+	assert.Equal(t, "low", <-preempted)
+	assert.True(t, low.Preempted())
+	assert.False(t, medium.Preempted())
+
+	low.Release()
+	low.Release()
+	<-done
+	medium.Release()
+	nl.Finish()
+}
+
+func TestPriorityLimiter_NoPreemptionOfEqualPriority(t *testing.T) {
+	nl := NewLimiter(1,
+		WithPreemption(),
+	)
+	ctx := context.Background()
+	preempted := make(chan struct{}, 1)
+	pm, err := nl.Acquire(ctx, High, func() { preempted <- struct{}{} })
+	assert.NoError(t, err)
+
+	go nl.Wait(ctx, High)
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-preempted:
+		t.Fatal("a holder with the same priority must not be preempted")
+	default:
+	}
+	pm.Release()
+}
+
+func TestPriorityLimiter_PermitTTL(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	reclaimed := make(chan struct{}, 1)
+	nl := NewLimiter(1,
+		WithClock(clk),
+		WithPermitTTL(time.Second, func() { reclaimed <- struct{}{} }),
+	)
+	ctx := context.Background()
+	pm, err := nl.Acquire(ctx, Low, nil)
+	assert.NoError(t, err)
+
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(ctx, High)
+	}()
+	for clk.Waiters() != 1 || nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// the slot of the hung holder goes to the queued goroutine.
+	clk.Advance(time.Second)
+	<-reclaimed
+	assert.NoError(t, <-errs)
+	assert.Equal(t, limiter.ErrReclaimed, pm.Renew())
+	pm.Release()
+	assert.Empty(t, nl.holders)
+}
+
+func TestPriorityLimiter_PermitToken(t *testing.T) {
+	nl := NewLimiter(2)
+	ctx := context.Background()
+	a, err := nl.Acquire(ctx, High, nil)
+	assert.NoError(t, err)
+	b, err := nl.AcquireCtx(ctx, Low)
+	assert.NoError(t, err)
+	assert.True(t, a.Token() < b.Token())
+	a.Release()
+	c, err := nl.Acquire(ctx, Low, nil)
+	assert.NoError(t, err)
+	assert.True(t, b.Token() < c.Token())
+	b.Release()
+	c.Release()
+}
+
+func TestPriorityLimiter_MaxHoldDuration(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	reclaimed := make(chan struct{}, 2)
+	nl := NewLimiter(2,
+		WithClock(clk),
+		WithMaxHoldDuration(time.Second, func() { reclaimed <- struct{}{} }),
+	)
+	ctx := context.Background()
+	// a holder leaks its slot acquired with Wait , another one hangs on its permit.
+	assert.NoError(t, nl.Wait(ctx, Low))
+	pm, err := nl.Acquire(ctx, Low, nil)
+	assert.NoError(t, err)
+	for clk.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	<-reclaimed
+	<-reclaimed
+	s := nl.Stats()
+	assert.Equal(t, 0, s.InFlight)
+	assert.Equal(t, uint64(2), s.Reclaimed)
+	assert.Equal(t, limiter.ErrReclaimed, context.Cause(pm.Context()))
+
+	// late releases of the reclaimed holders are ignored.
+	nl.Finish()
+	pm.Release()
+	assert.Equal(t, 0, nl.Stats().InFlight)
+	assert.Equal(t, uint64(2), nl.State().Reclaimed)
+}
+
+func TestPriorityLimiter_AcquireChan(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	low := nl.AcquireChan(ctx, Low)
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	high := nl.AcquireChan(ctx, High)
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	var pm *Permit
+	select {
+	case pm = <-high:
+	case <-low:
+		t.Fatal("low priority permit delivered first")
+	}
+	pm.Release()
+	pm = <-low
+	pm.Release()
+	assert.Empty(t, nl.holders)
+}
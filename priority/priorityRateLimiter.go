@@ -1,16 +1,29 @@
 package priority
 
 import (
-	"container/heap"
+	"container/list"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+	"github.com/vivek-ng/concurrency-limiter/histogram"
 	"github.com/vivek-ng/concurrency-limiter/queue"
+	"github.com/vivek-ng/concurrency-limiter/rate"
+	"github.com/vivek-ng/concurrency-limiter/wheel"
 )
 
 // PriorityValue defines the priority values of goroutines.
-// Greater priority value means higher priority
+// Greater priority value means higher priority. Any int is a valid priority unless a
+// range is declared with WithPriorityRange , the constants below are provided for convenience.
 type PriorityValue int
 
 const (
@@ -20,208 +33,1444 @@ const (
 	High       PriorityValue = 4
 )
 
-// limit: max number of concurrent goroutines that can access aresource
+// ErrInvalidPriority is returned by Wait when the priority is outside of the range declared with WithPriorityRange.
+var ErrInvalidPriority = errors.New("priority: priority is outside of the valid range")
+
+// ErrClassQueueFull is returned by Wait when the queue of the priority class of the goroutine is full , see
+// WithPriorityQueueLimits. It matches limiter.ErrQueueFull.
+var ErrClassQueueFull = fmt.Errorf("priority: queue of the priority class is full: %w", limiter.ErrQueueFull)
+
+// cfg: the current *config , see config for the available settings
 //
-// count: current number of goroutines accessing a resource
+// count , queueLen: current number of goroutines accessing a resource and in the priority queue , only modified
+// with the mutex held but atomic so InFlight and QueueLen don't take it
 //
 // waitList: Priority queue of goroutines waiting to access a resource. Goroutines will be added to
 // this list if the number of concurrent requests are greater than the limit specified. Greater value for priority means
-// higher priority for that particular goroutine.
+// higher priority for that particular goroutine. It keeps a FIFO bucket per priority , or a heap with earliest
+// deadline first scheduling , which orders goroutines by arbitrary deadlines.
 //
-// dynamicPeriod: If this field is specified , priority is increased for low priority goroutines periodically by the
-// interval specified by dynamicPeriod (in ms)
+// room: closed and reset whenever the priority queue shrinks , to wake goroutines blocked by the BlockCaller policy
 //
-// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
-// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit. (in ms)
+// holders: permits currently holding a slot , see Acquire
+//
+// inUse , queued: number of slots held and number of goroutines queued per priority class , only
+// maintained if quotas are configured with WithPriorityQuota , or queue limits with WithPriorityQueueLimits for queued
+//
+// fair: state of the weighted fair queuing among flows , only used if WithFlowWeights is configured
+//
+// version: incremented whenever the limit , count or waitList change , so consumers of Stats can tell
+// whether two snapshots describe the same state
+//
+// waitTimes: histogram of the time goroutines spent in the waitlist before accessing the resource
+//
+// serviceRate: rate at which goroutines finish accessing the resource , used to estimate wait times
+//
+// closed , drained: closed is set by Close , drained is closed once no goroutine accesses the resource anymore
+//
+// tokens: last fencing token handed out to a Permit
+//
+// holds , reaping , orphans: the slots acquired with Wait , oldest first , whether a goroutine reclaims them and the
+// number of reclaimed slots whose holder has not called Finish yet , see WithMaxHoldDuration
+//
+// reclaimed: number of slots reclaimed from their holders
+//
+// shed: number of goroutines rejected because of overload , see limiter.IsRejection
+//
+// events: the recent events , nil unless WithEventHistory is configured
+//
+// paused: set by Pause , no slot is granted until Resume
+//
+// random: source of the random numbers of lottery scheduling , replaced by tests
+//
+// timers: the timer wheel of the timeouts and the dynamic priority , nil unless WithTimerWheel is configured
+//
+// aging , scanning: the next aging of the queued goroutines and whether a goroutine ages them , only used if
+// WithAgingScanInterval is configured
+//
+// items , allowed: scratch storage of pick , the queued goroutines and whether their classes may take a slot ,
+// reused so picking the next goroutine does not allocate
 type PriorityLimiter struct {
-	count         int
-	limit         int
-	mu            sync.Mutex
-	waitList      queue.PriorityQueue
-	dynamicPeriod *int
-	timeout       *int
+	cfg         atomic.Value
+	count       atomic.Int64
+	queueLen    atomic.Int64
+	version     uint64
+	mu          sync.Mutex
+	waitList    queue.Queue
+	room        chan struct{}
+	holders     map[*Permit]struct{}
+	inUse       map[PriorityValue]int
+	queued      map[PriorityValue]int
+	fair        fairQueue
+	waitTimes   *histogram.Histogram
+	serviceRate *rate.Estimator
+	closed      bool
+	drained     chan struct{}
+	tokens      uint64
+	holds       list.List
+	reaping     bool
+	orphans     int
+	reclaimed   uint64
+	shed        atomic.Uint64
+	events      *limiter.EventBuffer
+	paused      bool
+	random      func() float64
+	timers      *wheel.Wheel
+	aging       map[*queue.Item]*aging
+	scanning    bool
+	items       []*queue.Item
+	allowed     map[int]bool
 }
 
 type Option func(*PriorityLimiter)
 
 // NewLimiter creates an instance of *PriorityLimiter. Configure the Limiter with the options specified.
-// Example: priority.NewLimiter(4, WithDynamicPriority(5))
+// Example: priority.NewLimiter(4, WithDynamicPeriodDuration(5*time.Millisecond))
 func NewLimiter(limit int, options ...Option) *PriorityLimiter {
-	pq := make(queue.PriorityQueue, 0)
 	nl := &PriorityLimiter{
-		limit:    limit,
-		waitList: pq,
+		holders:     make(map[*Permit]struct{}),
+		inUse:       make(map[PriorityValue]int),
+		queued:      make(map[PriorityValue]int),
+		aging:       make(map[*queue.Item]*aging),
+		waitTimes:   histogram.New(),
+		serviceRate: rate.NewEstimator(),
+		random:      rand.Float64,
 	}
+	nl.cfg.Store(&config{
+		limit: limit,
+		clock: clock.Real(),
+	})
 
 	for _, o := range options {
 		o(nl)
 	}
 
-	heap.Init(&pq)
+	if n := nl.config().history; n > 0 {
+		nl.events = limiter.NewEventBuffer(n)
+	}
+	if c := nl.config(); c.timerTick > 0 && c.clock != nil {
+		nl.timers = wheel.New(c.clock, c.timerTick)
+	}
+	if nl.config().edf {
+		nl.waitList = &queue.PriorityQueue{}
+	} else {
+		nl.waitList = queue.NewBuckets()
+	}
 	return nl
 }
 
+// NewLimiterWithValidation creates an instance of *PriorityLimiter like NewLimiter , but returns an error wrapping
+// limiter.ErrInvalidConfig if the configuration is invalid: a limit , timeout or dynamic period that is not positive ,
+// a negative max queue length or quota , a rejection policy without a max queue length , a timeout policy without
+// a timeout , an aging func without a dynamic period , an empty priority range , a negative permit TTL , max hold
+// duration , event history , timer wheel tick or aging scan interval , a nil clock or options contradicting earliest
+// deadline first scheduling.
+func NewLimiterWithValidation(limit int, options ...Option) (*PriorityLimiter, error) {
+	p := NewLimiter(limit, options...)
+	if err := p.config().validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // dynamicPeriod: If this field is specified , priority is increased for low priority goroutines periodically by the
-// interval specified by dynamicPeriod
+// interval specified by dynamicPeriod (in ms)
+//
+// Deprecated: use WithDynamicPeriodDuration.
 func WithDynamicPriority(dynamicPeriod int) func(*PriorityLimiter) {
+	return WithDynamicPeriodDuration(time.Duration(dynamicPeriod) * time.Millisecond)
+}
+
+// dynamicPeriod: If this field is specified , priority is increased for low priority goroutines periodically by the
+// interval specified by dynamicPeriod
+func WithDynamicPeriodDuration(dynamicPeriod time.Duration) func(*PriorityLimiter) {
 	return func(p *PriorityLimiter) {
-		p.dynamicPeriod = &dynamicPeriod
+		p.config().dynamicPeriod = &dynamicPeriod
+	}
+}
+
+// agingPeriods: If this field is specified , goroutines calling Wait with a priority in agingPeriods age every
+// period of their priority instead of the dynamic period of WithDynamicPeriodDuration , so low priorities can catch
+// up faster than the others. The priority passed to Wait decides , the period does not change as the goroutine ages.
+// Goroutines with other priorities age every dynamic period , or not at all if there is none.
+// Example: WithAgingPeriods(map[PriorityValue]time.Duration{Low: 5 * time.Millisecond, Medium: 20 * time.Millisecond})
+func WithAgingPeriods(agingPeriods map[PriorityValue]time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().agingPeriods = maps.Clone(agingPeriods)
+	}
+}
+
+// agingFunc: If this field is specified , it replaces the default aging of WithDynamicPriority , which raises the priority
+// of a goroutine by one every dynamicPeriod until it reaches High. agingFunc is called every dynamicPeriod with the current
+// priority of the goroutine and the time it has been waiting , and returns its new priority. This allows exponential aging ,
+// aging rates depending on the priority or priorities above High. It has no effect without WithDynamicPriority
+// or WithAgingPeriods.
+func WithAgingFunc(agingFunc func(current int, waited time.Duration) int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().agingFunc = agingFunc
+	}
+}
+
+// agingScan: If this field is specified , queued goroutines do not run a ticker each to age: a single goroutine of
+// the PriorityLimiter scans the priority queue every agingScan and ages the goroutines whose dynamic period has
+// passed , as many times as it passed. This saves a ticker per queued goroutine , at the cost of aging up to
+// agingScan late. The goroutine runs only while aging goroutines are queued.
+// Example: WithAgingScanInterval(10 * time.Millisecond)
+func WithAgingScanInterval(agingScan time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().agingScan = agingScan
+	}
+}
+
+// minPriority , maxPriority: If these fields are specified , Wait returns ErrInvalidPriority for priorities outside of
+// [minPriority , maxPriority]. The default aging of WithDynamicPriority raises priorities up to maxPriority instead of High.
+// Example: WithPriorityRange(0, 1000) for per user weighted priorities.
+func WithPriorityRange(minPriority, maxPriority PriorityValue) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().priorityRange = &priorityRange{min: minPriority, max: maxPriority}
 	}
 }
 
 // timeout: If this field is specified , goroutines will be automatically removed from the waitlist
-// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+// after the time passes the timeout specified (in ms) even if the number of concurrent requests is greater than the limit.
+//
+// Deprecated: use WithTimeoutDuration.
 func WithTimeout(timeout int) func(*PriorityLimiter) {
+	return WithTimeoutDuration(time.Duration(timeout) * time.Millisecond)
+}
+
+// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
+// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+func WithTimeoutDuration(timeout time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().timeout = &timeout
+	}
+}
+
+// priorityTimeouts: If this field is specified , goroutines calling Wait with a priority in priorityTimeouts are
+// removed from the priority queue after the timeout of their priority instead of the one of WithTimeoutDuration , so
+// low priority goroutines can give up quickly while high priority ones wait longer. The priority passed to Wait
+// decides , not the one reached with aging. Goroutines with other priorities keep the timeout of
+// WithTimeoutDuration , if any.
+// Example: WithPriorityTimeouts(map[PriorityValue]time.Duration{Low: 50 * time.Millisecond, High: time.Second})
+func WithPriorityTimeouts(priorityTimeouts map[PriorityValue]time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().priorityTimeouts = maps.Clone(priorityTimeouts)
+	}
+}
+
+// timeoutPolicy: decides what happens to a goroutine still in the priority queue when the timeout expires. It only
+// has an effect together with WithTimeoutDuration or WithPriorityTimeouts. Defaults to limiter.AdmitOnTimeout.
+func WithTimeoutPolicy(policy limiter.TimeoutPolicy) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().timeoutPolicy = policy
+	}
+}
+
+// jitter: If this field is specified , the timeout and the dynamic period of every goroutine are shortened by a
+// random fraction of at most jitter , between 0 and 1 , so the goroutines queued by the same spike don't all time
+// out or get aged , contending for the mutex , at the same instant. Deadlines used as timeouts are not jittered.
+func WithJitter(jitter float64) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().jitter = jitter
+	}
+}
+
+// spin: If this field is specified , a queued goroutine yields the processor and checks whether it was granted a
+// slot up to spin times before it parks. When slots are held for microseconds , parking and waking the goroutine
+// costs more than the wait. Spinning burns CPU , keep spin small.
+func WithSpin(spin int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().spin = spin
+	}
+}
+
+// deadlineAsTimeout: If this field is set and the context passed to Wait has a deadline , the deadline is used as the
+// timeout whenever it expires before the configured timeout , and the timeout policy applies when it expires.
+func WithDeadlineAsTimeout() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().deadlineAsTimeout = true
+	}
+}
+
+// unlimited: If this field is set , the PriorityLimiter does not limit anything: Wait returns immediately whatever
+// the priority , the limit passed to NewLimiter is ignored and may be zero. Slots are still counted , so Finish
+// must be called as usual. This lets a feature flag disable limiting without changing the call sites.
+func WithUnlimited() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().unlimited = true
+	}
+}
+
+// deadlineAwareRejection: If this field is set and the context passed to Wait has a deadline , Wait returns
+// limiter.ErrWaitExceedsDeadline immediately instead of queueing the goroutine when its estimated wait , based on
+// the number of goroutines it would queue behind and the recent service rate , already exceeds the time remaining
+// until the deadline.
+func WithDeadlineAwareRejection() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().deadlineAwareRejection = true
+	}
+}
+
+// maxQueueLength: If this field is specified , Wait returns limiter.ErrQueueFull immediately instead of adding
+// the goroutine to the priority queue when the queue already holds maxQueueLength goroutines.
+func WithMaxQueueLength(maxQueueLength int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().maxQueueLength = &maxQueueLength
+	}
+}
+
+// rejectionPolicy: decides what happens when a goroutine arrives while the priority queue is full. It only
+// has an effect together with WithMaxQueueLength. Defaults to limiter.RejectNew.
+func WithRejectionPolicy(policy limiter.RejectionPolicy) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().rejectionPolicy = policy
+	}
+}
+
+// deadlineCurve: If this field is specified , goroutines whose context has a deadline are queued with the priority
+// the curve assigns to the time remaining until their deadline , whenever it is higher than the priority passed to Wait.
+// Requests that are about to expire jump the queue. Example: WithDeadlinePriority(DeadlineCurve{{50 * time.Millisecond, High}})
+func WithDeadlinePriority(deadlineCurve DeadlineCurve) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().deadlineCurve = deadlineCurve
+	}
+}
+
+// edf: If this field is set , the PriorityLimiter schedules goroutines earliest deadline first (EDF): the goroutine
+// whose context expires first is admitted first and the priority passed to Wait is ignored. Goroutines whose context
+// has no deadline are admitted after all goroutines with a deadline , in FIFO order. Dynamic priority and deadline
+// derived priority have no effect in this mode.
+func WithEarliestDeadlineFirst() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().edf = true
+	}
+}
+
+// admissionPolicy: decides how many goroutines Finish removes from the priority queue. Defaults to limiter.AdmitOne.
+func WithAdmissionPolicy(policy limiter.AdmissionPolicy) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().admissionPolicy = policy
+	}
+}
+
+// preemption: If this field is set , a goroutine that has to wait asks the lowest priority holder of a Permit with
+// a lower priority than its own to give up its slot , by calling the onPreempt func registered with Acquire. This
+// lets interactive work preempt batch work sharing the same resource. Goroutines that called Wait instead of
+// Acquire cannot be preempted.
+func WithPreemption() func(*PriorityLimiter) {
 	return func(p *PriorityLimiter) {
-		p.timeout = &timeout
+		p.config().preemption = true
+	}
+}
+
+// timerTick: If this field is specified , the timeouts and the dynamic priority of the goroutines in the priority
+// queue are driven by a timer wheel with a resolution of timerTick instead of a timer and a ticker per goroutine.
+// A single ticker then drives all of them , which relieves the runtime of heavy timer pressure with tens of
+// thousands of queued goroutines , at the cost of timeouts and aging periods rounded up to the tick: a goroutine
+// may wait up to one tick past its timeout. Example: WithTimerWheel(time.Millisecond)
+func WithTimerWheel(timerTick time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().timerTick = timerTick
+	}
+}
+
+// clock: tells the time and creates the timers and tickers of the timeouts and the dynamic priority. Defaults to
+// the real time. Tests can pass a clock.Fake to control the passage of time instead of sleeping.
+func WithClock(c clock.Clock) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().clock = c
+	}
+}
+
+// history: If this field is positive , the PriorityLimiter keeps its last history events , with their time ,
+// priority , wait and limit , in a ring buffer returned by RecentEvents , so what the PriorityLimiter was doing
+// before an incident can be reconstructed without having configured a logger.
+func WithEventHistory(history int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().history = history
+	}
+}
+
+// permitTTL , onReclaim: If these fields are specified , a Permit is a lease of its slot for permitTTL: the holder
+// must renew it with Permit.Renew or Permit.KeepAlive , otherwise the slot is reclaimed once permitTTL has passed
+// since the permit was acquired or last renewed , and onReclaim , if not nil , is called. This protects the
+// PriorityLimiter against hung holders that never give their slot back. Slots acquired with Wait are not affected.
+func WithPermitTTL(permitTTL time.Duration, onReclaim func()) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		c := p.config()
+		c.permitTTL = permitTTL
+		c.onReclaim = onReclaim
+	}
+}
+
+// maxHold , onMaxHold: If these fields are specified , a slot held for longer than maxHold is reclaimed: it is
+// given to the next goroutine in the priority queue as if Finish had been called , and onMaxHold , if not nil , is
+// called. This bounds the damage done by callers that leak slots by never calling Finish. Slots acquired with Wait
+// are anonymous , so the PriorityLimiter reclaims the oldest ones and the late Finish of a reclaimed holder is
+// ignored once every slot it could belong to has been given back. The context of a Permit is cancelled when it is
+// reclaimed , see Permit.Context.
+func WithMaxHoldDuration(maxHold time.Duration, onMaxHold func()) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		c := p.config()
+		c.maxHold = maxHold
+		c.onMaxHold = onMaxHold
+	}
+}
+
+// quota: If this field is specified , quota[priority] slots are reserved for goroutines calling Wait with that
+// priority , so no priority can monopolize the resource. A priority may borrow the slots reserved for other
+// priorities as long as no goroutine of those priorities is queued , so unused quota is not wasted. Borrowed slots
+// are given back as their holders finish: nothing is preempted. Priorities without a quota can only borrow.
+// With quotas , release slots with FinishPriority or use Acquire so the PriorityLimiter knows which priority
+// gives a slot back. Example: WithPriorityQuota(map[PriorityValue]int{High: 6, Medium: 3, Low: 1})
+func WithPriorityQuota(quota map[PriorityValue]int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		c := p.config()
+		c.quota = make(map[PriorityValue]int, len(quota))
+		for priority, n := range quota {
+			c.quota[priority] = n
+		}
+	}
+}
+
+// queueLimits: If this field is specified , at most queueLimits[priority] goroutines that called Wait with that
+// priority wait in the priority queue , so a flood of low priority goroutines cannot fill a bounded priority queue
+// and crowd out high priority ones. A goroutine arriving when the queue of its priority is full is subject to the
+// rejection policy within its priority only: DropOldest and DropLowestPriority drop a queued goroutine of the same
+// priority , otherwise Wait returns ErrClassQueueFull or blocks with BlockCaller. Priorities without a limit are
+// only bounded by WithMaxQueueLength. Example: WithPriorityQueueLimits(map[PriorityValue]int{Low: 100})
+func WithPriorityQueueLimits(queueLimits map[PriorityValue]int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().queueLimits = maps.Clone(queueLimits)
+	}
+}
+
+// weights: If this field is specified , the goroutines sharing a priority are served by weighted fair queuing
+// among their flows instead of in FIFO order: priorities are still served strictly in order , but within a
+// priority a flow with twice the weight of another one is served twice as often while both have goroutines
+// waiting. This models "interactive before batch , and fair among interactive tenants" in one PriorityLimiter. Tag
+// goroutines with their flow using limiter.WithFlow , flows without a weight have a weight of 1 , and goroutines
+// without a flow share the empty flow. It cannot be combined with earliest deadline first scheduling.
+// Example: WithFlowWeights(map[string]int{"tenant-a": 2, "tenant-b": 1})
+func WithFlowWeights(weights map[string]int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		c := p.config()
+		c.weights = make(map[string]int, len(weights))
+		for flow, w := range weights {
+			c.weights[flow] = w
+		}
+	}
+}
+
+// lottery: If this field is set , the goroutine served next is drawn at random among the queued goroutines instead
+// of being the one with the highest priority: each goroutine holds as many tickets as its priority , at least one ,
+// so a goroutine with priority 4 is four times as likely to be served as one with priority 1. Low priority
+// goroutines are served statistically even under sustained high priority load , without the per goroutine tickers
+// of the dynamic priority. Goroutines past the max wait of WithMaxWaitBeforePromotion are still served first. It
+// cannot be combined with earliest deadline first scheduling or flow weights.
+func WithLottery() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().lottery = true
+	}
+}
+
+// maxWait: If this field is specified , a goroutine that has been waiting in the priority queue for longer than
+// maxWait is admitted before every other goroutine regardless of its priority. Goroutines past maxWait are admitted
+// in FIFO order. This is a hard bound on starvation , complementing the aging of WithDynamicPriority.
+func WithMaxWaitBeforePromotion(maxWait time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().maxWait = maxWait
+	}
+}
+
+// PriorityChange describes a change of the rank of a goroutine in the priority queue , see
+// WithOnPriorityChange.
+//
+// Old , New: priority of the goroutine before and after the change. New is lower than Old if an aging func or
+// Boost demoted the goroutine.
+//
+// Class: priority the goroutine called Wait with
+//
+// Waited: time the goroutine had been waiting when the change happened
+//
+// Promoted: set if the goroutine was admitted ahead of goroutines with a higher priority because it waited for
+// longer than the max wait , see WithMaxWaitBeforePromotion. Old and New are the same then.
+type PriorityChange struct {
+	Old      PriorityValue
+	New      PriorityValue
+	Class    PriorityValue
+	Waited   time.Duration
+	Promoted bool
+}
+
+// onPriorityChange: If this field is specified , it is called whenever the dynamic priority raises or lowers the
+// priority of a queued goroutine , and whenever a goroutine is promoted past the max wait. It is called from the
+// goroutine whose priority changed , or the one calling Boost or PromoteToFront , without holding the PriorityLimiter's mutex , so it can log or count
+// starvation events but delays the goroutine while it runs.
+func WithOnPriorityChange(onPriorityChange func(PriorityChange)) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().onPriorityChange = onPriorityChange
+	}
+}
+
+// logger: If this field is specified , the PriorityLimiter logs why goroutines stall: goroutines shed or timed out ,
+// goroutines promoted , slots reclaimed and limit changes , each with structured attributes including the priority
+// of the goroutine concerned , see limiter.Event. Events are logged at the level of limiter.EventKind.Level unless
+// changed with WithEventLevel. The logger is called without holding the PriorityLimiter's mutex.
+func WithLogger(logger *slog.Logger) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.config().logger = logger
+	}
+}
+
+// level: the level events of the kind are logged at by the logger of WithLogger , instead of
+// limiter.EventKind.Level.
+// Example: WithEventLevel(limiter.EventPromotion, slog.LevelInfo)
+func WithEventLevel(kind limiter.EventKind, level slog.Level) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		c := p.config()
+		if c.levels == nil {
+			c.levels = make(map[limiter.EventKind]slog.Level)
+		}
+		c.levels[kind] = level
 	}
 }
 
 // Wait method waits if the number of concurrent requests is more than the limit specified.
 // If the priority of two goroutines are same , the FIFO order is followed.
 // Greater priority value means higher priority.
-// priority must be one fo the values specified by PriorityValue
+// priority can be any int , such as one of the values specified by PriorityValue
 //
 // Low = 1
 // Medium = 2
 // MediumHigh = 3
 // High = 4
-func (p *PriorityLimiter) Wait(ctx context.Context, priority PriorityValue) {
-	ok, w := p.proceed(priority)
+//
+// If a range is declared with WithPriorityRange , Wait returns ErrInvalidPriority for priorities outside of it.
+// If the PriorityLimiter is closed , Wait returns limiter.ErrClosed.
+// If a timeout is configured , a goroutine still in the priority queue when it expires proceeds to access the
+// resource , unless the limiter.RejectOnTimeout policy is configured: Wait then returns limiter.ErrTimeout.
+// If the priority queue is bounded and full , Wait applies the configured limiter.RejectionPolicy. A goroutine
+// that is rejected or dropped gets limiter.ErrQueueFull or limiter.ErrDropped and must not access the resource.
+// If the context is done while the goroutine waits , including while it is blocked by the BlockCaller policy , Wait
+// returns an error matching both limiter.ErrCanceled and the cause of the cancellation. Otherwise Wait returns nil.
+func (p *PriorityLimiter) Wait(ctx context.Context, priority PriorityValue) error {
+	if err := p.wait(ctx, priority); err != nil {
+		p.countShed(err, priority)
+		return err
+	}
+	p.hold(priority)
+	return nil
+}
+
+// wait waits like Wait without recording the acquisition of the slot for WithMaxHoldDuration.
+func (p *PriorityLimiter) wait(ctx context.Context, priority PriorityValue) error {
+	ok, w, err := p.enter(ctx, priority)
+	if err != nil {
+		return err
+	}
 	if ok {
-		return
+		return nil
+	}
+	if handleFrom(ctx) == nil {
+		// a Handle keeps referring to the item after Wait returns.
+		defer queue.Recycle(w)
+	}
+	return p.await(ctx, w, priority)
+}
+
+// enter checks the priority passed to Wait and tries to acquire a slot like proceed , with the priority adjusted
+// by the deadline of ctx if earliest deadline first or a deadline curve is configured.
+func (p *PriorityLimiter) enter(ctx context.Context, priority PriorityValue) (bool, *queue.Item, error) {
+	c := p.config()
+	if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+		return false, nil, ErrInvalidPriority
+	}
+	class := priority
+	var deadline time.Time
+	switch {
+	case c.edf:
+		priority = 0
+		deadline, _ = ctx.Deadline()
+	case c.deadlineCurve != nil:
+		priority = c.deadlineCurve.adjust(ctx, c.clock.Now(), priority)
+	}
+	ok, w, err := p.proceed(ctx, class, priority, deadline)
+	if ok {
+		p.waitTimes.Observe(0)
+	}
+	return ok, w, err
+}
+
+// TryWaitPriority takes a free slot for a goroutine of the given priority without waiting and reports whether it
+// did. Unlike Wait with a context that is already done , it never enters the priority queue: a failed
+// TryWaitPriority does not apply the rejection policy , drop or preempt other goroutines , count as shed or emit
+// events , and leaves the PriorityLimiter unchanged. A goroutine that got a slot must call FinishPriority with the
+// same priority once done.
+func (p *PriorityLimiter) TryWaitPriority(priority PriorityValue) bool {
+	c := p.config()
+	if r := c.priorityRange; r != nil && (priority < r.min || priority > r.max) {
+		return false
+	}
+	p.mu.Lock()
+	if p.closed || !p.mayAdmit(priority) {
+		p.mu.Unlock()
+		return false
+	}
+	p.count.Add(1)
+	p.version++
+	if p.config().quota != nil {
+		p.inUse[priority]++
+	}
+	p.mu.Unlock()
+	p.waitTimes.Observe(0)
+	p.hold(priority)
+	return true
+}
+
+// await waits until the goroutine queued as w by enter with the priority class is settled , aging it and timing it
+// out as configured.
+func (p *PriorityLimiter) await(ctx context.Context, w *queue.Item, class PriorityValue) error {
+	c := p.config()
+	dynamicPeriod := c.dynamicPeriod
+	if d, ok := c.agingPeriods[class]; ok {
+		dynamicPeriod = &d
+	}
+	if c.edf {
+		dynamicPeriod = nil
+	}
+	start := c.clock.Now()
+	if dynamicPeriod != nil && c.agingScan > 0 {
+		p.schedule(w, limiter.Jitter(*dynamicPeriod, c.jitter))
+		defer p.unschedule(w)
+		dynamicPeriod = nil
 	}
 
-	if p.dynamicPeriod == nil && p.timeout == nil {
+	timeout := effectiveTimeout(ctx, c, class)
+	var acquired bool
+	switch {
+	case spinOn(w.Done, c.spin):
+		// the goroutine was settled while it was spinning.
+		acquired = true
+	case dynamicPeriod == nil && timeout == nil:
 		select {
 		case <-w.Done:
+			acquired = true
 		case <-ctx.Done():
-			p.removeWaiter(w)
+			p.cancel(ctx, w)
 		}
-		return
+	case dynamicPeriod != nil && timeout != nil:
+		acquired = p.dynamicPriorityAndTimeout(ctx, w, limiter.Jitter(*dynamicPeriod, c.jitter), *timeout)
+	case timeout != nil:
+		acquired = p.handleTimeout(ctx, w, *timeout)
+	default:
+		acquired = p.handleDynamicPriority(ctx, w, limiter.Jitter(*dynamicPeriod, c.jitter))
 	}
-
-	if p.dynamicPeriod != nil && p.timeout != nil {
-		p.dynamicPriorityAndTimeout(ctx, w)
-		return
+	if w.Err != nil {
+		return w.Err
 	}
-
-	if p.timeout != nil {
-		p.handleTimeout(ctx, w)
-		return
+	if acquired {
+		p.waitTimes.Observe(c.clock.Now().Sub(start))
 	}
-
-	p.handleDynamicPriority(ctx, w)
+	if w.Promoted {
+		p.changed(PriorityChange{
+			Old:      PriorityValue(w.Priority),
+			New:      PriorityValue(w.Priority),
+			Class:    PriorityValue(w.Class),
+			Waited:   c.clock.Now().Sub(w.EnqueuedAt()),
+			Promoted: true,
+		})
+	}
+	return nil
 }
 
-func (p *PriorityLimiter) dynamicPriorityAndTimeout(ctx context.Context, w *queue.Item) {
-	ticker := time.NewTicker(time.Duration(*p.dynamicPeriod) * time.Millisecond)
-	timer := time.NewTimer(time.Duration(*p.timeout) * time.Millisecond)
+// dynamicPriorityAndTimeout, handleDynamicPriority and handleTimeout report whether the
+// goroutine was allowed to access the resource.
+func (p *PriorityLimiter) dynamicPriorityAndTimeout(ctx context.Context, w *queue.Item, dynamicPeriod, timeout time.Duration) bool {
+	clk := p.waitClock()
+	ticker := clk.NewTicker(dynamicPeriod)
+	defer ticker.Stop()
+	timer := clk.NewTimer(timeout)
+	defer timer.Stop()
 	for {
 		select {
 		case <-w.Done:
-			return
+			return true
 		case <-ctx.Done():
-			p.removeWaiter(w)
-			return
-		case <-timer.C:
-			p.removeWaiter(w)
-			return
-		case <-ticker.C:
+			p.cancel(ctx, w)
+			return false
+		case <-timer.C():
+			p.expire(w)
+			return true
+		case <-ticker.C():
 			// edge case where we receive ctx.Done and ticker.C at the same time...
 			select {
 			case <-ctx.Done():
-				p.removeWaiter(w)
-				return
+				p.cancel(ctx, w)
+				return false
 			default:
 			}
-			p.mu.Lock()
-			if w.Priority < int(High) {
-				currentPriority := w.Priority
-				p.waitList.Update(w, currentPriority+1)
-			}
-			p.mu.Unlock()
+			p.age(w)
 		}
 	}
 }
 
-func (p *PriorityLimiter) handleDynamicPriority(ctx context.Context, w *queue.Item) {
-	ticker := time.NewTicker(time.Duration(*p.dynamicPeriod) * time.Millisecond)
+func (p *PriorityLimiter) handleDynamicPriority(ctx context.Context, w *queue.Item, dynamicPeriod time.Duration) bool {
+	ticker := p.waitClock().NewTicker(dynamicPeriod)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-w.Done:
-			return
-		case <-ticker.C:
-			p.mu.Lock()
-			if w.Priority < int(High) {
-				currentPriority := w.Priority
-				p.waitList.Update(w, currentPriority+1)
-			}
-			p.mu.Unlock()
+			return true
+		case <-ticker.C():
+			p.age(w)
 		case <-ctx.Done():
-			p.removeWaiter(w)
-			return
+			p.cancel(ctx, w)
+			return false
 		}
 	}
 }
 
-func (p *PriorityLimiter) handleTimeout(ctx context.Context, w *queue.Item) {
+// age updates the priority of the queued goroutine w with the aging func , or raises it by one up to High
+// (or the max of the priority range) if there is none.
+func (p *PriorityLimiter) age(w *queue.Item) {
+	p.mu.Lock()
+	change, ok := p.ageLocked(p.config(), w)
+	p.mu.Unlock()
+	if ok {
+		p.changed(change)
+	}
+}
+
+// ageLocked ages the goroutine w like age if it is still queued , and reports the change of its priority if there
+// is one. The mutex must be held.
+func (p *PriorityLimiter) ageLocked(c *config, w *queue.Item) (PriorityChange, bool) {
+	if !p.waitList.Contains(w) {
+		return PriorityChange{}, false
+	}
+	max := High
+	if c.priorityRange != nil {
+		max = c.priorityRange.max
+	}
+	priority := w.Priority
+	waited := c.clock.Now().Sub(w.EnqueuedAt())
+	switch {
+	case c.agingFunc != nil:
+		priority = c.agingFunc(w.Priority, waited)
+	case w.Priority < int(max):
+		priority++
+	}
+	if priority == w.Priority {
+		return PriorityChange{}, false
+	}
+	change := PriorityChange{
+		Old:    PriorityValue(w.Priority),
+		New:    PriorityValue(priority),
+		Class:  PriorityValue(w.Class),
+		Waited: waited,
+	}
+	p.waitList.Update(w, priority)
+	return change, true
+}
+
+func (p *PriorityLimiter) handleTimeout(ctx context.Context, w *queue.Item, timeout time.Duration) bool {
+	timer := p.waitClock().NewTimer(timeout)
+	defer timer.Stop()
 	select {
 	case <-w.Done:
-	case <-time.After(time.Duration(*p.timeout) * time.Millisecond):
-		p.removeWaiter(w)
+	case <-timer.C():
+		p.expire(w)
 	case <-ctx.Done():
-		p.removeWaiter(w)
+		p.cancel(ctx, w)
+		return false
+	}
+	return true
+}
+
+// waitClock returns the clock creating the timers and tickers of the goroutines in the priority queue: the timer
+// wheel if it is configured.
+func (p *PriorityLimiter) waitClock() clock.Clock {
+	if p.timers != nil {
+		return p.timers
+	}
+	return p.config().clock
+}
+
+// spinOn yields the processor and polls done up to spin times , and reports whether it received the signal.
+func spinOn(done <-chan struct{}, spin int) bool {
+	for i := 0; i < spin; i++ {
+		select {
+		case <-done:
+			return true
+		default:
+			runtime.Gosched()
+		}
+	}
+	return false
+}
+
+// effectiveTimeout returns the timeout of a goroutine calling Wait with ctx and the priority class , jittered if
+// jitter is configured , or the deadline of ctx if it expires first and deadlineAsTimeout is set. It returns nil if
+// the goroutine has no timeout.
+func effectiveTimeout(ctx context.Context, c *config, class PriorityValue) *time.Duration {
+	timeout := c.timeout
+	if d, ok := c.priorityTimeouts[class]; ok {
+		timeout = &d
+	}
+	if timeout != nil && c.jitter > 0 {
+		d := limiter.Jitter(*timeout, c.jitter)
+		timeout = &d
+	}
+	if deadline, ok := ctx.Deadline(); ok && c.deadlineAsTimeout {
+		if d := deadline.Sub(c.clock.Now()); timeout == nil || d < *timeout {
+			timeout = &d
+		}
+	}
+	return timeout
+}
+
+// countShed counts the goroutine that failed to wait with err if it was rejected because of overload.
+func (p *PriorityLimiter) countShed(err error, priority PriorityValue) {
+	if limiter.IsRejection(err) {
+		p.shed.Add(1)
+		// timeouts are reported where they expire , with the time spent waiting.
+		if !errors.Is(err, limiter.ErrTimeout) {
+			p.emit(limiter.Event{Kind: limiter.EventShed, Priority: priorityOf(int(priority)), Err: err})
+		}
+	}
+}
+
+// expire removes w from the priority queue once its timeout has passed.
+func (p *PriorityLimiter) expire(w *queue.Item) {
+	if err := p.timeoutErr(); p.removeWaiter(w, err) {
+		p.timedOut(w, err)
+	}
+}
+
+// ctxErr returns the error of a goroutine removed from the priority queue because its context is done: limiter.ErrCanceled
+// wrapping the cause of the cancellation. An expired deadline counts as a timeout if deadlineAsTimeout is set.
+func (p *PriorityLimiter) ctxErr(ctx context.Context) error {
+	if p.config().deadlineAsTimeout && ctx.Err() == context.DeadlineExceeded {
+		return p.timeoutErr()
+	}
+	return limiter.Canceled(ctx)
+}
+
+// timeoutErr returns the error of a goroutine removed from the priority queue after the timeout , nil if it is admitted.
+func (p *PriorityLimiter) timeoutErr() error {
+	if p.config().timeoutPolicy == limiter.RejectOnTimeout {
+		return limiter.ErrTimeout
 	}
+	return nil
 }
 
-func (p *PriorityLimiter) removeWaiter(w *queue.Item) {
+// removeWaiter removes the goroutine from the priority queue. If err is nil , the goroutine is let through and
+// counts against the limit , otherwise its Wait returns err. It is a no-op if the goroutine has already been
+// removed by Finish , SetLimit or the rejection policy. removeWaiter reports whether the goroutine was still waiting.
+func (p *PriorityLimiter) removeWaiter(w *queue.Item, err error) bool {
 	p.mu.Lock()
-	heap.Remove(&p.waitList, p.waitList.GetIndex(w))
-	p.count += 1
-	close(w.Done)
-	p.mu.Unlock()
+	defer p.mu.Unlock()
+	if !p.waitList.Contains(w) {
+		return false
+	}
+	return p.leave(w, err)
 }
 
-// proceed will return true if the number of concurrent requests is less than the limit else it
-// will add the goroutine to the priority queue and will return a channel. This channel is used by goutines to
-// check for signal when they are granted access to use the resource.
-func (p *PriorityLimiter) proceed(priority PriorityValue) (bool, *queue.Item) {
+// cancel handles a goroutine whose context is done while it waits. The goroutine is abandoned unless it has been
+// settled concurrently. If it has been granted a slot , the slot is given back: a goroutine whose Wait fails never
+// holds a slot.
+func (p *PriorityLimiter) cancel(ctx context.Context, w *queue.Item) {
+	err := p.ctxErr(ctx)
+	if err == nil {
+		// deadlineAsTimeout lets the goroutine through when its deadline expires.
+		if p.removeWaiter(w, nil) {
+			p.timedOut(w, nil)
+		}
+		return
+	}
+	// the swap settles the race with a concurrent Finish without waiting for the mutex , the goroutine is removed
+	// from the priority queue afterwards and skipped by Finish meanwhile.
+	abandoned := w.Abandon(err)
 	p.mu.Lock()
+	if abandoned {
+		if p.waitList.Contains(w) {
+			p.unqueue(w)
+		}
+		p.mu.Unlock()
+		if errors.Is(err, limiter.ErrTimeout) {
+			p.timedOut(w, err)
+		}
+		return
+	}
 	defer p.mu.Unlock()
+	if w.Granted() {
+		w.Err = err
+		p.giveBack(PriorityValue(w.Class))
+	}
+}
+
+// leave removes w from the priority queue , out of turn , and grants it a slot if err is nil or abandons it with
+// err otherwise. It reports whether the goroutine had not been settled yet. The mutex must be held.
+func (p *PriorityLimiter) leave(w *queue.Item, err error) bool {
+	p.unqueue(w)
+	if err == nil {
+		return p.grant(w)
+	}
+	return w.Abandon(err)
+}
+
+// unqueue removes w from the priority queue and returns it. The mutex must be held.
+func (p *PriorityLimiter) unqueue(w *queue.Item) *queue.Item {
+	p.waitList.Remove(w)
+	p.queueLen.Add(-1)
+	p.version++
+	if p.config().countsQueued() {
+		p.queued[PriorityValue(w.Class)]--
+	}
+	if p.config().weights != nil {
+		p.fair.leave(w)
+	}
+	p.notifyRoom()
+	return w
+}
+
+// grant settles w , which has been removed from the priority queue , by giving it a slot. It reports whether w had
+// not been settled yet. The mutex must be held.
+func (p *PriorityLimiter) grant(w *queue.Item) bool {
+	// w is recycled once its goroutine returns , so it is not read after being granted.
+	class := PriorityValue(w.Class)
+	// signalling never blocks, so the waiter is signalled even if it is busy
+	// trying to acquire the mutex we are holding to bump its priority.
+	if !w.Grant() {
+		return false
+	}
+	p.count.Add(1)
+	if p.config().quota != nil {
+		p.inUse[class]++
+	}
+	return true
+}
+
+// drop removes w from the priority queue without granting it access. The mutex must be held.
+func (p *PriorityLimiter) drop(w *queue.Item) {
+	p.unqueue(w).Abandon(limiter.ErrDropped)
+}
 
-	if p.count < p.limit {
-		p.count++
+// makeRoom reports whether w can join the priority queue , applying the rejection policy if the queue of its priority
+// class or the priority queue is full: a goroutine may be dropped to make room. It returns the error of w if it is
+// rejected , and false and nil if it must wait for room. The mutex must be held.
+func (p *PriorityLimiter) makeRoom(w *queue.Item, c *config) (bool, error) {
+	class := PriorityValue(w.Class)
+	if n, ok := c.queueLimits[class]; ok && p.queued[class] >= n {
+		var victim *queue.Item
+		for it := range p.waitList.All() {
+			if PriorityValue(it.Class) != class {
+				continue
+			}
+			switch {
+			case c.rejectionPolicy == limiter.DropOldest && (victim == nil || it.PushedBefore(victim)):
+				victim = it
+			case c.rejectionPolicy == limiter.DropLowestPriority && queue.Outranks(w, it) && (victim == nil || queue.Outranks(victim, it)):
+				victim = it
+			}
+		}
+		switch {
+		case victim != nil:
+			// the priority queue does not grow.
+			p.drop(victim)
+			return true, nil
+		case c.rejectionPolicy == limiter.BlockCaller:
+			return false, nil
+		}
+		return false, ErrClassQueueFull
+	}
+	if c.maxQueueLength == nil || p.waitList.Len() < *c.maxQueueLength {
+		return true, nil
+	}
+	if c.rejectionPolicy == limiter.DropOldest && p.waitList.Len() > 0 {
+		p.drop(p.waitList.FirstPushed())
 		return true, nil
 	}
-	ch := make(chan struct{})
-	w := &queue.Item{
-		Priority: int(priority),
-		Done:     ch,
+	if c.rejectionPolicy == limiter.DropLowestPriority && p.waitList.Len() > 0 {
+		// the arriving goroutine would be served after every queued goroutine it does not outrank.
+		if lowest := p.waitList.Back(); queue.Outranks(w, lowest) {
+			p.drop(lowest)
+			return true, nil
+		}
+	}
+	if c.rejectionPolicy != limiter.BlockCaller {
+		return false, limiter.ErrQueueFull
+	}
+	return false, nil
+}
+
+// notifyRoom wakes the goroutines blocked until there is room in the priority queue. The mutex must be held.
+func (p *PriorityLimiter) notifyRoom() {
+	if p.room != nil {
+		close(p.room)
+		p.room = nil
+	}
+}
+
+// proceed will return true if the number of concurrent requests is less than the limit else it
+// will add the goroutine to the priority queue and will return a channel. This channel is used by goutines to
+// check for signal when they are granted access to use the resource. If the priority queue is full the
+// rejection policy is applied.
+func (p *PriorityLimiter) proceed(ctx context.Context, class, priority PriorityValue, deadline time.Time) (bool, *queue.Item, error) {
+	var w *queue.Item
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return false, nil, limiter.ErrClosed
+		}
+		c := p.config()
+		if p.mayAdmit(class) {
+			p.count.Add(1)
+			p.version++
+			if c.quota != nil {
+				p.inUse[class]++
+			}
+			p.mu.Unlock()
+			return true, nil, nil
+		}
+		if w == nil {
+			w = queue.NewItem()
+			w.Priority = int(priority)
+			w.Class = int(class)
+			w.Deadline = deadline
+		}
+		if deadline, ok := ctx.Deadline(); ok && c.deadlineAwareRejection {
+			if wait, ok := p.serviceRate.Estimate(p.queuedBefore(w) + 1); ok && wait > deadline.Sub(c.clock.Now()) {
+				p.mu.Unlock()
+				return false, nil, limiter.ErrWaitExceedsDeadline
+			}
+		}
+		if ok, err := p.makeRoom(w, c); err != nil {
+			p.mu.Unlock()
+			return false, nil, err
+		} else if ok {
+			break
+		}
+		if p.room == nil {
+			p.room = make(chan struct{})
+		}
+		room := p.room
+		p.mu.Unlock()
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return false, nil, limiter.Canceled(ctx)
+		}
+		p.mu.Lock()
+	}
+	w.SetEnqueuedAt(p.config().clock.Now())
+	if c := p.config(); c.weights != nil {
+		w.Flow = limiter.FlowFrom(ctx)
+		p.fair.enqueue(w, c.weight(w.Flow))
 	}
-	heap.Push(&p.waitList, w)
-	return false, w
+	p.waitList.Enqueue(w)
+	p.queueLen.Add(1)
+	p.version++
+	if h := handleFrom(ctx); h != nil {
+		h.attach(p, w)
+	}
+	if p.config().countsQueued() {
+		p.queued[class]++
+	}
+	var victim *Permit
+	if p.config().preemption {
+		victim = p.preemptFor(w.Priority)
+	}
+	p.mu.Unlock()
+	if victim != nil {
+		victim.onPreempt()
+	}
+	return false, w, nil
 }
 
 // Finish will remove the goroutine from the priority queue and sends a signal
-// to the waiting goroutine to access the resource
+// to the waiting goroutine to access the resource. How many goroutines are removed
+// depends on the limiter.AdmissionPolicy. If quotas are configured , Finish cannot tell which
+// priority gives the slot back and takes it from the lowest priority holding one: use FinishPriority instead.
 func (p *PriorityLimiter) Finish() {
+	p.FinishN(1)
+}
+
+// FinishN gives back n slots , like calling Finish n times , under a single acquisition of the mutex. The
+// goroutines granted the slots are woken by closing their channels , which never blocks , so releasing a batch of
+// slots does not contend for the mutex once per slot with the goroutines it wakes.
+func (p *PriorityLimiter) FinishN(n int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.count -= 1
-	if p.waitList.Len() == 0 {
+	for i := 0; i < n; i++ {
+		p.finish()
+	}
+}
+
+// finish gives back a slot like Finish. An unmatched Finish , with no slot held , is a no-op. The mutex must be
+// held.
+func (p *PriorityLimiter) finish() {
+	if p.count.Load() == 0 || !p.unhold() {
 		return
 	}
-	ele := heap.Pop(&p.waitList)
-	it := ele.(*queue.Item)
-	it.Done <- struct{}{}
-	close(it.Done)
+	if p.config().quota != nil {
+		class, found := PriorityValue(0), false
+		for priority, n := range p.inUse {
+			if n > 0 && (!found || priority < class) {
+				class, found = priority, true
+			}
+		}
+		p.release(class)
+		return
+	}
+	p.release(0)
 }
 
-// only used in tests
-func (p *PriorityLimiter) waitListSize() int {
+// FinishPriority gives back a slot acquired by calling Wait with priority. It is the same as Finish
+// unless quotas are configured with WithPriorityQuota.
+func (p *PriorityLimiter) FinishPriority(priority PriorityValue) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	len := p.waitList.Len()
-	return len
+	if p.count.Load() > 0 && p.unhold() {
+		p.release(priority)
+	}
+}
+
+// release gives back a slot held by a goroutine of the priority class that accessed the resource. The mutex must
+// be held.
+func (p *PriorityLimiter) release(class PriorityValue) {
+	p.serviceRate.Observe(p.config().clock.Now())
+	p.giveBack(class)
+}
+
+// giveBack frees a slot held by the priority class and hands it to the next queued goroutine , if any. The mutex
+// must be held.
+func (p *PriorityLimiter) giveBack(class PriorityValue) {
+	p.count.Add(-1)
+	p.version++
+	p.checkDrained()
+	c := p.config()
+	if c.quota != nil {
+		if p.inUse[class] > 0 {
+			p.inUse[class]--
+		}
+		// the queued goroutine with the highest priority may not be allowed to borrow the slot ,
+		// so slots are always handed out by admit.
+		p.admit()
+		return
+	}
+	if c.admissionPolicy == limiter.AdmitUpToLimit || p.paused {
+		p.admit()
+		return
+	}
+	// goroutines abandoned by a concurrent cancellation are skipped.
+	for w := p.pick(); w != nil; w = p.pick() {
+		if p.serve(w) {
+			return
+		}
+	}
+}
+
+// SetLimit changes the max number of concurrent goroutines that can access the resource.
+// If the limit is raised , goroutines are removed from the priority queue in priority order
+// until the new limit is reached.
+func (p *PriorityLimiter) SetLimit(limit int) {
+	p.mu.Lock()
+	old := p.config().limit
+	p.updateConfig(func(c *config) {
+		c.limit = limit
+	})
+	p.version++
+	p.admit()
+	p.mu.Unlock()
+	if limit != old {
+		p.emit(limiter.Event{Kind: limiter.EventLimitChange})
+	}
+}
+
+// admit removes goroutines from the priority queue and grants them access until the limit is
+// reached. The mutex must be held.
+func (p *PriorityLimiter) admit() {
+	for w := p.next(); w != nil; w = p.next() {
+		p.serve(w)
+	}
+}
+
+// serve removes w , picked to be served next , from the priority queue and grants it a slot. It reports whether w
+// had not been settled yet. The mutex must be held.
+func (p *PriorityLimiter) serve(w *queue.Item) bool {
+	if p.config().weights != nil {
+		p.fair.serve(w)
+	}
+	return p.grant(p.unqueue(w))
+}
+
+// next returns the goroutine in the priority queue that should be granted access next , or nil if there is none ,
+// the PriorityLimiter is paused or the limit is reached. The mutex must be held.
+func (p *PriorityLimiter) next() *queue.Item {
+	if c := p.config(); p.paused || (!c.unlimited && int(p.count.Load()) >= c.limit) {
+		return nil
+	}
+	return p.pick()
+}
+
+// pick returns the goroutine in the priority queue that should be served next , or nil if there is none. This is
+// the top of the queue unless goroutines have been waiting for longer than maxWait , then the oldest of them is
+// picked. With lottery scheduling , a goroutine is drawn instead of the top of the queue. With
+// quotas , only goroutines whose priority may take a slot are considered. The mutex must be held.
+func (p *PriorityLimiter) pick() *queue.Item {
+	c := p.config()
+	if c.quota == nil && c.maxWait == 0 && c.weights == nil && !c.lottery {
+		return p.waitList.Front()
+	}
+	before := c.before()
+	now := c.clock.Now()
+	var next *queue.Item
+	promoted := false
+	if p.allowed == nil {
+		p.allowed = make(map[int]bool)
+	}
+	allowed := p.allowed
+	clear(allowed)
+	p.items = p.waitList.Append(p.items[:0])
+	defer clear(p.items)
+	var tickets int
+	for _, it := range p.items {
+		if c.quota != nil {
+			ok, seen := allowed[it.Class]
+			if !seen {
+				ok = p.mayAdmit(PriorityValue(it.Class))
+				allowed[it.Class] = ok
+			}
+			if !ok {
+				continue
+			}
+		}
+		tickets += ticketsOf(it)
+		overdue := c.maxWait > 0 && now.Sub(it.EnqueuedAt()) >= c.maxWait
+		switch {
+		case next == nil:
+			next, promoted = it, overdue
+		case overdue:
+			if !promoted || it.PushedBefore(next) {
+				next, promoted = it, true
+			}
+		case !promoted && before(it, next):
+			next = it
+		}
+	}
+	if next != nil && promoted && next != p.waitList.Front() {
+		next.Promoted = true
+	}
+	if next != nil && !promoted && c.lottery {
+		return p.draw(tickets, allowed)
+	}
+	return next
+}
+
+// draw holds a lottery among the goroutines in the priority queue whose class is allowed , tickets being the
+// number of tickets they hold in total , and returns the winner. The queued goroutines are read from the scratch
+// slice filled by pick. The mutex must be held.
+func (p *PriorityLimiter) draw(tickets int, allowed map[int]bool) *queue.Item {
+	c := p.config()
+	n := int(p.random() * float64(tickets))
+	var last *queue.Item
+	for _, it := range p.items {
+		if c.quota != nil && !allowed[it.Class] {
+			continue
+		}
+		if n -= ticketsOf(it); n < 0 {
+			return it
+		}
+		last = it
+	}
+	return last
+}
+
+// ticketsOf returns the number of lottery tickets held by it: its priority , at least one.
+func ticketsOf(it *queue.Item) int {
+	return max(it.Priority, 1)
+}
+
+// mayAdmit reports whether a goroutine of the priority class may take a slot: the PriorityLimiter must not be
+// paused , the limit must not be reached and , if quotas are configured , the class must be within its quota or
+// leave enough free slots for the unused quota of the other classes that have queued goroutines. The mutex must be
+// held.
+func (p *PriorityLimiter) mayAdmit(class PriorityValue) bool {
+	c := p.config()
+	if p.paused {
+		return false
+	}
+	if c.unlimited {
+		return true
+	}
+	if int(p.count.Load()) >= c.limit {
+		return false
+	}
+	if c.quota == nil || p.inUse[class] < c.quota[class] {
+		return true
+	}
+	reserved := 0
+	for priority, n := range c.quota {
+		if priority != class && p.queued[priority] > 0 && p.inUse[priority] < n {
+			reserved += n - p.inUse[priority]
+		}
+	}
+	return c.limit-int(p.count.Load()) > reserved
+}
+
+// queuedBefore returns the number of queued goroutines that would be served before w if it was queued now.
+// The mutex must be held.
+func (p *PriorityLimiter) queuedBefore(w *queue.Item) int {
+	n := 0
+	for it := range p.waitList.All() {
+		if !queue.Outranks(w, it) {
+			n++
+		}
+	}
+	return n
+}
+
+// position returns the position of w in the priority order of the queue , or 0 if it is not in the queue.
+func (p *PriorityLimiter) position(w *queue.Item) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.waitList.Contains(w) {
+		return 0
+	}
+	pos, before := 1, p.config().before()
+	for it := range p.waitList.All() {
+		if before(it, w) {
+			pos++
+		}
+	}
+	return pos
+}
+
+// Purge removes every goroutine from the priority queue without granting it access. Their Wait returns
+// limiter.ErrPurged. Purge returns the number of goroutines removed.
+func (p *PriorityLimiter) Purge() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clear(limiter.ErrPurged)
+}
+
+// clear removes every goroutine from the priority queue , their Wait returns err. The mutex must be held.
+func (p *PriorityLimiter) clear(err error) int {
+	n := p.waitList.Len()
+	for it := p.waitList.Front(); it != nil; it = p.waitList.Front() {
+		p.waitList.Remove(it)
+		p.queueLen.Add(-1)
+		it.Abandon(err)
+	}
+	if n > 0 {
+		p.version++
+		p.queued = make(map[PriorityValue]int)
+		p.fair.reset()
+		p.notifyRoom()
+	}
+	return n
+}
+
+// Close stops admitting goroutines: Wait returns limiter.ErrClosed from now on , including for the goroutines
+// in the priority queue. Close then waits until the goroutines accessing the resource have called Finish , or
+// until the context is done , in which case it returns the context error. Close can be called more than once ,
+// every call waits for the PriorityLimiter to be drained.
+func (p *PriorityLimiter) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		p.drained = make(chan struct{})
+		p.version++
+		p.clear(limiter.ErrClosed)
+		// goroutines blocked by the BlockCaller policy must notice the PriorityLimiter is closed.
+		p.notifyRoom()
+		p.checkDrained()
+	}
+	drained := p.drained
+	p.mu.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkDrained closes drained once the PriorityLimiter is closed and no goroutine accesses the resource
+// anymore. The mutex must be held.
+func (p *PriorityLimiter) checkDrained() {
+	if !p.closed || p.count.Load() > 0 {
+		return
+	}
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
+
+// EstimatedWait returns how long a goroutine calling Wait now is expected to wait before accessing the resource:
+// zero if a slot is free , otherwise the time to serve the priority queue at the rate the PriorityLimiter served
+// goroutines recently , whatever the priority of the goroutine. ok is false if the PriorityLimiter has not served
+// enough goroutines yet to estimate its rate. It suits Retry-After hints: the time until an overloaded
+// PriorityLimiter has drained its priority queue.
+func (p *PriorityLimiter) EstimatedWait() (d time.Duration, ok bool) {
+	c := p.config()
+	queued := p.QueueLen()
+	if queued == 0 && (c.unlimited || p.InFlight() < c.limit) {
+		return 0, true
+	}
+	return p.serviceRate.Estimate(queued + 1)
+}
+
+// OldestWaitAge returns how long the oldest goroutine in the priority queue has been waiting , zero if the queue is
+// empty. Health checks can compare it with the expected hold time to detect a stuck PriorityLimiter , for example
+// one whose slots leak or whose low priorities starve , even while the queue is short.
+func (p *PriorityLimiter) OldestWaitAge() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.oldestWaitAge()
+}
+
+// oldestWaitAge returns OldestWaitAge. The mutex must be held.
+func (p *PriorityLimiter) oldestWaitAge() time.Duration {
+	w := p.waitList.FirstPushed()
+	if w == nil {
+		return 0
+	}
+	return p.config().clock.Now().Sub(w.EnqueuedAt())
+}
+
+// Stats returns a snapshot of the current state of the limiter along with
+// the percentiles of the time spent by goroutines in the priority queue.
+func (p *PriorityLimiter) Stats() limiter.Stats {
+	p.mu.Lock()
+	s := limiter.Stats{
+		Limit:      p.config().limit,
+		InFlight:   int(p.count.Load()),
+		Waiting:    p.waitList.Len(),
+		Reclaimed:  p.reclaimed,
+		Shed:       p.shed.Load(),
+		Paused:     p.paused,
+		Version:    p.version,
+		OldestWait: p.oldestWaitAge(),
+	}
+	p.mu.Unlock()
+	s.WaitP50 = p.waitTimes.Quantile(0.50)
+	s.WaitP95 = p.waitTimes.Quantile(0.95)
+	s.WaitP99 = p.waitTimes.Quantile(0.99)
+	return s
+}
+
+// InFlight returns the number of goroutines accessing the resource. It never blocks on the PriorityLimiter's mutex.
+func (p *PriorityLimiter) InFlight() int {
+	return int(p.count.Load())
+}
+
+// QueueLen returns the number of goroutines in the priority queue. It never blocks on the PriorityLimiter's mutex.
+func (p *PriorityLimiter) QueueLen() int {
+	return int(p.queueLen.Load())
 }
@@ -2,14 +2,27 @@ package priority
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/clock"
 	"github.com/vivek-ng/concurrency-limiter/queue"
 )
 
+// top returns a copy of the next goroutine to be served.
+func top(nl *PriorityLimiter) interface{} {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	return nl.waitList.Top()
+}
+
 func TestPriorityLimiter(t *testing.T) {
 	nl := NewLimiter(3)
 	var wg sync.WaitGroup
@@ -23,18 +36,18 @@ func TestPriorityLimiter(t *testing.T) {
 		}(i)
 	}
 	time.Sleep(200 * time.Millisecond)
-	assert.Equal(t, 2, nl.waitListSize())
-	pVal := nl.waitList.Top()
+	assert.Equal(t, 2, nl.QueueLen())
+	pVal := top(nl)
 	pValItem := pVal.(queue.Item)
 	expectedVal1 := pValItem.Priority
 	nl.Finish()
-	pVal = nl.waitList.Top()
+	pVal = top(nl)
 	pValItem = pVal.(queue.Item)
 	expectedVal2 := pValItem.Priority
 	assert.Greater(t, expectedVal1, expectedVal2)
 	nl.Finish()
 	wg.Wait()
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.QueueLen())
 }
 
 func TestDynamicPriority(t *testing.T) {
@@ -51,12 +64,12 @@ func TestDynamicPriority(t *testing.T) {
 		}(i)
 	}
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 2, nl.waitListSize())
-	pVal := nl.waitList.Top()
+	assert.Equal(t, 2, nl.QueueLen())
+	pVal := top(nl)
 	pValItem := pVal.(queue.Item)
 	expectedVal1 := pValItem.Priority
 	nl.Finish()
-	pVal = nl.waitList.Top()
+	pVal = top(nl)
 	pValItem = pVal.(queue.Item)
 	expectedVal2 := pValItem.Priority
 	assert.GreaterOrEqual(t, expectedVal1, int(High))
@@ -82,8 +95,8 @@ func TestPriorityLimiter_Timeout(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		nl.Finish()
 	}
-	assert.Zero(t, nl.count)
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.InFlight())
+	assert.Zero(t, nl.QueueLen())
 }
 
 func TestPriorityLimiter_ContextDone(t *testing.T) {
@@ -99,10 +112,31 @@ func TestPriorityLimiter_ContextDone(t *testing.T) {
 		}(i)
 	}
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 2, nl.waitListSize())
+	assert.Equal(t, 2, nl.QueueLen())
 	cancel()
 	time.Sleep(100 * time.Millisecond)
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.QueueLen())
+}
+
+func TestPriorityLimiter_ContextCause(t *testing.T) {
+	nl := NewLimiter(1)
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	cause := errors.New("client went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(ctx, Low)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, nl.QueueLen())
+	cancel(cause)
+
+	err := <-errs
+	assert.True(t, errors.Is(err, limiter.ErrCanceled))
+	assert.True(t, errors.Is(err, cause))
+	assert.Zero(t, nl.QueueLen())
+	assert.Equal(t, 1, nl.InFlight())
 }
 
 func TestPriorityLimiter_ContextWithTimeout(t *testing.T) {
@@ -119,10 +153,10 @@ func TestPriorityLimiter_ContextWithTimeout(t *testing.T) {
 		}(i)
 	}
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 2, nl.waitListSize())
+	assert.Equal(t, 2, nl.QueueLen())
 	cancel()
 	time.Sleep(100 * time.Millisecond)
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.QueueLen())
 }
 
 func TestDynamicPriorityAndTimeout(t *testing.T) {
@@ -139,7 +173,7 @@ func TestDynamicPriorityAndTimeout(t *testing.T) {
 		}(i)
 	}
 	time.Sleep(200 * time.Millisecond)
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.QueueLen())
 }
 
 func TestDynamicPriorityWithTimeout_ContextDone(t *testing.T) {
@@ -159,5 +193,1279 @@ func TestDynamicPriorityWithTimeout_ContextDone(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 	cancel()
 	time.Sleep(100 * time.Millisecond)
-	assert.Zero(t, nl.waitListSize())
+	assert.Zero(t, nl.QueueLen())
+}
+
+func TestPriorityLimiter_Stats(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		nl.Wait(ctx, High)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	s := nl.Stats()
+	assert.Equal(t, 1, s.Limit)
+	assert.Equal(t, 1, s.Waiting)
+	nl.Finish()
+	<-done
+
+	s = nl.Stats()
+	assert.Zero(t, s.Waiting)
+	assert.Zero(t, s.WaitP50)
+	assert.GreaterOrEqual(t, int64(s.WaitP99), int64(90*time.Millisecond))
+}
+
+func TestPriorityLimiter_MaxQueueLength(t *testing.T) {
+	nl := NewLimiter(1,
+		WithMaxQueueLength(1),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, nl.Wait(ctx, Low))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, limiter.ErrQueueFull, nl.Wait(ctx, High))
+	assert.Equal(t, 1, nl.QueueLen())
+
+	nl.Finish()
+	<-done
+	assert.Zero(t, nl.QueueLen())
+}
+
+// priorityOrderProperty queues goroutines with random priorities behind a single held slot and then
+// applies the ops as Finish, SetLimit or cancellation of a queued goroutine. Goroutines must leave the
+// priority queue by priority and in FIFO order among equal priorities.
+func priorityOrderProperty(options ...Option) func(priorities []uint8, ops []uint8) bool {
+	return func(priorities []uint8, ops []uint8) bool {
+		nl := NewLimiter(1, options...)
+		nl.Wait(context.Background(), Low)
+
+		n := len(priorities)%6 + 2
+		granted := make(chan int, n)
+		cancels := make([]context.CancelFunc, n)
+		prs := make([]PriorityValue, n)
+		pending := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cancels[i] = cancel
+			prs[i] = Low
+			if i < len(priorities) {
+				prs[i] = PriorityValue(priorities[i]%4) + Low
+			}
+			go func(id int) {
+				nl.Wait(ctx, prs[id])
+				granted <- id
+			}(i)
+			for nl.QueueLen() != i+1 {
+				time.Sleep(time.Millisecond)
+			}
+			pending = append(pending, i)
+		}
+
+		// next returns the position in pending of the goroutine that must be admitted next.
+		next := func() int {
+			best := 0
+			for k, id := range pending {
+				if prs[id] > prs[pending[best]] {
+					best = k
+				}
+			}
+			return best
+		}
+		expect := func(id int) bool {
+			select {
+			case got := <-granted:
+				return got == id
+			case <-time.After(time.Second):
+				return false
+			}
+		}
+
+		limit := 1
+		for _, op := range ops {
+			if len(pending) == 0 {
+				break
+			}
+			switch op % 3 {
+			case 0:
+				nl.Finish()
+				k := next()
+				if !expect(pending[k]) {
+					return false
+				}
+				pending = append(pending[:k], pending[k+1:]...)
+			case 1:
+				k := int(op/3) % len(pending)
+				cancels[pending[k]]()
+				if !expect(pending[k]) {
+					return false
+				}
+				pending = append(pending[:k], pending[k+1:]...)
+			case 2:
+				before := nl.QueueLen()
+				limit++
+				nl.SetLimit(limit)
+				admitted := before - nl.QueueLen()
+				want := make(map[int]bool)
+				for i := 0; i < admitted; i++ {
+					k := next()
+					want[pending[k]] = true
+					pending = append(pending[:k], pending[k+1:]...)
+				}
+				for i := 0; i < admitted; i++ {
+					select {
+					case got := <-granted:
+						if !want[got] {
+							return false
+						}
+					case <-time.After(time.Second):
+						return false
+					}
+				}
+			}
+		}
+		for len(pending) > 0 {
+			nl.Finish()
+			k := next()
+			if !expect(pending[k]) {
+				return false
+			}
+			pending = append(pending[:k], pending[k+1:]...)
+		}
+		return true
+	}
+}
+
+func TestPriorityLimiter_OrderProperty(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 30}
+	assert.NoError(t, quick.Check(priorityOrderProperty(), cfg))
+	assert.NoError(t, quick.Check(priorityOrderProperty(WithTimeout(60000)), cfg))
+}
+
+func TestPriorityLimiter_DropLowestPriority(t *testing.T) {
+	nl := NewLimiter(1,
+		WithMaxQueueLength(1),
+		WithRejectionPolicy(limiter.DropLowestPriority),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	low := make(chan error, 1)
+	go func() {
+		low <- nl.Wait(ctx, Low)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	// an arrival that is not more important than the queued goroutine is rejected.
+	assert.Equal(t, limiter.ErrQueueFull, nl.Wait(ctx, Low))
+
+	high := make(chan error, 1)
+	go func() {
+		high <- nl.Wait(ctx, High)
+	}()
+	assert.Equal(t, limiter.ErrDropped, <-low)
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	assert.NoError(t, <-high)
+}
+
+func TestPriorityLimiter_ConfigWithoutLocking(t *testing.T) {
+	nl := NewLimiter(3,
+		WithDynamicPriority(5),
+		WithTimeout(50),
+	)
+	assert.Equal(t, Config{
+		Limit:          3,
+		DynamicPeriod:  5 * time.Millisecond,
+		Timeout:        50 * time.Millisecond,
+		MaxQueueLength: -1,
+	}, nl.Config())
+
+	// configuration reads must not contend with the mutex.
+	nl.mu.Lock()
+	assert.Equal(t, 3, nl.Limit())
+	nl.mu.Unlock()
+
+	nl.SetLimit(1)
+	assert.Equal(t, 1, nl.Limit())
+}
+
+func TestPriorityLimiter_AdmissionPolicy(t *testing.T) {
+	nl := NewLimiter(2,
+		WithTimeout(100),
+		WithAdmissionPolicy(limiter.AdmitUpToLimit),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	nl.Wait(ctx, Low)
+	nl.Wait(ctx, Low)
+	assert.Equal(t, 3, nl.Stats().InFlight)
+
+	go nl.Wait(ctx, High)
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	assert.Equal(t, 1, nl.QueueLen())
+	nl.Finish()
+	assert.Zero(t, nl.QueueLen())
+	assert.Equal(t, 2, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_State(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	for i, priority := range []PriorityValue{Low, High, Medium} {
+		go nl.Wait(ctx, priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	st := nl.State()
+	assert.Equal(t, limiter.KindPriorityLimiter, st.Kind)
+	assert.Equal(t, 3, st.Waiting)
+	var priorities []int
+	for _, w := range st.Waiters {
+		priorities = append(priorities, *w.Priority)
+	}
+	assert.Equal(t, []int{int(High), int(Medium), int(Low)}, priorities)
+	// dumping the state leaves the heap intact.
+	nl.Finish()
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int(Medium), *nl.State().Waiters[0].Priority)
+}
+
+func TestPriorityLimiter_PriorityQuota(t *testing.T) {
+	nl := NewLimiter(2, WithPriorityQuota(map[PriorityValue]int{High: 1, Low: 1}))
+	ctx := context.Background()
+	// nobody else is queued , so High borrows the slot reserved for Low.
+	nl.Wait(ctx, High)
+	nl.Wait(ctx, High)
+	assert.Equal(t, 2, nl.Stats().InFlight)
+
+	done := make(chan PriorityValue, 2)
+	for i, priority := range []PriorityValue{High, Low} {
+		priority := priority
+		go func() {
+			nl.Wait(ctx, priority)
+			done <- priority
+		}()
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// High is over its quota and Low is queued , so the freed slot goes to Low.
+	nl.FinishPriority(High)
+	assert.Equal(t, Low, <-done)
+	nl.FinishPriority(High)
+	assert.Equal(t, High, <-done)
+	assert.Equal(t, 2, nl.Stats().InFlight)
+	assert.Equal(t, map[PriorityValue]int{High: 1, Low: 1}, nl.Config().PriorityQuota)
+}
+
+func TestPriorityLimiter_PriorityQueueLimits(t *testing.T) {
+	nl := NewLimiter(1, WithPriorityQueueLimits(map[PriorityValue]int{Low: 1}), WithMaxQueueLength(3))
+	assert.Equal(t, map[PriorityValue]int{Low: 1}, nl.Config().PriorityQueueLimits)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	admitted := make(chan PriorityValue, 3)
+	for i, priority := range []PriorityValue{Low, High, High} {
+		go func(priority PriorityValue) {
+			if nl.Wait(ctx, priority) == nil {
+				admitted <- priority
+			}
+		}(priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// the queue of Low is full , not the priority queue.
+	err := nl.Wait(ctx, Low)
+	assert.True(t, errors.Is(err, ErrClassQueueFull))
+	assert.True(t, errors.Is(err, limiter.ErrQueueFull))
+	assert.Equal(t, uint64(1), nl.Stats().Shed)
+	// the priority queue is full.
+	err = nl.Wait(ctx, Medium)
+	assert.Equal(t, limiter.ErrQueueFull, err)
+
+	nl.FinishN(4)
+	for i := 0; i < 3; i++ {
+		<-admitted
+	}
+	assert.Zero(t, nl.queued[Low])
+	assert.NoError(t, nl.SetPriorityQueueLimits(nil))
+	assert.Nil(t, nl.Config().PriorityQueueLimits)
+}
+
+func TestPriorityLimiter_PriorityQueueLimitsDropOldest(t *testing.T) {
+	nl := NewLimiter(1,
+		WithPriorityQueueLimits(map[PriorityValue]int{Low: 1}),
+		WithRejectionPolicy(limiter.DropOldest),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	errs := make(chan error, 2)
+	for i, priority := range []PriorityValue{Low, High, Low} {
+		go func(priority PriorityValue) {
+			errs <- nl.Wait(ctx, priority)
+		}(priority)
+		for i < 2 && nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// the oldest Low goroutine makes room , the High one stays.
+	assert.Equal(t, limiter.ErrDropped, <-errs)
+	assert.Equal(t, 2, nl.QueueLen())
+	nl.FinishN(3)
+	assert.NoError(t, <-errs)
+	assert.NoError(t, <-errs)
+
+	_, err := NewLimiterWithValidation(1, WithPriorityQueueLimits(map[PriorityValue]int{Low: -1}))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_FlowWeights(t *testing.T) {
+	nl := NewLimiter(1, WithFlowWeights(map[string]int{"a": 2}))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	var h *Handle
+	// the chatty flow a queues all of its goroutines first , the batch goroutine is served last whatever its flow.
+	waiters := []struct {
+		flow     string
+		priority PriorityValue
+	}{{"b", Low}, {"a", High}, {"a", High}, {"a", High}, {"a", High}, {"b", High}, {"b", High}}
+	for i, w := range waiters {
+		fctx := limiter.WithFlow(ctx, w.flow)
+		if i == 5 {
+			fctx, h = WithHandle(fctx)
+		}
+		wg.Add(1)
+		go func(flow string, priority PriorityValue) {
+			defer wg.Done()
+			if nl.Wait(fctx, priority) == nil {
+				mu.Lock()
+				order = append(order, fmt.Sprintf("%s%d", flow, priority))
+				mu.Unlock()
+				nl.Finish()
+			}
+		}(w.flow, w.priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 3, h.Position())
+	st := nl.State()
+	assert.Equal(t, "b", st.Waiters[2].Flow)
+	assert.True(t, st.Config.FairQueuing)
+	assert.Equal(t, map[string]int{"a": 2}, nl.Config().FlowWeights)
+
+	nl.Finish()
+	wg.Wait()
+	assert.Equal(t, []string{"a4", "a4", "b4", "a4", "a4", "b4", "b1"}, order)
+
+	_, err := NewLimiterWithValidation(1, WithFlowWeights(map[string]int{"a": 0}))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	_, err = NewLimiterWithValidation(1, WithFlowWeights(nil), WithEarliestDeadlineFirst())
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_Lottery(t *testing.T) {
+	nl := NewLimiter(1, WithLottery())
+	assert.True(t, nl.Config().Lottery)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	admitted := make(chan PriorityValue, 2)
+	for i, priority := range []PriorityValue{High, Low} {
+		go func(priority PriorityValue) {
+			nl.Wait(ctx, priority)
+			admitted <- priority
+		}(priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// High holds the first four of the five tickets.
+	nl.mu.Lock()
+	var winners [2]int
+	for i := 0; i < 10000; i++ {
+		if nl.pick().Priority == int(Low) {
+			winners[0]++
+		} else {
+			winners[1]++
+		}
+	}
+	nl.random = func() float64 { return 0.9 }
+	nl.mu.Unlock()
+	assert.InDelta(t, 0.2, float64(winners[0])/10000, 0.03)
+
+	nl.Finish()
+	assert.Equal(t, Low, <-admitted)
+	nl.Finish()
+	assert.Equal(t, High, <-admitted)
+
+	_, err := NewLimiterWithValidation(1, WithLottery(), WithEarliestDeadlineFirst())
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_PriorityQuotaWithPermits(t *testing.T) {
+	nl := NewLimiter(1, WithPriorityQuota(map[PriorityValue]int{Low: 1}))
+	ctx := context.Background()
+	pm, err := nl.Acquire(ctx, High, nil)
+	assert.NoError(t, err)
+
+	done := make(chan PriorityValue, 2)
+	for i, priority := range []PriorityValue{High, Low} {
+		priority := priority
+		go func() {
+			pm, _ := nl.Acquire(ctx, priority, nil)
+			done <- priority
+			pm.Release()
+		}()
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	pm.Release()
+	assert.Equal(t, Low, <-done)
+	assert.Equal(t, High, <-done)
+}
+
+func TestPriorityLimiter_MaxWaitBeforePromotion(t *testing.T) {
+	nl := NewLimiter(1, WithMaxWaitBeforePromotion(50*time.Millisecond))
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	done := make(chan PriorityValue, 3)
+	for i, priority := range []PriorityValue{Low, Medium, High} {
+		priority := priority
+		go func() {
+			nl.Wait(ctx, priority)
+			done <- priority
+		}()
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+		if i == 0 {
+			time.Sleep(60 * time.Millisecond)
+		}
+	}
+
+	// Low has been waiting for longer than the bound and is admitted before High.
+	nl.Finish()
+	assert.Equal(t, Low, <-done)
+	nl.Finish()
+	assert.Equal(t, High, <-done)
+	nl.Finish()
+	assert.Equal(t, Medium, <-done)
+}
+
+func TestPriorityLimiter_Purge(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- nl.Wait(ctx, High)
+		}()
+	}
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 2, nl.Purge())
+	assert.Equal(t, limiter.ErrPurged, <-errs)
+	assert.Equal(t, limiter.ErrPurged, <-errs)
+	assert.Equal(t, 1, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_AgingFunc(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	waits := make(chan time.Duration, 1)
+	nl := NewLimiter(1,
+		WithDynamicPriority(5),
+		WithClock(clk),
+		WithAgingFunc(func(current int, waited time.Duration) int {
+			waits <- waited
+			if current >= 64 {
+				return current
+			}
+			return current * 2
+		}),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	go nl.Wait(ctx, Low)
+	for nl.QueueLen() != 1 || clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the priority is not capped at High.
+	for i := 1; i <= 8; i++ {
+		clk.Advance(5 * time.Millisecond)
+		assert.Equal(t, time.Duration(i)*5*time.Millisecond, <-waits)
+	}
+	assert.Equal(t, 64, *nl.State().Waiters[0].Priority)
+	nl.Finish()
+}
+
+func TestPriorityLimiter_AgingPeriods(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	changes := make(chan PriorityChange, 2)
+	nl := NewLimiter(1,
+		WithAgingPeriods(map[PriorityValue]time.Duration{Low: 5 * time.Millisecond, Medium: 20 * time.Millisecond}),
+		WithAgingFunc(func(current int, waited time.Duration) int { return current + 1 }),
+		WithOnPriorityChange(func(c PriorityChange) { changes <- c }),
+		WithClock(clk),
+	)
+	assert.Equal(t, 5*time.Millisecond, nl.Config().AgingPeriods[Low])
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	for _, priority := range []PriorityValue{Low, Medium, High} {
+		go nl.Wait(ctx, priority)
+	}
+	// goroutines with a priority without period do not age.
+	for nl.QueueLen() != 3 || clk.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 1; i <= 3; i++ {
+		clk.Advance(5 * time.Millisecond)
+		change := <-changes
+		assert.Equal(t, Low, change.Class)
+		assert.Equal(t, Low+PriorityValue(i), change.New)
+	}
+	clk.Advance(5 * time.Millisecond)
+	raised := make(map[PriorityValue]PriorityValue)
+	for i := 0; i < 2; i++ {
+		change := <-changes
+		raised[change.Class] = change.New
+	}
+	assert.Equal(t, map[PriorityValue]PriorityValue{Low: Low + 4, Medium: MediumHigh}, raised)
+	nl.FinishN(3)
+
+	_, err := NewLimiterWithValidation(1, WithAgingPeriods(map[PriorityValue]time.Duration{Low: -time.Millisecond}))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	_, err = NewLimiterWithValidation(1, WithAgingPeriods(map[PriorityValue]time.Duration{Low: time.Millisecond}), WithEarliestDeadlineFirst())
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_AgingScanInterval(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	changes := make(chan PriorityChange, 4)
+	nl := NewLimiter(1,
+		WithDynamicPeriodDuration(15*time.Millisecond),
+		WithAgingScanInterval(10*time.Millisecond),
+		WithOnPriorityChange(func(c PriorityChange) { changes <- c }),
+		WithClock(clk),
+	)
+	assert.Equal(t, 10*time.Millisecond, nl.Config().AgingScanInterval)
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	for i := 0; i < 2; i++ {
+		go nl.Wait(ctx, Low)
+	}
+	scheduled := func() int {
+		nl.mu.Lock()
+		defer nl.mu.Unlock()
+		return len(nl.aging)
+	}
+	for scheduled() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// the queued goroutines share the ticker of the scan.
+	assert.Equal(t, 1, clk.Waiters())
+
+	// the goroutines age at the first scan after their dynamic period.
+	clk.Advance(20 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		change := <-changes
+		assert.Equal(t, Low+1, change.New)
+	}
+	clk.Advance(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		change := <-changes
+		assert.Equal(t, Low+2, change.New)
+	}
+	nl.FinishN(2)
+	for scheduled() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := NewLimiterWithValidation(1, WithAgingScanInterval(-time.Millisecond))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_PriorityRange(t *testing.T) {
+	nl := NewLimiter(1, WithPriorityRange(0, 1000))
+	ctx := context.Background()
+	assert.Equal(t, ErrInvalidPriority, nl.Wait(ctx, 1001))
+	assert.Equal(t, ErrInvalidPriority, nl.Wait(ctx, -1))
+	assert.NoError(t, nl.Wait(ctx, 0))
+
+	done := make(chan PriorityValue, 3)
+	for i, priority := range []PriorityValue{10, 999, 500} {
+		priority := priority
+		go func() {
+			nl.Wait(ctx, priority)
+			done <- priority
+		}()
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, priority := range []PriorityValue{999, 500, 10} {
+		nl.Finish()
+		assert.Equal(t, priority, <-done)
+	}
+	c := nl.Config()
+	assert.True(t, c.PriorityRange)
+	assert.Equal(t, PriorityValue(1000), c.MaxPriority)
+}
+
+func TestPriorityLimiter_Handle(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	handles := make(map[PriorityValue]*Handle)
+	for i, priority := range []PriorityValue{Low, High, Medium} {
+		hctx, h := WithHandle(ctx)
+		handles[priority] = h
+		go nl.Wait(hctx, priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 1, handles[High].Position())
+	assert.Equal(t, 2, handles[Medium].Position())
+	assert.Equal(t, 3, handles[Low].Position())
+	_, ok := handles[Low].EstimatedWait()
+	assert.False(t, ok)
+
+	nl.Finish()
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, handles[High].Position())
+	assert.Equal(t, 2, handles[Low].Position())
+}
+
+func TestPriorityLimiter_Close(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	pm, err := nl.Acquire(ctx, Low, nil)
+	assert.NoError(t, err)
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(ctx, High)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- nl.Close(ctx)
+	}()
+	assert.Equal(t, limiter.ErrClosed, <-errs)
+	_, err = nl.Acquire(ctx, High, nil)
+	assert.Equal(t, limiter.ErrClosed, err)
+	pm.Release()
+	assert.NoError(t, <-closed)
+}
+
+func TestPriorityLimiter_DurationOptions(t *testing.T) {
+	c := NewLimiter(1,
+		WithTimeoutDuration(2*time.Minute),
+		WithDynamicPeriodDuration(500*time.Microsecond),
+	).Config()
+	assert.Equal(t, 2*time.Minute, c.Timeout)
+	assert.Equal(t, 500*time.Microsecond, c.DynamicPeriod)
+	c = NewLimiter(1, WithTimeout(100), WithDynamicPriority(5)).Config()
+	assert.Equal(t, 100*time.Millisecond, c.Timeout)
+	assert.Equal(t, 5*time.Millisecond, c.DynamicPeriod)
+}
+
+func TestNewLimiterWithValidation(t *testing.T) {
+	nl, err := NewLimiterWithValidation(2, WithDynamicPeriodDuration(time.Millisecond), WithPriorityRange(0, 10))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, nl.Limit())
+
+	invalid := []struct {
+		limit   int
+		options []Option
+	}{
+		{-1, nil},
+		{1, []Option{WithDynamicPeriodDuration(0)}},
+		{1, []Option{WithAgingFunc(func(current int, waited time.Duration) int { return current })}},
+		{1, []Option{WithEarliestDeadlineFirst(), WithDynamicPriority(5)}},
+		{1, []Option{WithPriorityRange(10, 0)}},
+		{1, []Option{WithPriorityRange(0, 10), WithPriorityQuota(map[PriorityValue]int{11: 1})}},
+		{1, []Option{WithRejectionPolicy(limiter.DropLowestPriority)}},
+	}
+	for _, c := range invalid {
+		nl, err := NewLimiterWithValidation(c.limit, c.options...)
+		assert.Nil(t, nl)
+		assert.True(t, errors.Is(err, limiter.ErrInvalidConfig), "%v", err)
+	}
+}
+
+func TestPriorityLimiter_RejectOnTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := NewLimiter(1,
+		WithTimeoutDuration(20*time.Millisecond),
+		WithDynamicPeriodDuration(5*time.Millisecond),
+		WithTimeoutPolicy(limiter.RejectOnTimeout),
+		WithClock(clk),
+	)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(ctx, High)
+	}()
+	// a ticker for the dynamic priority and a timer for the timeout.
+	for clk.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(20 * time.Millisecond)
+	assert.Equal(t, limiter.ErrTimeout, <-errs)
+	assert.Equal(t, 1, nl.Stats().InFlight)
+	assert.Equal(t, limiter.RejectOnTimeout, nl.Config().TimeoutPolicy)
+}
+
+func TestPriorityLimiter_TimerWheel(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFake(start)
+	nl := NewLimiter(1,
+		WithTimeoutDuration(25*time.Millisecond),
+		WithDynamicPeriodDuration(5*time.Millisecond),
+		WithTimeoutPolicy(limiter.RejectOnTimeout),
+		WithTimerWheel(10*time.Millisecond),
+		WithClock(clk),
+	)
+	assert.Equal(t, 10*time.Millisecond, nl.Config().TimerWheelTick)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	errs := make(chan error, 3)
+	for _, priority := range []PriorityValue{Low, Medium, High} {
+		go func(priority PriorityValue) {
+			errs <- nl.Wait(ctx, priority)
+		}(priority)
+	}
+	for nl.QueueLen() != 3 || clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the tickers and timers of the queued goroutines share the ticker of the wheel.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, clk.Waiters())
+
+	// the timeouts are rounded up to the tick.
+	for i := 0; i < 3; {
+		clk.Advance(10 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+		for ; len(errs) > 0; i++ {
+			assert.Equal(t, limiter.ErrTimeout, <-errs)
+			assert.True(t, clk.Now().Sub(start) >= 30*time.Millisecond)
+		}
+	}
+	assert.Equal(t, 0, nl.QueueLen())
+
+	_, err := NewLimiterWithValidation(1, WithTimerWheel(-time.Millisecond))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_PriorityTimeouts(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := NewLimiter(1,
+		WithTimeoutDuration(time.Second),
+		WithPriorityTimeouts(map[PriorityValue]time.Duration{Low: 10 * time.Millisecond}),
+		WithTimeoutPolicy(limiter.RejectOnTimeout),
+		WithClock(clk),
+	)
+	assert.Equal(t, map[PriorityValue]time.Duration{Low: 10 * time.Millisecond}, nl.Config().PriorityTimeouts)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	errs := make(map[PriorityValue]chan error)
+	for _, priority := range []PriorityValue{Low, High} {
+		ch := make(chan error)
+		errs[priority] = ch
+		go func(priority PriorityValue) {
+			ch <- nl.Wait(ctx, priority)
+		}(priority)
+	}
+	for clk.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(10 * time.Millisecond)
+	assert.Equal(t, limiter.ErrTimeout, <-errs[Low])
+	assert.Equal(t, 1, nl.QueueLen())
+	nl.Finish()
+	assert.NoError(t, <-errs[High])
+
+	_, err := NewLimiterWithValidation(1, WithPriorityTimeouts(map[PriorityValue]time.Duration{Low: 0}))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	// per priority timeouts are enough for a timeout policy.
+	_, err = NewLimiterWithValidation(1,
+		WithPriorityTimeouts(map[PriorityValue]time.Duration{Low: time.Second}),
+		WithTimeoutPolicy(limiter.RejectOnTimeout),
+	)
+	assert.NoError(t, err)
+}
+
+func TestPriorityLimiter_FinishN(t *testing.T) {
+	nl := NewLimiter(2)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	nl.Wait(ctx, Low)
+	admitted := make(chan PriorityValue, 3)
+	for _, p := range []PriorityValue{Low, High, Medium} {
+		go func(p PriorityValue) {
+			nl.Wait(ctx, p)
+			admitted <- p
+		}(p)
+	}
+	for nl.Stats().Waiting != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.FinishN(2)
+	assert.ElementsMatch(t, []PriorityValue{High, Medium}, []PriorityValue{<-admitted, <-admitted})
+	assert.Equal(t, 1, nl.Stats().Waiting)
+	nl.FinishN(3)
+	assert.Equal(t, Low, <-admitted)
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_Jitter(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	changes := make(chan PriorityChange, 1)
+	nl, err := NewLimiterWithValidation(1,
+		WithDynamicPeriodDuration(100*time.Millisecond),
+		WithJitter(0.5),
+		WithOnPriorityChange(func(c PriorityChange) { changes <- c }),
+		WithClock(clk),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+	go nl.Wait(ctx, Low)
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the goroutine is aged between half of the dynamic period and the dynamic period.
+	clk.Advance(49 * time.Millisecond)
+	select {
+	case c := <-changes:
+		t.Fatalf("aged early: %+v", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clk.Advance(51 * time.Millisecond)
+	assert.Equal(t, Medium, (<-changes).New)
+	assert.Equal(t, 0.5, nl.Config().Jitter)
+	nl.Finish()
+
+	_, err = NewLimiterWithValidation(1, WithJitter(-1))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+}
+
+func TestPriorityLimiter_DeadlineAwareRejection(t *testing.T) {
+	nl := NewLimiter(1, WithDeadlineAwareRejection())
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		nl.Wait(ctx, Low)
+		time.Sleep(30 * time.Millisecond)
+		nl.Finish()
+	}
+	nl.Wait(ctx, Low)
+	for i := 0; i < 3; i++ {
+		go nl.Wait(ctx, Medium)
+	}
+	for nl.QueueLen() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// High jumps the queue and is expected to wait about 30ms , Low would wait about 120ms.
+	dctx, cancel := context.WithTimeout(ctx, 80*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, limiter.ErrWaitExceedsDeadline, nl.Wait(dctx, Low))
+	go nl.Wait(dctx, High)
+	for nl.QueueLen() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Purge()
+}
+
+func TestPriorityLimiter_AcquireCtx(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	pm, err := nl.AcquireCtx(ctx, Low)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, nl.Stats().InFlight)
+
+	cancel()
+	for nl.Stats().InFlight != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pm.Release()
+	assert.Equal(t, 0, nl.Stats().InFlight)
+
+	pm, err = nl.AcquireCtx(context.Background(), High)
+	assert.NoError(t, err)
+	pm.Release()
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestAtPriority(t *testing.T) {
+	nl := NewLimiter(1, WithPriorityQuota(map[PriorityValue]int{High: 1}))
+	var w limiter.Waiter = AtPriority(nl, High)
+	ctx := context.Background()
+	assert.NoError(t, w.Wait(ctx))
+	assert.Equal(t, 1, nl.inUse[High])
+	w.Finish()
+	assert.Equal(t, 0, nl.inUse[High])
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_OnPriorityChange(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	changes := make(chan PriorityChange, 4)
+	nl := NewLimiter(1,
+		WithClock(clk),
+		WithDynamicPeriodDuration(time.Second),
+		WithMaxWaitBeforePromotion(2*time.Second),
+		WithOnPriorityChange(func(c PriorityChange) { changes <- c }),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	done := make(chan struct{})
+	go func() {
+		nl.Wait(ctx, Low)
+		close(done)
+	}()
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	assert.Equal(t, PriorityChange{Old: Low, New: Medium, Class: Low, Waited: time.Second}, <-changes)
+
+	go nl.Wait(ctx, High)
+	for nl.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	assert.Equal(t, PriorityChange{Old: Medium, New: MediumHigh, Class: Low, Waited: 2 * time.Second}, <-changes)
+
+	// the goroutine queued with Low has waited for longer than the max wait and is admitted before High.
+	nl.Finish()
+	<-done
+	assert.Equal(t, PriorityChange{Old: MediumHigh, New: MediumHigh, Class: Low, Waited: 2 * time.Second, Promoted: true}, <-changes)
+}
+
+func TestPriorityLimiter_Boost(t *testing.T) {
+	changes := make(chan PriorityChange, 2)
+	nl := NewLimiter(1, WithOnPriorityChange(func(c PriorityChange) { changes <- c }))
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	handles := make(map[PriorityValue]*Handle)
+	admitted := make(chan PriorityValue, 3)
+	for i, priority := range []PriorityValue{High, Medium, Low} {
+		hctx, h := WithHandle(ctx)
+		handles[priority] = h
+		go func(priority PriorityValue) {
+			if nl.Wait(hctx, priority) == nil {
+				admitted <- priority
+			}
+		}(priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.True(t, nl.PromoteToFront(handles[Low]))
+	assert.Equal(t, 1, handles[Low].Position())
+	change := <-changes
+	assert.Equal(t, Low, change.Old)
+	assert.Equal(t, High+1, change.New)
+	assert.Equal(t, Low, change.Class)
+	// ties with the promoted goroutine , which was queued later.
+	assert.True(t, nl.Boost(handles[Medium], High+1))
+	assert.Equal(t, 1, handles[Medium].Position())
+	assert.Equal(t, 3, handles[High].Position())
+	assert.Equal(t, Medium, (<-changes).Class)
+
+	nl.Finish()
+	assert.Equal(t, Medium, <-admitted)
+	assert.False(t, nl.Boost(handles[Medium], High))
+	assert.False(t, nl.PromoteToFront(handles[Medium]))
+	assert.False(t, NewLimiter(1).Boost(handles[High], Low))
+	nl.Finish()
+	assert.Equal(t, Low, <-admitted)
+	nl.Finish()
+	assert.Equal(t, High, <-admitted)
+}
+
+func TestPriorityLimiter_Cancel(t *testing.T) {
+	nl := NewLimiter(1, WithPriorityQuota(map[PriorityValue]int{Low: 1}))
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	hctx, h := WithHandle(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- nl.Wait(hctx, Low)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, nl.Cancel(h))
+	assert.Equal(t, limiter.ErrCancelledByLimiter, <-errs)
+	assert.False(t, nl.Cancel(h))
+	assert.Zero(t, nl.queued[Low])
+	nl.FinishPriority(Low)
+}
+
+func TestPriorityLimiter_SlotAccounting(t *testing.T) {
+	nl := NewLimiter(1, WithTimeoutDuration(time.Hour))
+	ctx := context.Background()
+	nl.Wait(ctx, Low)
+
+	cctx, cancel := context.WithCancel(ctx)
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(cctx, High)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.True(t, errors.Is(<-errs, limiter.ErrCanceled))
+	assert.Equal(t, 1, nl.Stats().InFlight)
+
+	// the slot is handed over , a latecomer cannot take it.
+	go func() {
+		errs <- nl.Wait(ctx, Low)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 1, nl.Stats().InFlight)
+	late, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(nl.Wait(late, High), limiter.ErrCanceled))
+
+	// a goroutine granted a slot as its context is done gives the slot back.
+	gctx, cancel := context.WithCancel(ctx)
+	_, w, err := nl.proceed(gctx, Low, Low, time.Time{})
+	assert.NoError(t, err)
+	nl.Finish()
+	cancel()
+	nl.cancel(gctx, w)
+	assert.True(t, errors.Is(w.Err, limiter.ErrCanceled))
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_HandoffRace(t *testing.T) {
+	// Finish hands slots over while the timeouts and contexts of the waiting goroutines expire.
+	nl := NewLimiter(2, WithTimeoutDuration(time.Millisecond), WithTimeoutPolicy(limiter.RejectOnTimeout))
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%3)*time.Millisecond)
+			defer cancel()
+			if nl.Wait(ctx, PriorityValue(i%4)) == nil {
+				time.Sleep(time.Duration(i%2) * time.Millisecond)
+				nl.Finish()
+			}
+		}(i)
+	}
+	wg.Wait()
+	s := nl.Stats()
+	assert.Equal(t, 0, s.InFlight)
+	assert.Equal(t, 0, s.Waiting)
+}
+
+func TestPriorityLimiter_Unlimited(t *testing.T) {
+	nl, err := NewLimiterWithValidation(0, WithUnlimited(), WithPriorityQuota(map[PriorityValue]int{High: 1}))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, nl.Wait(ctx, Low))
+		assert.NoError(t, nl.Wait(ctx, High))
+	}
+	assert.Equal(t, 20, nl.Stats().InFlight)
+	assert.Equal(t, 0, nl.QueueLen())
+	for i := 0; i < 20; i++ {
+		nl.Finish()
+	}
+	assert.Equal(t, 0, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_Allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector makes sync.Pool drop items")
+	}
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		nl.Wait(ctx, High)
+		nl.Finish()
+	}))
+	// a queued goroutine reuses a pooled item and its channel.
+	nl.Wait(ctx, High)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		_, w, _ := nl.proceed(ctx, Low, Low, time.Time{})
+		nl.Finish()
+		<-w.Done
+		queue.Recycle(w)
+	}))
+}
+
+func TestPriorityLimiter_PickAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector makes sync.Pool drop items")
+	}
+	nl := NewLimiter(1, WithPriorityQuota(map[PriorityValue]int{Low: 1, High: 1}), WithMaxWaitBeforePromotion(time.Hour),
+		WithLottery())
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	// picking the goroutine granted the slot given back does not allocate with quotas , promotion and lottery.
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		for _, class := range []PriorityValue{Low, High} {
+			_, w, _ := nl.proceed(ctx, class, class, time.Time{})
+			nl.FinishPriority(Low + High - class)
+			<-w.Done
+			queue.Recycle(w)
+		}
+	}))
+}
+
+func TestPriorityLimiter_Spin(t *testing.T) {
+	_, err := NewLimiterWithValidation(1, WithSpin(-1))
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+
+	nl := NewLimiter(1, WithSpin(1<<30))
+	assert.Equal(t, 1<<30, nl.Config().Spin)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	done := make(chan error)
+	go func() {
+		done <- nl.Wait(ctx, High)
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	nl.Finish()
+	assert.NoError(t, <-done)
+	nl.Finish()
+	assert.Zero(t, nl.Stats().InFlight)
+}
+
+func TestPriorityLimiter_OldestWaitAge(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := NewLimiter(1, WithClock(clk))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.Zero(t, nl.OldestWaitAge())
+	for i, priority := range []PriorityValue{Low, High} {
+		go nl.Wait(ctx, priority)
+		for nl.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(time.Second)
+	}
+	assert.Equal(t, 2*time.Second, nl.OldestWaitAge())
+	assert.Equal(t, 2*time.Second, nl.Stats().OldestWait)
+	// the goroutine served first is not the oldest one.
+	nl.Finish()
+	assert.Equal(t, 2*time.Second, nl.OldestWaitAge())
+	nl.Finish()
+	assert.Zero(t, nl.OldestWaitAge())
+}
+
+func TestPriorityLimiter_String(t *testing.T) {
+	nl := NewLimiter(3, WithMaxQueueLength(5))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+	assert.Equal(t, "priority limit=3 in_flight=1 waiting=0 max_queue_length=5 rejection_policy=RejectNew", nl.String())
+	assert.Equal(t, slog.KindGroup, nl.LogValue().Kind())
+	nl.Finish()
+}
+
+func TestPriorityLimiter_EstimatedWait(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	nl := NewLimiter(1, WithClock(clk))
+	ctx := context.Background()
+	d, ok := nl.EstimatedWait()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	nl.Wait(ctx, Low)
+	nl.Finish()
+	clk.Advance(100 * time.Millisecond)
+	nl.Wait(ctx, Low)
+	nl.Finish()
+	nl.Wait(ctx, Low)
+	go nl.Wait(ctx, High)
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	d, ok = nl.EstimatedWait()
+	assert.True(t, ok)
+	assert.Equal(t, 200*time.Millisecond, d)
+	nl.FinishN(2)
+}
+
+func TestPriorityLimiter_TryWaitPriority(t *testing.T) {
+	nl := NewLimiter(1, WithMaxQueueLength(1), WithRejectionPolicy(limiter.DropOldest), WithPriorityRange(Low, High))
+	assert.True(t, nl.TryWaitPriority(High))
+	errs := make(chan error)
+	go func() { errs <- nl.Wait(context.Background(), Low) }()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, nl.TryWaitPriority(High))
+	// the queued goroutine is not dropped and the failed call is not counted as shed.
+	assert.Equal(t, 1, nl.QueueLen())
+	assert.Zero(t, nl.Stats().Shed)
+	nl.FinishPriority(High)
+	assert.NoError(t, <-errs)
+	nl.FinishPriority(Low)
+	assert.False(t, nl.TryWaitPriority(High+1))
+}
+
+func TestPriorityLimiter_UnmatchedFinish(t *testing.T) {
+	nl := NewLimiter(1)
+	nl.Finish()
+	nl.FinishPriority(High)
+	assert.Equal(t, 0, nl.Stats().InFlight)
+	assert.True(t, nl.TryWaitPriority(High))
+	assert.False(t, nl.TryWaitPriority(High))
+	nl.Finish()
 }
@@ -0,0 +1,6 @@
+//go:build race
+
+package priority
+
+// raceEnabled is set when the race detector is enabled , it makes sync.Pool drop items at random.
+const raceEnabled = true
@@ -0,0 +1,98 @@
+package priority
+
+import (
+	"maps"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// SetTimeout changes the timeout of the goroutines calling Wait from now on and the policy applied when it
+// expires. A zero timeout removes it. The goroutines already in the priority queue keep the timeout they started
+// with. SetTimeout returns an error wrapping limiter.ErrInvalidConfig , and changes nothing , if the settings
+// contradict the configuration.
+func (p *PriorityLimiter) SetTimeout(timeout time.Duration, policy limiter.TimeoutPolicy) error {
+	return p.reconfigure(func(c *config) {
+		c.timeout = nil
+		if timeout != 0 {
+			c.timeout = &timeout
+		}
+		c.timeoutPolicy = policy
+	})
+}
+
+// SetPriorityTimeouts replaces the timeouts of WithPriorityTimeouts , a nil map removes them. Like SetTimeout , it
+// applies to the goroutines calling Wait from now on. SetPriorityTimeouts returns an error wrapping
+// limiter.ErrInvalidConfig , and changes nothing , if the timeouts contradict the configuration.
+func (p *PriorityLimiter) SetPriorityTimeouts(priorityTimeouts map[PriorityValue]time.Duration) error {
+	return p.reconfigure(func(c *config) {
+		c.priorityTimeouts = maps.Clone(priorityTimeouts)
+	})
+}
+
+// SetMaxQueueLength changes the max length of the priority queue and the policy applied when it is full , see
+// WithMaxQueueLength and WithRejectionPolicy. A negative length removes the bound. Goroutines already in the priority
+// queue stay there when the bound is lowered below the length of the queue. SetMaxQueueLength returns an error
+// wrapping limiter.ErrInvalidConfig , and changes nothing , if the settings contradict the configuration.
+func (p *PriorityLimiter) SetMaxQueueLength(maxQueueLength int, policy limiter.RejectionPolicy) error {
+	return p.reconfigure(func(c *config) {
+		c.maxQueueLength = nil
+		if maxQueueLength >= 0 {
+			c.maxQueueLength = &maxQueueLength
+		}
+		c.rejectionPolicy = policy
+	})
+}
+
+// SetPriorityQueueLimits replaces the limits of WithPriorityQueueLimits , a nil map removes them. Goroutines already
+// in the priority queue stay there when the limit of their priority is lowered below their number.
+// SetPriorityQueueLimits returns an error wrapping limiter.ErrInvalidConfig , and changes nothing , if the limits
+// contradict the configuration.
+func (p *PriorityLimiter) SetPriorityQueueLimits(queueLimits map[PriorityValue]int) error {
+	return p.reconfigure(func(c *config) {
+		c.queueLimits = maps.Clone(queueLimits)
+	})
+}
+
+// SetPriorityQuota replaces the quotas of WithPriorityQuota , a nil quota removes them. Queued goroutines the new
+// quotas allow to take a free slot are admitted. Slots are only counted against the quotas while they are
+// configured: the slots held when quotas are enabled count against none. SetPriorityQuota returns an error wrapping
+// limiter.ErrInvalidConfig , and changes nothing , if the quotas contradict the configuration.
+func (p *PriorityLimiter) SetPriorityQuota(quota map[PriorityValue]int) error {
+	return p.reconfigure(func(c *config) {
+		c.quota = nil
+		if quota != nil {
+			c.quota = make(map[PriorityValue]int, len(quota))
+			for priority, n := range quota {
+				c.quota[priority] = n
+			}
+		}
+	})
+}
+
+// reconfigure publishes the settings changed by update if they are valid. The goroutines blocked until there is
+// room in the priority queue are woken and queued goroutines are admitted , the settings may allow both.
+func (p *PriorityLimiter) reconfigure(update func(c *config)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := *p.config()
+	update(&c)
+	if err := c.validate(); err != nil {
+		return err
+	}
+	// the goroutines are only counted per priority while quotas or queue limits are configured.
+	if c.quota == nil {
+		clear(p.inUse)
+	}
+	clear(p.queued)
+	if c.countsQueued() {
+		for it := range p.waitList.All() {
+			p.queued[PriorityValue(it.Class)]++
+		}
+	}
+	p.cfg.Store(&c)
+	p.version++
+	p.notifyRoom()
+	p.admit()
+	return nil
+}
@@ -0,0 +1,74 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestPriorityLimiter_SetTimeoutAndMaxQueueLength(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.NoError(t, nl.SetTimeout(10*time.Millisecond, limiter.RejectOnTimeout))
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.Equal(t, limiter.ErrTimeout, nl.Wait(ctx, High))
+
+	assert.NoError(t, nl.SetMaxQueueLength(0, limiter.RejectNew))
+	assert.Equal(t, limiter.ErrQueueFull, nl.Wait(ctx, High))
+	err := nl.SetMaxQueueLength(-1, limiter.DropOldest)
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	assert.Equal(t, 0, nl.Config().MaxQueueLength)
+	nl.Finish()
+}
+
+func TestPriorityLimiter_SetPriorityQuota(t *testing.T) {
+	nl := NewLimiter(2)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.NoError(t, nl.Wait(ctx, Low))
+	granted := make(chan PriorityValue)
+	go func() {
+		nl.Wait(ctx, High)
+		granted <- High
+	}()
+	for nl.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// quotas enabled while goroutines are queued count them by priority.
+	assert.NoError(t, nl.SetPriorityQuota(map[PriorityValue]int{High: 1}))
+	assert.Equal(t, map[PriorityValue]int{High: 1}, nl.Config().PriorityQuota)
+	nl.FinishPriority(Low)
+	assert.Equal(t, High, <-granted)
+	assert.Zero(t, nl.queued[High])
+
+	err := nl.SetPriorityQuota(map[PriorityValue]int{High: -1})
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	assert.NoError(t, nl.SetPriorityQuota(nil))
+	assert.Nil(t, nl.Config().PriorityQuota)
+	assert.Empty(t, nl.inUse)
+	nl.FinishN(2)
+}
+
+func TestPriorityLimiter_SetPriorityTimeouts(t *testing.T) {
+	nl := NewLimiter(1)
+	timeouts := map[PriorityValue]time.Duration{Low: time.Millisecond}
+	assert.NoError(t, nl.SetPriorityTimeouts(timeouts))
+	timeouts[Low] = time.Hour
+	assert.Equal(t, map[PriorityValue]time.Duration{Low: time.Millisecond}, nl.Config().PriorityTimeouts)
+
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	// the goroutine is let through once its timeout expires , the default policy.
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.Equal(t, 2, nl.InFlight())
+
+	err := nl.SetPriorityTimeouts(map[PriorityValue]time.Duration{Low: -time.Second})
+	assert.True(t, errors.Is(err, limiter.ErrInvalidConfig))
+	assert.NoError(t, nl.SetPriorityTimeouts(nil))
+	assert.Nil(t, nl.Config().PriorityTimeouts)
+}
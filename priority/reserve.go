@@ -0,0 +1,129 @@
+package priority
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// Reservation is a place in a PriorityLimiter taken with Reserve. It lets the caller check how long the goroutine is
+// expected to wait before committing to it: Wait blocks until the reserved slot is granted , Cancel gives the place
+// up. Every Reservation must be either waited for or cancelled , otherwise the slot it holds once granted leaks.
+type Reservation struct {
+	p     *PriorityLimiter
+	class PriorityValue
+	w     *queue.Item
+	stop  context.CancelFunc
+	done  chan struct{}
+	err   error
+
+	mu       sync.Mutex
+	finished bool
+}
+
+// Reserve takes a place for a goroutine with the priority in the PriorityLimiter without blocking: it is granted a
+// slot right away if one is free , otherwise it is queued and waits in the background , aging and timing out like
+// a goroutine calling Wait. The Reservation reports the expected delay , so the caller can do something else if the
+// wait will be too long instead of committing to block. The reservation is cancelled when ctx is done. If the
+// priority queue is full , the rejection policy applies as in Wait: the BlockCaller policy blocks Reserve until
+// there is room.
+func (p *PriorityLimiter) Reserve(ctx context.Context, priority PriorityValue) *Reservation {
+	r := &Reservation{p: p, class: priority, done: make(chan struct{})}
+	ok, w, err := p.enter(ctx, priority)
+	if err != nil || ok {
+		if err != nil {
+			p.countShed(err, priority)
+		}
+		r.err = err
+		close(r.done)
+		return r
+	}
+	r.w = w
+	ctx, r.stop = context.WithCancel(ctx)
+	go func() {
+		if err := p.await(ctx, w, priority); err != nil {
+			p.countShed(err, priority)
+			r.err = err
+		}
+		close(r.done)
+	}()
+	return r
+}
+
+// OK reports whether the place was taken: it is false if Reserve failed , because the priority is outside of the
+// valid range , the priority queue is full or the PriorityLimiter is closed. Wait then returns the reason.
+func (r *Reservation) OK() bool {
+	// the error of a queued goroutine is only set once it leaves the priority queue.
+	return r.w != nil || r.err == nil
+}
+
+// Delay returns how long the goroutine is expected to wait for the reserved slot , based on its position in the
+// priority queue and the rate at which the PriorityLimiter served goroutines recently. It is zero once the slot is
+// granted. ok is false if the PriorityLimiter has not served enough goroutines yet to estimate its rate.
+func (r *Reservation) Delay() (d time.Duration, ok bool) {
+	if r.w == nil {
+		return 0, true
+	}
+	pos := r.p.position(r.w)
+	if pos == 0 {
+		return 0, true
+	}
+	return r.p.serviceRate.Estimate(pos)
+}
+
+// Ready returns a channel closed once the reservation is settled: the slot is granted , or the goroutine left the
+// priority queue because it was rejected , timed out or cancelled. Wait then returns without blocking.
+func (r *Reservation) Ready() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until the reserved slot is granted and returns nil , the goroutine may then access the resource and
+// must call Finish or FinishPriority afterwards. Otherwise it returns the error Wait of the PriorityLimiter would
+// have returned. If ctx is done first , the reservation is cancelled and Wait returns an error matching both
+// limiter.ErrCanceled and the cause of the cancellation. Wait returns limiter.ErrCancelledByLimiter if the
+// reservation has already been cancelled or waited for.
+func (r *Reservation) Wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.Cancel()
+		return limiter.Canceled(ctx)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return limiter.ErrCancelledByLimiter
+	}
+	r.finished = true
+	if r.stop != nil {
+		r.stop()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	r.p.hold(r.class)
+	return nil
+}
+
+// Cancel gives the place up: the goroutine leaves the priority queue , or gives the slot back if it has already
+// been granted. Cancel is a no-op once Wait returned.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	r.finished = true
+	if r.stop != nil {
+		r.stop()
+	}
+	<-r.done
+	if r.err == nil {
+		r.p.mu.Lock()
+		r.p.giveBack(r.class)
+		r.p.mu.Unlock()
+	}
+}
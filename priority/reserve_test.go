@@ -0,0 +1,99 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestReservation_Granted(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	r := nl.Reserve(ctx, Low)
+	assert.True(t, r.OK())
+	d, ok := r.Delay()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+	<-r.Ready()
+	assert.NoError(t, r.Wait(ctx))
+	assert.Equal(t, 1, nl.InFlight())
+	// the slot is given back with Finish once the reservation has been waited for.
+	r.Cancel()
+	assert.Equal(t, 1, nl.InFlight())
+	nl.Finish()
+	assert.Equal(t, 0, nl.InFlight())
+}
+
+func TestReservation_Queued(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	low := nl.Reserve(ctx, Low)
+	high := nl.Reserve(ctx, High)
+	assert.True(t, low.OK())
+	assert.Equal(t, 2, nl.QueueLen())
+	select {
+	case <-low.Ready():
+		t.Fatal("the reservation is settled before a slot is free")
+	default:
+	}
+
+	// the reservation keeps its place in the priority queue.
+	nl.Finish()
+	<-high.Ready()
+	assert.NoError(t, high.Wait(ctx))
+	assert.Equal(t, 1, nl.QueueLen())
+	nl.Finish()
+	assert.NoError(t, low.Wait(ctx))
+	d, _ := low.Delay()
+	assert.Equal(t, time.Duration(0), d)
+	assert.Equal(t, 1, nl.InFlight())
+	assert.Equal(t, 0, nl.QueueLen())
+}
+
+func TestReservation_Cancel(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	queued := nl.Reserve(ctx, Low)
+	assert.Equal(t, 1, nl.QueueLen())
+	queued.Cancel()
+	assert.Equal(t, 0, nl.QueueLen())
+	assert.Equal(t, limiter.ErrCancelledByLimiter, queued.Wait(ctx))
+
+	// a granted reservation gives its slot back.
+	nl.Finish()
+	granted := nl.Reserve(ctx, Low)
+	assert.Equal(t, 1, nl.InFlight())
+	granted.Cancel()
+	assert.Equal(t, 0, nl.InFlight())
+
+	// the reservation is cancelled when the context passed to Wait is done first.
+	nl.Wait(ctx, High)
+	r := nl.Reserve(ctx, Low)
+	wctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.True(t, errors.Is(r.Wait(wctx), limiter.ErrCanceled))
+	assert.Equal(t, 0, nl.QueueLen())
+	nl.Finish()
+	assert.Equal(t, 0, nl.InFlight())
+}
+
+func TestReservation_Rejected(t *testing.T) {
+	nl := NewLimiter(1, WithMaxQueueLength(0))
+	ctx := context.Background()
+	nl.Wait(ctx, High)
+	r := nl.Reserve(ctx, Low)
+	assert.False(t, r.OK())
+	assert.True(t, errors.Is(r.Wait(ctx), limiter.ErrQueueFull))
+	assert.Equal(t, uint64(1), nl.Stats().Shed)
+
+	nl = NewLimiter(1, WithPriorityRange(0, 10))
+	r = nl.Reserve(ctx, 11)
+	assert.False(t, r.OK())
+	assert.Equal(t, ErrInvalidPriority, r.Wait(ctx))
+}
@@ -0,0 +1,104 @@
+package priority
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// State returns a dump of the current state of the PriorityLimiter , see limiter.State.
+func (p *PriorityLimiter) State() limiter.State {
+	now := p.config().clock.Now()
+	s := p.Stats()
+	c := p.Config()
+	st := limiter.State{
+		Version:           limiter.StateVersion,
+		Kind:              limiter.KindPriorityLimiter,
+		Time:              now,
+		Limit:             s.Limit,
+		InFlight:          s.InFlight,
+		Waiting:           s.Waiting,
+		WaitP50Seconds:    s.WaitP50.Seconds(),
+		WaitP95Seconds:    s.WaitP95.Seconds(),
+		WaitP99Seconds:    s.WaitP99.Seconds(),
+		OldestWaitSeconds: s.OldestWait.Seconds(),
+		Reclaimed:         s.Reclaimed,
+		Shed:              s.Shed,
+		Paused:            s.Paused,
+		Config: limiter.ConfigState{
+			TimeoutSeconds:        c.Timeout.Seconds(),
+			TimeoutPolicy:         c.TimeoutPolicy.String(),
+			Jitter:                c.Jitter,
+			Spin:                  c.Spin,
+			DynamicPeriodSeconds:  c.DynamicPeriod.Seconds(),
+			RejectionPolicy:       c.RejectionPolicy.String(),
+			AdmissionPolicy:       c.AdmissionPolicy.String(),
+			DeadlineCurve:         c.DeadlineCurve.String(),
+			EarliestDeadlineFirst: c.EarliestDeadlineFirst,
+			Preemption:            c.Preemption,
+			Lottery:               c.Lottery,
+
+			MaxWaitBeforePromotionSeconds: c.MaxWaitBeforePromotion.Seconds(),
+			DeadlineAsTimeout:             c.DeadlineAsTimeout,
+			DeadlineAwareRejection:        c.DeadlineAwareRejection,
+			Unlimited:                     c.Unlimited,
+			PermitTTLSeconds:              c.PermitTTL.Seconds(),
+			MaxHoldSeconds:                c.MaxHoldDuration.Seconds(),
+			FairQueuing:                   c.FlowWeights != nil,
+			FlowWeights:                   c.FlowWeights,
+		},
+		Waiters: []limiter.WaiterState{},
+	}
+	if c.MaxQueueLength >= 0 {
+		st.Config.MaxQueueLength = &c.MaxQueueLength
+	}
+	if c.PriorityRange {
+		min, max := int(c.MinPriority), int(c.MaxPriority)
+		st.Config.MinPriority = &min
+		st.Config.MaxPriority = &max
+	}
+	if c.PriorityQuota != nil {
+		st.Config.PriorityQuota = make(map[string]int, len(c.PriorityQuota))
+		for priority, n := range c.PriorityQuota {
+			st.Config.PriorityQuota[strconv.Itoa(int(priority))] = n
+		}
+	}
+
+	p.mu.Lock()
+	before := p.config().before()
+	items := slices.SortedFunc(p.waitList.All(), func(a, b *queue.Item) int {
+		if before(a, b) {
+			return -1
+		}
+		return 1
+	})
+	for _, it := range items {
+		priority := it.Priority
+		st.Waiters = append(st.Waiters, limiter.WaiterState{
+			Priority:      &priority,
+			Flow:          it.Flow,
+			WaitedSeconds: now.Sub(it.EnqueuedAt()).Seconds(),
+		})
+	}
+	p.mu.Unlock()
+	return st
+}
+
+// MarshalJSON encodes the State of the PriorityLimiter.
+func (p *PriorityLimiter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.State())
+}
+
+// String returns a one line summary of the PriorityLimiter , see limiter.State.String.
+func (p *PriorityLimiter) String() string {
+	return p.State().String()
+}
+
+// LogValue reports the PriorityLimiter to log/slog as a group of attributes , see limiter.State.LogValue.
+func (p *PriorityLimiter) LogValue() slog.Value {
+	return p.State().LogValue()
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"iter"
+	"sort"
+	"sync/atomic"
+)
+
+// Buckets is a Queue keeping a FIFO list of items per priority , for items without Deadline. Items are pushed and
+// removed in constant time , and changing the priority of an item moves it to another list without sifting a
+// heap. Finding the list of a priority nobody is queued with is linear in the number of distinct priorities
+// queued , so Buckets suits the few priority levels goroutines are usually queued with.
+//
+// levels: the list of items of every priority with queued items
+//
+// active: the priorities with queued items , highest first
+//
+// spare: emptied lists , reused for the next priority queued with so queueing allocates nothing
+type Buckets struct {
+	levels map[int]*bucket
+	active []int
+	spare  []*bucket
+	len    int
+}
+
+// bucket is the list of the items queued with one priority , in FIFO order.
+type bucket struct {
+	front, back *Item
+}
+
+// NewBuckets creates an empty *Buckets.
+func NewBuckets() *Buckets {
+	return &Buckets{levels: make(map[int]*bucket)}
+}
+
+// Len returns the number of queued items.
+func (b *Buckets) Len() int {
+	return b.len
+}
+
+// Enqueue appends it to the list of its priority.
+func (b *Buckets) Enqueue(it *Item) {
+	it.seq = atomic.AddUint64(&sequence, 1)
+	if it.timeStamp == 0 {
+		it.timeStamp = makeTimestamp()
+	}
+	b.insert(it)
+}
+
+// insert links it into the list of its priority , behind the items pushed before it. The sequence numbers only
+// grow , so a new item is linked at the back and an item changing priority is usually close to the front.
+func (b *Buckets) insert(it *Item) {
+	l := b.levels[it.Priority]
+	if l == nil {
+		if n := len(b.spare); n > 0 {
+			l, b.spare = b.spare[n-1], b.spare[:n-1]
+		} else {
+			l = &bucket{}
+		}
+		b.levels[it.Priority] = l
+		i := sort.Search(len(b.active), func(i int) bool { return b.active[i] < it.Priority })
+		b.active = append(b.active, 0)
+		copy(b.active[i+1:], b.active[i:])
+		b.active[i] = it.Priority
+	}
+	after := l.back
+	for after != nil && after.seq > it.seq {
+		after = after.prev
+	}
+	it.prev = after
+	if after != nil {
+		it.next = after.next
+		after.next = it
+	} else {
+		it.next = l.front
+		l.front = it
+	}
+	if it.next != nil {
+		it.next.prev = it
+	} else {
+		l.back = it
+	}
+	it.bucketed = true
+	b.len++
+}
+
+// Front returns the oldest item of the highest priority , or nil if no item is queued.
+func (b *Buckets) Front() *Item {
+	if len(b.active) == 0 {
+		return nil
+	}
+	return b.levels[b.active[0]].front
+}
+
+// Back returns the newest item of the lowest priority , or nil if no item is queued.
+func (b *Buckets) Back() *Item {
+	if len(b.active) == 0 {
+		return nil
+	}
+	return b.levels[b.active[len(b.active)-1]].back
+}
+
+// FirstPushed returns the item that was pushed first , or nil if no item is queued.
+func (b *Buckets) FirstPushed() *Item {
+	var oldest *Item
+	for _, priority := range b.active {
+		if it := b.levels[priority].front; oldest == nil || it.seq < oldest.seq {
+			oldest = it
+		}
+	}
+	return oldest
+}
+
+// Remove unlinks it from the list of its priority.
+func (b *Buckets) Remove(it *Item) {
+	l := b.levels[it.Priority]
+	if it.prev != nil {
+		it.prev.next = it.next
+	} else {
+		l.front = it.next
+	}
+	if it.next != nil {
+		it.next.prev = it.prev
+	} else {
+		l.back = it.prev
+	}
+	it.prev, it.next, it.bucketed = nil, nil, false
+	b.len--
+	if l.front == nil {
+		delete(b.levels, it.Priority)
+		b.spare = append(b.spare, l)
+		i := sort.Search(len(b.active), func(i int) bool { return b.active[i] <= it.Priority })
+		b.active = append(b.active[:i], b.active[i+1:]...)
+	}
+}
+
+// Contains reports whether it is queued.
+func (b *Buckets) Contains(it *Item) bool {
+	return it.bucketed
+}
+
+// Update moves it to the list of priority , where it keeps its place among the items in the order they were
+// pushed.
+func (b *Buckets) Update(it *Item, priority int) {
+	b.Remove(it)
+	it.Priority = priority
+	b.insert(it)
+}
+
+// All returns the queued items in the order they are served.
+func (b *Buckets) All() iter.Seq[*Item] {
+	return func(yield func(*Item) bool) {
+		for _, priority := range b.active {
+			for it := b.levels[priority].front; it != nil; it = it.next {
+				if !yield(it) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Append appends the queued items to items in the order they are served and returns the extended slice.
+func (b *Buckets) Append(items []*Item) []*Item {
+	for _, priority := range b.active {
+		for it := b.levels[priority].front; it != nil; it = it.next {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+// Top returns a copy of the item served next , or nil if no item is queued.
+func (b *Buckets) Top() interface{} {
+	if it := b.Front(); it != nil {
+		return *it
+	}
+	return nil
+}
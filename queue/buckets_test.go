@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"container/heap"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuckets(t *testing.T) {
+	b := NewBuckets()
+	assert.Nil(t, b.Front())
+	assert.Nil(t, b.Back())
+	assert.Nil(t, b.FirstPushed())
+	assert.Nil(t, b.Top())
+
+	items := make([]*Item, 6)
+	for i, pr := range []int{2, 1, 3, 1, 2, 3} {
+		items[i] = &Item{Priority: pr}
+		b.Enqueue(items[i])
+	}
+	assert.Equal(t, 6, b.Len())
+	assert.Equal(t, []*Item{items[2], items[5], items[0], items[4], items[1], items[3]}, slices.Collect(b.All()))
+	assert.Equal(t, slices.Collect(b.All()), b.Append(nil))
+	assert.Same(t, items[2], b.Front())
+	assert.Same(t, items[3], b.Back())
+	assert.Same(t, items[0], b.FirstPushed())
+	assert.Equal(t, 3, b.Top().(Item).Priority)
+
+	// an item changing priority keeps its place among the items pushed before and after it.
+	b.Update(items[3], 2)
+	b.Update(items[0], 1)
+	assert.Equal(t, []*Item{items[2], items[5], items[3], items[4], items[0], items[1]}, slices.Collect(b.All()))
+
+	b.Remove(items[2])
+	b.Remove(items[5])
+	assert.False(t, b.Contains(items[5]))
+	assert.True(t, b.Contains(items[3]))
+	assert.Same(t, items[3], b.Front())
+	assert.Equal(t, 4, b.Len())
+	for it := b.Front(); it != nil; it = b.Front() {
+		b.Remove(it)
+	}
+	assert.Zero(t, b.Len())
+	assert.Empty(t, b.levels)
+	assert.Empty(t, b.active)
+}
+
+// Buckets and PriorityQueue serve items without deadline in the same order.
+func TestBuckets_SameOrderAsHeap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	b, pq := NewBuckets(), &PriorityQueue{}
+	for i := 0; i < 1000; i++ {
+		switch op := rnd.Intn(4); {
+		case op < 2 || b.Len() == 0:
+			it := &Item{Priority: rnd.Intn(5)}
+			b.Enqueue(it)
+			// the heap assigns the item a later sequence number , which keeps the relative order.
+			heap.Push(pq, it)
+		case op == 2:
+			it := b.FirstPushed()
+			assert.Same(t, it, pq.FirstPushed())
+			b.Remove(it)
+			pq.Remove(it)
+		default:
+			it := b.Back()
+			assert.Same(t, it, pq.Back())
+			pr := rnd.Intn(5)
+			b.Update(it, pr)
+			pq.Update(it, pr)
+		}
+		assert.Same(t, pq.Front(), b.Front())
+	}
+}
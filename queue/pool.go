@@ -0,0 +1,27 @@
+package queue
+
+import "sync"
+
+// items recycles the Items passed to Recycle.
+var items = sync.Pool{
+	New: func() any { return &Item{Done: make(chan struct{}, 1)} },
+}
+
+// NewItem returns an Item with a buffered Done channel , recycled with its channel from an Item passed to Recycle
+// if possible , so queueing a goroutine allocates nothing once the pool is warm.
+func NewItem() *Item {
+	return items.Get().(*Item)
+}
+
+// Recycle makes it available to NewItem. it must have been returned by NewItem , be settled and not be queued or
+// referenced anymore. The value of Done that was not received is discarded , so it must have been sent: settle
+// the item under the lock of the queue , or from the goroutine recycling it.
+func Recycle(it *Item) {
+	done := it.Done
+	select {
+	case <-done:
+	default:
+	}
+	*it = Item{Done: done}
+	items.Put(it)
+}
@@ -0,0 +1,27 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecycle(t *testing.T) {
+	it := NewItem()
+	assert.Equal(t, 1, cap(it.Done))
+	it.Priority = 3
+	assert.True(t, it.Abandon(errors.New("abandoned")))
+	// a buffered Done receives a value instead of being closed.
+	assert.Equal(t, 1, len(it.Done))
+	Recycle(it)
+
+	// the item returned may be the recycled one , reset with an empty channel.
+	it = NewItem()
+	assert.Zero(t, it.Priority)
+	assert.Nil(t, it.Err)
+	assert.Zero(t, len(it.Done))
+	assert.True(t, it.Grant())
+	<-it.Done
+	Recycle(it)
+}
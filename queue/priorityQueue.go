@@ -2,14 +2,46 @@ package queue
 
 import (
 	"container/heap"
+	"sync/atomic"
 	"time"
 )
 
+// states of an Item.
+const (
+	queued int32 = iota
+	granted
+	abandoned
+)
+
+// sequence is the last sequence number handed out to an item pushed to a PriorityQueue.
+var sequence uint64
+
+// Item is a goroutine waiting in the PriorityQueue. Done is signalled once the item is settled , exactly once , by
+// Grant or Abandon: it is closed , or receives a single value if it is buffered , which lets NewItem reuse it.
+// Err is set before Done is signalled if the goroutine was abandoned without being granted access.
+//
+// Items are ordered by Priority , then by Deadline (earliest first , a zero Deadline sorts
+// after every other deadline) and finally in FIFO order , which is enforced with a sequence number
+// assigned when the item is pushed. Class is the priority the goroutine
+// was queued with , it is not changed by Update. Promoted is set by the owner of the queue , before
+// Done is closed , if the goroutine was served ahead of items outranking it. Flow and Finish are set by the owner
+// of the queue to serve the flows sharing a priority fairly , the queue does not order items by them.
 type Item struct {
 	Done      chan struct{}
 	Priority  int
+	Class     int
+	Deadline  time.Time
+	Err       error
+	Promoted  bool
+	Flow      string
+	Finish    float64
+	state     int32
+	seq       uint64
 	timeStamp int64
 	index     int
+	// prev , next and bucketed link the item in a bucket of Buckets.
+	prev, next *Item
+	bucketed   bool
 }
 
 type PriorityQueue []*Item
@@ -17,10 +49,22 @@ type PriorityQueue []*Item
 func (pq PriorityQueue) Len() int { return len(pq) }
 
 func (pq PriorityQueue) Less(i, j int) bool {
-	if pq[i].Priority == pq[j].Priority {
-		return pq[i].timeStamp <= pq[j].timeStamp
+	return Before(pq[i], pq[j])
+}
+
+// Outranks reports whether a must be popped before b regardless of the order they were pushed in ,
+// because of a higher priority or an earlier deadline.
+func Outranks(a, b *Item) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.Deadline.Equal(b.Deadline) {
+		return false
 	}
-	return pq[i].Priority > pq[j].Priority
+	if a.Deadline.IsZero() || b.Deadline.IsZero() {
+		return b.Deadline.IsZero()
+	}
+	return a.Deadline.Before(b.Deadline)
 }
 
 func (pq PriorityQueue) Swap(i, j int) {
@@ -33,7 +77,10 @@ func (pq *PriorityQueue) Push(x interface{}) {
 	n := len(*pq)
 	item := x.(*Item)
 	item.index = n
-	item.timeStamp = makeTimestamp()
+	item.seq = atomic.AddUint64(&sequence, 1)
+	if item.timeStamp == 0 {
+		item.timeStamp = makeTimestamp()
+	}
 	*pq = append(*pq, item)
 }
 
@@ -61,8 +108,76 @@ func (pq *PriorityQueue) GetIndex(x interface{}) int {
 	return item.index
 }
 
+// EnqueuedAt returns the time the item was pushed to the queue.
+func (it *Item) EnqueuedAt() time.Time {
+	return time.Unix(0, it.timeStamp)
+}
+
+// SetEnqueuedAt sets the time returned by EnqueuedAt. Push records the current time unless SetEnqueuedAt has
+// been called before , which lets callers measure time with their own clock.
+func (it *Item) SetEnqueuedAt(t time.Time) {
+	it.timeStamp = t.UnixNano()
+}
+
+// PushedBefore reports whether it was pushed to its queue before other.
+func (it *Item) PushedBefore(other *Item) bool {
+	return it.seq < other.seq
+}
+
+// Grant settles the item by granting the goroutine access and reports whether it was still waiting. Grant and
+// Abandon compare and swap the state of the item , so when both race exactly one of them wins and closes Done.
+func (it *Item) Grant() bool {
+	return it.settle(granted, nil)
+}
+
+// Abandon settles the item without granting the goroutine access , its Err is set to err. Abandon reports whether
+// the item was still waiting.
+func (it *Item) Abandon(err error) bool {
+	return it.settle(abandoned, err)
+}
+
+// Granted reports whether the item was settled by Grant.
+func (it *Item) Granted() bool {
+	return atomic.LoadInt32(&it.state) == granted
+}
+
+func (it *Item) settle(state int32, err error) bool {
+	if !atomic.CompareAndSwapInt32(&it.state, queued, state) {
+		return false
+	}
+	it.Err = err
+	if cap(it.Done) > 0 {
+		it.Done <- struct{}{}
+	} else {
+		close(it.Done)
+	}
+	return true
+}
+
+// Oldest returns the index of the item that was pushed first , or -1 if the queue is empty.
+func (pq PriorityQueue) Oldest() int {
+	oldest := -1
+	for i, it := range pq {
+		if oldest < 0 || it.seq < pq[oldest].seq {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+// Lowest returns the index of the item that would be popped last , or -1 if the queue is empty.
+func (pq PriorityQueue) Lowest() int {
+	lowest := -1
+	for i := range pq {
+		if lowest < 0 || pq.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
 func makeTimestamp() int64 {
-	return time.Now().UnixNano() / int64(time.Millisecond)
+	return time.Now().UnixNano()
 }
 
 func (pq *PriorityQueue) Update(item *Item, priority int) {
@@ -2,7 +2,9 @@ package queue
 
 import (
 	"container/heap"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -33,17 +35,83 @@ func TestPriorityQueue_SamePriority(t *testing.T) {
 
 	for i := 0; i < 3; i++ {
 		pq[i] = &Item{
-			Priority:  1,
-			timeStamp: int64(i),
+			Priority: 1,
+			seq:      uint64(i),
 		}
 	}
 
 	pq.Update(pq[2], 3)
-	expectedVals := []int64{2, 0, 1}
-	actualVals := make([]int64, 0)
+	expectedVals := []uint64{2, 0, 1}
+	actualVals := make([]uint64, 0)
 	for pq.Len() > 0 {
 		item := heap.Pop(&pq).(*Item)
-		actualVals = append(actualVals, item.timeStamp)
+		actualVals = append(actualVals, item.seq)
 	}
 	assert.Equal(t, expectedVals, actualVals)
 }
+
+func TestPriorityQueue_OldestAndLowest(t *testing.T) {
+	pq := make(PriorityQueue, 0)
+	assert.Equal(t, -1, pq.Oldest())
+	assert.Equal(t, -1, pq.Lowest())
+
+	priorities := []int{2, 1, 3, 1}
+	for i, pr := range priorities {
+		pq = append(pq, &Item{
+			Priority: pr,
+			seq:      uint64(i),
+			index:    i,
+		})
+	}
+	heap.Init(&pq)
+	assert.Equal(t, uint64(0), pq[pq.Oldest()].seq)
+	lowest := pq[pq.Lowest()]
+	assert.Equal(t, 1, lowest.Priority)
+	assert.Equal(t, uint64(3), lowest.seq)
+}
+
+func TestPriorityQueue_Deadline(t *testing.T) {
+	now := time.Now()
+	pq := make(PriorityQueue, 0)
+	heap.Push(&pq, &Item{Priority: 0})
+	heap.Push(&pq, &Item{Priority: 0, Deadline: now.Add(time.Second)})
+	heap.Push(&pq, &Item{Priority: 0, Deadline: now.Add(time.Millisecond)})
+	heap.Push(&pq, &Item{Priority: 1})
+
+	assert.Equal(t, 1, heap.Pop(&pq).(*Item).Priority)
+	assert.Equal(t, now.Add(time.Millisecond), heap.Pop(&pq).(*Item).Deadline)
+	assert.Equal(t, now.Add(time.Second), heap.Pop(&pq).(*Item).Deadline)
+	assert.True(t, heap.Pop(&pq).(*Item).Deadline.IsZero())
+}
+
+func TestPriorityQueue_FIFOWithinPriority(t *testing.T) {
+	pq := make(PriorityQueue, 0)
+	items := make([]*Item, 1000)
+	for i := range items {
+		items[i] = &Item{Priority: i % 2}
+		heap.Push(&pq, items[i])
+	}
+	// the clock may not advance between pushes , FIFO order is still followed.
+	for _, it := range items {
+		it.timeStamp = 0
+	}
+	for i := 1; i < len(items); i += 2 {
+		assert.Same(t, items[i], heap.Pop(&pq))
+	}
+	for i := 0; i < len(items); i += 2 {
+		assert.Same(t, items[i], heap.Pop(&pq))
+	}
+}
+
+func TestItem_Settle(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		it := &Item{Done: make(chan struct{})}
+		results := make(chan bool, 2)
+		go func() { results <- it.Grant() }()
+		go func() { results <- it.Abandon(errors.New("abandoned")) }()
+		// exactly one of them settles the item.
+		assert.True(t, <-results != <-results)
+		<-it.Done
+		assert.Equal(t, it.Granted(), it.Err == nil)
+	}
+}
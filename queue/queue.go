@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"container/heap"
+	"iter"
+)
+
+// Queue is a queue of Items served in the order of Before. Items are identified by pointer , so the owner of the
+// queue does not depend on how they are stored. *PriorityQueue orders any Items , *Buckets is faster but ignores
+// Deadline.
+type Queue interface {
+	// Len returns the number of queued items.
+	Len() int
+	// Enqueue queues it , which must not be queued already.
+	Enqueue(it *Item)
+	// Front returns the item served next , or nil if the queue is empty.
+	Front() *Item
+	// Back returns the item served last , or nil if the queue is empty.
+	Back() *Item
+	// FirstPushed returns the item that was queued first , or nil if the queue is empty.
+	FirstPushed() *Item
+	// Remove removes it , which must be queued.
+	Remove(it *Item)
+	// Contains reports whether it is queued.
+	Contains(it *Item) bool
+	// Update changes the priority of it , which must be queued.
+	Update(it *Item, priority int)
+	// All returns the queued items , in no particular order.
+	All() iter.Seq[*Item]
+	// Append appends the queued items to items , in the order of All , and returns the extended slice.
+	Append(items []*Item) []*Item
+	// Top returns a copy of the item served next , or nil if the queue is empty.
+	Top() interface{}
+}
+
+var (
+	_ Queue = (*PriorityQueue)(nil)
+	_ Queue = (*Buckets)(nil)
+)
+
+// Before reports whether a is served before b: it outranks b , or neither outranks the other and a was pushed
+// first.
+func Before(a, b *Item) bool {
+	if Outranks(a, b) {
+		return true
+	}
+	if Outranks(b, a) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+// Enqueue pushes it to the heap.
+func (pq *PriorityQueue) Enqueue(it *Item) {
+	heap.Push(pq, it)
+}
+
+// Front returns the top of the heap , or nil if it is empty.
+func (pq *PriorityQueue) Front() *Item {
+	if len(*pq) == 0 {
+		return nil
+	}
+	return (*pq)[0]
+}
+
+// Back returns the item that would be popped last , or nil if the heap is empty.
+func (pq *PriorityQueue) Back() *Item {
+	if i := pq.Lowest(); i >= 0 {
+		return (*pq)[i]
+	}
+	return nil
+}
+
+// FirstPushed returns the item that was pushed first , or nil if the heap is empty.
+func (pq *PriorityQueue) FirstPushed() *Item {
+	if i := pq.Oldest(); i >= 0 {
+		return (*pq)[i]
+	}
+	return nil
+}
+
+// Remove removes it from the heap.
+func (pq *PriorityQueue) Remove(it *Item) {
+	heap.Remove(pq, it.index)
+}
+
+// Append appends the items of the heap to items in heap order and returns the extended slice.
+func (pq *PriorityQueue) Append(items []*Item) []*Item {
+	return append(items, *pq...)
+}
+
+// Contains reports whether it is in the heap.
+func (pq *PriorityQueue) Contains(it *Item) bool {
+	return it.index >= 0 && it.index < len(*pq) && (*pq)[it.index] == it
+}
+
+// All returns the items of the heap in heap order.
+func (pq *PriorityQueue) All() iter.Seq[*Item] {
+	return func(yield func(*Item) bool) {
+		for _, it := range *pq {
+			if !yield(it) {
+				return
+			}
+		}
+	}
+}
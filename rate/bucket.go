@@ -0,0 +1,92 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// Bucket is a token bucket letting through perSecond units per second on average , and up to burst units at
+// once. All methods are safe for concurrent use.
+//
+// tokens: the units that can go through without waiting at last , negative when units have been reserved ahead
+type Bucket struct {
+	mu        sync.Mutex
+	perSecond float64
+	burst     int
+	tokens    float64
+	last      time.Time
+	clock     clock.Clock
+}
+
+type BucketOption func(*Bucket)
+
+// NewBucket creates a *Bucket letting through perSecond units per second , and up to burst units at once. The
+// bucket starts full.
+func NewBucket(perSecond float64, burst int, options ...BucketOption) *Bucket {
+	b := &Bucket{
+		perSecond: perSecond,
+		burst:     burst,
+		tokens:    float64(burst),
+		clock:     clock.Real(),
+	}
+	for _, o := range options {
+		o(b)
+	}
+	b.last = b.clock.Now()
+	return b
+}
+
+// clock: refills the bucket and times the waits. Defaults to the real time. Tests can pass a clock.Fake to
+// control the passage of time instead of sleeping.
+func WithClock(c clock.Clock) func(*Bucket) {
+	return func(b *Bucket) {
+		b.clock = c
+	}
+}
+
+// Burst returns the max number of units going through at once.
+func (b *Bucket) Burst() int {
+	return b.burst
+}
+
+// WaitN waits until n units can go through and takes them from the bucket. n above the burst is taken as the
+// burst , so callers should split larger flows into chunks of Burst units. If ctx is done first , the units are
+// given back and WaitN returns the cause of the cancellation , see context.Cause.
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	n = min(n, b.burst)
+	b.mu.Lock()
+	now := b.clock.Now()
+	b.refill(now)
+	b.tokens -= float64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.perSecond * float64(time.Second))
+	}
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := b.clock.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.refill(b.clock.Now())
+		b.tokens = min(b.tokens+float64(n), float64(b.burst))
+		b.mu.Unlock()
+		return context.Cause(ctx)
+	}
+}
+
+// refill adds the tokens earned since the last refill. The mutex must be held.
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*b.perSecond, float64(b.burst))
+		b.last = now
+	}
+}
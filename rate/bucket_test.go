@@ -0,0 +1,63 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestBucket_WaitN(t *testing.T) {
+	f := clock.NewFake(time.Unix(0, 0))
+	b := NewBucket(10, 5, WithClock(f))
+	assert.Equal(t, 5, b.Burst())
+	// the bucket starts full.
+	assert.NoError(t, b.WaitN(context.Background(), 5))
+
+	done := make(chan error)
+	go func() { done <- b.WaitN(context.Background(), 2) }()
+	assert.Eventually(t, func() bool { return f.Waiters() == 1 }, time.Second, time.Millisecond)
+	f.Advance(199 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("WaitN returned before the tokens were earned")
+	case <-time.After(10 * time.Millisecond):
+	}
+	f.Advance(time.Millisecond)
+	assert.NoError(t, <-done)
+
+	// tokens beyond the burst are not kept.
+	f.Advance(time.Hour)
+	assert.NoError(t, b.WaitN(context.Background(), 5))
+	go func() { done <- b.WaitN(context.Background(), 1) }()
+	assert.Eventually(t, func() bool { return f.Waiters() == 1 }, time.Second, time.Millisecond)
+	f.Advance(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+}
+
+func TestBucket_Cancel(t *testing.T) {
+	f := clock.NewFake(time.Unix(0, 0))
+	b := NewBucket(10, 5, WithClock(f))
+	assert.NoError(t, b.WaitN(context.Background(), 5))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.WaitN(ctx, 5) }()
+	assert.Eventually(t, func() bool { return f.Waiters() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+
+	// the units of the cancelled wait are given back.
+	f.Advance(100 * time.Millisecond)
+	go func() { done <- b.WaitN(context.Background(), 1) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitN waited for the units of the cancelled wait")
+	}
+}
@@ -0,0 +1,72 @@
+// Package rate estimates the rate at which a limiter serves goroutines , and limits the rate of a flow of units ,
+// like bytes , with a token bucket.
+//
+// The estimate is an exponentially weighted moving average of the interval between two
+// completions , so it follows changes of the service rate within a few dozen completions.
+package rate
+
+import (
+	"sync"
+	"time"
+)
+
+// weight is the weight of the latest interval in the moving average.
+const weight = 0.1
+
+// Estimator measures the interval between completions. The zero value is ready to use and
+// all methods are safe for concurrent use.
+type Estimator struct {
+	mu       sync.Mutex
+	last     time.Time
+	interval float64
+}
+
+// NewEstimator creates an *Estimator without any measurement.
+func NewEstimator() *Estimator {
+	return &Estimator{}
+}
+
+// Observe records a completion at now.
+func (e *Estimator) Observe(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.last.IsZero() {
+		d := float64(now.Sub(e.last))
+		if e.interval == 0 {
+			e.interval = d
+		} else {
+			e.interval += weight * (d - e.interval)
+		}
+	}
+	e.last = now
+}
+
+// Interval returns the average interval between two completions. ok is false until two
+// completions have been observed.
+func (e *Estimator) Interval() (interval time.Duration, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.interval == 0 {
+		return 0, false
+	}
+	return time.Duration(e.interval), true
+}
+
+// Rate returns the number of completions per second , or zero until two completions have been observed.
+func (e *Estimator) Rate() float64 {
+	interval, ok := e.Interval()
+	if !ok {
+		return 0
+	}
+	return float64(time.Second) / float64(interval)
+}
+
+// Estimate returns the time it takes to serve n goroutines at the current rate. ok is false until two
+// completions have been observed.
+func (e *Estimator) Estimate(n int) (d time.Duration, ok bool) {
+	interval, ok := e.Interval()
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * interval, true
+}
@@ -0,0 +1,30 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimator(t *testing.T) {
+	e := NewEstimator()
+	_, ok := e.Estimate(3)
+	assert.False(t, ok)
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		e.Observe(now.Add(time.Duration(i) * 10 * time.Millisecond))
+	}
+	interval, ok := e.Interval()
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Millisecond, interval)
+	assert.InDelta(t, 100, e.Rate(), 0.001)
+	d, _ := e.Estimate(3)
+	assert.Equal(t, 30*time.Millisecond, d)
+
+	// the average moves towards slower completions.
+	e.Observe(now.Add(140 * time.Millisecond))
+	interval, _ = e.Interval()
+	assert.Equal(t, 19*time.Millisecond, interval)
+}
@@ -3,132 +3,1077 @@ package limiter
 import (
 	"container/list"
 	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+	"github.com/vivek-ng/concurrency-limiter/histogram"
+	"github.com/vivek-ng/concurrency-limiter/rate"
+	"github.com/vivek-ng/concurrency-limiter/wheel"
+)
+
+// states of a waiter. A waiter is queued until it is settled , exactly once , with a compare and swap: either it is
+// granted a slot , which counts against the limit , or it is abandoned without a slot. The path that settles the
+// waiter closes its done channel , the others lose the swap and leave the waiter alone , so Finish handing over a
+// slot and a timeout or cancellation removing the waiter at the same moment can neither close the channel twice
+// nor lose the slot.
+const (
+	waiterQueued int32 = iota
+	waiterGranted
+	waiterAbandoned
 )
 
 // waiter is the individual goroutine waiting for accessing the resource.
-// waiter waits for the signal through the done channel.
+// waiter waits for the signal through the done channel , which receives a single value once it is settled and is
+// reused with the waiter. err is set if the
+// goroutine was abandoned. prev and next link it in the waitlist while queued is set. pinned is set if a Handle
+// refers to it , so it is never recycled. flow and finish are only used by fair queuing.
 type waiter struct {
-	done chan struct{}
+	done       chan struct{}
+	state      int32
+	err        error
+	prev, next *waiter
+	queued     bool
+	pinned     bool
+	enqueued   time.Time
+	flow       string
+	finish     float64
 }
 
-// limit: max number of concurrent goroutines that can access aresource
+// cfg: the current *config , see config for the available settings
 //
-// count: current number of goroutines accessing a resource
+// state: current number of goroutines accessing a resource , number of goroutines in the waitlist and whether the
+// Limiter is closed , packed so Wait can take a free slot without the mutex , see acquireFast. The count is only
+// decremented under the mutex
 //
 // waitList: list of goroutines waiting to access a resource. Goroutines will be added to
 // this list if the number of concurrent requests are greater than the limit specified
 //
-// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
-// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit. (in ms)
+// room: closed and reset whenever the waitlist shrinks , to wake goroutines blocked by the BlockCaller policy
+//
+// codel: state of the CoDel queue management , only used if it is configured
+//
+// fair: state of the weighted fair queuing , only used if it is configured
+//
+// version: incremented whenever the limit , count or waitList change , so consumers of Stats can tell
+// whether two snapshots describe the same state
+//
+// waitTimes: histogram of the time goroutines spent in the waitlist before accessing the resource
+//
+// serviceRate: rate at which goroutines finish accessing the resource , used to estimate wait times
+//
+// closed , stop , drained: closed is set by Close , stop is closed by Close to stop the background goroutines ,
+// drained is closed once no goroutine accesses the resource anymore
+//
+// tokens: last fencing token handed out to a Permit
+//
+// holds , reaping , orphans: acquisition times of the slots acquired with Wait , oldest first , whether a goroutine
+// reclaims them and the number of reclaimed slots whose holder has not called Finish yet , see WithMaxHoldDuration
+//
+// reclaimed: number of slots reclaimed from their holders
+//
+// shed: number of goroutines rejected because of overload , see IsRejection
+//
+// events: the recent events , nil unless WithEventHistory is configured
+//
+// timers: the timer wheel of the timeouts , nil unless WithTimerWheel is configured
+//
+// flights: the keys of the goroutines holding a slot acquired with WaitShared , guarded by flightsMu
+//
+// random: source of the random numbers of Random Early Detection , replaced by tests
+//
+// breaker: state of the circuit breaker , only used if it is configured
+//
+// succeeded , failed , results: outcomes reported with Permit.Record , in total and since the last sample of the
+// limit controller
 type Limiter struct {
-	count    int
-	limit    int
-	mu       sync.Mutex
-	waitList list.List
-	timeout  *int
+	cfg         atomic.Value
+	state       atomic.Uint64
+	version     atomic.Uint64
+	mu          sync.Mutex
+	waitList    waitList
+	room        chan struct{}
+	codel       codel
+	fair        fairQueue
+	waitTimes   *histogram.Histogram
+	serviceRate *rate.Estimator
+	closed      bool
+	stop        chan struct{}
+	drained     chan struct{}
+	tokens      uint64
+	holds       list.List
+	reaping     bool
+	orphans     int
+	reclaimed   uint64
+	shed        atomic.Uint64
+	events      *EventBuffer
+	succeeded   uint64
+	failed      uint64
+	results     results
+	breaker     breaker
+	random      func() float64
+	profile     string
+	timers      *wheel.Wheel
+	flightsMu   sync.Mutex
+	flights     map[string]*flight
 }
 
 type Option func(*Limiter)
 
 // New creates an instance of *Limiter. Configure the Limiter with the options specified.
-// Example: limiter.New(4, WithTimeout(5))
+// Example: limiter.New(4, WithTimeoutDuration(5*time.Millisecond))
 func New(limit int, options ...Option) *Limiter {
+	l := newLimiter(limit, options...)
+	l.start()
+	return l
+}
+
+// newLimiter creates a *Limiter configured with the options , without starting its background goroutines.
+func newLimiter(limit int, options ...Option) *Limiter {
 	l := &Limiter{
-		limit: limit,
+		waitTimes:   histogram.New(),
+		serviceRate: rate.NewEstimator(),
+		random:      rand.Float64,
+		stop:        make(chan struct{}),
 	}
+	l.cfg.Store(&config{
+		limit: limit,
+		clock: clock.Real(),
+	})
 
 	for _, o := range options {
 		o(l)
 	}
+	if w := l.config().warmup; w != nil {
+		l.config().limit = w.initial
+	}
+	if n := l.config().history; n > 0 {
+		l.events = NewEventBuffer(n)
+	}
+	if c := l.config(); c.timerTick > 0 && c.clock != nil {
+		l.timers = wheel.New(c.clock, c.timerTick)
+	}
 	return l
 }
 
+// start starts the background goroutines required by the configuration.
+func (l *Limiter) start() {
+	if l.config().warmup != nil {
+		go l.warmUp()
+	}
+	if l.config().schedule != nil {
+		go l.followSchedule()
+	}
+	if l.config().controller != nil {
+		go l.control()
+	}
+}
+
+// NewWithValidation creates an instance of *Limiter like New , but returns an error wrapping ErrInvalidConfig
+// if the configuration is invalid: a limit that is not positive , a timeout that is not positive , a negative
+// max queue length or LIFO threshold , an incomplete CoDel configuration , a rejection policy without a max
+// queue length , a timeout policy without a timeout , a negative permit TTL , max hold duration , event history
+// or timer wheel tick or a nil clock.
+func NewWithValidation(limit int, options ...Option) (*Limiter, error) {
+	l := newLimiter(limit, options...)
+	if err := l.config().validate(); err != nil {
+		return nil, err
+	}
+	l.start()
+	return l, nil
+}
+
 // timeout: If this field is specified , goroutines will be automatically removed from the waitlist
-// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+// after the time passes the timeout specified (in ms) even if the number of concurrent requests is greater than the limit.
+//
+// Deprecated: use WithTimeoutDuration.
 func WithTimeout(timeout int) func(*Limiter) {
+	return WithTimeoutDuration(time.Duration(timeout) * time.Millisecond)
+}
+
+// timeout: If this field is specified , goroutines will be automatically removed from the waitlist
+// after the time passes the timeout specified even if the number of concurrent requests is greater than the limit.
+func WithTimeoutDuration(timeout time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().timeout = &timeout
+	}
+}
+
+// timeoutPolicy: decides what happens to a goroutine still in the waitlist when the timeout expires. It only has an
+// effect together with WithTimeoutDuration. Defaults to AdmitOnTimeout.
+func WithTimeoutPolicy(policy TimeoutPolicy) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().timeoutPolicy = policy
+	}
+}
+
+// jitter: If this field is specified , the timeout of every goroutine is shortened by a random fraction of at most
+// jitter , between 0 and 1 , so the goroutines queued by the same spike don't all time out and contend for the
+// mutex at the same instant. Deadlines used as timeouts are not jittered.
+func WithJitter(jitter float64) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().jitter = jitter
+	}
+}
+
+// spin: If this field is specified , a goroutine finding no free slot yields the processor and checks again up to
+// spin times before it queues , and once queued up to spin times more before it parks. When slots are held for
+// microseconds , parking and waking the goroutine costs more than the wait: spinning lets it take the slot as soon
+// as it is freed or handed over without being descheduled. Spinning burns CPU , keep spin small.
+func WithSpin(spin int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().spin = spin
+	}
+}
+
+// deadlineAsTimeout: If this field is set and the context passed to Wait has a deadline , the deadline is used as the
+// timeout whenever it expires before the configured timeout , and the timeout policy applies when it expires.
+func WithDeadlineAsTimeout() func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().deadlineAsTimeout = true
+	}
+}
+
+// deadlineAwareRejection: If this field is set and the context passed to Wait has a deadline , Wait returns
+// ErrWaitExceedsDeadline immediately instead of queueing the goroutine when its estimated wait , based on its
+// position and the recent service rate , already exceeds the time remaining until the deadline. Queueing goroutines
+// that are doomed to expire only wastes slots.
+func WithDeadlineAwareRejection() func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().deadlineAwareRejection = true
+	}
+}
+
+// maxQueueLength: If this field is specified , Wait returns ErrQueueFull immediately instead of adding
+// the goroutine to the waitlist when the waitlist already holds maxQueueLength goroutines.
+func WithMaxQueueLength(maxQueueLength int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().maxQueueLength = &maxQueueLength
+	}
+}
+
+// redThreshold: If this field is specified , the waitlist is managed with Random Early Detection: once it holds
+// redThreshold goroutines , arriving goroutines are rejected with ErrRejectedEarly with a probability rising
+// linearly from 0 at redThreshold to 1 at the max queue length. Under sustained overload , the Limiter sheds load
+// gradually instead of going from accepting every goroutine to rejecting every goroutine at once. It requires
+// WithMaxQueueLength and a threshold below the max queue length.
+func WithRandomEarlyDetection(redThreshold int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().redThreshold = &redThreshold
+	}
+}
+
+// rejectionPolicy: decides what happens when a goroutine arrives while the waitlist is full. It only
+// has an effect together with WithMaxQueueLength. Defaults to RejectNew.
+func WithRejectionPolicy(policy RejectionPolicy) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().rejectionPolicy = policy
+	}
+}
+
+// lifoThreshold: If this field is specified , goroutines are removed from the waitlist in LIFO order instead of
+// FIFO order while the waitlist holds more than lifoThreshold goroutines. During overload the freshest goroutines ,
+// whose callers are the most likely to still be waiting for an answer , are served first. The FIFO order is
+// restored once the waitlist drains below the threshold.
+func WithAdaptiveLIFO(lifoThreshold int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().lifoThreshold = &lifoThreshold
+	}
+}
+
+// codelTarget , codelInterval: If these fields are specified , the waitlist is managed with CoDel. Once goroutines
+// have been spending more than codelTarget in the waitlist for at least codelInterval , goroutines leaving the waitlist
+// are shed with ErrShed at an increasing rate until the time spent in the waitlist drops below codelTarget again.
+// Typical values are a target of a few milliseconds and an interval of about 100ms.
+func WithCoDel(codelTarget, codelInterval time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		c.codelTarget = codelTarget
+		c.codelInterval = codelInterval
+	}
+}
+
+// weights: If this field is specified , goroutines are removed from the waitlist with weighted fair queuing instead
+// of FIFO order. Goroutines are tagged with a flow , for example a tenant , with WithFlow , and flows with waiting
+// goroutines are served in proportion to their weights: a flow with weight 2 gets twice as many slots as a flow with
+// weight 1 , whatever the number of goroutines each one queues. Flows missing from weights , including the goroutines
+// without a flow , have a weight of 1. A chatty flow can no longer occupy the whole waitlist and delay all others.
+func WithFairQueuing(weights map[string]int) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		c.weights = make(map[string]int, len(weights))
+		for flow, w := range weights {
+			c.weights[flow] = w
+		}
+	}
+}
+
+// admissionPolicy: decides how many goroutines Finish removes from the waitlist. Defaults to AdmitOne.
+func WithAdmissionPolicy(policy AdmissionPolicy) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().admissionPolicy = policy
+	}
+}
+
+// unlimited: If this field is set , the Limiter does not limit anything: Wait returns immediately , the limit
+// passed to New is ignored and may be zero. Slots are still counted , so Finish must be called as usual and
+// InFlight reports the goroutines accessing the resource. This lets a feature flag disable limiting without
+// changing the call sites:
+//
+//	options := []limiter.Option{}
+//	if !flags.LimitOutbound {
+//		options = append(options, limiter.WithUnlimited())
+//	}
+//	outbound := limiter.New(50, options...)
+func WithUnlimited() func(*Limiter) {
 	return func(l *Limiter) {
-		l.timeout = &timeout
+		l.config().unlimited = true
+	}
+}
+
+// warmup: If this field is specified , the Limiter starts with a limit of initial and raises it linearly to target
+// over ramp , admitting waiting goroutines as the limit grows. This protects cold downstreams , with empty caches
+// or connection pools , right after a deploy. target replaces the limit passed to New. Changing the limit with
+// SetLimit or closing the Limiter ends the warm-up.
+func WithWarmup(initial, target int, ramp time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().warmup = &warmup{
+			initial: initial,
+			target:  target,
+			ramp:    ramp,
+		}
+	}
+}
+
+// schedule: If this field is specified , the limit follows a daily schedule: while a profile is in effect , the
+// limit is the limit of the profile , for example 50 during business hours and 200 at night for batch jobs , and
+// outside of the profiles it is the limit passed to New. The first profile listed wins if several overlap. SetLimit
+// overrides the limit until the next profile starts or ends. Stats reports the limit and the name of the profile in
+// effect. The schedule is followed by a goroutine of its own until the Limiter is closed , so a Limiter with a
+// schedule must be closed once it is no longer used.
+func WithSchedule(profiles ...Profile) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().schedule = append([]Profile(nil), profiles...)
+	}
+}
+
+// controller , controlPeriod: If these fields are specified , the controller is sampled every controlPeriod and
+// sets the limit , so autoscalers and controllers outside of the package can drive the limit without forking the
+// Limiter. SetLimit overrides the limit until the next sample. The controller runs on a goroutine of its own
+// until the Limiter is closed , which keeps the Limiter reachable: a Limiter with a controller must be closed once
+// it is no longer used.
+func WithLimitController(controller LimitController, controlPeriod time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		c.controller = controller
+		c.controlPeriod = controlPeriod
+	}
+}
+
+// circuitBreaker: If this field is specified , the Limiter also acts as a circuit breaker fed with the outcomes
+// recorded with Permit.Record. Once more than threshold , a fraction between 0 and 1 , of the last window outcomes
+// are failures , the circuit opens: for coolDown , Wait rejects goroutines immediately with an error matching
+// ErrCircuitOpen , and the goroutines in the waitlist are rejected too. The circuit then half-opens: the limit
+// drops to 1 until the outcome of the next permit admitted , the probe , is recorded. A success closes the circuit ,
+// a failure opens it again. The outcomes of the goroutines admitted before the circuit opened are ignored. The
+// probe must record its outcome , otherwise the circuit stays half-open until the next permit is admitted.
+func WithCircuitBreaker(threshold float64, window int, coolDown time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().circuitBreaker = &circuitBreaker{
+			threshold: threshold,
+			window:    window,
+			coolDown:  coolDown,
+		}
+	}
+}
+
+// fallback: If this field is specified , Do calls fallback instead of its func when the Limiter sheds , times out or
+// otherwise rejects the goroutine , see IsRejection. reason is the error of Wait and Do returns the error of
+// fallback , so a degraded response can be served from one place instead of handling rejections in every caller.
+// Returning nil from fallback reports the degraded response as a success.
+func WithFallback(fallback func(ctx context.Context, reason error) error) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().fallback = fallback
+	}
+}
+
+// strictFIFO: If this field is set , a goroutine calling Wait never gets ahead of the goroutines already in the
+// waitlist: it only takes a free slot if the waitlist is empty , and queues behind it otherwise. Finish and
+// SetLimit already hand free slots over to the queued goroutines before returning , strict FIFO makes the
+// guarantee hold whatever frees a slot , including ways added to the Limiter in the future. It contradicts
+// adaptive LIFO and fair queuing.
+func WithStrictFIFO() func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().strictFIFO = true
+	}
+}
+
+// timerTick: If this field is specified , the timeouts of the goroutines in the waitlist are driven by a timer
+// wheel with a resolution of timerTick instead of a timer per goroutine. A single ticker then drives all of them ,
+// which relieves the runtime of heavy timer pressure with tens of thousands of queued goroutines , at the cost of
+// timeouts rounded up to the tick: a goroutine may wait up to one tick past its timeout.
+// Example: WithTimerWheel(time.Millisecond)
+func WithTimerWheel(timerTick time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().timerTick = timerTick
+	}
+}
+
+// clock: tells the time and creates the timers of the timeouts. Defaults to the real time. Tests can pass a
+// clock.Fake to control the passage of time instead of sleeping.
+func WithClock(c clock.Clock) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().clock = c
+	}
+}
+
+// logger: If this field is specified , the Limiter logs why goroutines stall: goroutines shed or timed out , slots
+// reclaimed and limit changes , each with structured attributes , see Event. Events are logged at the level of
+// EventKind.Level unless changed with WithEventLevel. The logger is called without holding the Limiter's mutex.
+func WithLogger(logger *slog.Logger) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().logger = logger
+	}
+}
+
+// level: the level events of the kind are logged at by the logger of WithLogger , instead of EventKind.Level.
+// Example: WithEventLevel(limiter.EventShed, slog.LevelDebug)
+func WithEventLevel(kind EventKind, level slog.Level) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		if c.levels == nil {
+			c.levels = make(map[EventKind]slog.Level)
+		}
+		c.levels[kind] = level
+	}
+}
+
+// history: If this field is positive , the Limiter keeps its last history events , with their time , wait and
+// limit , in a ring buffer returned by RecentEvents , so what the Limiter was doing before an incident can be
+// reconstructed without having configured a logger. Recording an event takes a short lock of its own.
+func WithEventHistory(history int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.config().history = history
+	}
+}
+
+// permitTTL , onReclaim: If these fields are specified , a Permit is a lease of its slot for permitTTL: the holder
+// must renew it with Permit.Renew or Permit.KeepAlive , otherwise the slot is reclaimed once permitTTL has passed
+// since the permit was acquired or last renewed , and onReclaim , if not nil , is called. This protects the Limiter
+// against hung holders that never give their slot back. Slots acquired with Wait are not affected.
+func WithPermitTTL(permitTTL time.Duration, onReclaim func()) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		c.permitTTL = permitTTL
+		c.onReclaim = onReclaim
+	}
+}
+
+// maxHold , onMaxHold: If these fields are specified , a slot held for longer than maxHold is reclaimed: it is
+// given to the next goroutine in the waitlist as if Finish had been called , and onMaxHold , if not nil , is called.
+// This bounds the damage done by callers that leak slots by never calling Finish. Slots acquired with Wait are
+// anonymous , so the Limiter reclaims the oldest ones and the late Finish of a reclaimed holder is ignored once
+// every slot it could belong to has been given back. The context of a Permit is cancelled when it is reclaimed ,
+// see Permit.Context.
+func WithMaxHoldDuration(maxHold time.Duration, onMaxHold func()) func(*Limiter) {
+	return func(l *Limiter) {
+		c := l.config()
+		c.maxHold = maxHold
+		c.onMaxHold = onMaxHold
 	}
 }
 
 // Wait method waits if the number of concurrent requests is more than the limit specified.
+// If the Limiter is closed , Wait returns ErrClosed.
 // If a timeout is configured , then the goroutine will wait until the timeout occurs and then proceeds to
-// access the resource irrespective of whether it has received a signal in the done channel.
-func (l *Limiter) Wait(ctx context.Context) {
-	ok, ch := l.proceed()
+// access the resource irrespective of whether it has received a signal in the done channel , unless the
+// RejectOnTimeout policy is configured: Wait then returns ErrTimeout.
+// If the waitlist is bounded and full , Wait applies the configured RejectionPolicy. A goroutine that is
+// rejected or dropped gets ErrQueueFull or ErrDropped and must not access the resource. The same holds
+// for a goroutine shed by CoDel , which gets an error matching ErrShed (see errors.Is) carrying a RetryAfter hint.
+// If the context is done while the goroutine waits , including while it is blocked by the BlockCaller policy , Wait
+// returns an error matching both ErrCanceled and the cause of the cancellation. Otherwise Wait returns nil.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := l.wait(ctx); err != nil {
+		l.countShed(err)
+		return err
+	}
+	l.hold()
+	return nil
+}
+
+// wait waits like Wait without recording the acquisition of the slot for WithMaxHoldDuration.
+func (l *Limiter) wait(ctx context.Context) error {
+	c := l.config()
+	if l.acquireFast(c) || l.spin(c) {
+		l.waitTimes.Observe(0)
+		return nil
+	}
+	ok, w, err := l.proceed(ctx)
+	if err != nil {
+		return err
+	}
 	if ok {
-		return
+		l.waitTimes.Observe(0)
+		return nil
 	}
-	if l.timeout != nil {
+	defer recycle(w)
+	c = l.config()
+	start := c.clock.Now()
+	switch timeout := effectiveTimeout(ctx, c); {
+	case spinOn(w.done, c.spin):
+		// the goroutine was settled while it was spinning.
+	case timeout != nil:
+		timer := l.waitClock().NewTimer(*timeout)
+		defer timer.Stop()
 		select {
-		case <-ch:
-		case <-time.After((time.Duration(*l.timeout) * time.Millisecond)):
-			l.removeWaiter(ch)
+		case <-w.done:
+		case <-timer.C():
+			if err := l.timeoutErr(); l.removeWaiter(w, err) {
+				l.emit(EventTimeout, c.clock.Now().Sub(w.enqueued), err)
+			}
 		case <-ctx.Done():
+			return l.cancel(ctx, w)
+		}
+	default:
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return l.cancel(ctx, w)
 		}
-		return
 	}
-	select {
-	case <-ch:
-	case <-ctx.Done():
-		l.removeWaiter(ch)
+	if w.err != nil {
+		return w.err
+	}
+	l.waitTimes.Observe(c.clock.Now().Sub(start))
+	return nil
+}
+
+// waitClock returns the clock creating the timers of the goroutines in the waitlist: the timer wheel if it is
+// configured.
+func (l *Limiter) waitClock() clock.Clock {
+	if l.timers != nil {
+		return l.timers
+	}
+	return l.config().clock
+}
+
+// countShed counts the goroutine that failed to wait with err if it was rejected because of overload.
+func (l *Limiter) countShed(err error) {
+	if IsRejection(err) {
+		l.shed.Add(1)
+		// timeouts are reported where they expire , with the time spent waiting.
+		if !errors.Is(err, ErrTimeout) {
+			l.emit(EventShed, 0, err)
+		}
 	}
 }
 
-func (l *Limiter) removeWaiter(ch chan struct{}) {
+// effectiveTimeout returns the timeout of a goroutine calling Wait with ctx , jittered if jitter is configured ,
+// or the deadline of ctx if it expires first and deadlineAsTimeout is set. It returns nil if the goroutine has no
+// timeout.
+func effectiveTimeout(ctx context.Context, c *config) *time.Duration {
+	timeout := c.timeout
+	if timeout != nil && c.jitter > 0 {
+		d := Jitter(*timeout, c.jitter)
+		timeout = &d
+	}
+	if deadline, ok := ctx.Deadline(); ok && c.deadlineAsTimeout {
+		if d := deadline.Sub(c.clock.Now()); timeout == nil || d < *timeout {
+			timeout = &d
+		}
+	}
+	return timeout
+}
+
+// ctxErr returns the error of a goroutine removed from the waitlist because its context is done: ErrCanceled
+// wrapping the cause of the cancellation. An expired deadline counts as a timeout if deadlineAsTimeout is set.
+func (l *Limiter) ctxErr(ctx context.Context) error {
+	if l.config().deadlineAsTimeout && ctx.Err() == context.DeadlineExceeded {
+		return l.timeoutErr()
+	}
+	return canceled(ctx)
+}
+
+// timeoutErr returns the error of a goroutine removed from the waitlist after the timeout , nil if it is admitted.
+func (l *Limiter) timeoutErr() error {
+	if l.config().timeoutPolicy == RejectOnTimeout {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// cancel handles a goroutine whose context is done while it waits. The goroutine is abandoned unless it has been
+// settled concurrently. If it has been granted a slot , the slot is given back: a goroutine whose Wait fails never
+// holds a slot. cancel returns the error of Wait.
+func (l *Limiter) cancel(ctx context.Context, w *waiter) error {
+	err := l.ctxErr(ctx)
+	if err == nil {
+		// deadlineAsTimeout lets the goroutine through when its deadline expires.
+		if l.removeWaiter(w, nil) {
+			l.emit(EventTimeout, l.config().clock.Now().Sub(w.enqueued), nil)
+		}
+		return w.err
+	}
+	// the swap settles the race with a concurrent Finish without waiting for the mutex , the waiter is unlinked
+	// afterwards and skipped by dequeue meanwhile.
+	abandoned := w.abandon(err)
 	l.mu.Lock()
-	for w := l.waitList.Front(); w != nil; w = w.Next() {
-		ele := w.Value.(waiter)
-		if ele.done == ch {
-			close(ch)
-			l.waitList.Remove(w)
-			l.count += 1
-			break
+	if abandoned {
+		l.unlink(w)
+		l.mu.Unlock()
+		if errors.Is(err, ErrTimeout) {
+			l.emit(EventTimeout, l.config().clock.Now().Sub(w.enqueued), err)
 		}
+		return err
 	}
-	l.mu.Unlock()
+	defer l.mu.Unlock()
+	if atomic.LoadInt32(&w.state) == waiterGranted {
+		l.giveBack()
+		return err
+	}
+	return w.err
 }
 
-// proceed will return true if the number of concurrent requests is less than the limit else it
-// will add the goroutine to the waiting list and will return a channel. This channel is used by goutines to
-// check for signal when they are granted access to use the resource.
-func (l *Limiter) proceed() (bool, chan struct{}) {
+// removeWaiter removes the goroutine from the waitlist. If err is nil , the goroutine is granted a slot , even
+// above the limit , otherwise it is abandoned and its Wait returns err. It is a no-op if the goroutine has already
+// been settled. removeWaiter reports whether the goroutine was still queued.
+func (l *Limiter) removeWaiter(w *waiter, err error) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if err == nil {
+		if !l.grant(w) {
+			return false
+		}
+	} else if !w.abandon(err) {
+		return false
+	}
+	l.unlink(w)
+	return true
+}
 
-	if l.count < l.limit {
-		l.count++
-		return true, nil
+// unlink removes w from the waitlist , out of turn. It is a no-op if w has already been removed. The mutex must be
+// held.
+func (l *Limiter) unlink(w *waiter) {
+	if !w.queued {
+		return
 	}
-	ch := make(chan struct{})
-	w := waiter{
-		done: ch,
+	l.waitList.Remove(w)
+	l.addQueued(-1)
+	l.fair.leave(w, false)
+	l.version.Add(1)
+	l.notifyRoom()
+}
+
+// grant settles w by giving it a slot , and reports whether it was still queued. The mutex must be held.
+func (l *Limiter) grant(w *waiter) bool {
+	if !w.settle(waiterGranted, nil) {
+		return false
+	}
+	l.addCount(1)
+	return true
+}
+
+// abandon settles w without a slot: its Wait returns err. It reports whether w was still queued.
+func (w *waiter) abandon(err error) bool {
+	return w.settle(waiterAbandoned, err)
+}
+
+// settle moves w from the queued state to state and signals it , and reports whether it was still queued.
+func (w *waiter) settle(state int32, err error) bool {
+	if !atomic.CompareAndSwapInt32(&w.state, waiterQueued, state) {
+		return false
+	}
+	w.err = err
+	// done has room for the single value , so the send never blocks and the waiter is signalled even if it is
+	// busy trying to acquire the mutex we are holding.
+	w.done <- struct{}{}
+	return true
+}
+
+// proceed will return true if the number of concurrent requests is less than the limit else it
+// will add the goroutine to the waiting list and will return a waiter. The waiter's channel is used by goutines to
+// check for signal when they are granted access to use the resource. If the waiting list is full the
+// rejection policy is applied.
+func (l *Limiter) proceed(ctx context.Context) (bool, *waiter, error) {
+	l.mu.Lock()
+	for {
+		if l.closed {
+			l.mu.Unlock()
+			return false, nil, ErrClosed
+		}
+		c := l.config()
+		if c.circuitBreaker != nil {
+			if err := l.breaker.check(c.clock.Now()); err != nil {
+				l.mu.Unlock()
+				return false, nil, err
+			}
+		}
+		if c.unlimited && l.breaker.state != circuitHalfOpen && !l.paused() {
+			l.addCount(1)
+			l.mu.Unlock()
+			return true, nil, nil
+		}
+		if (!c.strictFIFO || l.waitList.Len() == 0) && l.reserve(l.effectiveLimit(c)) {
+			l.mu.Unlock()
+			return true, nil, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && c.deadlineAwareRejection {
+			if wait, ok := l.serviceRate.Estimate(l.waitList.Len() + 1); ok && wait > deadline.Sub(c.clock.Now()) {
+				l.mu.Unlock()
+				return false, nil, ErrWaitExceedsDeadline
+			}
+		}
+		if l.rejectEarly(c) {
+			l.mu.Unlock()
+			return false, nil, ErrRejectedEarly
+		}
+		if c.maxQueueLength == nil || l.waitList.Len() < *c.maxQueueLength {
+			break
+		}
+		if c.rejectionPolicy == DropOldest && l.waitList.Len() > 0 {
+			l.drop(l.waitList.Front())
+			break
+		}
+		if c.rejectionPolicy != BlockCaller {
+			l.mu.Unlock()
+			return false, nil, ErrQueueFull
+		}
+		if l.room == nil {
+			l.room = make(chan struct{})
+		}
+		room := l.room
+		l.mu.Unlock()
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return false, nil, canceled(ctx)
+		}
+		l.mu.Lock()
+	}
+	c := l.config()
+	w := newWaiter()
+	w.enqueued = c.clock.Now()
+	w.flow = FlowFrom(ctx)
+	if c.weights != nil {
+		l.fair.enqueue(w, c.weight(w.flow))
 	}
 	l.waitList.PushBack(w)
-	return false, ch
+	l.addQueued(1)
+	l.version.Add(1)
+	if h := handleFrom(ctx); h != nil {
+		h.attach(l, w)
+	}
+	l.mu.Unlock()
+	return false, w, nil
+}
+
+// rejectEarly decides at random whether Random Early Detection rejects a goroutine arriving now. The mutex must be
+// held.
+func (l *Limiter) rejectEarly(c *config) bool {
+	if c.redThreshold == nil || c.maxQueueLength == nil {
+		return false
+	}
+	n, t, max := l.waitList.Len(), *c.redThreshold, *c.maxQueueLength
+	if n < t || n >= max {
+		// a full waitlist is handled by the rejection policy.
+		return false
+	}
+	return l.random() < float64(n-t)/float64(max-t)
+}
+
+// drop removes a goroutine from the waiting list without granting it access. The mutex must be held.
+func (l *Limiter) drop(w *waiter) {
+	l.unlink(w)
+	w.abandon(ErrDropped)
+}
+
+// next returns the goroutine that should be removed from the waiting list next , or nil if the list
+// is empty. The mutex must be held.
+func (l *Limiter) next() *waiter {
+	c := l.config()
+	if c.weights != nil {
+		return l.fair.next(&l.waitList)
+	}
+	if t := c.lifoThreshold; t != nil && l.waitList.Len() > *t {
+		return l.waitList.Back()
+	}
+	return l.waitList.Front()
+}
+
+// dequeue removes the goroutine that should be granted access next from the waiting list , shedding
+// goroutines on the way if CoDel is configured and skipping the goroutines abandoned by a concurrent
+// cancellation. It returns nil if the list is empty. The mutex must be held.
+func (l *Limiter) dequeue() *waiter {
+	c := l.config()
+	now := c.clock.Now()
+	for w := l.next(); w != nil; w = l.next() {
+		l.waitList.Remove(w)
+		l.addQueued(-1)
+		l.version.Add(1)
+		l.notifyRoom()
+		if atomic.LoadInt32(&w.state) != waiterQueued {
+			l.fair.leave(w, false)
+			continue
+		}
+		l.fair.leave(w, true)
+		if c.codelTarget > 0 && l.codel.shed(now, now.Sub(w.enqueued), c.codelTarget, c.codelInterval) {
+			w.abandon(&RetryAfterError{
+				Err:   ErrShed,
+				After: c.codelInterval,
+			})
+			continue
+		}
+		return w
+	}
+	return nil
+}
+
+// notifyRoom wakes the goroutines blocked until there is room in the waiting list. The mutex must be held.
+func (l *Limiter) notifyRoom() {
+	if l.room != nil {
+		close(l.room)
+		l.room = nil
+	}
 }
 
 // Finish will remove the goroutine from the waiting list and sends a signal
-// to the waiting goroutine to access the resource
+// to the waiting goroutine to access the resource. How many goroutines are removed
+// depends on the AdmissionPolicy.
 func (l *Limiter) Finish() {
+	l.FinishN(1)
+}
+
+// FinishN gives back n slots , like calling Finish n times , under a single acquisition of the mutex. The
+// goroutines granted the slots are woken by closing their channels , which never blocks , so releasing a batch of
+// slots does not contend for the mutex once per slot with the goroutines it wakes.
+func (l *Limiter) FinishN(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if l.unhold() {
+			l.release()
+		}
+	}
+}
+
+// release gives back the slot of a goroutine that accessed the resource. The mutex must be held.
+func (l *Limiter) release() {
+	if l.giveBack() {
+		l.serviceRate.Observe(l.config().clock.Now())
+	}
+}
+
+// giveBack frees a slot and hands it to the next waiting goroutine , if any , and reports whether there was a slot
+// to free. The slot is handed over without being freed in between , so the fast path of Wait cannot take it ahead
+// of the waiting goroutines. A call without any slot taken , like an unmatched Finish , is a no-op. The mutex must
+// be held.
+func (l *Limiter) giveBack() bool {
+	// slots are only given back under the mutex , so the count cannot drop to zero concurrently.
+	if l.InFlight() == 0 {
+		return false
+	}
+	// a half-open circuit admits a single goroutine , whatever the number of slots given back.
+	if l.config().admissionPolicy == AdmitUpToLimit || l.breaker.state == circuitHalfOpen {
+		l.addCount(-1)
+		l.checkDrained()
+		l.admit()
+		return true
+	}
+	if !l.paused() && l.handOver() {
+		l.version.Add(1)
+		return true
+	}
+	l.addCount(-1)
+	l.checkDrained()
+	return true
+}
+
+// handOver grants the slot of the caller to the next waiting goroutine and reports whether there was one. The
+// mutex must be held.
+func (l *Limiter) handOver() bool {
+	// goroutines abandoned by a concurrent cancellation are skipped.
+	for w := l.dequeue(); w != nil; w = l.dequeue() {
+		if w.settle(waiterGranted, nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit removes goroutines from the waiting list and grants them access until the limit is
+// reached. The mutex must be held.
+func (l *Limiter) admit() {
+	for l.waitList.Len() > 0 && l.reserve(l.effectiveLimit(l.config())) {
+		if !l.handOver() {
+			l.addCount(-1)
+			return
+		}
+	}
+}
+
+// SetLimit changes the max number of concurrent goroutines that can access the resource.
+// If the limit is raised , goroutines are removed from the waitlist in FIFO order (or LIFO order
+// if adaptive LIFO is in effect) until the new limit is reached.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	old := l.config().limit
+	l.updateConfig(func(c *config) {
+		c.limit = limit
+	})
+	l.version.Add(1)
+	l.admit()
+	l.mu.Unlock()
+	if limit != old {
+		l.emit(EventLimitChange, 0, nil)
+	}
+}
+
+// position returns the position of w in the serving order of the waitlist , or 0 if it is not in the waitlist.
+func (l *Limiter) position(w *waiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config().weights != nil {
+		return l.fairPosition(w)
+	}
+	i := 0
+	for o := l.waitList.Front(); o != nil; o = o.next {
+		i++
+		if o != w {
+			continue
+		}
+		if t := l.config().lifoThreshold; t != nil && l.waitList.Len() > *t {
+			return l.waitList.Len() - i + 1
+		}
+		return i
+	}
+	return 0
+}
+
+// Purge removes every goroutine from the waitlist without granting it access. Their Wait returns ErrPurged.
+// Purge returns the number of goroutines removed.
+func (l *Limiter) Purge() int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.count -= 1
-	first := l.waitList.Front()
-	if first == nil {
+	return l.clear(ErrPurged)
+}
+
+// clear removes every goroutine from the waitlist , their Wait returns err. The mutex must be held.
+func (l *Limiter) clear(err error) int {
+	n := l.waitList.Len()
+	for w := l.waitList.Front(); w != nil; w = l.waitList.Front() {
+		l.waitList.Remove(w)
+		l.addQueued(-1)
+		w.abandon(err)
+	}
+	l.fair.reset()
+	if n > 0 {
+		l.version.Add(1)
+		l.notifyRoom()
+	}
+	return n
+}
+
+// Close stops admitting goroutines: Wait returns ErrClosed from now on , including for the goroutines in
+// the waitlist. Close then waits until the goroutines accessing the resource have called Finish , or until
+// the context is done , in which case it returns the context error. Close can be called more than once ,
+// every call waits for the Limiter to be drained.
+func (l *Limiter) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		l.state.Or(closedBit)
+		// wakes the background goroutines sleeping until their next deadline.
+		close(l.stop)
+		l.drained = make(chan struct{})
+		l.version.Add(1)
+		l.clear(ErrClosed)
+		// goroutines blocked by the BlockCaller policy must notice the Limiter is closed.
+		l.notifyRoom()
+		l.checkDrained()
+	}
+	drained := l.drained
+	l.mu.Unlock()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkDrained closes drained once the Limiter is closed and no goroutine accesses the resource anymore.
+// The mutex must be held.
+func (l *Limiter) checkDrained() {
+	if !l.closed || l.InFlight() > 0 {
 		return
 	}
-	w := l.waitList.Remove(first).(waiter)
-	w.done <- struct{}{}
-	close(w.done)
+	select {
+	case <-l.drained:
+	default:
+		close(l.drained)
+	}
+}
+
+// EstimatedWait returns how long a goroutine calling Wait now is expected to wait before accessing the resource:
+// zero if a slot is free , otherwise the time to serve the waitlist ahead of it at the rate the Limiter served
+// goroutines recently. ok is false if the Limiter has not served enough goroutines yet to estimate its rate. It
+// suits Retry-After hints: the time until an overloaded Limiter has drained its waitlist.
+func (l *Limiter) EstimatedWait() (d time.Duration, ok bool) {
+	c := l.config()
+	queued := l.QueueLen()
+	if queued == 0 && (c.unlimited || l.InFlight() < c.limit) {
+		return 0, true
+	}
+	return l.serviceRate.Estimate(queued + 1)
 }
 
-// only used in tests
-func (l *Limiter) waitListSize() int {
+// OldestWaitAge returns how long the oldest goroutine in the waitlist has been waiting , zero if the waitlist is
+// empty. Health checks can compare it with the expected hold time to detect a stuck Limiter , for example one whose
+// slots leak , even while the waitlist is short.
+func (l *Limiter) OldestWaitAge() time.Duration {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	len := l.waitList.Len()
-	return len
+	return l.oldestWaitAge()
+}
+
+// oldestWaitAge returns OldestWaitAge. Goroutines are appended to the waitlist whatever order they are served in , so
+// the oldest is at the front. The mutex must be held.
+func (l *Limiter) oldestWaitAge() time.Duration {
+	w := l.waitList.Front()
+	if w == nil {
+		return 0
+	}
+	return l.config().clock.Now().Sub(w.enqueued)
+}
+
+// Stats returns a snapshot of the current state of the limiter along with
+// the percentiles of the time spent by goroutines in the waitlist.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	s := Stats{
+		Limit:      l.config().limit,
+		InFlight:   l.InFlight(),
+		Waiting:    l.waitList.Len(),
+		Reclaimed:  l.reclaimed,
+		Shed:       l.shed.Load(),
+		Succeeded:  l.succeeded,
+		Failed:     l.failed,
+		Paused:     l.paused(),
+		Profile:    l.profile,
+		Version:    l.version.Load(),
+		OldestWait: l.oldestWaitAge(),
+	}
+	if l.config().circuitBreaker != nil {
+		s.Circuit = circuitName(l.breaker.state)
+	}
+	l.mu.Unlock()
+	s.WaitP50 = l.waitTimes.Quantile(0.50)
+	s.WaitP95 = l.waitTimes.Quantile(0.95)
+	s.WaitP99 = l.waitTimes.Quantile(0.99)
+	return s
 }
@@ -1,12 +1,21 @@
 package limiter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vivek-ng/concurrency-limiter/clock"
 )
 
 func TestConcurrentRateLimiterNonBlocking(t *testing.T) {
@@ -40,12 +49,50 @@ func TestConcurrentRateLimiterBlocking(t *testing.T) {
 		}()
 	}
 	time.Sleep(100 * time.Millisecond)
-	assert.Equal(t, 3, l.waitListSize())
+	assert.Equal(t, 3, l.QueueLen())
 	for i := 0; i < 3; i++ {
 		l.Finish()
 	}
 	wg.Wait()
-	assert.Equal(t, 0, l.waitListSize())
+	assert.Equal(t, 0, l.QueueLen())
+}
+
+func TestConcurrentRateLimiter_UnmatchedFinish(t *testing.T) {
+	l := New(2)
+	l.Finish()
+	assert.Equal(t, 0, l.InFlight())
+	assert.Equal(t, 0, l.QueueLen())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, l.Wait(ctx))
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, 2, l.InFlight())
+	l.FinishN(3)
+	assert.Equal(t, 0, l.InFlight())
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, 1, l.InFlight())
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_TryWait(t *testing.T) {
+	l := New(1, WithMaxQueueLength(1), WithRejectionPolicy(DropOldest))
+	assert.True(t, l.TryWait())
+	errs := make(chan error)
+	go func() { errs <- l.Wait(context.Background()) }()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, l.TryWait())
+	// the queued goroutine is not dropped and the failed call is not counted as shed.
+	assert.Equal(t, 1, l.QueueLen())
+	assert.Zero(t, l.Stats().Shed)
+	l.Finish()
+	assert.NoError(t, <-errs)
+	l.Finish()
+
+	l.Close(context.Background())
+	assert.False(t, l.TryWait())
 }
 
 func TestConcurrentRateLimiterTimeout(t *testing.T) {
@@ -67,7 +114,7 @@ func TestConcurrentRateLimiterTimeout(t *testing.T) {
 	wg.Wait()
 	l.Finish()
 	l.Finish()
-	assert.Equal(t, 3, l.count)
+	assert.Equal(t, 3, l.InFlight())
 	assert.Equal(t, 0, l.waitList.Len())
 }
 
@@ -86,9 +133,1466 @@ func TestConcurrentRateLimiter_ContextDone(t *testing.T) {
 		}()
 	}
 	time.Sleep(200 * time.Millisecond)
-	assert.Equal(t, 3, l.waitListSize())
+	assert.Equal(t, 3, l.QueueLen())
 	cancel()
 	time.Sleep(100 * time.Millisecond)
-	assert.Zero(t, l.waitListSize())
-	assert.Equal(t, 5, l.count)
+	assert.Zero(t, l.QueueLen())
+	assert.Equal(t, 2, l.InFlight())
+}
+
+func TestConcurrentRateLimiter_ContextCause(t *testing.T) {
+	l := New(1)
+	assert.NoError(t, l.Wait(context.Background()))
+
+	cause := errors.New("client went away")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, l.QueueLen())
+	cancel(cause)
+
+	err := <-errs
+	assert.True(t, errors.Is(err, ErrCanceled))
+	assert.True(t, errors.Is(err, cause))
+	assert.Zero(t, l.QueueLen())
+	assert.Equal(t, 1, l.InFlight())
+
+	ctx, cancel2 := context.WithCancel(context.Background())
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel2()
+	err = <-errs
+	assert.True(t, errors.Is(err, ErrCanceled))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, IsRejection(err))
+}
+
+func TestConcurrentRateLimiter_Stats(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Wait(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	s := l.Stats()
+	assert.Equal(t, 1, s.Limit)
+	assert.Equal(t, 1, s.InFlight)
+	assert.Equal(t, 1, s.Waiting)
+	l.Finish()
+	<-done
+
+	s = l.Stats()
+	assert.Zero(t, s.Waiting)
+	assert.Zero(t, s.WaitP50)
+	assert.GreaterOrEqual(t, int64(s.WaitP99), int64(90*time.Millisecond))
+}
+
+func TestConcurrentRateLimiter_MaxQueueLength(t *testing.T) {
+	l := New(1,
+		WithMaxQueueLength(2),
+	)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, l.Wait(ctx))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 2, l.QueueLen())
+	assert.Equal(t, ErrQueueFull, l.Wait(ctx))
+	assert.Equal(t, 2, l.QueueLen())
+
+	l.Finish()
+	l.Finish()
+	wg.Wait()
+	assert.Zero(t, l.QueueLen())
+}
+
+// fifoProperty queues one goroutine per op behind a single held slot and then applies the ops as
+// Finish, SetLimit or cancellation of a queued goroutine. Goroutines must leave the waitlist in
+// the order they joined it.
+func fifoProperty(options ...Option) func(ops []uint8) bool {
+	return func(ops []uint8) bool {
+		l := New(1, options...)
+		l.Wait(context.Background())
+
+		n := len(ops)%6 + 2
+		granted := make(chan int, n)
+		cancels := make([]context.CancelFunc, n)
+		pending := make([]int, 0, n)
+		for i := 0; i < n; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			cancels[i] = cancel
+			go func(id int) {
+				l.Wait(ctx)
+				granted <- id
+			}(i)
+			for l.QueueLen() != i+1 {
+				time.Sleep(time.Millisecond)
+			}
+			pending = append(pending, i)
+		}
+
+		expect := func(ids ...int) bool {
+			want := make(map[int]bool)
+			for _, id := range ids {
+				want[id] = true
+			}
+			for range ids {
+				select {
+				case id := <-granted:
+					if !want[id] {
+						return false
+					}
+				case <-time.After(time.Second):
+					return false
+				}
+			}
+			return true
+		}
+
+		limit := 1
+		for _, op := range ops {
+			if len(pending) == 0 {
+				break
+			}
+			switch op % 3 {
+			case 0:
+				l.Finish()
+				if !expect(pending[0]) {
+					return false
+				}
+				pending = pending[1:]
+			case 1:
+				k := int(op/3) % len(pending)
+				cancels[pending[k]]()
+				if !expect(pending[k]) {
+					return false
+				}
+				pending = append(pending[:k], pending[k+1:]...)
+			case 2:
+				before := l.QueueLen()
+				limit++
+				l.SetLimit(limit)
+				admitted := before - l.QueueLen()
+				if !expect(pending[:admitted]...) {
+					return false
+				}
+				pending = pending[admitted:]
+			}
+		}
+		for len(pending) > 0 {
+			l.Finish()
+			if !expect(pending[0]) {
+				return false
+			}
+			pending = pending[1:]
+		}
+		return true
+	}
+}
+
+func TestConcurrentRateLimiter_FIFOProperty(t *testing.T) {
+	cfg := &quick.Config{MaxCount: 30}
+	assert.NoError(t, quick.Check(fifoProperty(), cfg))
+	assert.NoError(t, quick.Check(fifoProperty(WithTimeout(60000)), cfg))
+}
+
+func TestConcurrentRateLimiter_TimeoutKeepsFIFO(t *testing.T) {
+	l := New(1,
+		WithTimeout(200),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	granted := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(id int) {
+			l.Wait(ctx)
+			granted <- id
+		}(i)
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+		if i == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	// the first goroutine times out while the others are still queued.
+	assert.Equal(t, 0, <-granted)
+	assert.Equal(t, 2, l.QueueLen())
+	l.Finish()
+	assert.Equal(t, 1, <-granted)
+	l.Finish()
+	assert.Equal(t, 2, <-granted)
+}
+
+func TestConcurrentRateLimiter_DropOldest(t *testing.T) {
+	l := New(1,
+		WithMaxQueueLength(1),
+		WithRejectionPolicy(DropOldest),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	first := make(chan error, 1)
+	go func() {
+		first <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		second <- l.Wait(ctx)
+	}()
+	assert.Equal(t, ErrDropped, <-first)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	assert.NoError(t, <-second)
+}
+
+func TestConcurrentRateLimiter_BlockCaller(t *testing.T) {
+	l := New(1,
+		WithMaxQueueLength(1),
+		WithRejectionPolicy(BlockCaller),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, l.Wait(ctx))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, l.QueueLen())
+
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err := l.Wait(cctx)
+	assert.True(t, errors.Is(err, ErrCanceled))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	l.Finish()
+	l.Finish()
+	wg.Wait()
+	assert.Zero(t, l.QueueLen())
+}
+
+func TestConcurrentRateLimiter_ConfigWithoutLocking(t *testing.T) {
+	l := New(3,
+		WithTimeout(50),
+		WithMaxQueueLength(10),
+		WithRejectionPolicy(DropOldest),
+	)
+	assert.Equal(t, Config{
+		Limit:           3,
+		Timeout:         50 * time.Millisecond,
+		MaxQueueLength:  10,
+		RejectionPolicy: DropOldest,
+		REDThreshold:    -1,
+		LIFOThreshold:   -1,
+	}, l.Config())
+
+	// configuration reads must not contend with the mutex.
+	l.mu.Lock()
+	assert.Equal(t, 3, l.Limit())
+	l.mu.Unlock()
+
+	l.SetLimit(5)
+	assert.Equal(t, 5, l.Limit())
+	assert.Equal(t, -1, New(1).Config().MaxQueueLength)
+}
+
+func TestConcurrentRateLimiter_AdaptiveLIFO(t *testing.T) {
+	l := New(1,
+		WithAdaptiveLIFO(1),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	granted := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(id int) {
+			l.Wait(ctx)
+			granted <- id
+		}(i)
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// LIFO while more than one goroutine is queued , FIFO afterwards.
+	for _, id := range []int{2, 1, 0} {
+		l.Finish()
+		assert.Equal(t, id, <-granted)
+	}
+}
+
+func TestConcurrentRateLimiter_CoDel(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1,
+		WithCoDel(10*time.Millisecond, 50*time.Millisecond),
+		WithClock(clk),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	results := make([]chan error, 3)
+	for i := range results {
+		results[i] = make(chan error, 1)
+		go func(res chan error) {
+			res <- l.Wait(ctx)
+		}(results[i])
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// the queue is above target but not yet for a whole interval.
+	clk.Advance(100 * time.Millisecond)
+	l.Finish()
+	assert.NoError(t, <-results[0])
+
+	// the queue stayed above target for an interval: one goroutine is shed ,
+	// and the next one is admitted as the following shed is not due yet.
+	clk.Advance(100 * time.Millisecond)
+	l.Finish()
+	err := <-results[1]
+	assert.True(t, errors.Is(err, ErrShed))
+	after, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, after)
+	assert.NoError(t, <-results[2])
+}
+
+// admissionAfterTimeout lets a timed out goroutine through above the limit , queues another one and
+// returns how many goroutines are still queued after a call to Finish.
+func admissionAfterTimeout(t *testing.T, policy AdmissionPolicy) int {
+	l := New(2,
+		WithTimeout(100),
+		WithAdmissionPolicy(policy),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+	l.Wait(ctx)
+	l.Wait(ctx)
+	assert.Equal(t, 3, l.Stats().InFlight)
+
+	go l.Wait(ctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	return l.QueueLen()
+}
+
+func TestConcurrentRateLimiter_AdmissionPolicy(t *testing.T) {
+	// the slot released by Finish is always handed to a queued goroutine.
+	assert.Zero(t, admissionAfterTimeout(t, AdmitOne))
+	// two goroutines still access the resource , which is the limit: nobody is admitted.
+	assert.Equal(t, 1, admissionAfterTimeout(t, AdmitUpToLimit))
+}
+
+func TestConcurrentRateLimiter_StateMatchesSchema(t *testing.T) {
+	l := New(1, WithMaxQueueLength(2))
+	ctx := context.Background()
+	l.Wait(ctx)
+	go l.Wait(ctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	b, err := json.Marshal(l)
+	assert.NoError(t, err)
+	var state map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &state))
+
+	raw, err := ioutil.ReadFile("schema/state.v1.json")
+	assert.NoError(t, err)
+	var schema struct {
+		Required   []string
+		Properties map[string]json.RawMessage
+	}
+	assert.NoError(t, json.Unmarshal(raw, &schema))
+	for _, key := range schema.Required {
+		assert.Contains(t, state, key)
+	}
+	for key := range state {
+		assert.Contains(t, schema.Properties, key)
+	}
+	assert.Equal(t, float64(StateVersion), state["version"])
+	assert.Equal(t, KindLimiter, state["kind"])
+	assert.Equal(t, float64(2), state["config"].(map[string]interface{})["max_queue_length"])
+	assert.Len(t, state["waiters"], 1)
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_Handle(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	l.Wait(ctx)
+	// two completions give the Limiter a service rate.
+	l.Finish()
+	l.Wait(ctx)
+	l.Finish()
+	l.Wait(ctx)
+
+	handles := make([]*Handle, 2)
+	for i := range handles {
+		hctx, h := WithHandle(ctx)
+		handles[i] = h
+		go l.Wait(hctx)
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 1, handles[0].Position())
+	assert.Equal(t, 2, handles[1].Position())
+	first, ok := handles[0].EstimatedWait()
+	assert.True(t, ok)
+	second, _ := handles[1].EstimatedWait()
+	assert.Equal(t, 2*first, second)
+
+	l.Finish()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, handles[0].Position())
+	assert.Equal(t, 1, handles[1].Position())
+	l.Finish()
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_SlotAccounting(t *testing.T) {
+	l := New(1, WithTimeoutDuration(time.Hour))
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	// a goroutine cancelled while queued neither takes nor leaks a slot.
+	cctx, cancel := context.WithCancel(ctx)
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(cctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.True(t, errors.Is(<-errs, ErrCanceled))
+	s := l.Stats()
+	assert.Equal(t, 1, s.InFlight)
+	assert.Equal(t, 0, s.Waiting)
+
+	// the slot is handed over , a latecomer cannot take it.
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 1, l.Stats().InFlight)
+	late, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(l.Wait(late), ErrCanceled))
+
+	// a goroutine granted a slot as its context is done gives the slot back.
+	gctx, cancel := context.WithCancel(ctx)
+	_, w, err := l.proceed(gctx)
+	assert.NoError(t, err)
+	l.Finish()
+	cancel()
+	assert.True(t, errors.Is(l.cancel(gctx, w), ErrCanceled))
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_HandoffRace(t *testing.T) {
+	// Finish hands slots over while the timeouts and contexts of the waiting goroutines expire.
+	l := New(2, WithTimeoutDuration(time.Millisecond), WithTimeoutPolicy(RejectOnTimeout))
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i%3)*time.Millisecond)
+			defer cancel()
+			if l.Wait(ctx) == nil {
+				time.Sleep(time.Duration(i%2) * time.Millisecond)
+				l.Finish()
+			}
+		}(i)
+	}
+	wg.Wait()
+	s := l.Stats()
+	assert.Equal(t, 0, s.InFlight)
+	assert.Equal(t, 0, s.Waiting)
+}
+
+func TestConcurrentRateLimiter_StrictFIFO(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var options []Option
+		if strict {
+			options = append(options, WithStrictFIFO())
+		}
+		l := New(2, options...)
+		ctx := context.Background()
+		l.Wait(ctx)
+		l.Wait(ctx)
+		admitted := make(chan struct{})
+		go func() {
+			l.Wait(ctx)
+			close(admitted)
+		}()
+		for l.QueueLen() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		// a slot freed without being handed over , as if one holder was gone.
+		l.mu.Lock()
+		l.addCount(-1)
+		l.mu.Unlock()
+
+		late, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		err := l.Wait(late)
+		cancel()
+		if !strict {
+			assert.NoError(t, err)
+			l.Purge()
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrCanceled))
+		l.Finish()
+		<-admitted
+		assert.Equal(t, 1, l.Stats().InFlight)
+		assert.True(t, l.State().Config.StrictFIFO)
+	}
+}
+
+func TestConcurrentRateLimiter_Unlimited(t *testing.T) {
+	l, err := NewWithValidation(0, WithUnlimited())
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, l.Wait(ctx))
+	}
+	assert.Equal(t, 100, l.Stats().InFlight)
+	assert.Equal(t, 0, l.QueueLen())
+	for i := 0; i < 100; i++ {
+		l.Finish()
+	}
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.True(t, l.Config().Unlimited)
+}
+
+func TestConcurrentRateLimiter_Warmup(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l, err := NewWithValidation(100, WithWarmup(1, 5, 4*time.Second), WithClock(clk))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	l.Wait(ctx)
+	for i := 0; i < 4; i++ {
+		go l.Wait(ctx)
+	}
+	for l.QueueLen() != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	for limit := 2; limit <= 5; limit++ {
+		for clk.Waiters() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(time.Second)
+		for l.QueueLen() != 5-limit {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, limit, l.Limit())
+	}
+	// the warm-up is over.
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 5, l.Stats().InFlight)
+
+	// SetLimit ends the warm-up.
+	l = New(100, WithWarmup(1, 5, 4*time.Second), WithClock(clk))
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.SetLimit(3)
+	clk.Advance(4 * time.Second)
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 3, l.Limit())
+
+	// Close ends the warm-up without waiting for the next step of the ramp.
+	l = New(100, WithWarmup(1, 5, 4*time.Hour), WithClock(clk))
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Close(context.Background())
+	assert.Eventually(t, func() bool { return clk.Waiters() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, l.Limit())
+
+	_, err = NewWithValidation(1, WithWarmup(5, 1, time.Second))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConcurrentRateLimiter_Schedule(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC))
+	l, err := NewWithValidation(5, WithClock(clk), WithSchedule(
+		Profile{Name: "business", Start: 9 * time.Hour, End: 17 * time.Hour, Limit: 2},
+		Profile{Name: "night", Start: 22 * time.Hour, End: 6 * time.Hour, Limit: 10},
+	))
+	assert.NoError(t, err)
+	for _, step := range []struct {
+		advance time.Duration
+		profile string
+		limit   int
+	}{
+		{0, "", 5},
+		{time.Hour, "business", 2},
+		{8 * time.Hour, "", 5},
+		{5 * time.Hour, "night", 10},
+		// past midnight.
+		{8 * time.Hour, "", 5},
+	} {
+		for clk.Waiters() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(step.advance)
+		for l.Stats().Profile != step.profile || l.Limit() != step.limit {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// Close stops the goroutine following the schedule , without waiting for the next boundary.
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Close(context.Background())
+	assert.Eventually(t, func() bool { return clk.Waiters() == 0 }, time.Second, time.Millisecond)
+
+	_, err = NewWithValidation(1, WithSchedule(Profile{Start: time.Hour, End: time.Hour, Limit: 1}))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConcurrentRateLimiter_LimitController(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	samples := make(chan [2]int, 1)
+	controller := LimitControllerFunc(func(inflight, queueLen int, latency time.Duration) int {
+		samples <- [2]int{inflight, queueLen}
+		if queueLen == 0 {
+			return 0
+		}
+		return inflight + queueLen
+	})
+	l, err := NewWithValidation(1, WithLimitController(controller, time.Second), WithClock(clk))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	l.Wait(ctx)
+	for i := 0; i < 2; i++ {
+		go l.Wait(ctx)
+	}
+	for l.QueueLen() != 2 || clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	assert.Equal(t, [2]int{1, 2}, <-samples)
+	for l.QueueLen() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 3, l.Limit())
+
+	// a limit that is not positive leaves the limit unchanged.
+	clk.Advance(time.Second)
+	assert.Equal(t, [2]int{3, 0}, <-samples)
+	assert.Equal(t, 3, l.Limit())
+
+	// Close stops the controller without waiting for the next sample , even before the Limiter is drained.
+	closeCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	l.Close(closeCtx)
+	assert.Eventually(t, func() bool { return clk.Waiters() == 0 }, time.Second, time.Millisecond)
+
+	_, err = NewWithValidation(1, WithLimitController(controller, 0))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+// recorder is a LimitController recording the outcomes and latencies it is passed.
+type recorder struct {
+	mu        sync.Mutex
+	errs      []error
+	latencies chan time.Duration
+}
+
+func (r *recorder) OnResult(err error, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+func (r *recorder) OnSample(inflight, queueLen int, latency time.Duration) int {
+	r.latencies <- latency
+	return 0
+}
+
+func TestPermit_Record(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	r := &recorder{latencies: make(chan time.Duration, 1)}
+	l := New(2, WithLimitController(r, time.Second), WithClock(clk))
+	failed := errors.New("failed")
+	for i, err := range []error{nil, failed, nil} {
+		pm, _ := l.AcquireCtx(context.Background())
+		pm.Release()
+		pm.Record(err, time.Duration(i+1)*time.Second)
+	}
+	s := l.Stats()
+	assert.Equal(t, uint64(2), s.Succeeded)
+	assert.Equal(t, uint64(1), s.Failed)
+	assert.Equal(t, []error{nil, failed, nil}, r.errs)
+
+	// the controller is passed the mean latency of the outcomes recorded since the last sample.
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	assert.Equal(t, 2*time.Second, <-r.latencies)
+	clk.Advance(time.Second)
+	assert.NotEqual(t, 2*time.Second, <-r.latencies)
+}
+
+func TestConcurrentRateLimiter_CircuitBreaker(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l, err := NewWithValidation(2, WithCircuitBreaker(0.5, 4, time.Second), WithClock(clk))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	failed := errors.New("failed")
+	a, _ := l.AcquireCtx(ctx)
+	b, _ := l.AcquireCtx(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the circuit opens once more than half of the last 4 outcomes are failures.
+	a.Record(nil, 0)
+	a.Record(failed, 0)
+	b.Record(failed, 0)
+	assert.Equal(t, "closed", l.Stats().Circuit)
+	b.Record(failed, 0)
+	assert.Equal(t, "open", l.Stats().Circuit)
+	assert.True(t, errors.Is(<-errs, ErrCircuitOpen))
+	err = l.Wait(ctx)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	after, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, after)
+	a.Release()
+	b.Release()
+
+	// after the cool-down , a single goroutine probes the resource.
+	clk.Advance(time.Second)
+	probe, err := l.AcquireCtx(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "half-open", l.Stats().Circuit)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	probe.Record(failed, 0)
+	probe.Release()
+	assert.True(t, errors.Is(<-errs, ErrCircuitOpen))
+	assert.Equal(t, "open", l.Stats().Circuit)
+
+	clk.Advance(time.Second)
+	probe, _ = l.AcquireCtx(ctx)
+	probe.Record(nil, 0)
+	assert.Equal(t, "closed", l.Stats().Circuit)
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, 2, l.Stats().InFlight)
+
+	_, err = NewWithValidation(1, WithCircuitBreaker(1, 4, time.Second))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConcurrentRateLimiter_CircuitBreakerStaleOutcome(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(2, WithCircuitBreaker(0.5, 2, time.Second), WithClock(clk))
+	ctx := context.Background()
+	failed := errors.New("failed")
+	holder, _ := l.AcquireCtx(ctx)
+	other, _ := l.AcquireCtx(ctx)
+	other.Record(failed, 0)
+	other.Record(failed, 0)
+	other.Release()
+	assert.Equal(t, "open", l.Stats().Circuit)
+
+	// after the cool-down , the goroutine admitted before the circuit opened records while the probe waits for it.
+	clk.Advance(time.Second)
+	probes := make(chan *Permit)
+	go func() {
+		pm, err := l.AcquireCtx(ctx)
+		assert.NoError(t, err)
+		probes <- pm
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "half-open", l.Stats().Circuit)
+	holder.Record(nil, 0)
+	assert.Equal(t, "half-open", l.Stats().Circuit)
+	holder.Release()
+
+	// only the outcome of the probe moves the circuit.
+	probe := <-probes
+	probe.Record(failed, 0)
+	assert.Equal(t, "open", l.Stats().Circuit)
+	probe.Release()
+}
+
+func TestConcurrentRateLimiter_FinishN(t *testing.T) {
+	l := New(3)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		l.Wait(ctx)
+	}
+	admitted := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			l.Wait(ctx)
+			admitted <- struct{}{}
+		}()
+	}
+	for l.QueueLen() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	l.FinishN(2)
+	<-admitted
+	<-admitted
+	assert.Equal(t, 1, l.QueueLen())
+	assert.Equal(t, 3, l.Stats().InFlight)
+	l.FinishN(4)
+	<-admitted
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_FastPath(t *testing.T) {
+	l := New(2)
+	ctx := context.Background()
+	// below the limit and without queued goroutines , slots are taken without the mutex.
+	l.mu.Lock()
+	assert.NoError(t, l.Wait(ctx))
+	l.mu.Unlock()
+
+	var inflight, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Wait(ctx)
+				n := atomic.AddInt32(&inflight, 1)
+				for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+				}
+				atomic.AddInt32(&inflight, -1)
+				l.Finish()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), max)
+	assert.Equal(t, 1, l.InFlight())
+	assert.Zero(t, l.QueueLen())
+
+	// a closed Limiter rejects the fast path.
+	l.Finish()
+	l.Close(ctx)
+	assert.Equal(t, ErrClosed, l.Wait(ctx))
+}
+
+func TestConcurrentRateLimiter_Cancel(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	errs := make([]chan error, 2)
+	handles := make([]*Handle, 2)
+	for i := range handles {
+		hctx, h := WithHandle(ctx)
+		handles[i] = h
+		errs[i] = make(chan error, 1)
+		go func(errs chan error) {
+			errs <- l.Wait(hctx)
+		}(errs[i])
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.True(t, l.Cancel(handles[0]))
+	assert.Equal(t, ErrCancelledByLimiter, <-errs[0])
+	assert.False(t, l.Cancel(handles[0]))
+	assert.False(t, New(1).Cancel(handles[1]))
+	assert.Equal(t, 1, handles[1].Position())
+
+	l.Finish()
+	assert.NoError(t, <-errs[1])
+	assert.False(t, l.Cancel(handles[1]))
+}
+
+func TestConcurrentRateLimiter_Close(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	l.Wait(ctx)
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a slot is still held , so the Limiter is not drained.
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.Close(tctx))
+	assert.Equal(t, ErrClosed, <-errs)
+	assert.Equal(t, ErrClosed, l.Wait(ctx))
+
+	closed := make(chan error)
+	go func() {
+		closed <- l.Close(ctx)
+	}()
+	l.Finish()
+	assert.NoError(t, <-closed)
+}
+
+func TestConcurrentRateLimiter_TimeoutDuration(t *testing.T) {
+	l := New(1, WithTimeoutDuration(500*time.Microsecond))
+	assert.Equal(t, 500*time.Microsecond, l.Config().Timeout)
+	ctx := context.Background()
+	l.Wait(ctx)
+	start := time.Now()
+	assert.NoError(t, l.Wait(ctx))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+	assert.Equal(t, 2*time.Second, New(1, WithTimeout(2000)).Config().Timeout)
+}
+
+func TestNewWithValidation(t *testing.T) {
+	l, err := NewWithValidation(2, WithMaxQueueLength(10), WithRejectionPolicy(DropOldest))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, l.Limit())
+
+	invalid := []struct {
+		limit   int
+		options []Option
+	}{
+		{0, nil},
+		{1, []Option{WithTimeoutDuration(0)}},
+		{1, []Option{WithMaxQueueLength(-1)}},
+		{1, []Option{WithRejectionPolicy(BlockCaller)}},
+		{1, []Option{WithAdmissionPolicy(AdmissionPolicy(7))}},
+		{1, []Option{WithAdaptiveLIFO(-1)}},
+		{1, []Option{WithCoDel(5*time.Millisecond, 0)}},
+		{1, []Option{WithMaxHoldDuration(-time.Second, nil)}},
+		{1, []Option{WithFairQueuing(map[string]int{"a": 0})}},
+		{1, []Option{WithFairQueuing(nil), WithAdaptiveLIFO(10)}},
+		{1, []Option{WithStrictFIFO(), WithAdaptiveLIFO(10)}},
+		{1, []Option{WithStrictFIFO(), WithFairQueuing(nil)}},
+	}
+	for _, c := range invalid {
+		l, err := NewWithValidation(c.limit, c.options...)
+		assert.Nil(t, l)
+		assert.True(t, errors.Is(err, ErrInvalidConfig), "%v", err)
+	}
+}
+
+func TestConcurrentRateLimiter_RejectOnTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1,
+		WithTimeoutDuration(20*time.Millisecond),
+		WithTimeoutPolicy(RejectOnTimeout),
+		WithClock(clk),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(19 * time.Millisecond)
+	assert.Equal(t, 1, l.QueueLen())
+	clk.Advance(time.Millisecond)
+	err := <-errs
+	assert.Equal(t, ErrTimeout, err)
+	assert.True(t, IsRejection(err))
+	// the rejected goroutine does not count against the limit.
+	assert.Equal(t, 1, l.Stats().InFlight)
+	assert.Equal(t, 0, l.QueueLen())
+}
+
+func TestConcurrentRateLimiter_TimerWheel(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFake(start)
+	l := New(1,
+		WithTimeoutDuration(25*time.Millisecond),
+		WithTimeoutPolicy(RejectOnTimeout),
+		WithTimerWheel(10*time.Millisecond),
+		WithClock(clk),
+	)
+	assert.Equal(t, 10*time.Millisecond, l.Config().TimerWheelTick)
+	ctx := context.Background()
+	l.Wait(ctx)
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			errs <- l.Wait(ctx)
+		}()
+	}
+	for l.QueueLen() != 3 || clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the timeouts of the queued goroutines share the ticker of the wheel.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, clk.Waiters())
+
+	// the timeouts are rounded up to the tick.
+	for i := 0; i < 3; {
+		clk.Advance(10 * time.Millisecond)
+		time.Sleep(time.Millisecond)
+		for ; len(errs) > 0; i++ {
+			assert.Equal(t, ErrTimeout, <-errs)
+			assert.True(t, clk.Now().Sub(start) >= 30*time.Millisecond)
+		}
+	}
+	assert.Equal(t, 0, l.QueueLen())
+
+	_, err := NewWithValidation(1, WithTimerWheel(-time.Millisecond))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConcurrentRateLimiter_DeadlineAsTimeout(t *testing.T) {
+	l := New(1,
+		WithDeadlineAsTimeout(),
+		WithTimeoutPolicy(RejectOnTimeout),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+	dctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrTimeout, l.Wait(dctx))
+	assert.Equal(t, 1, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_DeadlineAwareRejection(t *testing.T) {
+	l := New(1, WithDeadlineAwareRejection())
+	ctx := context.Background()
+	// the Limiter serves a goroutine every 50ms.
+	for i := 0; i < 3; i++ {
+		l.Wait(ctx)
+		time.Sleep(50 * time.Millisecond)
+		l.Finish()
+	}
+	l.Wait(ctx)
+
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, ErrWaitExceedsDeadline, l.Wait(dctx))
+	assert.Equal(t, 0, l.QueueLen())
+
+	dctx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	go l.Wait(dctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_AcquireCtx(t *testing.T) {
+	l := New(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	pm, err := l.AcquireCtx(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Stats().InFlight)
+
+	cancel()
+	for l.Stats().InFlight != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pm.Release()
+	assert.Equal(t, 0, l.Stats().InFlight)
+
+	pm, err = l.AcquireCtx(context.Background())
+	assert.NoError(t, err)
+	pm.Release()
+	pm.Release()
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_PermitTTL(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	reclaimed := make(chan struct{}, 1)
+	l := New(1,
+		WithClock(clk),
+		WithPermitTTL(time.Second, func() { reclaimed <- struct{}{} }),
+	)
+	pm, err := l.AcquireCtx(context.Background())
+	assert.NoError(t, err)
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	<-reclaimed
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.Equal(t, ErrReclaimed, pm.Renew())
+	assert.Equal(t, ErrReclaimed, pm.KeepAlive(context.Background()))
+	pm.Release()
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.Equal(t, time.Second, l.Config().PermitTTL)
+}
+
+func TestConcurrentRateLimiter_PermitKeepAlive(t *testing.T) {
+	reclaimed := make(chan struct{}, 1)
+	l := New(1, WithPermitTTL(100*time.Millisecond, func() { reclaimed <- struct{}{} }))
+	pm, err := l.AcquireCtx(context.Background())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, pm.KeepAlive(ctx))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, l.Stats().InFlight)
+
+	// the holder stops renewing the lease.
+	cancel()
+	select {
+	case <-reclaimed:
+	case <-time.After(time.Second):
+		t.Fatal("permit not reclaimed")
+	}
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_PermitToken(t *testing.T) {
+	l := New(2)
+	ctx := context.Background()
+	a, err := l.AcquireCtx(ctx)
+	assert.NoError(t, err)
+	b, err := l.AcquireCtx(ctx)
+	assert.NoError(t, err)
+	assert.True(t, a.Token() < b.Token())
+	a.Release()
+	c, err := l.AcquireCtx(ctx)
+	assert.NoError(t, err)
+	assert.True(t, b.Token() < c.Token())
+	b.Release()
+	c.Release()
+}
+
+func TestConcurrentRateLimiter_MaxHoldDuration(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	reclaimed := make(chan struct{}, 1)
+	l := New(1,
+		WithClock(clk),
+		WithMaxHoldDuration(time.Second, func() { reclaimed <- struct{}{} }),
+	)
+	ctx := context.Background()
+	// the holder leaks its slot.
+	assert.NoError(t, l.Wait(ctx))
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	<-reclaimed
+	s := l.Stats()
+	assert.Equal(t, 0, s.InFlight)
+	assert.Equal(t, uint64(1), s.Reclaimed)
+
+	// the late Finish of the reclaimed holder is ignored.
+	l.Finish()
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, 1, l.Stats().InFlight)
+	l.Finish()
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.Equal(t, time.Second, l.Config().MaxHoldDuration)
+}
+
+func TestConcurrentRateLimiter_PermitMaxHold(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1,
+		WithClock(clk),
+		WithMaxHoldDuration(time.Second, nil),
+	)
+	pm, err := l.AcquireCtx(context.Background())
+	assert.NoError(t, err)
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+	<-pm.Context().Done()
+	assert.Equal(t, ErrReclaimed, context.Cause(pm.Context()))
+	assert.Equal(t, ErrReclaimed, pm.Renew())
+	assert.Equal(t, uint64(1), l.Stats().Reclaimed)
+
+	pm, err = l.AcquireCtx(context.Background())
+	assert.NoError(t, err)
+	pm.Release()
+	assert.Equal(t, context.Canceled, context.Cause(pm.Context()))
+	assert.Equal(t, 0, l.Stats().InFlight)
+}
+
+func TestConcurrentRateLimiter_AcquireChan(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	ch := l.AcquireChan(ctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-ch:
+		t.Fatal("acquired above the limit")
+	default:
+	}
+	l.Finish()
+	pm, ok := <-ch
+	assert.True(t, ok)
+	pm.Release()
+
+	// the channel is closed if the goroutine gives up.
+	l = New(1)
+	assert.NoError(t, l.Wait(ctx))
+	cctx, cancel := context.WithCancel(ctx)
+	ch = l.AcquireChan(cctx)
+	cancel()
+	_, ok = <-ch
+	assert.False(t, ok)
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_FairQueuing(t *testing.T) {
+	l := New(1, WithFairQueuing(map[string]int{"a": 2}))
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	var h *Handle
+	// the chatty flow a queues all of its goroutines first.
+	for i, flow := range []string{"a", "a", "a", "a", "a", "a", "b", "b", "b"} {
+		fctx := WithFlow(ctx, flow)
+		if i == 6 {
+			fctx, h = WithHandle(fctx)
+		}
+		wg.Add(1)
+		go func(flow string) {
+			defer wg.Done()
+			if l.Wait(fctx) == nil {
+				mu.Lock()
+				order = append(order, flow)
+				mu.Unlock()
+				l.Finish()
+			}
+		}(flow)
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, 3, h.Position())
+	st := l.State()
+	assert.Equal(t, "b", st.Waiters[2].Flow)
+	assert.True(t, st.Config.FairQueuing)
+
+	l.Finish()
+	wg.Wait()
+	assert.Equal(t, []string{"a", "a", "b", "a", "a", "b", "a", "a", "b"}, order)
+}
+
+func TestConcurrentRateLimiter_RandomEarlyDetection(t *testing.T) {
+	l, err := NewWithValidation(1, WithMaxQueueLength(4), WithRandomEarlyDetection(2))
+	assert.NoError(t, err)
+	var draw float64
+	l.random = func() float64 { return draw }
+	ctx := context.Background()
+	l.Wait(ctx)
+	// arrive queues a goroutine if it is not rejected.
+	arrive := func() error {
+		errs := make(chan error, 1)
+		n := l.QueueLen()
+		go func() {
+			if err := l.Wait(ctx); err != nil {
+				errs <- err
+			}
+		}()
+		for l.QueueLen() == n {
+			select {
+			case err := <-errs:
+				return err
+			default:
+				time.Sleep(time.Millisecond)
+			}
+		}
+		return nil
+	}
+
+	// below the threshold , goroutines are never rejected.
+	draw = 0
+	assert.NoError(t, arrive())
+	assert.NoError(t, arrive())
+	// the probability of rejection rises from 0 at the threshold to 1 at the max queue length.
+	assert.NoError(t, arrive())
+	draw = 0.4
+	assert.Equal(t, ErrRejectedEarly, arrive())
+	draw = 0.6
+	assert.NoError(t, arrive())
+	assert.Equal(t, ErrQueueFull, arrive())
+	assert.Equal(t, 2, l.Config().REDThreshold)
+
+	_, err = NewWithValidation(1, WithRandomEarlyDetection(2))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	_, err = NewWithValidation(1, WithMaxQueueLength(2), WithRandomEarlyDetection(2))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+}
+
+func TestConcurrentRateLimiter_Allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector makes sync.Pool drop waiters")
+	}
+	l := New(1)
+	ctx := context.Background()
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		l.Wait(ctx)
+		l.Finish()
+	}))
+	// a queued goroutine reuses a pooled waiter and its channel.
+	l.Wait(ctx)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		_, w, _ := l.proceed(ctx)
+		l.Finish()
+		<-w.done
+		recycle(w)
+	}))
+}
+
+func TestConcurrentRateLimiter_InFlightAndQueueLen(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	go l.Wait(ctx)
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 1, l.InFlight())
+	assert.Equal(t, 1, l.Limit())
+	l.Finish()
+	assert.Zero(t, l.QueueLen())
+	assert.Equal(t, 1, l.InFlight())
+	l.Finish()
+	assert.Zero(t, l.InFlight())
+	assert.Zero(t, l.QueueLen())
+}
+
+func TestConcurrentRateLimiter_OldestWaitAge(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1, WithClock(clk))
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	assert.Zero(t, l.OldestWaitAge())
+	for i := 0; i < 2; i++ {
+		go l.Wait(ctx)
+		for l.QueueLen() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(time.Second)
+	}
+	assert.Equal(t, 2*time.Second, l.OldestWaitAge())
+	assert.Equal(t, 2*time.Second, l.Stats().OldestWait)
+	assert.Equal(t, 2.0, l.State().OldestWaitSeconds)
+	// the oldest goroutine is served , the next one has been waiting for a second.
+	l.Finish()
+	assert.Equal(t, time.Second, l.OldestWaitAge())
+	l.Finish()
+	assert.Zero(t, l.OldestWaitAge())
+}
+
+func TestConcurrentRateLimiter_String(t *testing.T) {
+	l := New(2, WithTimeoutDuration(500*time.Millisecond), WithTimeoutPolicy(RejectOnTimeout),
+		WithMaxQueueLength(10), WithRejectionPolicy(DropOldest))
+	assert.NoError(t, l.Wait(context.Background()))
+	l.Pause()
+	want := "limiter limit=2 in_flight=1 waiting=0 paused=true timeout=500ms timeout_policy=RejectOnTimeout max_queue_length=10 rejection_policy=DropOldest"
+	assert.Equal(t, want, l.String())
+	assert.Equal(t, want, fmt.Sprint(l))
+
+	var b bytes.Buffer
+	slog.New(slog.NewTextHandler(&b, nil)).Info("acquired", "limiter", l)
+	assert.Contains(t, b.String(), "limiter.kind=limiter limiter.limit=2 limiter.in_flight=1")
+
+	data, err := json.Marshal(l)
+	assert.NoError(t, err)
+	var st State
+	assert.NoError(t, json.Unmarshal(data, &st))
+	assert.Equal(t, 1, st.InFlight)
+	assert.Equal(t, 10, *st.Config.MaxQueueLength)
+	l.Resume()
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_EstimatedWait(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1, WithClock(clk))
+	ctx := context.Background()
+	d, ok := l.EstimatedWait()
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	l.Wait(ctx)
+	_, ok = l.EstimatedWait()
+	assert.False(t, ok)
+	l.Finish()
+	clk.Advance(100 * time.Millisecond)
+	l.Wait(ctx)
+	l.Finish()
+	l.Wait(ctx)
+	d, ok = l.EstimatedWait()
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, d)
+
+	for i := 0; i < 2; i++ {
+		go l.Wait(ctx)
+	}
+	for l.QueueLen() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	d, _ = l.EstimatedWait()
+	assert.Equal(t, 300*time.Millisecond, d)
+	l.FinishN(3)
 }
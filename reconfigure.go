@@ -0,0 +1,47 @@
+package limiter
+
+import "time"
+
+// SetTimeout changes the timeout of the goroutines calling Wait from now on and the policy applied when it
+// expires. A zero timeout removes it. The goroutines already in the waitlist keep the timeout they started with.
+// SetTimeout returns an error wrapping ErrInvalidConfig , and changes nothing , if the settings contradict the
+// configuration.
+func (l *Limiter) SetTimeout(timeout time.Duration, policy TimeoutPolicy) error {
+	return l.reconfigure(func(c *config) {
+		c.timeout = nil
+		if timeout != 0 {
+			c.timeout = &timeout
+		}
+		c.timeoutPolicy = policy
+	})
+}
+
+// SetMaxQueueLength changes the max length of the waitlist and the policy applied when it is full , see
+// WithMaxQueueLength and WithRejectionPolicy. A negative length removes the bound. Goroutines already in the waitlist
+// stay there when the bound is lowered below the length of the waitlist. SetMaxQueueLength returns an error wrapping
+// ErrInvalidConfig , and changes nothing , if the settings contradict the configuration.
+func (l *Limiter) SetMaxQueueLength(maxQueueLength int, policy RejectionPolicy) error {
+	return l.reconfigure(func(c *config) {
+		c.maxQueueLength = nil
+		if maxQueueLength >= 0 {
+			c.maxQueueLength = &maxQueueLength
+		}
+		c.rejectionPolicy = policy
+	})
+}
+
+// reconfigure publishes the settings changed by update if they are valid. The goroutines blocked until there is
+// room in the waitlist are woken , the bound may have been raised.
+func (l *Limiter) reconfigure(update func(c *config)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := *l.config()
+	update(&c)
+	if err := c.validate(); err != nil {
+		return err
+	}
+	l.cfg.Store(&c)
+	l.version.Add(1)
+	l.notifyRoom()
+	return nil
+}
@@ -0,0 +1,56 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentRateLimiter_SetTimeout(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.SetTimeout(10*time.Millisecond, RejectOnTimeout))
+	assert.Equal(t, 10*time.Millisecond, l.Config().Timeout)
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, ErrTimeout, l.Wait(ctx))
+
+	// a policy without timeout is a contradiction , nothing is changed.
+	err := l.SetTimeout(0, RejectOnTimeout)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.Equal(t, 10*time.Millisecond, l.Config().Timeout)
+
+	assert.NoError(t, l.SetTimeout(0, AdmitOnTimeout))
+	assert.Zero(t, l.Config().Timeout)
+	l.Finish()
+}
+
+func TestConcurrentRateLimiter_SetMaxQueueLength(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	assert.NoError(t, l.SetMaxQueueLength(0, RejectNew))
+	assert.Equal(t, ErrQueueFull, l.Wait(ctx))
+
+	err := l.SetMaxQueueLength(-1, DropOldest)
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+	assert.Equal(t, 0, l.Config().MaxQueueLength)
+
+	// goroutines blocked until there is room are let in when the bound is raised.
+	assert.NoError(t, l.SetMaxQueueLength(0, BlockCaller))
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, l.QueueLen())
+	assert.NoError(t, l.SetMaxQueueLength(-1, RejectNew))
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	assert.NoError(t, <-errs)
+	l.Finish()
+}
@@ -0,0 +1,175 @@
+// Package registry keeps track of limiters by name , so they can be reported on and managed uniformly.
+package registry
+
+import (
+	"errors"
+	"iter"
+	"sort"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// maxCollectAttempts bounds the number of passes CollectAll makes to get a consistent snapshot.
+const maxCollectAttempts = 10
+
+// ErrDuplicate is returned by Register when a limiter is already registered under the name.
+var ErrDuplicate = errors.New("registry: a limiter is already registered under this name")
+
+// StatsProvider is implemented by *limiter.Limiter and *priority.PriorityLimiter.
+type StatsProvider interface {
+	Stats() limiter.Stats
+}
+
+// Registry holds limiters registered by name. The zero value is not usable , create one with New.
+type Registry struct {
+	mu       sync.RWMutex
+	limiters map[string]StatsProvider
+}
+
+// New creates an empty *Registry.
+func New() *Registry {
+	return &Registry{
+		limiters: make(map[string]StatsProvider),
+	}
+}
+
+// Register adds l to the registry under name. It returns ErrDuplicate if the name is taken.
+func (r *Registry) Register(name string, l StatsProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.limiters[name]; ok {
+		return ErrDuplicate
+	}
+	r.limiters[name] = l
+	return nil
+}
+
+// Unregister removes the limiter registered under name , if any.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.limiters, name)
+}
+
+// Get returns the limiter registered under name.
+func (r *Registry) Get(name string) (StatsProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l, ok := r.limiters[name]
+	return l, ok
+}
+
+// Names returns the sorted names of the registered limiters.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.limiters))
+	for name := range r.limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All returns the registered limiters with their name , in the order of their names. Limiters registered or
+// unregistered while iterating may or may not be seen.
+func (r *Registry) All() iter.Seq2[string, StatsProvider] {
+	return func(yield func(string, StatsProvider) bool) {
+		for _, name := range r.Names() {
+			if l, ok := r.Get(name); ok && !yield(name, l) {
+				return
+			}
+		}
+	}
+}
+
+// Default is the registry used by the package level functions , so limiters can be registered where they are
+// created and looked up by name anywhere else , for example by the admin and debug handlers.
+var Default = New()
+
+// Register adds l to the Default registry under name. It returns ErrDuplicate if the name is taken.
+func Register(name string, l StatsProvider) error {
+	return Default.Register(name, l)
+}
+
+// Unregister removes the limiter registered under name in the Default registry , if any.
+func Unregister(name string) {
+	Default.Unregister(name)
+}
+
+// Get returns the limiter registered under name in the Default registry.
+func Get(name string) (StatsProvider, bool) {
+	return Default.Get(name)
+}
+
+// Lookup returns the limiter registered under name in r if it is a T , typically *limiter.Limiter or
+// *priority.PriorityLimiter:
+//
+//	l, ok := registry.Lookup[*limiter.Limiter](registry.Default, "db-writes")
+func Lookup[T StatsProvider](r *Registry, name string) (T, bool) {
+	l, _ := r.Get(name)
+	t, ok := l.(T)
+	return t, ok
+}
+
+// Snapshot holds the Stats of every registered limiter at a single point in time.
+//
+// Consistent is false if the limiters kept changing while they were collected , in which case
+// Stats may mix states observed at slightly different times.
+type Snapshot struct {
+	Time       time.Time
+	Consistent bool
+	Stats      map[string]limiter.Stats
+}
+
+// CollectAll gathers the Stats of every registered limiter in one consistent pass.
+//
+// Limiters are collected twice in a row. If no limiter changed in between , all the Stats describe the
+// state of the limiters at the instant separating both passes , which is reported as the snapshot Time.
+// Otherwise the collection is retried a few times before giving up and returning the last pass with
+// Consistent set to false. No limiter is locked for longer than a single call to Stats.
+func (r *Registry) CollectAll() Snapshot {
+	r.mu.RLock()
+	limiters := make(map[string]StatsProvider, len(r.limiters))
+	for name, l := range r.limiters {
+		limiters[name] = l
+	}
+	r.mu.RUnlock()
+
+	collect := func() map[string]limiter.Stats {
+		stats := make(map[string]limiter.Stats, len(limiters))
+		for name, l := range limiters {
+			stats[name] = l.Stats()
+		}
+		return stats
+	}
+
+	prev := collect()
+	for attempt := 0; attempt < maxCollectAttempts; attempt++ {
+		at := time.Now()
+		cur := collect()
+		if unchanged(prev, cur) {
+			return Snapshot{
+				Time:       at,
+				Consistent: true,
+				Stats:      cur,
+			}
+		}
+		prev = cur
+	}
+	return Snapshot{
+		Time:  time.Now(),
+		Stats: prev,
+	}
+}
+
+func unchanged(prev, cur map[string]limiter.Stats) bool {
+	for name, s := range cur {
+		if prev[name].Version != s.Version {
+			return false
+		}
+	}
+	return true
+}
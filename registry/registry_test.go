@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New()
+	db := limiter.New(2)
+	assert.NoError(t, r.Register("db", db))
+	assert.NoError(t, r.Register("api", priority.NewLimiter(3)))
+	assert.Equal(t, ErrDuplicate, r.Register("db", limiter.New(1)))
+
+	l, ok := r.Get("db")
+	assert.True(t, ok)
+	assert.Equal(t, db, l)
+	assert.Equal(t, []string{"api", "db"}, r.Names())
+
+	r.Unregister("api")
+	_, ok = r.Get("api")
+	assert.False(t, ok)
+}
+
+func TestRegistry_CollectAll(t *testing.T) {
+	r := New()
+	parent := limiter.New(10)
+	child := limiter.New(5)
+	r.Register("parent", parent)
+	r.Register("child", child)
+
+	ctx := context.Background()
+	parent.Wait(ctx)
+	child.Wait(ctx)
+
+	s := r.CollectAll()
+	assert.True(t, s.Consistent)
+	assert.False(t, s.Time.IsZero())
+	assert.Equal(t, 1, s.Stats["parent"].InFlight)
+	assert.Equal(t, 5, s.Stats["child"].Limit)
+}
+
+func TestRegistry_CollectAllUnderChurn(t *testing.T) {
+	r := New()
+	l := limiter.New(1)
+	r.Register("busy", l)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.Wait(context.Background())
+				l.Finish()
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		s := r.CollectAll()
+		assert.Contains(t, s.Stats, "busy")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestRegistry_Default(t *testing.T) {
+	db := limiter.New(2)
+	assert.NoError(t, Register("db-writes", db))
+	defer Unregister("db-writes")
+	assert.Equal(t, ErrDuplicate, Register("db-writes", db))
+
+	l, ok := Get("db-writes")
+	assert.True(t, ok)
+	assert.Equal(t, db, l)
+	typed, ok := Lookup[*limiter.Limiter](Default, "db-writes")
+	assert.True(t, ok)
+	assert.Same(t, db, typed)
+	_, ok = Lookup[*priority.PriorityLimiter](Default, "db-writes")
+	assert.False(t, ok)
+	_, ok = Lookup[*limiter.Limiter](Default, "cache")
+	assert.False(t, ok)
+}
+
+func TestRegistry_All(t *testing.T) {
+	r := New()
+	r.Register("b", limiter.New(1))
+	r.Register("a", priority.NewLimiter(1))
+	var names []string
+	for name, l := range r.All() {
+		names = append(names, name)
+		assert.NotNil(t, l)
+	}
+	assert.Equal(t, []string{"a", "b"}, names)
+}
@@ -0,0 +1,46 @@
+package limiter
+
+import "time"
+
+// ResultObserver is implemented by the LimitControllers learning from the outcome of the work done under the
+// slots of the Limiter , for example to lower the limit when errors increase. See Permit.Record.
+type ResultObserver interface {
+	// OnResult is called by Permit.Record with the error the work returned , nil if it succeeded , and the time it
+	// took.
+	OnResult(err error, latency time.Duration)
+}
+
+// results accumulates the outcomes recorded since the last sample of the limit controller.
+type results struct {
+	count   int
+	latency time.Duration
+}
+
+// Record reports the outcome of the work done under the permit: err is nil if the work succeeded and latency is
+// the time it took. Outcomes are counted in Stats and passed on to the limit controller if it is a ResultObserver.
+// While outcomes are recorded , the latency passed to LimitController.OnSample is their mean instead of the
+// estimate derived from the rate at which slots are given back. Outcomes also feed the circuit breaker configured
+// with WithCircuitBreaker. Record can be called after Release.
+func (pm *Permit) Record(err error, latency time.Duration) {
+	l := pm.l
+	l.mu.Lock()
+	if err != nil {
+		l.failed++
+	} else {
+		l.succeeded++
+	}
+	l.results.count++
+	l.results.latency += latency
+	l.recordOutcome(err != nil, pm.token)
+	l.mu.Unlock()
+	if o, ok := l.config().controller.(ResultObserver); ok {
+		o.OnResult(err, latency)
+	}
+}
+
+// takeResults returns the outcomes recorded since the last call and starts a new window. The mutex must be held.
+func (l *Limiter) takeResults() results {
+	r := l.results
+	l.results = results{}
+	return r
+}
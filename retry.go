@@ -0,0 +1,155 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy configures the exponential backoff used by RetryUnderLimit and WaitWithRetry.
+//
+// MaxAttempts: max number of attempts , zero means retry until the context is done
+//
+// InitialBackoff: time to wait after the first failed attempt , defaults to 10ms
+//
+// MaxBackoff: upper bound for the time to wait between two attempts , zero means no bound
+//
+// Multiplier: factor applied to the backoff after each failed attempt , defaults to 2
+//
+// Jitter: fraction of the backoff , between 0 and 1 , removed at random from every wait so goroutines rejected
+// together don't retry in lockstep , zero means no jitter
+//
+// Retryable: decides whether an error returned by the retried function should be retried , nil means
+// every error is retried. Rejections by the limiter are always retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	Retryable      func(err error) bool
+}
+
+// backoff returns the time to wait after the given number of failed attempts.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	m := p.Multiplier
+	if m < 1 {
+		m = 2
+	}
+	for i := 1; i < attempt; i++ {
+		d = time.Duration(float64(d) * m)
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// sleep waits after the given number of failed attempts , the last of which failed with err , or until ctx is
+// done , in which case it returns the context error. The backoff is jittered , and extended to the RetryAfter hint
+// carried by err if it is longer.
+func (p RetryPolicy) sleep(ctx context.Context, attempt int, err error) error {
+	d := Jitter(p.backoff(attempt), p.Jitter)
+	if hint, ok := RetryAfter(err); ok && hint > d {
+		d = hint
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RetryAfterError wraps a rejection with a hint of how long the caller should wait before trying again.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error() + " (retry after " + e.After.String() + ")"
+}
+
+// Unwrap returns the wrapped rejection , so errors.Is(err, ErrShed) keeps working.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns the hint carried by err , if any.
+func RetryAfter(err error) (time.Duration, bool) {
+	var r *RetryAfterError
+	if errors.As(err, &r) {
+		return r.After, true
+	}
+	return 0, false
+}
+
+// IsRejection reports whether err means the limiter refused to let the goroutine access the resource
+// because of overload , as opposed to a context error.
+func IsRejection(err error) bool {
+	return errors.Is(err, ErrQueueFull) || errors.Is(err, ErrDropped) || errors.Is(err, ErrShed) || errors.Is(err, ErrPurged) ||
+		errors.Is(err, ErrTimeout) || errors.Is(err, ErrWaitExceedsDeadline) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, ErrRejectedEarly)
+}
+
+// RetryUnderLimit calls fn while holding a slot of l , retrying with exponential backoff when l rejects the
+// goroutine or fn fails. The slot is released between attempts , so no capacity is held while backing off.
+// If a rejection carries a RetryAfter hint longer than the backoff , the hint is honoured.
+//
+// RetryUnderLimit returns nil as soon as an attempt succeeds , and otherwise the error of the last attempt , or
+// the context error if the context is done while waiting.
+func RetryUnderLimit(ctx context.Context, l Waiter, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := l.Wait(ctx)
+		if err == nil {
+			err = fn(ctx)
+			l.Finish()
+			if err == nil {
+				return nil
+			}
+			if policy.Retryable != nil && !policy.Retryable(err) {
+				return err
+			}
+		} else if !IsRejection(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		if err := policy.sleep(ctx, attempt, err); err != nil {
+			return err
+		}
+	}
+}
+
+// WaitWithRetry waits like Wait , retrying with the exponential backoff of policy when the Limiter rejects the
+// goroutine , see IsRejection. Clients of a Limiter with a bounded waitlist can thus wait for room without
+// retrying by hand. Retryable is ignored: only rejections are retried.
+//
+// WaitWithRetry returns nil once an attempt is admitted , the caller must then call Finish. Otherwise it returns
+// the rejection of the last attempt , the error of Wait if it is not a rejection , or the context error if the
+// context is done while backing off.
+func (l *Limiter) WaitWithRetry(ctx context.Context, policy RetryPolicy) error {
+	for attempt := 1; ; attempt++ {
+		err := l.Wait(ctx)
+		if err == nil || !IsRejection(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		if err := policy.sleep(ctx, attempt, err); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+	}
+	assert.Equal(t, 10*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, p.backoff(4))
+}
+
+func TestRetryUnderLimit_ReleasesSlotBetweenAttempts(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	errFlaky := errors.New("flaky")
+
+	attempts := 0
+	err := RetryUnderLimit(ctx, l, RetryPolicy{InitialBackoff: time.Millisecond}, func(ctx context.Context) error {
+		attempts++
+		assert.Equal(t, 1, l.Stats().InFlight)
+		if attempts < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Zero(t, l.Stats().InFlight)
+}
+
+func TestRetryUnderLimit_Rejections(t *testing.T) {
+	l := New(1,
+		WithMaxQueueLength(0),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	calls := 0
+	err := RetryUnderLimit(ctx, l, RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, ErrQueueFull, err)
+	assert.Zero(t, calls)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.Finish()
+	}()
+	err = RetryUnderLimit(ctx, l, RetryPolicy{InitialBackoff: 5 * time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryUnderLimit_NotRetryable(t *testing.T) {
+	l := New(1)
+	errFatal := errors.New("fatal")
+	policy := RetryPolicy{
+		Retryable: func(err error) bool {
+			return err != errFatal
+		},
+	}
+	calls := 0
+	err := RetryUnderLimit(context.Background(), l, policy, func(ctx context.Context) error {
+		calls++
+		return errFatal
+	})
+	assert.Equal(t, errFatal, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryAfter(t *testing.T) {
+	_, ok := RetryAfter(ErrQueueFull)
+	assert.False(t, ok)
+	err := &RetryAfterError{Err: ErrShed, After: time.Second}
+	d, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, d)
+	assert.True(t, IsRejection(err))
+	assert.False(t, IsRejection(context.Canceled))
+}
+
+func TestWaitWithRetry(t *testing.T) {
+	l := New(1, WithMaxQueueLength(0))
+	ctx := context.Background()
+	l.Wait(ctx)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Jitter: 0.5}
+	assert.Equal(t, ErrQueueFull, l.WaitWithRetry(ctx, policy))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		l.Finish()
+	}()
+	policy.MaxAttempts = 0
+	assert.NoError(t, l.WaitWithRetry(ctx, policy))
+	assert.Equal(t, 1, l.Stats().InFlight)
+
+	// the retries are bounded by the context.
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.WaitWithRetry(cctx, policy))
+}
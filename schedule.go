@@ -0,0 +1,100 @@
+package limiter
+
+import "time"
+
+// Profile is a limit applied during a daily time window , see WithSchedule.
+//
+// Name: reported by Stats while the profile is in effect
+//
+// Start , End: time of day the profile starts and ends , as offsets from midnight in the location of the times
+// returned by the clock. The profile applies from Start included to End excluded , and wraps around midnight if
+// End is before Start.
+//
+// Limit: max number of concurrent goroutines while the profile is in effect
+type Profile struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+	Limit int
+}
+
+// covers reports whether the profile is in effect at the time of day tod.
+func (p Profile) covers(tod time.Duration) bool {
+	if p.Start <= p.End {
+		return tod >= p.Start && tod < p.End
+	}
+	return tod >= p.Start || tod < p.End
+}
+
+// timeOfDay returns the time elapsed since midnight at t.
+func timeOfDay(t time.Time) time.Duration {
+	y, m, d := t.Date()
+	return t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+}
+
+// active returns the first profile of the schedule in effect at t , or nil.
+func active(schedule []Profile, t time.Time) *Profile {
+	tod := timeOfDay(t)
+	for i := range schedule {
+		if schedule[i].covers(tod) {
+			return &schedule[i]
+		}
+	}
+	return nil
+}
+
+// nextBoundary returns how long after t a profile of the schedule starts or ends next.
+func nextBoundary(schedule []Profile, t time.Time) time.Duration {
+	tod := timeOfDay(t)
+	next := 24 * time.Hour
+	for _, p := range schedule {
+		for _, b := range []time.Duration{p.Start, p.End} {
+			d := b - tod
+			if d <= 0 {
+				d += 24 * time.Hour
+			}
+			if d < next {
+				next = d
+			}
+		}
+	}
+	return next
+}
+
+// followSchedule applies the limit of the profile in effect , or the limit the Limiter was created with outside of
+// the profiles , whenever a profile starts or ends , until the Limiter is closed.
+func (l *Limiter) followSchedule() {
+	c := l.config()
+	base := c.limit
+	for {
+		now := c.clock.Now()
+		limit, name := base, ""
+		if p := active(c.schedule, now); p != nil {
+			limit, name = p.Limit, p.Name
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return
+		}
+		old := l.config().limit
+		l.updateConfig(func(c *config) {
+			c.limit = limit
+		})
+		l.profile = name
+		l.version.Add(1)
+		l.admit()
+		l.mu.Unlock()
+		if limit != old {
+			l.emit(EventLimitChange, 0, nil)
+		}
+
+		t := c.clock.NewTimer(nextBoundary(c.schedule, now))
+		select {
+		case <-t.C():
+		case <-l.stop:
+			t.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package semaphore adapts the limiters of this module to the API of golang.org/x/sync/semaphore , so code using
+// semaphore.Weighted can switch to them , and gain priorities , timeouts and metrics , without rewriting its call
+// sites:
+//
+//	sem := semaphore.NewWeighted(10 , limiter.WithTimeoutDuration(time.Second))
+//	if err := sem.Acquire(ctx , 1); err != nil {
+//		return err
+//	}
+//	defer sem.Release(1)
+//
+// Each unit of weight is a slot of the limiter. A weight above one is acquired one slot at a time , and a single
+// acquisition of several slots is in progress at any time , so two of them never hold part of the slots the other
+// waits for. Acquisitions of a single slot don't wait for their turn.
+package semaphore
+
+import (
+	"context"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// Weighted provides a way to bound concurrent access to a resource , with the methods of semaphore.Weighted.
+//
+// turn: held by the goroutine acquiring several slots
+type Weighted struct {
+	l    limiter.Waiter
+	turn chan struct{}
+}
+
+// New creates a *Weighted acquiring the slots of l. Use priority.AtPriority to acquire the slots of a priority
+// limiter with a given priority.
+func New(l limiter.Waiter) *Weighted {
+	return &Weighted{l: l, turn: make(chan struct{}, 1)}
+}
+
+// NewWeighted creates a *Weighted with a *limiter.Limiter of n slots configured with the options , like
+// semaphore.NewWeighted.
+func NewWeighted(n int64, options ...limiter.Option) *Weighted {
+	return New(limiter.New(int(n), options...))
+}
+
+// Acquire acquires the semaphore with a weight of n , blocking until resources are available or ctx is done. On
+// success , it returns nil. On failure , it returns the error of Wait , matching ctx.Err() if ctx is done , and
+// leaves the semaphore unchanged.
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	if n > 1 {
+		select {
+		case s.turn <- struct{}{}:
+			defer func() { <-s.turn }()
+		case <-ctx.Done():
+			return limiter.Canceled(ctx)
+		}
+	}
+	for i := int64(0); i < n; i++ {
+		if err := s.l.Wait(ctx); err != nil {
+			s.Release(i)
+			return err
+		}
+	}
+	return nil
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On success , it returns true. On failure ,
+// it returns false and leaves the semaphore unchanged. The slots are taken with limiter.TryWait , which never enters
+// the waitlist of *limiter.Limiter and of the adapters of priority.AtPriority.
+func (s *Weighted) TryAcquire(n int64) bool {
+	if n > 1 {
+		select {
+		case s.turn <- struct{}{}:
+			defer func() { <-s.turn }()
+		default:
+			return false
+		}
+	}
+	for i := int64(0); i < n; i++ {
+		if !limiter.TryWait(s.l) {
+			s.Release(i)
+			return false
+		}
+	}
+	return true
+}
+
+// Release releases the semaphore with a weight of n , giving n slots back to the limiter.
+func (s *Weighted) Release(n int64) {
+	if l, ok := s.l.(interface{ FinishN(n int) }); ok {
+		l.FinishN(int(n))
+		return
+	}
+	for i := int64(0); i < n; i++ {
+		s.l.Finish()
+	}
+}
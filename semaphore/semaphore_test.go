@@ -0,0 +1,100 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func TestWeighted(t *testing.T) {
+	l := limiter.New(3)
+	sem := New(l)
+	ctx := context.Background()
+	assert.NoError(t, sem.Acquire(ctx, 2))
+	assert.False(t, sem.TryAcquire(2))
+	assert.Equal(t, 2, l.InFlight())
+	assert.Equal(t, 0, l.QueueLen())
+	assert.True(t, sem.TryAcquire(1))
+	assert.Equal(t, 3, l.InFlight())
+
+	// a failed acquisition leaves the semaphore unchanged.
+	sem.Release(1)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := sem.Acquire(cctx, 2)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 2, l.InFlight())
+
+	sem.Release(2)
+	assert.True(t, sem.TryAcquire(3))
+	sem.Release(3)
+	assert.Equal(t, 0, l.InFlight())
+}
+
+func TestWeighted_TryAcquireDoesNotQueue(t *testing.T) {
+	for name, w := range map[string]func() (limiter.Waiter, func() int){
+		"limiter": func() (limiter.Waiter, func() int) {
+			l := limiter.New(1, limiter.WithMaxQueueLength(1), limiter.WithRejectionPolicy(limiter.DropOldest))
+			return l, l.QueueLen
+		},
+		"priority": func() (limiter.Waiter, func() int) {
+			nl := priority.NewLimiter(1, priority.WithMaxQueueLength(1), priority.WithRejectionPolicy(limiter.DropOldest))
+			return priority.AtPriority(nl, priority.High), nl.QueueLen
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l, queueLen := w()
+			sem := New(l)
+			ctx := context.Background()
+			assert.NoError(t, sem.Acquire(ctx, 1))
+			errs := make(chan error)
+			go func() { errs <- sem.Acquire(ctx, 1) }()
+			for queueLen() != 1 {
+				time.Sleep(time.Millisecond)
+			}
+
+			// a failed TryAcquire neither enters the waitlist nor drops the queued acquisition.
+			assert.False(t, sem.TryAcquire(1))
+			assert.Equal(t, 1, queueLen())
+			sem.Release(1)
+			assert.NoError(t, <-errs)
+			sem.Release(1)
+		})
+	}
+}
+
+func TestWeighted_Blocks(t *testing.T) {
+	sem := NewWeighted(2)
+	ctx := context.Background()
+	assert.NoError(t, sem.Acquire(ctx, 2))
+	acquired := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 2)
+		close(acquired)
+	}()
+	sem.Release(1)
+	select {
+	case <-acquired:
+		t.Fatal("acquired with a single free slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	sem.Release(1)
+	<-acquired
+	sem.Release(2)
+}
+
+func TestWeighted_Priority(t *testing.T) {
+	nl := priority.NewLimiter(2)
+	sem := New(priority.AtPriority(nl, priority.High))
+	assert.NoError(t, sem.Acquire(context.Background(), 2))
+	assert.Equal(t, 2, nl.InFlight())
+	assert.False(t, sem.TryAcquire(1))
+	assert.Equal(t, 0, nl.QueueLen())
+	sem.Release(2)
+	assert.Equal(t, 0, nl.InFlight())
+}
@@ -0,0 +1,279 @@
+// Package sharded implements a limiter splitting its limit across shards , for process-wide limits on hot paths
+// where the mutex of limiter.Limiter dominates:
+//
+//	nl := sharded.New(1000 , sharded.WithSharding(runtime.GOMAXPROCS(0)))
+//	if err := nl.Wait(ctx); err != nil {
+//		return err
+//	}
+//	defer nl.Finish()
+//
+// Every goroutine first tries the shard of the processor it runs on , so goroutines running on different
+// processors rarely touch the same memory. A goroutine finding its shard full takes a slot from another shard ,
+// and only waits once every shard is full. The shares of the limit are rebalanced periodically towards the shards
+// in demand.
+//
+// The trade-off is exactness: the Limiter has no waitlist , waiting goroutines are woken together and race for
+// the freed slots in no particular order , and while shares are rebalanced the number of goroutines accessing the
+// resource can briefly exceed the limit by the capacity moved between shards. Timeouts , queue bounds and the
+// other options of limiter.Limiter are not available.
+package sharded
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+var _ limiter.Waiter = (*Limiter)(nil)
+
+// shard holds a share of the limit. It is padded to a cache line , so shards don't share one.
+//
+// count: number of goroutines holding a slot of the shard
+//
+// limit: share of the limit of the Limiter
+//
+// demand: number of goroutines that tried the shard first since the last rebalancing
+type shard struct {
+	count  atomic.Int64
+	limit  atomic.Int64
+	demand atomic.Int64
+	_      [40]byte
+}
+
+// Limiter is a limiter.Waiter splitting its limit across shards.
+//
+// limit: max number of concurrent goroutines that can access the resource
+//
+// rebalancePeriod: min time between two rebalancings of the shares
+//
+// homes: pool of shard indexes , the pool keeps them per processor so goroutines on a processor share a shard
+//
+// waiting , wake: number of goroutines waiting for a slot and the channel closed to wake them
+type Limiter struct {
+	shards          []shard
+	limit           atomic.Int64
+	rebalancePeriod time.Duration
+	lastRebalance   atomic.Int64
+	mu              sync.Mutex
+	homes           sync.Pool
+	nextHome        atomic.Uint32
+
+	waiting atomic.Int64
+	wakeMu  sync.Mutex
+	wake    chan struct{}
+}
+
+type Option func(*Limiter)
+
+// shards: number of shards the limit is split across. Defaults to GOMAXPROCS , more shards than processors only
+// spread the limit thinner.
+func WithSharding(shards int) func(*Limiter) {
+	return func(l *Limiter) {
+		if shards > 0 {
+			l.shards = make([]shard, shards)
+		}
+	}
+}
+
+// rebalancePeriod: min time between two rebalancings of the shares of the limit. Defaults to 100ms. Rebalancing
+// happens when a goroutine finds its shard full , so an idle Limiter does no work.
+func WithRebalancePeriod(rebalancePeriod time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.rebalancePeriod = rebalancePeriod
+	}
+}
+
+// New creates a *Limiter. Configure the Limiter with the options specified.
+func New(limit int, options ...Option) *Limiter {
+	l := &Limiter{
+		rebalancePeriod: 100 * time.Millisecond,
+		wake:            make(chan struct{}),
+	}
+	for _, o := range options {
+		o(l)
+	}
+	if l.shards == nil {
+		l.shards = make([]shard, runtime.GOMAXPROCS(0))
+	}
+	l.homes.New = func() any {
+		home := int(l.nextHome.Add(1)-1) % len(l.shards)
+		return &home
+	}
+	l.lastRebalance.Store(time.Now().UnixNano())
+	l.split(limit)
+	return l
+}
+
+// Wait waits until a shard has a free slot and takes it. If ctx is done while the goroutine waits , Wait returns
+// an error matching both limiter.ErrCanceled and the cause of the cancellation , and the goroutine must not access
+// the resource. Otherwise Wait returns nil.
+func (l *Limiter) Wait(ctx context.Context) error {
+	home := l.homes.Get().(*int)
+	defer l.homes.Put(home)
+	l.shards[*home].demand.Add(1)
+	if l.acquire(*home) {
+		return nil
+	}
+	for {
+		// registering before the last attempt makes sure a slot freed in between wakes the goroutine.
+		l.waiting.Add(1)
+		l.wakeMu.Lock()
+		wake := l.wake
+		l.wakeMu.Unlock()
+		if l.acquire(*home) {
+			l.waiting.Add(-1)
+			return nil
+		}
+		select {
+		case <-wake:
+			l.waiting.Add(-1)
+			if l.acquire(*home) {
+				return nil
+			}
+		case <-ctx.Done():
+			l.waiting.Add(-1)
+			return limiter.Canceled(ctx)
+		}
+	}
+}
+
+// acquire takes a slot of the home shard , or of the other shards in turn if it is full , and reports whether it
+// did. A full home shard triggers a rebalancing once the rebalance period has passed.
+func (l *Limiter) acquire(home int) bool {
+	n := len(l.shards)
+	for i := 0; i < n; i++ {
+		s := &l.shards[(home+i)%n]
+		for {
+			count := s.count.Load()
+			if count >= s.limit.Load() {
+				break
+			}
+			if s.count.CompareAndSwap(count, count+1) {
+				return true
+			}
+		}
+		if i == 0 {
+			l.maybeRebalance()
+		}
+	}
+	return false
+}
+
+// Finish gives back a slot , of the shard of the calling processor if it holds one , and wakes the waiting
+// goroutines.
+func (l *Limiter) Finish() {
+	home := l.homes.Get().(*int)
+	defer l.homes.Put(home)
+	n := len(l.shards)
+	for i := 0; i < n; i++ {
+		s := &l.shards[(*home+i)%n]
+		count := s.count.Load()
+		for count > 0 && !s.count.CompareAndSwap(count, count-1) {
+			count = s.count.Load()
+		}
+		if count > 0 {
+			break
+		}
+	}
+	l.notify()
+}
+
+// notify wakes the waiting goroutines , if any.
+func (l *Limiter) notify() {
+	if l.waiting.Load() == 0 {
+		return
+	}
+	l.wakeMu.Lock()
+	close(l.wake)
+	l.wake = make(chan struct{})
+	l.wakeMu.Unlock()
+}
+
+// maybeRebalance rebalances the shares if the rebalance period has passed since the last rebalancing and no
+// other goroutine is rebalancing them.
+func (l *Limiter) maybeRebalance() {
+	last := l.lastRebalance.Load()
+	now := time.Now().UnixNano()
+	if now-last < int64(l.rebalancePeriod) || !l.lastRebalance.CompareAndSwap(last, now) {
+		return
+	}
+	if !l.mu.TryLock() {
+		return
+	}
+	defer l.mu.Unlock()
+	demands := make([]int64, len(l.shards))
+	var total int64
+	for i := range l.shards {
+		demands[i] = l.shards[i].demand.Swap(0)
+		total += demands[i]
+	}
+	if total > 0 {
+		l.assign(l.limit.Load(), demands, total)
+	}
+}
+
+// split splits limit evenly across the shards. The mutex must be held , or the Limiter not yet shared.
+func (l *Limiter) split(limit int) {
+	demands := make([]int64, len(l.shards))
+	for i := range demands {
+		demands[i] = 1
+	}
+	l.limit.Store(int64(limit))
+	l.assign(int64(limit), demands, int64(len(demands)))
+}
+
+// assign gives every shard a share of limit proportional to its demand , rounding with the largest remainder
+// method so the shares add up to limit. The mutex must be held.
+func (l *Limiter) assign(limit int64, demands []int64, total int64) {
+	shares := make([]int64, len(demands))
+	assigned := int64(0)
+	for i, d := range demands {
+		shares[i] = limit * d / total
+		assigned += shares[i]
+	}
+	for assigned < limit {
+		best := 0
+		for i, d := range demands {
+			if limit*d%total > limit*demands[best]%total {
+				best = i
+			}
+		}
+		shares[best]++
+		demands[best] = 0
+		assigned++
+	}
+	for i := range l.shards {
+		l.shards[i].limit.Store(shares[i])
+	}
+}
+
+// SetLimit changes the max number of concurrent goroutines that can access the resource , split evenly across
+// the shards until the next rebalancing. Raising the limit wakes the waiting goroutines.
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	l.split(limit)
+	l.mu.Unlock()
+	l.notify()
+}
+
+// Limit returns the max number of concurrent goroutines that can access the resource.
+func (l *Limiter) Limit() int {
+	return int(l.limit.Load())
+}
+
+// Stats returns a snapshot of the Limiter. The shards are read one after the other , so InFlight is approximate
+// while goroutines come and go. Wait times and versions are not tracked.
+func (l *Limiter) Stats() limiter.Stats {
+	s := limiter.Stats{
+		Limit:   l.Limit(),
+		Waiting: int(l.waiting.Load()),
+	}
+	for i := range l.shards {
+		s.InFlight += int(l.shards[i].count.Load())
+	}
+	return s
+}
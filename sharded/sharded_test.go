@@ -0,0 +1,102 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func shares(l *Limiter) []int64 {
+	s := make([]int64, len(l.shards))
+	for i := range l.shards {
+		s[i] = l.shards[i].limit.Load()
+	}
+	return s
+}
+
+func TestLimiter(t *testing.T) {
+	// without rebalancing , the limit is exact.
+	nl := New(5, WithSharding(3), WithRebalancePeriod(time.Hour))
+	assert.Equal(t, []int64{2, 2, 1}, shares(nl))
+	var inFlight, peak atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, nl.Wait(context.Background()))
+			n := inFlight.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			inFlight.Add(-1)
+			nl.Finish()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(5), peak.Load())
+	assert.Equal(t, limiter.Stats{Limit: 5}, nl.Stats())
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	nl := New(2, WithSharding(4))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx))
+	assert.NoError(t, nl.Wait(ctx))
+
+	done := make(chan error)
+	go func() {
+		done <- nl.Wait(ctx)
+	}()
+	assert.Eventually(t, func() bool { return nl.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	nl.Finish()
+	assert.NoError(t, <-done)
+	assert.Equal(t, limiter.Stats{Limit: 2, InFlight: 2}, nl.Stats())
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err := nl.Wait(ctx)
+	assert.True(t, errors.Is(err, limiter.ErrCanceled))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 0, nl.Stats().Waiting)
+
+	// raising the limit wakes the waiting goroutines.
+	go func() {
+		done <- nl.Wait(context.Background())
+	}()
+	assert.Eventually(t, func() bool { return nl.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+	nl.SetLimit(3)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, nl.Limit())
+}
+
+func TestLimiter_Rebalance(t *testing.T) {
+	nl := New(10, WithSharding(4), WithRebalancePeriod(time.Nanosecond))
+	assert.Equal(t, []int64{3, 3, 2, 2}, shares(nl))
+	nl.shards[0].demand.Store(6)
+	nl.shards[1].demand.Store(3)
+	nl.shards[3].demand.Store(1)
+	nl.lastRebalance.Store(0)
+	nl.maybeRebalance()
+	assert.Equal(t, []int64{6, 3, 0, 1}, shares(nl))
+
+	// the largest remainders get the units left over by rounding down.
+	nl.shards[0].demand.Store(1)
+	nl.shards[1].demand.Store(1)
+	nl.shards[2].demand.Store(1)
+	nl.lastRebalance.Store(0)
+	nl.maybeRebalance()
+	assert.Equal(t, []int64{4, 3, 3, 0}, shares(nl))
+
+	// a full shard takes slots from the others.
+	for i := 0; i < 10; i++ {
+		assert.True(t, nl.acquire(3))
+	}
+	assert.False(t, nl.acquire(3))
+}
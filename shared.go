@@ -0,0 +1,71 @@
+package limiter
+
+import "context"
+
+// flight is the execution of a key by the goroutine that acquired a slot with WaitShared. done is closed once it
+// is over , err is the error of its Wait if it did not get a slot.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// WaitShared coalesces duplicate requests , like golang.org/x/sync/singleflight combined with admission control:
+// only the first goroutine calling WaitShared for a key waits for a slot , the goroutines calling it for the same
+// key meanwhile wait for its execution to be over instead of each consuming a slot.
+//
+// leader is true for the goroutine that acquired the slot: it must do the work , for example fill a cache , then
+// call FinishShared with the key. The other goroutines get false once FinishShared is called , without holding a
+// slot , and use the result of the work. If the leader is rejected , see IsRejection , they get the same error.
+// If its Wait fails otherwise , for example because its context is done , one of them takes over as leader. If
+// ctx is done while waiting , WaitShared returns an error matching both ErrCanceled and the cause of the
+// cancellation.
+func (l *Limiter) WaitShared(ctx context.Context, key string) (leader bool, err error) {
+	for {
+		l.flightsMu.Lock()
+		if f, ok := l.flights[key]; ok {
+			l.flightsMu.Unlock()
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return false, Canceled(ctx)
+			}
+			if f.err == nil || IsRejection(f.err) {
+				return false, f.err
+			}
+			continue
+		}
+		if l.flights == nil {
+			l.flights = make(map[string]*flight)
+		}
+		f := &flight{done: make(chan struct{})}
+		l.flights[key] = f
+		l.flightsMu.Unlock()
+		if err := l.Wait(ctx); err != nil {
+			l.land(key, err)
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// FinishShared gives back the slot acquired by the leader of key with WaitShared and wakes the goroutines waiting
+// for its execution.
+func (l *Limiter) FinishShared(key string) {
+	if l.land(key, nil) {
+		l.Finish()
+	}
+}
+
+// land ends the execution of key with err and reports whether there was one.
+func (l *Limiter) land(key string, err error) bool {
+	l.flightsMu.Lock()
+	defer l.flightsMu.Unlock()
+	f, ok := l.flights[key]
+	if !ok {
+		return false
+	}
+	delete(l.flights, key)
+	f.err = err
+	close(f.done)
+	return true
+}
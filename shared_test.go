@@ -0,0 +1,98 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+func TestWaitShared(t *testing.T) {
+	l := New(2)
+	ctx := context.Background()
+	leader, err := l.WaitShared(ctx, "a")
+	assert.True(t, leader)
+	assert.NoError(t, err)
+
+	followers := make(chan bool, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			leader, err := l.WaitShared(ctx, "a")
+			assert.NoError(t, err)
+			followers <- leader
+		}()
+	}
+	// another key gets a slot of its own.
+	leader, err = l.WaitShared(ctx, "b")
+	assert.True(t, leader)
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2, l.InFlight())
+	assert.Equal(t, 0, l.QueueLen())
+	assert.Equal(t, 0, len(followers))
+
+	l.FinishShared("a")
+	for i := 0; i < 3; i++ {
+		assert.False(t, <-followers)
+	}
+	l.FinishShared("b")
+	l.FinishShared("b")
+	assert.Equal(t, 0, l.InFlight())
+}
+
+func TestWaitShared_LeaderFails(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	l := New(1,
+		WithTimeoutDuration(10*time.Millisecond),
+		WithTimeoutPolicy(RejectOnTimeout),
+		WithClock(clk),
+	)
+	ctx := context.Background()
+	l.Wait(ctx)
+
+	// the followers share the rejection of the leader.
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := l.WaitShared(ctx, "a")
+			errs <- err
+		}()
+	}
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	clk.Advance(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, ErrTimeout, <-errs)
+	}
+
+	// a follower takes over once the context of the leader is done.
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		_, err := l.WaitShared(cctx, "a")
+		errs <- err
+	}()
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	leaders := make(chan bool, 1)
+	go func() {
+		leader, err := l.WaitShared(ctx, "a")
+		assert.NoError(t, err)
+		leaders <- leader
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.True(t, errors.Is(<-errs, ErrCanceled))
+	for l.QueueLen() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	l.Finish()
+	assert.True(t, <-leaders)
+	l.FinishShared("a")
+	assert.Equal(t, 0, l.InFlight())
+}
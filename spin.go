@@ -0,0 +1,31 @@
+package limiter
+
+import "runtime"
+
+// spin yields the processor and retries the fast path up to spin times , and reports whether it took a slot. It
+// gives up as soon as goroutines are queued , the fast path never takes a slot ahead of them.
+func (l *Limiter) spin(c *config) bool {
+	for i := 0; i < c.spin; i++ {
+		runtime.Gosched()
+		if l.acquireFast(c) {
+			return true
+		}
+		if l.state.Load()&^countMask != 0 {
+			return false
+		}
+	}
+	return false
+}
+
+// spinOn yields the processor and polls done up to spin times , and reports whether it received the signal.
+func spinOn(done <-chan struct{}, spin int) bool {
+	for i := 0; i < spin; i++ {
+		select {
+		case <-done:
+			return true
+		default:
+			runtime.Gosched()
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpinOn(t *testing.T) {
+	done := make(chan struct{}, 1)
+	assert.False(t, spinOn(done, 10))
+	done <- struct{}{}
+	assert.True(t, spinOn(done, 10))
+	done <- struct{}{}
+	assert.False(t, spinOn(done, 0))
+}
+
+func TestConcurrentRateLimiter_Spin(t *testing.T) {
+	_, err := NewWithValidation(1, WithSpin(-1))
+	assert.True(t, errors.Is(err, ErrInvalidConfig))
+
+	l := New(1, WithSpin(1<<30))
+	assert.Equal(t, 1<<30, l.Config().Spin)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	go func() {
+		time.Sleep(time.Millisecond)
+		l.Finish()
+	}()
+	// the slot is freed while the goroutine spins , it never queues.
+	assert.NoError(t, l.Wait(ctx))
+	assert.Equal(t, 1, l.InFlight())
+	assert.Zero(t, l.Stats().Waiting)
+
+	l.Finish()
+
+	// a goroutine queued after spinning is handed the slot while it spins again.
+	l = New(1, WithSpin(10))
+	assert.NoError(t, l.Wait(ctx))
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(ctx)
+	}()
+	go func() {
+		for l.QueueLen() != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		l.Finish()
+	}()
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, l.InFlight())
+	l.Finish()
+	assert.Zero(t, l.InFlight())
+}
@@ -0,0 +1,240 @@
+package limiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateVersion is the version of the State schema. It is bumped whenever a field is removed or
+// changes meaning , adding fields does not change the version. The schema is published as JSON
+// Schema in schema/state.v1.json.
+const StateVersion = 1
+
+// Kinds of limiters reported in State.Kind.
+const (
+	KindLimiter         = "limiter"
+	KindPriorityLimiter = "priority"
+)
+
+// State is a language agnostic dump of the state of a limiter. It is what MarshalJSON emits , so external
+// tooling can consume it without depending on Go types. Durations are reported in seconds.
+type State struct {
+	Version           int           `json:"version"`
+	Kind              string        `json:"kind"`
+	Time              time.Time     `json:"time"`
+	Limit             int           `json:"limit"`
+	InFlight          int           `json:"in_flight"`
+	Waiting           int           `json:"waiting"`
+	WaitP50Seconds    float64       `json:"wait_p50_seconds"`
+	WaitP95Seconds    float64       `json:"wait_p95_seconds"`
+	WaitP99Seconds    float64       `json:"wait_p99_seconds"`
+	OldestWaitSeconds float64       `json:"oldest_wait_seconds,omitempty"`
+	Reclaimed         uint64        `json:"reclaimed"`
+	Shed              uint64        `json:"shed,omitempty"`
+	Succeeded         uint64        `json:"succeeded,omitempty"`
+	Failed            uint64        `json:"failed,omitempty"`
+	Paused            bool          `json:"paused,omitempty"`
+	Circuit           string        `json:"circuit,omitempty"`
+	Profile           string        `json:"profile,omitempty"`
+	Config            ConfigState   `json:"config"`
+	Waiters           []WaiterState `json:"waiters"`
+}
+
+// ConfigState is the configuration part of State. Settings that are not configured are omitted.
+type ConfigState struct {
+	TimeoutSeconds        float64 `json:"timeout_seconds,omitempty"`
+	TimeoutPolicy         string  `json:"timeout_policy,omitempty"`
+	Jitter                float64 `json:"jitter,omitempty"`
+	Spin                  int     `json:"spin,omitempty"`
+	DynamicPeriodSeconds  float64 `json:"dynamic_period_seconds,omitempty"`
+	MaxQueueLength        *int    `json:"max_queue_length,omitempty"`
+	RejectionPolicy       string  `json:"rejection_policy"`
+	AdmissionPolicy       string  `json:"admission_policy"`
+	REDThreshold          *int    `json:"red_threshold,omitempty"`
+	LIFOThreshold         *int    `json:"lifo_threshold,omitempty"`
+	CoDelTargetSeconds    float64 `json:"codel_target_seconds,omitempty"`
+	CoDelIntervalSeconds  float64 `json:"codel_interval_seconds,omitempty"`
+	DeadlineCurve         string  `json:"deadline_curve,omitempty"`
+	EarliestDeadlineFirst bool    `json:"earliest_deadline_first,omitempty"`
+	Preemption            bool    `json:"preemption,omitempty"`
+	Lottery               bool    `json:"lottery,omitempty"`
+	// PriorityQuota maps priorities , formatted as decimal numbers , to the number of slots reserved for them.
+	PriorityQuota                 map[string]int `json:"priority_quota,omitempty"`
+	MaxWaitBeforePromotionSeconds float64        `json:"max_wait_before_promotion_seconds,omitempty"`
+	MinPriority                   *int           `json:"min_priority,omitempty"`
+	MaxPriority                   *int           `json:"max_priority,omitempty"`
+	DeadlineAsTimeout             bool           `json:"deadline_as_timeout,omitempty"`
+	DeadlineAwareRejection        bool           `json:"deadline_aware_rejection,omitempty"`
+	Unlimited                     bool           `json:"unlimited,omitempty"`
+	StrictFIFO                    bool           `json:"strict_fifo,omitempty"`
+	PermitTTLSeconds              float64        `json:"permit_ttl_seconds,omitempty"`
+	MaxHoldSeconds                float64        `json:"max_hold_seconds,omitempty"`
+	FairQueuing                   bool           `json:"fair_queuing,omitempty"`
+	// FlowWeights maps flows to their weight , flows without a configured weight have a weight of 1.
+	FlowWeights map[string]int `json:"flow_weights,omitempty"`
+}
+
+// WaiterState describes a goroutine in the waitlist , in the order goroutines will be served.
+// Priority is omitted for limiters without priorities and Flow for goroutines without a flow.
+type WaiterState struct {
+	Priority      *int    `json:"priority,omitempty"`
+	Flow          string  `json:"flow,omitempty"`
+	WaitedSeconds float64 `json:"waited_seconds"`
+}
+
+// State returns a dump of the current state of the Limiter.
+func (l *Limiter) State() State {
+	now := l.config().clock.Now()
+	s := l.Stats()
+	c := l.Config()
+	st := State{
+		Version:           StateVersion,
+		Kind:              KindLimiter,
+		Time:              now,
+		Limit:             s.Limit,
+		InFlight:          s.InFlight,
+		Waiting:           s.Waiting,
+		WaitP50Seconds:    s.WaitP50.Seconds(),
+		WaitP95Seconds:    s.WaitP95.Seconds(),
+		WaitP99Seconds:    s.WaitP99.Seconds(),
+		OldestWaitSeconds: s.OldestWait.Seconds(),
+		Reclaimed:         s.Reclaimed,
+		Shed:              s.Shed,
+		Succeeded:         s.Succeeded,
+		Failed:            s.Failed,
+		Paused:            s.Paused,
+		Circuit:           s.Circuit,
+		Profile:           s.Profile,
+		Config: ConfigState{
+			TimeoutSeconds:       c.Timeout.Seconds(),
+			TimeoutPolicy:        c.TimeoutPolicy.String(),
+			Jitter:               c.Jitter,
+			Spin:                 c.Spin,
+			RejectionPolicy:      c.RejectionPolicy.String(),
+			AdmissionPolicy:      c.AdmissionPolicy.String(),
+			CoDelTargetSeconds:   c.CoDelTarget.Seconds(),
+			CoDelIntervalSeconds: c.CoDelInterval.Seconds(),
+
+			DeadlineAsTimeout:      c.DeadlineAsTimeout,
+			DeadlineAwareRejection: c.DeadlineAwareRejection,
+			StrictFIFO:             c.StrictFIFO,
+			Unlimited:              c.Unlimited,
+			PermitTTLSeconds:       c.PermitTTL.Seconds(),
+			MaxHoldSeconds:         c.MaxHoldDuration.Seconds(),
+			FairQueuing:            c.FlowWeights != nil,
+			FlowWeights:            c.FlowWeights,
+		},
+		Waiters: []WaiterState{},
+	}
+	if c.MaxQueueLength >= 0 {
+		st.Config.MaxQueueLength = &c.MaxQueueLength
+	}
+	if c.REDThreshold >= 0 {
+		st.Config.REDThreshold = &c.REDThreshold
+	}
+	if c.LIFOThreshold >= 0 {
+		st.Config.LIFOThreshold = &c.LIFOThreshold
+	}
+
+	l.mu.Lock()
+	lifo := c.LIFOThreshold >= 0 && l.waitList.Len() > c.LIFOThreshold
+	// the fields are copied under the mutex , waiters are recycled once their goroutine returns from Wait.
+	type waiterCopy struct {
+		flow     string
+		enqueued time.Time
+		finish   float64
+	}
+	var waiters []waiterCopy
+	for w := l.waitList.Front(); w != nil; w = w.next {
+		waiters = append(waiters, waiterCopy{flow: w.flow, enqueued: w.enqueued, finish: w.finish})
+	}
+	l.mu.Unlock()
+	if c.FlowWeights != nil {
+		sort.SliceStable(waiters, func(i, j int) bool { return waiters[i].finish < waiters[j].finish })
+	}
+	for _, w := range waiters {
+		st.Waiters = append(st.Waiters, WaiterState{
+			Flow:          w.flow,
+			WaitedSeconds: now.Sub(w.enqueued).Seconds(),
+		})
+	}
+	if lifo {
+		for i, j := 0, len(st.Waiters)-1; i < j; i, j = i+1, j-1 {
+			st.Waiters[i], st.Waiters[j] = st.Waiters[j], st.Waiters[i]
+		}
+	}
+	return st
+}
+
+// MarshalJSON encodes the State of the Limiter.
+func (l *Limiter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.State())
+}
+
+// String returns a one line summary of the Limiter , see State.String.
+func (l *Limiter) String() string {
+	return l.State().String()
+}
+
+// LogValue reports the Limiter to log/slog as a group of attributes , see State.LogValue.
+func (l *Limiter) LogValue() slog.Value {
+	return l.State().LogValue()
+}
+
+// String returns a one line summary of the state , for logs: the kind followed by key=value pairs for the limit , the
+// number of goroutines accessing the resource and waiting , and the settings that decide how goroutines wait. The
+// goroutines in the waitlist are not listed.
+func (s State) String() string {
+	var b strings.Builder
+	b.WriteString(s.Kind)
+	for _, a := range s.attrs() {
+		fmt.Fprintf(&b, " %s=%s", a.Key, a.Value)
+	}
+	return b.String()
+}
+
+// LogValue returns the attributes of String as a log/slog group.
+func (s State) LogValue() slog.Value {
+	return slog.GroupValue(append([]slog.Attr{slog.String("kind", s.Kind)}, s.attrs()...)...)
+}
+
+// attrs returns the attributes of String.
+func (s State) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("limit", s.Limit),
+		slog.Int("in_flight", s.InFlight),
+		slog.Int("waiting", s.Waiting),
+	}
+	if s.OldestWaitSeconds > 0 {
+		attrs = append(attrs, slog.Duration("oldest_wait", seconds(s.OldestWaitSeconds)))
+	}
+	if s.Shed > 0 {
+		attrs = append(attrs, slog.Uint64("shed", s.Shed))
+	}
+	if s.Paused {
+		attrs = append(attrs, slog.Bool("paused", true))
+	}
+	if s.Circuit != "" {
+		attrs = append(attrs, slog.String("circuit", s.Circuit))
+	}
+	c := s.Config
+	if c.Unlimited {
+		attrs = append(attrs, slog.Bool("unlimited", true))
+	}
+	if c.TimeoutSeconds > 0 {
+		attrs = append(attrs, slog.Duration("timeout", seconds(c.TimeoutSeconds)), slog.String("timeout_policy", c.TimeoutPolicy))
+	}
+	if c.MaxQueueLength != nil {
+		attrs = append(attrs, slog.Int("max_queue_length", *c.MaxQueueLength), slog.String("rejection_policy", c.RejectionPolicy))
+	}
+	return attrs
+}
+
+// seconds converts a number of seconds of the State to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
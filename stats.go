@@ -0,0 +1,52 @@
+package limiter
+
+import "time"
+
+// Stats is a point-in-time view of a limiter.
+//
+// Limit: max number of concurrent goroutines that can access the resource
+//
+// InFlight: current number of goroutines accessing the resource
+//
+// Waiting: number of goroutines in the waitlist
+//
+// WaitP50, WaitP95, WaitP99: percentiles of the time spent in the waitlist by goroutines that
+// were granted access. Goroutines that did not have to wait are counted with a zero wait time.
+//
+// OldestWait: time the oldest goroutine in the waitlist has been waiting , zero if the waitlist is empty. It keeps
+// growing when the limiter is stuck , for example because slots leak , even while Waiting looks normal
+//
+// Reclaimed: number of slots taken back from holders that exceeded the max hold duration or did not renew their
+// permit , see WithMaxHoldDuration and WithPermitTTL
+//
+// Shed: number of goroutines the limiter refused to let access the resource because of overload , see IsRejection.
+// Health checks derive the shed rate from it
+//
+// Succeeded , Failed: number of outcomes reported as successes and as errors , see Permit.Record
+//
+// Paused: whether the limiter is paused , see Pause
+//
+// Circuit: state of the circuit breaker , "closed" , "open" or "half-open" , empty if none is configured , see
+// WithCircuitBreaker
+//
+// Profile: name of the scheduled profile in effect , empty if none , see WithSchedule
+//
+// Version: changes whenever Limit , InFlight or Waiting change. Two Stats of the same limiter with the
+// same Version describe the same state.
+type Stats struct {
+	Limit      int
+	InFlight   int
+	Waiting    int
+	WaitP50    time.Duration
+	WaitP95    time.Duration
+	WaitP99    time.Duration
+	OldestWait time.Duration
+	Reclaimed  uint64
+	Shed       uint64
+	Succeeded  uint64
+	Failed     uint64
+	Paused     bool
+	Circuit    string
+	Profile    string
+	Version    uint64
+}
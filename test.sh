@@ -9,4 +9,15 @@ for d in $(go list ./... | grep -v vendor); do
         cat profile.out >> coverage.txt
         rm profile.out
     fi
-done
\ No newline at end of file
+done
+# the etcd limiter is a separate module , its tests need ETCD_ENDPOINTS to run against a cluster.
+(cd etcdlimiter && go test -race ./...)
+# the framework adapters are separate modules , so the core limiters don't depend on the frameworks.
+(cd ginlimit && go test -race ./...)
+(cd echolimit && go test -race ./...)
+(cd fiberlimit && go test -race ./...)
+(cd grpclimit && go test -race ./...)
+# the consumer examples are a separate module , so the core limiters don't depend on the Kafka clients.
+(cd consumer/examples && go vet ./...)
+# the configuration file loader is a separate module , so the core limiters don't depend on a YAML parser.
+(cd fileconfig && go test -race ./...)
@@ -0,0 +1,83 @@
+package limiter
+
+import "sync"
+
+// waitList is an intrusive doubly linked list of waiters: the links are stored in the waiters themselves , so
+// queueing a goroutine allocates no list element and any waiter is removed in constant time.
+type waitList struct {
+	front, back *waiter
+	len         int
+}
+
+// Len returns the number of waiters in the list.
+func (q *waitList) Len() int {
+	return q.len
+}
+
+// Front returns the oldest waiter of the list , or nil if it is empty.
+func (q *waitList) Front() *waiter {
+	return q.front
+}
+
+// Back returns the newest waiter of the list , or nil if it is empty.
+func (q *waitList) Back() *waiter {
+	return q.back
+}
+
+// PushBack appends w to the list. w must not be in a list.
+func (q *waitList) PushBack(w *waiter) {
+	w.prev, w.next, w.queued = q.back, nil, true
+	if q.back != nil {
+		q.back.next = w
+	} else {
+		q.front = w
+	}
+	q.back = w
+	q.len++
+}
+
+// Remove removes w from the list. w must be in the list.
+func (q *waitList) Remove(w *waiter) {
+	if w.prev != nil {
+		w.prev.next = w.next
+	} else {
+		q.front = w.next
+	}
+	if w.next != nil {
+		w.next.prev = w.prev
+	} else {
+		q.back = w.prev
+	}
+	w.prev, w.next, w.queued = nil, nil, false
+	q.len--
+}
+
+// waiters recycles the waiters of the goroutines that returned from Wait.
+var waiters = sync.Pool{
+	New: func() any { return new(waiter) },
+}
+
+// newWaiter returns a queued waiter , recycled with its channel if possible.
+func newWaiter() *waiter {
+	w := waiters.Get().(*waiter)
+	if w.done == nil {
+		w.done = make(chan struct{}, 1)
+	}
+	return w
+}
+
+// recycle makes w available to newWaiter. The goroutine that waited with w must have returned from Wait and w
+// must not be referenced anymore , waiters attached to a Handle are never recycled. w has been settled under the
+// mutex or by its own goroutine , so the signal it did not receive is already in done and is discarded.
+func recycle(w *waiter) {
+	if w.pinned {
+		return
+	}
+	done := w.done
+	select {
+	case <-done:
+	default:
+	}
+	*w = waiter{done: done}
+	waiters.Put(w)
+}
@@ -0,0 +1,59 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func items(q *waitList) []*waiter {
+	var ws []*waiter
+	for w := q.Front(); w != nil; w = w.next {
+		ws = append(ws, w)
+	}
+	return ws
+}
+
+func TestWaitList(t *testing.T) {
+	var q waitList
+	a, b, c := newWaiter(), newWaiter(), newWaiter()
+	q.PushBack(a)
+	q.PushBack(b)
+	q.PushBack(c)
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, []*waiter{a, b, c}, items(&q))
+
+	q.Remove(b)
+	assert.False(t, b.queued)
+	assert.Equal(t, []*waiter{a, c}, items(&q))
+	q.Remove(a)
+	assert.Equal(t, c, q.Front())
+	assert.Equal(t, c, q.Back())
+	q.PushBack(a)
+	q.Remove(a)
+	q.Remove(c)
+	assert.Zero(t, q.Len())
+	assert.Nil(t, q.Front())
+	assert.Nil(t, q.Back())
+}
+
+func TestRecycle(t *testing.T) {
+	w := newWaiter()
+	w.flow = "tenant"
+	w.abandon(ErrDropped)
+	recycle(w)
+	// the channel is kept , without the signal the goroutine did not receive.
+	assert.Equal(t, waiter{done: w.done}, *w)
+	assert.Zero(t, len(w.done))
+
+	// a Handle keeps referring to its waiter after Wait returns.
+	l := New(1)
+	w = newWaiter()
+	_, h := WithHandle(context.Background())
+	h.attach(l, w)
+	w.abandon(ErrDropped)
+	recycle(w)
+	assert.True(t, w.pinned)
+	assert.False(t, l.Cancel(h))
+}
@@ -0,0 +1,59 @@
+package limiter
+
+import "time"
+
+// warmup ramps the limit up from initial to target over ramp , see WithWarmup.
+type warmup struct {
+	initial int
+	target  int
+	ramp    time.Duration
+}
+
+// at returns the limit ramped up to after elapsed.
+func (w *warmup) at(elapsed time.Duration) int {
+	if elapsed >= w.ramp {
+		return w.target
+	}
+	return w.initial + int(int64(w.target-w.initial)*int64(elapsed)/int64(w.ramp))
+}
+
+// until returns the time it takes the ramp to reach limit.
+func (w *warmup) until(limit int) time.Duration {
+	d := int64(w.target - w.initial)
+	return time.Duration((int64(limit-w.initial)*int64(w.ramp) + d - 1) / d)
+}
+
+// warmUp raises the limit along the warm-up ramp , admitting the waiting goroutines as slots appear , until the
+// ramp is over , the Limiter is closed or the limit is changed with SetLimit.
+func (l *Limiter) warmUp() {
+	c := l.config()
+	w := c.warmup
+	start := c.clock.Now()
+	current := w.initial
+	for current < w.target {
+		t := c.clock.NewTimer(start.Add(w.until(current + 1)).Sub(c.clock.Now()))
+		select {
+		case <-t.C():
+		case <-l.stop:
+			t.Stop()
+			return
+		}
+		limit := w.at(c.clock.Now().Sub(start))
+		if limit == current {
+			continue
+		}
+		l.mu.Lock()
+		if l.closed || l.config().limit != current {
+			l.mu.Unlock()
+			return
+		}
+		l.updateConfig(func(c *config) {
+			c.limit = limit
+		})
+		l.version.Add(1)
+		l.admit()
+		l.mu.Unlock()
+		l.emit(EventLimitChange, 0, nil)
+		current = limit
+	}
+}
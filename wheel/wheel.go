@@ -0,0 +1,181 @@
+// Package wheel implements a hashed timer wheel: timers and tickers of a coarse resolution , all driven by a single
+// ticker of the underlying clock , so a limiter with tens of thousands of queued goroutines with a timeout or a
+// dynamic priority does not arm as many runtime timers.
+//
+// A Wheel is a clock.Clock. Its timers fire on the first tick after their delay has passed , so they may fire up
+// to one tick late , and , like time.Ticker , its tickers drop ticks their receiver is not ready for. The goroutine
+// driving the wheel only runs while timers or tickers are armed.
+package wheel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// slots is the number of slots of a Wheel: delays of up to slots ticks are armed in constant time , longer ones
+// go around the wheel.
+const slots = 512
+
+// Wheel is a clock.Clock whose timers and tickers are driven by a single ticker of the underlying clock. It is safe
+// for concurrent use.
+//
+// buckets: the timers expiring in each slot , as doubly linked lists
+//
+// pos , last: the slot and the time of the last tick , delays are counted from the time of the last tick so timers
+// armed between two ticks never fire early
+//
+// armed: number of timers and tickers armed , the goroutine driving the wheel stops when it drops to zero
+//
+// running: whether the goroutine driving the wheel runs
+type Wheel struct {
+	clock clock.Clock
+	tick  time.Duration
+
+	mu      sync.Mutex
+	buckets [slots]*timer
+	pos     int
+	last    time.Time
+	armed   int
+	running bool
+}
+
+// New creates a *Wheel driven by a ticker of clk with the resolution tick , which must be positive.
+func New(clk clock.Clock, tick time.Duration) *Wheel {
+	return &Wheel{clock: clk, tick: tick}
+}
+
+// Now returns the time of the underlying clock.
+func (w *Wheel) Now() time.Time {
+	return w.clock.Now()
+}
+
+// NewTimer returns a clock.Timer firing once d has passed , rounded up to the tick.
+func (w *Wheel) NewTimer(d time.Duration) clock.Timer {
+	t := &timer{w: w, c: make(chan time.Time, 1)}
+	w.arm(t, d)
+	return t
+}
+
+// NewTicker returns a clock.Ticker firing every d , rounded up to the tick.
+func (w *Wheel) NewTicker(d time.Duration) clock.Ticker {
+	t := &timer{w: w, c: make(chan time.Time, 1), period: d}
+	w.arm(t, d)
+	return ticker{t}
+}
+
+// timer is a timer , or a ticker if period is positive , armed in a slot of the wheel for a number of rounds.
+type timer struct {
+	w          *Wheel
+	c          chan time.Time
+	period     time.Duration
+	slot       int
+	rounds     int
+	prev, next *timer
+	armed      bool
+}
+
+func (t *timer) C() <-chan time.Time { return t.c }
+
+// Stop disarms t and reports whether it was armed.
+func (t *timer) Stop() bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !t.armed {
+		return false
+	}
+	w.unlink(t)
+	w.armed--
+	return true
+}
+
+type ticker struct{ t *timer }
+
+func (t ticker) C() <-chan time.Time { return t.t.c }
+
+func (t ticker) Stop() { t.t.Stop() }
+
+// arm arms t to fire once d has passed and starts the goroutine driving the wheel if it is not running.
+func (w *Wheel) arm(t *timer, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.running {
+		w.running = true
+		w.last = w.clock.Now()
+		go w.run(w.clock.NewTicker(w.tick))
+	}
+	w.link(t, d)
+	w.armed++
+}
+
+// link inserts t in the slot reached once d has passed , counted from now rather than from the last tick. The mutex
+// must be held.
+func (w *Wheel) link(t *timer, d time.Duration) {
+	d += max(w.clock.Now().Sub(w.last), 0)
+	ticks := max(int((d+w.tick-1)/w.tick), 1)
+	t.slot = (w.pos + ticks) % slots
+	t.rounds = (ticks - 1) / slots
+	t.prev, t.next = nil, w.buckets[t.slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.buckets[t.slot] = t
+	t.armed = true
+}
+
+// unlink removes t from its slot. The mutex must be held.
+func (w *Wheel) unlink(t *timer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.buckets[t.slot] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next = nil, nil
+	t.armed = false
+}
+
+// run moves the wheel forward by one slot every tick of tk , firing the timers of the slot that have gone around
+// the wheel enough times , until no timer is armed anymore.
+func (w *Wheel) run(tk clock.Ticker) {
+	defer tk.Stop()
+	for now := range tk.C() {
+		w.mu.Lock()
+		w.pos = (w.pos + 1) % slots
+		w.last = now
+		var rearm []*timer
+		for t := w.buckets[w.pos]; t != nil; {
+			next := t.next
+			if t.rounds > 0 {
+				t.rounds--
+				t = next
+				continue
+			}
+			w.unlink(t)
+			// the channel is buffered: a timer fires once , a ticker drops the tick if the last one is pending.
+			select {
+			case t.c <- now:
+			default:
+			}
+			if t.period > 0 {
+				rearm = append(rearm, t)
+			} else {
+				w.armed--
+			}
+			t = next
+		}
+		for _, t := range rearm {
+			w.link(t, t.period)
+		}
+		if w.armed == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,119 @@
+package wheel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vivek-ng/concurrency-limiter/clock"
+)
+
+// step advances clk by one tick and waits until w has moved forward.
+func step(clk *clock.Fake, w *Wheel) {
+	for clk.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	w.mu.Lock()
+	pos := w.pos
+	w.mu.Unlock()
+	clk.Advance(w.tick)
+	for {
+		w.mu.Lock()
+		moved := w.pos != pos
+		w.mu.Unlock()
+		if moved {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fired reports whether c has fired.
+func fired(c <-chan time.Time) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWheel_Timer(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFake(start)
+	w := New(clk, 10*time.Millisecond)
+	assert.Equal(t, start, w.Now())
+
+	// rounded up to three ticks.
+	timer := w.NewTimer(25 * time.Millisecond)
+	stopped := w.NewTimer(10 * time.Millisecond)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	step(clk, w)
+	step(clk, w)
+	assert.False(t, fired(timer.C()))
+	step(clk, w)
+	assert.Equal(t, start.Add(30*time.Millisecond), <-timer.C())
+	assert.False(t, timer.Stop())
+	assert.False(t, fired(stopped.C()))
+
+	// the goroutine driving the wheel stops once no timer is armed.
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWheel_TimerArmedMidTick(t *testing.T) {
+	start := time.Now()
+	clk := clock.NewFake(start)
+	w := New(clk, 10*time.Millisecond)
+	// keeps the wheel running.
+	long := w.NewTimer(time.Second)
+	defer long.Stop()
+	step(clk, w)
+
+	// armed 9ms after the last tick , the timer must not fire on the next tick 1ms later.
+	clk.Advance(9 * time.Millisecond)
+	timer := w.NewTimer(10 * time.Millisecond)
+	step(clk, w)
+	assert.False(t, fired(timer.C()))
+	step(clk, w)
+	assert.Equal(t, start.Add(30*time.Millisecond), <-timer.C())
+}
+
+func TestWheel_LongTimer(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	w := New(clk, time.Millisecond)
+	timer := w.NewTimer((slots + 2) * time.Millisecond)
+	for i := 0; i < slots+1; i++ {
+		step(clk, w)
+	}
+	assert.False(t, fired(timer.C()))
+	step(clk, w)
+	assert.True(t, fired(timer.C()))
+}
+
+func TestWheel_Ticker(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	w := New(clk, 10*time.Millisecond)
+	ticker := w.NewTicker(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		step(clk, w)
+		assert.False(t, fired(ticker.C()))
+		step(clk, w)
+		assert.True(t, fired(ticker.C()))
+	}
+	// ticks the receiver is not ready for are dropped.
+	for i := 0; i < 4; i++ {
+		step(clk, w)
+	}
+	assert.True(t, fired(ticker.C()))
+	assert.False(t, fired(ticker.C()))
+	// the goroutine driving the wheel stops on the next tick.
+	ticker.Stop()
+	step(clk, w)
+	for clk.Waiters() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}